@@ -235,6 +235,16 @@ const (
 	FakeNodeCreateError = "create-error"
 )
 
+// TemplateChangeReporter is an optional interface of CloudProvider, implemented
+// by cloud providers which detect changes of node group templates, like the
+// machine type, image or labels, when refreshing node groups. Node infos cached
+// for node groups whose template changed are dropped.
+type TemplateChangeReporter interface {
+	// ChangedTemplates returns ids of node groups whose templates changed
+	// since the previous call. It is called after Refresh.
+	ChangedTemplates() []string
+}
+
 // PricingModel contains information about the node price and how it changes in time.
 type PricingModel interface {
 	// NodePrice returns a price of running the given node for a given period of time.
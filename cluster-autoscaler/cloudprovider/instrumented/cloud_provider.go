@@ -0,0 +1,177 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instrumented
+
+import (
+	"reflect"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/metrics"
+	"k8s.io/autoscaler/cluster-autoscaler/tracing"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/checkpoint"
+)
+
+const (
+	increaseSizeCall       = "IncreaseSize"
+	deleteNodesCall        = "DeleteNodes"
+	decreaseTargetSizeCall = "DecreaseTargetSize"
+	nodesCall              = "Nodes"
+	targetSizeCall         = "TargetSize"
+)
+
+// cloudProvider wraps a CloudProvider, so that calls to all node groups it
+// returns are measured.
+type cloudProvider struct {
+	cloudprovider.CloudProvider
+}
+
+// NewCloudProvider returns a CloudProvider which records latency and result
+// of node group calls (IncreaseSize, DeleteNodes, DecreaseTargetSize, Nodes
+// and TargetSize) in the cloud provider call metrics and as tracing spans.
+func NewCloudProvider(cp cloudprovider.CloudProvider) cloudprovider.CloudProvider {
+	return &cloudProvider{CloudProvider: cp}
+}
+
+// NodeGroups returns all node groups of the wrapped cloud provider.
+func (cp *cloudProvider) NodeGroups() []cloudprovider.NodeGroup {
+	nodeGroups := cp.CloudProvider.NodeGroups()
+	result := make([]cloudprovider.NodeGroup, 0, len(nodeGroups))
+	for _, ng := range nodeGroups {
+		result = append(result, wrap(ng))
+	}
+	return result
+}
+
+// NodeGroupForNode returns the node group for the given node.
+func (cp *cloudProvider) NodeGroupForNode(node *apiv1.Node) (cloudprovider.NodeGroup, error) {
+	ng, err := cp.CloudProvider.NodeGroupForNode(node)
+	if err != nil || ng == nil || reflect.ValueOf(ng).IsNil() {
+		return ng, err
+	}
+	return wrap(ng), nil
+}
+
+// NewNodeGroup builds a theoretical node group based on the node definition provided.
+func (cp *cloudProvider) NewNodeGroup(machineType string, labels map[string]string, systemLabels map[string]string,
+	taints []apiv1.Taint, extraResources map[string]resource.Quantity) (cloudprovider.NodeGroup, error) {
+	ng, err := cp.CloudProvider.NewNodeGroup(machineType, labels, systemLabels, taints, extraResources)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(ng), nil
+}
+
+// ChangedTemplates returns node groups whose templates changed, if the wrapped
+// cloud provider reports them.
+func (cp *cloudProvider) ChangedTemplates() []string {
+	if reporter, ok := cp.CloudProvider.(cloudprovider.TemplateChangeReporter); ok {
+		return reporter.ChangedTemplates()
+	}
+	return nil
+}
+
+// CheckpointState returns the checkpointed state of the wrapped cloud provider, if it has any.
+func (cp *cloudProvider) CheckpointState() ([]byte, error) {
+	if component, ok := cp.CloudProvider.(checkpoint.Component); ok {
+		return component.CheckpointState()
+	}
+	return nil, nil
+}
+
+// RestoreState restores the state of the wrapped cloud provider, if it has any.
+func (cp *cloudProvider) RestoreState(data []byte) error {
+	if component, ok := cp.CloudProvider.(checkpoint.Component); ok {
+		return component.RestoreState(data)
+	}
+	return nil
+}
+
+func wrap(ng cloudprovider.NodeGroup) cloudprovider.NodeGroup {
+	if wrapped, ok := ng.(*nodeGroup); ok {
+		return wrapped
+	}
+	return &nodeGroup{NodeGroup: ng}
+}
+
+// nodeGroup measures calls passed to the wrapped node group.
+type nodeGroup struct {
+	cloudprovider.NodeGroup
+}
+
+// IncreaseSize increases the size of the node group.
+func (ng *nodeGroup) IncreaseSize(delta int) error {
+	done := ng.start(increaseSizeCall, tracing.Int("delta", delta))
+	err := ng.NodeGroup.IncreaseSize(delta)
+	done(err)
+	return err
+}
+
+// DeleteNodes deletes nodes from the node group.
+func (ng *nodeGroup) DeleteNodes(nodes []*apiv1.Node) error {
+	done := ng.start(deleteNodesCall, tracing.Int("nodes", len(nodes)))
+	err := ng.NodeGroup.DeleteNodes(nodes)
+	done(err)
+	return err
+}
+
+// DecreaseTargetSize decreases the target size of the node group.
+func (ng *nodeGroup) DecreaseTargetSize(delta int) error {
+	done := ng.start(decreaseTargetSizeCall, tracing.Int("delta", delta))
+	err := ng.NodeGroup.DecreaseTargetSize(delta)
+	done(err)
+	return err
+}
+
+// Nodes returns a list of all nodes that belong to the node group.
+func (ng *nodeGroup) Nodes() ([]cloudprovider.Instance, error) {
+	done := ng.start(nodesCall)
+	instances, err := ng.NodeGroup.Nodes()
+	done(err)
+	return instances, err
+}
+
+// TargetSize returns the current target size of the node group.
+func (ng *nodeGroup) TargetSize() (int, error) {
+	done := ng.start(targetSizeCall)
+	size, err := ng.NodeGroup.TargetSize()
+	done(err)
+	return size, err
+}
+
+// Create creates the node group on the cloud provider side.
+func (ng *nodeGroup) Create() (cloudprovider.NodeGroup, error) {
+	created, err := ng.NodeGroup.Create()
+	if err != nil {
+		return nil, err
+	}
+	return wrap(created), nil
+}
+
+// start starts measuring a call. The returned function records its result.
+// Calls may come from any goroutine, so their spans don't become active.
+func (ng *nodeGroup) start(call string, attrs ...tracing.Attribute) func(err error) {
+	start := time.Now()
+	span := tracing.Current().StartChild("CloudProvider."+call, append(attrs, tracing.String("node_group", ng.Id()))...)
+	return func(err error) {
+		metrics.RegisterCloudProviderCall(call, time.Since(start), err)
+		span.RecordError(err)
+		span.End()
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instrumented
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	testprovider "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/test"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+)
+
+func TestInstrumentedNodeGroupCallsArePassedThrough(t *testing.T) {
+	scaledUp := map[string]int{}
+	deleted := []string{}
+	provider := testprovider.NewTestCloudProvider(
+		func(nodeGroup string, delta int) error {
+			scaledUp[nodeGroup] += delta
+			return nil
+		}, func(nodeGroup string, node string) error {
+			deleted = append(deleted, node)
+			return fmt.Errorf("failed to delete %s", node)
+		})
+	provider.AddNodeGroup("ng1", 0, 10, 3)
+	n1 := BuildTestNode("n1", 1000, 1000)
+	provider.AddNode("ng1", n1)
+	cp := NewCloudProvider(provider)
+
+	ngs := cp.NodeGroups()
+	assert.Equal(t, 1, len(ngs))
+	assert.NoError(t, ngs[0].IncreaseSize(2))
+	assert.Equal(t, map[string]int{"ng1": 2}, scaledUp)
+
+	ng, err := cp.NodeGroupForNode(n1)
+	assert.NoError(t, err)
+	assert.Equal(t, "ng1", ng.Id())
+	assert.Error(t, ng.DeleteNodes([]*apiv1.Node{n1}))
+	assert.Equal(t, []string{"n1"}, deleted)
+
+	size, err := ng.TargetSize()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, size)
+
+	instances, err := ng.Nodes()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(instances))
+}
+
+func TestInstrumentedNodeGroupForUnknownNode(t *testing.T) {
+	provider := testprovider.NewTestCloudProvider(nil, nil)
+	cp := NewCloudProvider(provider)
+
+	ng, err := cp.NodeGroupForNode(BuildTestNode("n1", 1000, 1000))
+	assert.NoError(t, err)
+	assert.Nil(t, ng)
+}
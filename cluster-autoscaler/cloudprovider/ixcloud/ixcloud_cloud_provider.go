@@ -1,6 +1,7 @@
 package ixcloud
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -11,6 +12,7 @@ import (
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/ixcloud/iksclient"
 	"k8s.io/autoscaler/cluster-autoscaler/config"
 	"k8s.io/autoscaler/cluster-autoscaler/config/dynamic"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
@@ -21,6 +23,11 @@ const (
 	// GPULabel is the label added to nodes with GPU resource.
 	// TODO: fix gpu label
 	GPULabel = "ixcloud.openstack.org/gpu"
+	// NodeGroupLabel is the label IKS sets on nodes to the name of their node group.
+	NodeGroupLabel = "ixcloud.openstack.org/nodegroup"
+	// CinderCSIZoneLabel is the label set on nodes by the Cinder CSI driver deployed by IKS,
+	// used as a target for Persistent Volume Node Affinity.
+	CinderCSIZoneLabel = "topology.cinder.csi.openstack.org/zone"
 
 	// Refresh interval for node group auto discovery
 	discoveryRefreshInterval = 1 * time.Minute
@@ -41,6 +48,11 @@ type ixCloudProvider struct {
 	usingAutoDiscovery   bool
 	autoDiscoveryConfigs []ixCloudAutoDiscoveryConfig
 	lastDiscoveryRefresh time.Time
+
+	// changedTemplates are ids of node groups whose flavor, image or GPU
+	// support changed since the last call to ChangedTemplates.
+	// Guarded by nodeGroupsLock.
+	changedTemplates []string
 }
 
 func buildIxCloudProvider(ixCloudManager ixCloudManager, resourceLimiter *cloudprovider.ResourceLimiter) (*ixCloudProvider, error) {
@@ -137,6 +149,73 @@ func (ixcp *ixCloudProvider) Cleanup() error {
 	return nil
 }
 
+// CheckpointState returns the nodes recently requested for deletion in each
+// node group, so that they aren't reported as failed and deleted again after
+// a restart.
+func (ixcp *ixCloudProvider) CheckpointState() ([]byte, error) {
+	deletedNodes := make(map[string]map[string]time.Time)
+	for _, ng := range ixcp.nodeGroupsSnapshot() {
+		ng.clusterUpdateLock.Lock()
+		if len(ng.deletedNodes) > 0 {
+			deletedNodes[ng.id] = make(map[string]time.Time, len(ng.deletedNodes))
+			for node, deletedTime := range ng.deletedNodes {
+				deletedNodes[ng.id][node] = deletedTime
+			}
+		}
+		ng.clusterUpdateLock.Unlock()
+	}
+	if len(deletedNodes) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(deletedNodes)
+}
+
+// RestoreState restores the nodes recently requested for deletion in node
+// groups which still exist.
+func (ixcp *ixCloudProvider) RestoreState(data []byte) error {
+	deletedNodes := make(map[string]map[string]time.Time)
+	if err := json.Unmarshal(data, &deletedNodes); err != nil {
+		return err
+	}
+	for _, ng := range ixcp.nodeGroupsSnapshot() {
+		ng.clusterUpdateLock.Lock()
+		for node, deletedTime := range deletedNodes[ng.id] {
+			if _, found := ng.deletedNodes[node]; !found {
+				ng.deletedNodes[node] = deletedTime
+			}
+		}
+		ng.clusterUpdateLock.Unlock()
+	}
+	return nil
+}
+
+// ChangedTemplates returns ids of auto discovered node groups whose flavor,
+// image or GPU support changed since the previous call.
+func (ixcp *ixCloudProvider) ChangedTemplates() []string {
+	ixcp.nodeGroupsLock.Lock()
+	defer ixcp.nodeGroupsLock.Unlock()
+	changed := ixcp.changedTemplates
+	ixcp.changedTemplates = nil
+	return changed
+}
+
+// templateOf returns the template of nodes of an IKS node group.
+func templateOf(nodeGroup *iksclient.NodeGroup) nodeGroupTemplate {
+	return nodeGroupTemplate{
+		flavorID:   nodeGroup.FlavorID,
+		imageID:    nodeGroup.ImageID,
+		gpuEnabled: nodeGroup.GpuEnabled,
+	}
+}
+
+// nodeGroupsSnapshot returns a copy of the node groups slice, so that node
+// groups can be locked without holding the node groups lock.
+func (ixcp *ixCloudProvider) nodeGroupsSnapshot() []*ixCloudNodeGroup {
+	ixcp.nodeGroupsLock.Lock()
+	defer ixcp.nodeGroupsLock.Unlock()
+	return append([]*ixCloudNodeGroup(nil), ixcp.nodeGroups...)
+}
+
 // Refresh is called before every autoscaler main loop.
 //
 // Debug information for each node group is printed with logging level >= 5.
@@ -214,6 +293,13 @@ func (ixcp *ixCloudProvider) refreshNodeGroups() error {
 				ng.maxSize = *nodeGroup.MaxNodeCount
 				klog.V(2).Infof("Node group %s max node count changed to %d", nodeGroup.Name, ng.maxSize)
 			}
+			if template := templateOf(nodeGroup); ng.template != template {
+				ng.template = template
+				klog.V(2).Infof("Node group %s flavor, image or GPU support changed", nodeGroup.Name)
+				ixcp.nodeGroupsLock.Lock()
+				ixcp.changedTemplates = append(ixcp.changedTemplates, ng.id)
+				ixcp.nodeGroupsLock.Unlock()
+			}
 			continue
 		}
 
@@ -226,6 +312,7 @@ func (ixcp *ixCloudProvider) refreshNodeGroups() error {
 			minSize:           nodeGroup.MinNodeCount,
 			maxSize:           *nodeGroup.MaxNodeCount,
 			targetSize:        nodeGroup.CurrentSize,
+			template:          templateOf(nodeGroup),
 			deletedNodes:      make(map[string]time.Time),
 		}
 		ixcp.AddNodeGroup(ng)
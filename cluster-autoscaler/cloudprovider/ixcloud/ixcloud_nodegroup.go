@@ -36,6 +36,10 @@ type ixCloudNodeGroup struct {
 	maxSize    int
 	targetSize int
 
+	// template describes the nodes of the node group, if it was
+	// auto discovered, to detect template changes.
+	template nodeGroupTemplate
+
 	// deletedNodes tracks nodes which have been requested for deletion.
 	// Heat can't always delete a node immediately if there is another concurrent update,
 	// so reporting a node as being in a failed state multiple times can cause the autoscaler
@@ -44,6 +48,14 @@ type ixCloudNodeGroup struct {
 	deletedNodes map[string]time.Time
 }
 
+// nodeGroupTemplate holds the properties of an IKS node group which are
+// used to create its nodes.
+type nodeGroupTemplate struct {
+	flavorID   string
+	imageID    string
+	gpuEnabled bool
+}
+
 func (ng *ixCloudNodeGroup) IncreaseSize(delta int) error {
 	ng.clusterUpdateLock.Lock()
 	defer ng.clusterUpdateLock.Unlock()
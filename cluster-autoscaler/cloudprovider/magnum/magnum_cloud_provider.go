@@ -17,9 +17,11 @@ limitations under the License.
 package magnum
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -27,6 +29,7 @@ import (
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/magnum/gophercloud/openstack/containerinfra/v1/nodegroups"
 	"k8s.io/autoscaler/cluster-autoscaler/config"
 	"k8s.io/autoscaler/cluster-autoscaler/config/dynamic"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
@@ -36,6 +39,11 @@ import (
 const (
 	// GPULabel is the label added to nodes with GPU resource.
 	GPULabel = "magnum.openstack.org/gpu"
+	// NodeGroupLabel is the label Magnum sets on nodes to the name of their node group.
+	NodeGroupLabel = "magnum.openstack.org/nodegroup"
+	// CinderCSIZoneLabel is the label set on nodes by the Cinder CSI driver deployed by Magnum,
+	// used as a target for Persistent Volume Node Affinity.
+	CinderCSIZoneLabel = "topology.cinder.csi.openstack.org/zone"
 
 	// Refresh interval for node group auto discovery
 	discoveryRefreshInterval = 1 * time.Minute
@@ -61,6 +69,11 @@ type magnumCloudProvider struct {
 	usingAutoDiscovery   bool
 	autoDiscoveryConfigs []magnumAutoDiscoveryConfig
 	lastDiscoveryRefresh time.Time
+
+	// changedTemplates are ids of node groups whose flavor, image or labels
+	// changed since the last call to ChangedTemplates.
+	// Guarded by nodeGroupsLock.
+	changedTemplates []string
 }
 
 func buildMagnumCloudProvider(magnumManager magnumManager, resourceLimiter *cloudprovider.ResourceLimiter) (*magnumCloudProvider, error) {
@@ -186,6 +199,73 @@ func (mcp *magnumCloudProvider) Cleanup() error {
 	return nil
 }
 
+// CheckpointState returns the nodes recently requested for deletion in each
+// node group, so that they aren't reported as failed and deleted again after
+// a restart.
+func (mcp *magnumCloudProvider) CheckpointState() ([]byte, error) {
+	deletedNodes := make(map[string]map[string]time.Time)
+	for _, ng := range mcp.nodeGroupsSnapshot() {
+		ng.clusterUpdateLock.Lock()
+		if len(ng.deletedNodes) > 0 {
+			deletedNodes[ng.id] = make(map[string]time.Time, len(ng.deletedNodes))
+			for node, deletedTime := range ng.deletedNodes {
+				deletedNodes[ng.id][node] = deletedTime
+			}
+		}
+		ng.clusterUpdateLock.Unlock()
+	}
+	if len(deletedNodes) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(deletedNodes)
+}
+
+// RestoreState restores the nodes recently requested for deletion in node
+// groups which still exist.
+func (mcp *magnumCloudProvider) RestoreState(data []byte) error {
+	deletedNodes := make(map[string]map[string]time.Time)
+	if err := json.Unmarshal(data, &deletedNodes); err != nil {
+		return err
+	}
+	for _, ng := range mcp.nodeGroupsSnapshot() {
+		ng.clusterUpdateLock.Lock()
+		for node, deletedTime := range deletedNodes[ng.id] {
+			if _, found := ng.deletedNodes[node]; !found {
+				ng.deletedNodes[node] = deletedTime
+			}
+		}
+		ng.clusterUpdateLock.Unlock()
+	}
+	return nil
+}
+
+// ChangedTemplates returns ids of auto discovered node groups whose flavor,
+// image or labels changed since the previous call.
+func (mcp *magnumCloudProvider) ChangedTemplates() []string {
+	mcp.nodeGroupsLock.Lock()
+	defer mcp.nodeGroupsLock.Unlock()
+	changed := mcp.changedTemplates
+	mcp.changedTemplates = nil
+	return changed
+}
+
+// templateOf returns the template of nodes of a Magnum node group.
+func templateOf(nodeGroup *nodegroups.NodeGroup) nodeGroupTemplate {
+	return nodeGroupTemplate{
+		flavorID: nodeGroup.FlavorID,
+		imageID:  nodeGroup.ImageID,
+		labels:   nodeGroup.Labels,
+	}
+}
+
+// nodeGroupsSnapshot returns a copy of the node groups slice, so that node
+// groups can be locked without holding the node groups lock.
+func (mcp *magnumCloudProvider) nodeGroupsSnapshot() []*magnumNodeGroup {
+	mcp.nodeGroupsLock.Lock()
+	defer mcp.nodeGroupsLock.Unlock()
+	return append([]*magnumNodeGroup(nil), mcp.nodeGroups...)
+}
+
 // refreshNodeGroups gets the list of node groups which meet the requirements for autoscaling,
 // creates magnumNodeGroups for any that do not exist in the cloud provider,
 // and drops any node groups which are present in the cloud provider but not in the
@@ -238,6 +318,13 @@ func (mcp *magnumCloudProvider) refreshNodeGroups() error {
 				ng.maxSize = *nodeGroup.MaxNodeCount
 				klog.V(2).Infof("Node group %s max node count changed to %d", nodeGroup.Name, ng.maxSize)
 			}
+			if template := templateOf(nodeGroup); !reflect.DeepEqual(ng.template, template) {
+				ng.template = template
+				klog.V(2).Infof("Node group %s flavor, image or labels changed", nodeGroup.Name)
+				mcp.nodeGroupsLock.Lock()
+				mcp.changedTemplates = append(mcp.changedTemplates, ng.id)
+				mcp.nodeGroupsLock.Unlock()
+			}
 			continue
 		}
 
@@ -250,6 +337,7 @@ func (mcp *magnumCloudProvider) refreshNodeGroups() error {
 			minSize:           nodeGroup.MinNodeCount,
 			maxSize:           *nodeGroup.MaxNodeCount,
 			targetSize:        nodeGroup.NodeCount,
+			template:          templateOf(nodeGroup),
 			deletedNodes:      make(map[string]time.Time),
 		}
 		mcp.AddNodeGroup(ng)
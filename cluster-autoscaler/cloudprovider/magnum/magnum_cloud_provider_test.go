@@ -387,6 +387,61 @@ func TestRefreshNodeGroupsUpdate(t *testing.T) {
 	assert.Equal(t, 4, provider.nodeGroups[0].MaxSize(), "wrong updated max node count")
 }
 
+// TestRefreshNodeGroupsChangedTemplates checks that refreshNodeGroups
+// reports node groups whose flavor, image or labels changed.
+func TestRefreshNodeGroupsChangedTemplates(t *testing.T) {
+	manager := &magnumManagerMock{}
+	provider := magnumCloudProvider{
+		magnumManager:        manager,
+		usingAutoDiscovery:   true,
+		autoDiscoveryConfigs: nil,
+		nodeGroupsLock:       &sync.Mutex{},
+		clusterUpdateLock:    &sync.Mutex{},
+	}
+
+	autoDiscoverySpec, err := parseMagnumAutoDiscoverySpec("magnum:role=autoscaling")
+	require.NoError(t, err, "error parsing auto discovery spec")
+	provider.autoDiscoveryConfigs = []magnumAutoDiscoveryConfig{autoDiscoverySpec}
+
+	three := 3
+	nodeGroup := func(name, uuid, flavor string) *nodegroups.NodeGroup {
+		return &nodegroups.NodeGroup{
+			UUID:         uuid,
+			Name:         name,
+			Role:         "autoscaling",
+			NodeCount:    2,
+			MinNodeCount: 1,
+			MaxNodeCount: &three,
+			FlavorID:     flavor,
+			ImageID:      "fedora-coreos",
+			Labels:       map[string]string{"kube_tag": "v1.22.3"},
+		}
+	}
+
+	initialNodeGroups := []*nodegroups.NodeGroup{
+		nodeGroup("test-ng-1", "ece653dd-2544-4f2e-b553-3c136af0ffa6", "m1.small"),
+		nodeGroup("test-ng-2", "1a61c05a-5eb6-4a1d-b4dc-0e1fd64f4a0a", "m1.small"),
+	}
+	secondNodeGroups := []*nodegroups.NodeGroup{
+		nodeGroup("test-ng-1", "ece653dd-2544-4f2e-b553-3c136af0ffa6", "m1.large"),
+		nodeGroup("test-ng-2", "1a61c05a-5eb6-4a1d-b4dc-0e1fd64f4a0a", "m1.small"),
+	}
+
+	manager.On("autoDiscoverNodeGroups", []magnumAutoDiscoveryConfig{autoDiscoverySpec}).Return(initialNodeGroups, nil).Once()
+	manager.On("autoDiscoverNodeGroups", []magnumAutoDiscoveryConfig{autoDiscoverySpec}).Return(secondNodeGroups, nil).Once()
+	manager.On("fetchNodeGroupStackIDs", mock.AnythingOfType("string")).Return(nodeGroupStacks{}, nil)
+
+	// Newly discovered node groups aren't changed.
+	err = provider.refreshNodeGroups()
+	require.NoError(t, err)
+	assert.Empty(t, provider.ChangedTemplates())
+
+	err = provider.refreshNodeGroups()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test-ng-1-ece653dd"}, provider.ChangedTemplates())
+	assert.Empty(t, provider.ChangedTemplates())
+}
+
 // TestRefreshNodeGroupsEmpty checks that refreshNodeGroups correctly
 // works when autodiscovery does not find any node groups to autoscale.
 func TestRefreshNodeGroupsEmpty(t *testing.T) {
@@ -497,3 +552,34 @@ func TestProviderNodeGroupForNode(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestCheckpointDeletedNodes(t *testing.T) {
+	clusterLock := &sync.Mutex{}
+	newProvider := func() *magnumCloudProvider {
+		provider := &magnumCloudProvider{
+			nodeGroupsLock:    &sync.Mutex{},
+			clusterUpdateLock: clusterLock,
+		}
+		provider.nodeGroups = []*magnumNodeGroup{
+			{id: "ng1", clusterUpdateLock: clusterLock, deletedNodes: make(map[string]time.Time)},
+			{id: "ng2", clusterUpdateLock: clusterLock, deletedNodes: make(map[string]time.Time)},
+		}
+		return provider
+	}
+
+	provider := newProvider()
+	data, err := provider.CheckpointState()
+	require.NoError(t, err)
+	assert.Nil(t, data)
+
+	deletedTime := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	provider.nodeGroups[0].deletedNodes["openstack:///node-1"] = deletedTime
+	data, err = provider.CheckpointState()
+	require.NoError(t, err)
+
+	restarted := newProvider()
+	restarted.nodeGroups[1].id = "ng3"
+	require.NoError(t, restarted.RestoreState(data))
+	assert.Equal(t, map[string]time.Time{"openstack:///node-1": deletedTime}, restarted.nodeGroups[0].deletedNodes)
+	assert.Empty(t, restarted.nodeGroups[1].deletedNodes)
+}
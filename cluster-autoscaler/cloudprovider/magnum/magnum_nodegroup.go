@@ -53,6 +53,10 @@ type magnumNodeGroup struct {
 	maxSize    int
 	targetSize int
 
+	// template describes the nodes of the node group, if it was
+	// auto discovered, to detect template changes.
+	template nodeGroupTemplate
+
 	// deletedNodes tracks nodes which have been requested for deletion.
 	// Heat can't always delete a node immediately if there is another concurrent update,
 	// so reporting a node as being in a failed state multiple times can cause the autoscaler
@@ -61,6 +65,14 @@ type magnumNodeGroup struct {
 	deletedNodes map[string]time.Time
 }
 
+// nodeGroupTemplate holds the properties of a Magnum node group which are
+// used to create its nodes.
+type nodeGroupTemplate struct {
+	flavorID string
+	imageID  string
+	labels   map[string]string
+}
+
 // IncreaseSize increases the number of nodes by replacing the cluster's node_count.
 //
 // Takes precautions so that the cluster is not modified while in an UPDATE_IN_PROGRESS state.
@@ -92,6 +92,18 @@ type ClusterAutoscalerStatus struct {
 	NodeGroupStatuses []NodeGroupStatus `json:"nodeGroupStatuses,omitempty"`
 	// ClusterwideConditions contains conditions that apply to the whole autoscaler.
 	ClusterwideConditions []ClusterAutoscalerCondition `json:"clusterwideConditions,omitempty"`
+	// QuotaGroupStatuses contains usage of quota groups.
+	QuotaGroupStatuses []QuotaGroupStatus `json:"quotaGroupStatuses,omitempty"`
+}
+
+// QuotaGroupStatus contains usage of a quota group, a set of node groups with limited resources.
+type QuotaGroupStatus struct {
+	// Name is the name of the quota group.
+	Name string `json:"name,omitempty"`
+	// NodeGroups are ids of node groups in the quota group.
+	NodeGroups []string `json:"nodeGroups,omitempty"`
+	// Usage maps resources to their usage and limit, like "10/50".
+	Usage map[string]string `json:"usage,omitempty"`
 }
 
 // NodeGroupStatus contains status of a group of nodes controlled by ClusterAutoscaler.
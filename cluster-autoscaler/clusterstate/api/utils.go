@@ -19,6 +19,8 @@ package api
 import (
 	"bytes"
 	"fmt"
+	"sort"
+	"strings"
 )
 
 // GetConditionByType gets condition by type.
@@ -79,14 +81,29 @@ func (status ClusterAutoscalerStatus) GetReadableString() string {
 	var buffer bytes.Buffer
 	buffer.WriteString("Cluster-wide:\n")
 	buffer.WriteString(getConditionsString(status.ClusterwideConditions, "  "))
-	if len(status.NodeGroupStatuses) == 0 {
-		return buffer.String()
+	if len(status.NodeGroupStatuses) > 0 {
+		buffer.WriteString("\nNodeGroups:\n")
+		for _, nodeGroupStatus := range status.NodeGroupStatuses {
+			buffer.WriteString(fmt.Sprintf("  Name:        %v\n", nodeGroupStatus.ProviderID))
+			buffer.WriteString(getConditionsString(nodeGroupStatus.Conditions, "  "))
+			buffer.WriteString("\n")
+		}
 	}
-	buffer.WriteString("\nNodeGroups:\n")
-	for _, nodeGroupStatus := range status.NodeGroupStatuses {
-		buffer.WriteString(fmt.Sprintf("  Name:        %v\n", nodeGroupStatus.ProviderID))
-		buffer.WriteString(getConditionsString(nodeGroupStatus.Conditions, "  "))
-		buffer.WriteString("\n")
+	if len(status.QuotaGroupStatuses) > 0 {
+		buffer.WriteString("\nQuotaGroups:\n")
+		for _, quotaGroupStatus := range status.QuotaGroupStatuses {
+			buffer.WriteString(fmt.Sprintf("  Name:        %v\n", quotaGroupStatus.Name))
+			buffer.WriteString(fmt.Sprintf("  NodeGroups:  %v\n", strings.Join(quotaGroupStatus.NodeGroups, ", ")))
+			resources := make([]string, 0, len(quotaGroupStatus.Usage))
+			for resource := range quotaGroupStatus.Usage {
+				resources = append(resources, resource)
+			}
+			sort.Strings(resources)
+			for _, resource := range resources {
+				buffer.WriteString(fmt.Sprintf("  %-12s %v\n", resource+":", quotaGroupStatus.Usage[resource]))
+			}
+			buffer.WriteString("\n")
+		}
 	}
 	return buffer.String()
 }
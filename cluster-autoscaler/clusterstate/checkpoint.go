@@ -0,0 +1,84 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterstate
+
+import (
+	"encoding/json"
+	"time"
+
+	klog "k8s.io/klog/v2"
+)
+
+// scaleUpRequestState is the checkpointed form of ScaleUpRequest.
+type scaleUpRequestState struct {
+	Time            time.Time `json:"time"`
+	ExpectedAddTime time.Time `json:"expectedAddTime"`
+	Increase        int       `json:"increase"`
+}
+
+// clusterStateCheckpoint is the checkpointed state of ClusterStateRegistry.
+type clusterStateCheckpoint struct {
+	// ScaleUpRequests maps node group ids to scale-up requests in flight.
+	ScaleUpRequests map[string]scaleUpRequestState `json:"scaleUpRequests,omitempty"`
+}
+
+// CheckpointState returns the scale-up requests in flight, so that they are
+// not repeated after a restart.
+func (csr *ClusterStateRegistry) CheckpointState() ([]byte, error) {
+	csr.Lock()
+	defer csr.Unlock()
+	if len(csr.scaleUpRequests) == 0 {
+		return nil, nil
+	}
+	state := clusterStateCheckpoint{ScaleUpRequests: make(map[string]scaleUpRequestState)}
+	for id, request := range csr.scaleUpRequests {
+		state.ScaleUpRequests[id] = scaleUpRequestState{
+			Time:            request.Time,
+			ExpectedAddTime: request.ExpectedAddTime,
+			Increase:        request.Increase,
+		}
+	}
+	return json.Marshal(state)
+}
+
+// RestoreState restores scale-up requests in flight. Requests of node groups
+// which no longer exist are dropped.
+func (csr *ClusterStateRegistry) RestoreState(data []byte) error {
+	state := clusterStateCheckpoint{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	csr.Lock()
+	defer csr.Unlock()
+	for _, nodeGroup := range csr.cloudProvider.NodeGroups() {
+		request, found := state.ScaleUpRequests[nodeGroup.Id()]
+		if !found {
+			continue
+		}
+		if _, found := csr.scaleUpRequests[nodeGroup.Id()]; found {
+			continue
+		}
+		csr.scaleUpRequests[nodeGroup.Id()] = &ScaleUpRequest{
+			NodeGroup:       nodeGroup,
+			Time:            request.Time,
+			ExpectedAddTime: request.ExpectedAddTime,
+			Increase:        request.Increase,
+		}
+		klog.V(2).Infof("Restored scale-up of node group %s by %d requested at %v", nodeGroup.Id(), request.Increase, request.Time)
+	}
+	return nil
+}
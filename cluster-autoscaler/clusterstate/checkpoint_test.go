@@ -0,0 +1,62 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterstate
+
+import (
+	"testing"
+	"time"
+
+	testprovider "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/test"
+	"k8s.io/autoscaler/cluster-autoscaler/clusterstate/utils"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+	kube_record "k8s.io/client-go/tools/record"
+)
+
+func TestCheckpointScaleUpRequests(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	newRegistry := func(nodeGroups ...string) (*ClusterStateRegistry, *testprovider.TestCloudProvider) {
+		provider := testprovider.NewTestCloudProvider(nil, nil)
+		for _, id := range nodeGroups {
+			provider.AddNodeGroup(id, 1, 10, 1)
+		}
+		fakeLogRecorder, _ := utils.NewStatusMapRecorder(&fake.Clientset{}, "kube-system", kube_record.NewFakeRecorder(5), false, "my-cool-configmap")
+		return NewClusterStateRegistry(provider, ClusterStateRegistryConfig{MaxNodeProvisionTime: 15 * time.Minute}, fakeLogRecorder, newBackoff()), provider
+	}
+
+	clusterstate, provider := newRegistry("ng1", "ng2")
+	data, err := clusterstate.CheckpointState()
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+
+	clusterstate.RegisterOrUpdateScaleUp(provider.GetNodeGroup("ng1"), 3, now)
+	clusterstate.RegisterOrUpdateScaleUp(provider.GetNodeGroup("ng2"), 1, now)
+	data, err = clusterstate.CheckpointState()
+	assert.NoError(t, err)
+
+	// ng2 no longer exists after the restart.
+	restarted, restartedProvider := newRegistry("ng1", "ng3")
+	assert.NoError(t, restarted.RestoreState(data))
+	assert.Len(t, restarted.scaleUpRequests, 1)
+	assert.Equal(t, &ScaleUpRequest{
+		NodeGroup:       restartedProvider.GetNodeGroup("ng1"),
+		Time:            now,
+		ExpectedAddTime: now.Add(15 * time.Minute),
+		Increase:        3,
+	}, restarted.scaleUpRequests["ng1"])
+}
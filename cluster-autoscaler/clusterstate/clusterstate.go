@@ -238,6 +238,7 @@ func (csr *ClusterStateRegistry) updateScaleRequests(currentTime time.Time) {
 			csr.backoff.RemoveBackoff(scaleUpRequest.NodeGroup, csr.nodeInfosForGroups[scaleUpRequest.NodeGroup.Id()])
 			klog.V(4).Infof("Scale up in group %v finished successfully in %v",
 				nodeGroupName, currentTime.Sub(scaleUpRequest.Time))
+			metrics.RegisterNodeGroupNodeRegistration(nodeGroupName, currentTime.Sub(scaleUpRequest.Time))
 			continue
 		}
 
@@ -316,6 +317,7 @@ func (csr *ClusterStateRegistry) UpdateNodes(nodes []*apiv1.Node, nodeInfosForGr
 	//  recalculate acceptable ranges after removing timed out requests
 	csr.updateAcceptableRanges(targetSizes)
 	csr.updateIncorrectNodeGroupSizes(currentTime)
+	csr.updatePerNodeGroupMetrics(targetSizes, currentTime)
 	return nil
 }
 
@@ -410,6 +412,22 @@ func (csr *ClusterStateRegistry) updateNodeGroupMetrics() {
 	metrics.UpdateNodeGroupsCount(autoscaled, autoprovisioned)
 }
 
+// updatePerNodeGroupMetrics updates size, readiness and backoff metrics of each node group.
+// To be executed under a lock.
+func (csr *ClusterStateRegistry) updatePerNodeGroupMetrics(targetSizes map[string]int, currentTime time.Time) {
+	for _, nodeGroup := range csr.cloudProvider.NodeGroups() {
+		id := nodeGroup.Id()
+		readiness := csr.perNodeGroupReadiness[id]
+		upcoming := targetSizes[id] - (readiness.Ready + readiness.Unready + readiness.LongUnregistered)
+		if upcoming < 0 {
+			upcoming = 0
+		}
+		metrics.UpdateNodeGroupTargetSize(id, targetSizes[id])
+		metrics.UpdateNodeGroupNodesCount(id, readiness.Ready, readiness.Unready, readiness.NotStarted, upcoming)
+		metrics.UpdateNodeGroupBackoffStatus(id, csr.backoff.IsBackedOff(nodeGroup, csr.nodeInfosForGroups[id], currentTime))
+	}
+}
+
 // IsNodeGroupSafeToScaleUp returns true if node group can be scaled up now.
 func (csr *ClusterStateRegistry) IsNodeGroupSafeToScaleUp(nodeGroup cloudprovider.NodeGroup, now time.Time) bool {
 	if !csr.IsNodeGroupHealthy(nodeGroup.Id()) {
@@ -1103,6 +1121,19 @@ func (csr *ClusterStateRegistry) GetCreatedNodesWithErrors() []*apiv1.Node {
 	return nodesWithCreateErrors
 }
 
+// GetCloudProviderNodeInstances returns instances of node groups listed when
+// the cluster state was last updated, by node group id.
+func (csr *ClusterStateRegistry) GetCloudProviderNodeInstances() map[string][]cloudprovider.Instance {
+	csr.Lock()
+	defer csr.Unlock()
+
+	result := make(map[string][]cloudprovider.Instance, len(csr.cloudProviderNodeInstances))
+	for nodeGroupId, instances := range csr.cloudProviderNodeInstances {
+		result[nodeGroupId] = instances
+	}
+	return result
+}
+
 // RefreshCloudProviderNodeInstancesCache refreshes cloud provider node instances cache.
 func (csr *ClusterStateRegistry) RefreshCloudProviderNodeInstancesCache() {
 	csr.cloudProviderNodeInstancesCache.Refresh()
@@ -18,6 +18,8 @@ package config
 
 import (
 	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 // GpuLimits define lower and upper bound on GPU instances of given type in cluster
@@ -30,6 +32,37 @@ type GpuLimits struct {
 	Max int64
 }
 
+// ExtendedResourceLimits define lower and upper bound on an extended resource in cluster
+type ExtendedResourceLimits struct {
+	// Name of the extended resource (e.g. intel.com/sriov_netdevice or hugepages-1Gi)
+	Resource string
+	// Lower bound on the amount of the resource in cluster, in the units of its quantity
+	Min int64
+	// Upper bound on the amount of the resource in cluster, in the units of its quantity
+	Max int64
+}
+
+// QuotaGroup limits the resources of a named set of node groups. Limits set to 0 are not enforced.
+// A quota group without node group ids nor selector contains all node groups.
+type QuotaGroup struct {
+	// Name of the quota group, used in status, metrics and events
+	Name string
+	// NodeGroupIds is a regular expression matching ids of node groups in the quota group
+	NodeGroupIds string
+	// NodeGroupSelector is a label selector matching labels of template nodes of node groups in the quota group
+	NodeGroupSelector string
+	// MaxNodes is the maximum number of nodes in the quota group
+	MaxNodes int
+	// MaxCores is the maximum number of cores in the quota group
+	MaxCores int64
+	// MaxMemory is the maximum memory in the quota group, in bytes
+	MaxMemory int64
+	// MaxGpus is the maximum number of GPUs in the quota group
+	MaxGpus int64
+	// MaxHourlyCost is the maximum cost per hour of nodes in the quota group, as returned by the cloud provider pricing model
+	MaxHourlyCost float64
+}
+
 // NodeGroupAutoscalingOptions contain various options to customize how autoscaling of
 // a given NodeGroup works. Different options can be used for each NodeGroup.
 type NodeGroupAutoscalingOptions struct {
@@ -44,6 +77,39 @@ type NodeGroupAutoscalingOptions struct {
 	ScaleDownUnneededTime time.Duration
 	// ScaleDownUnreadyTime represents how long an unready node should be unneeded before it is eligible for scale down
 	ScaleDownUnreadyTime time.Duration
+	// ScaleDownSelectionPolicies is the chain of policies used to order scale down candidates. Each policy breaks
+	// ties left by the previous ones. Candidates left in a tie keep the order in which they were found unneeded.
+	ScaleDownSelectionPolicies []string
+}
+
+// NodeGroupAutoscalingOptionsOverride overrides some of the options of a given NodeGroup.
+// Nil fields don't override the value otherwise used for the NodeGroup.
+type NodeGroupAutoscalingOptionsOverride struct {
+	ScaleDownUtilizationThreshold    *float64
+	ScaleDownGpuUtilizationThreshold *float64
+	ScaleDownUnneededTime            *time.Duration
+	ScaleDownUnreadyTime             *time.Duration
+	ScaleDownSelectionPolicies       []string
+}
+
+// Apply returns the options with overridden values replaced.
+func (o NodeGroupAutoscalingOptionsOverride) Apply(options NodeGroupAutoscalingOptions) NodeGroupAutoscalingOptions {
+	if o.ScaleDownUtilizationThreshold != nil {
+		options.ScaleDownUtilizationThreshold = *o.ScaleDownUtilizationThreshold
+	}
+	if o.ScaleDownGpuUtilizationThreshold != nil {
+		options.ScaleDownGpuUtilizationThreshold = *o.ScaleDownGpuUtilizationThreshold
+	}
+	if o.ScaleDownUnneededTime != nil {
+		options.ScaleDownUnneededTime = *o.ScaleDownUnneededTime
+	}
+	if o.ScaleDownUnreadyTime != nil {
+		options.ScaleDownUnreadyTime = *o.ScaleDownUnreadyTime
+	}
+	if o.ScaleDownSelectionPolicies != nil {
+		options.ScaleDownSelectionPolicies = o.ScaleDownSelectionPolicies
+	}
+	return options
 }
 
 // AutoscalingOptions contain various options to customize how autoscaling works
@@ -51,6 +117,9 @@ type AutoscalingOptions struct {
 	// NodeGroupDefaults are default values for per NodeGroup options.
 	// They will be used any time a specific value is not provided for a given NodeGroup.
 	NodeGroupDefaults NodeGroupAutoscalingOptions
+	// NodeGroupOverrides override options of NodeGroups with given ids. They take precedence over
+	// both NodeGroupDefaults and options provided by the NodeGroups themselves.
+	NodeGroupOverrides map[string]NodeGroupAutoscalingOptionsOverride
 	// MaxEmptyBulkDelete is a number of empty nodes that can be removed at the same time.
 	MaxEmptyBulkDelete int
 	// MaxNodesTotal sets the maximum number of nodes in the whole cluster
@@ -65,6 +134,13 @@ type AutoscalingOptions struct {
 	MinMemoryTotal int64
 	// GpuTotal is a list of strings with configuration of min/max limits for different GPUs.
 	GpuTotal []GpuLimits
+	// ExtendedResources is a list of extended resources handled like GPUs: nodes are considered unready
+	// until the resources defined in their node group template become allocatable.
+	ExtendedResources []string
+	// ExtendedResourceTotal is a list of min/max limits for extended resources.
+	ExtendedResourceTotal []ExtendedResourceLimits
+	// QuotaGroups limit resources of sets of node groups. A node group may belong to several quota groups.
+	QuotaGroups []QuotaGroup
 	// NodeGroupAutoDiscovery represents one or more definition(s) of node group auto-discovery
 	NodeGroupAutoDiscovery []string
 	// EstimatorName is the estimator used to estimate the number of needed nodes in scale up.
@@ -90,6 +166,17 @@ type AutoscalingOptions struct {
 	OkTotalUnreadyCount int
 	// ScaleUpFromZero defines if CA should scale up when there 0 ready nodes.
 	ScaleUpFromZero bool
+	// MaxNodeCountDropPercentage is the maximum percentage of nodes which may disappear between loops without
+	// being deleted by CA before CA assumes the node list is partial and freezes scale-down. 0 disables the check.
+	MaxNodeCountDropPercentage float64
+	// MaxUnregisteredInstancesPercentage is the maximum percentage of running cloud provider instances which
+	// may be not registered as nodes before CA freezes scale-down. 0 disables the check.
+	MaxUnregisteredInstancesPercentage float64
+	// ControlPlaneHealthCheck makes CA freeze scale-down while the API server reports it's not ready.
+	ControlPlaneHealthCheck bool
+	// ScaleDownKillSwitchConfigMapName is the name of a ConfigMap through which scale-down can be paused.
+	// The kill switch is disabled if empty.
+	ScaleDownKillSwitchConfigMapName string
 	// CloudConfig is the path to the cloud provider configuration file. Empty string for no configuration file.
 	CloudConfig string
 	// CloudProviderName sets the type of the cloud provider CA is about to run in. Allowed values: gce, aws
@@ -117,6 +204,13 @@ type AutoscalingOptions struct {
 	// The formula to calculate additional candidates number is following:
 	// max(#nodes * ScaleDownCandidatesPoolRatio, ScaleDownCandidatesPoolMinCount)
 	ScaleDownCandidatesPoolMinCount int
+	// ScaleDownSimulationParallelism is the maximum number of scale down
+	// candidates checked concurrently. It only applies with a cluster snapshot
+	// which can be copied.
+	ScaleDownSimulationParallelism int
+	// MaxEvictableEmptyDirSize is the maximum size limit of emptyDir volumes annotated as safe to evict
+	// which don't block scale down. If nil, pods with local storage block scale down.
+	MaxEvictableEmptyDirSize *resource.Quantity
 	// NodeDeletionDelayTimeout is maximum time CA waits for removing delay-deletion.cluster-autoscaler.kubernetes.io/ annotations before deleting the node.
 	NodeDeletionDelayTimeout time.Duration
 	// WriteStatusConfigMap tells if the status information should be written to a ConfigMap
@@ -125,6 +219,9 @@ type AutoscalingOptions struct {
 	StatusConfigMapName string
 	// BalanceSimilarNodeGroups enables logic that identifies node groups with similar machines and tries to balance node count between them.
 	BalanceSimilarNodeGroups bool
+	// BalanceSimilarNodeGroupsByZone makes balancing split scale-up between similar node groups in different zones
+	// according to the zones pods triggering the scale-up need, instead of evenly by node count.
+	BalanceSimilarNodeGroupsByZone bool
 	// ConfigNamespace is the namespace cluster-autoscaler is running in and all related configmaps live in
 	ConfigNamespace string
 	// ClusterName if available
@@ -142,12 +239,25 @@ type AutoscalingOptions struct {
 	Regional bool
 	// Pods newer than this will not be considered as unschedulable for scale-up.
 	NewPodScaleUpDelay time.Duration
+	// PodBatchingWindow is the time without new unschedulable pods after which held pods are considered for scale-up together.
+	// Value of 0 turns off pod batching.
+	PodBatchingWindow time.Duration
+	// PodBatchingMaxDelay is the maximum time unschedulable pods are held back by pod batching.
+	PodBatchingMaxDelay time.Duration
+	// PodGroupsFromJobs tells if pods of Jobs with parallelism greater than one are treated as pod groups,
+	// which trigger scale-up only if all their pods fit.
+	PodGroupsFromJobs bool
+	// PodGroupScaleDownUnneededTime is the duration after which nodes holding only pods of incomplete
+	// pod groups may be scaled down, if it's shorter than the node group's ScaleDownUnneededTime.
+	// Value of 0 turns it off.
+	PodGroupScaleDownUnneededTime time.Duration
 	// MaxBulkSoftTaint sets the maximum number of nodes that can be (un)tainted PreferNoSchedule during single scaling down run.
 	// Value of 0 turns turn off such tainting.
 	MaxBulkSoftTaintCount int
 	// MaxBulkSoftTaintTime sets the maximum duration of single run of PreferNoSchedule tainting.
 	MaxBulkSoftTaintTime time.Duration
-	// MaxPodEvictionTime sets the maximum time CA tries to evict a pod before giving up.
+	// MaxPodEvictionTime sets the maximum time CA tries to evict a pod before giving up. While evictions
+	// from a node are paced, it is counted from the last pod evicted or removed from the node.
 	MaxPodEvictionTime time.Duration
 	// IgnoredTaints is a list of taints to ignore when considering a node template for scheduling.
 	IgnoredTaints []string
@@ -177,4 +287,43 @@ type AutoscalingOptions struct {
 	MaxNodeGroupBackoffDuration time.Duration
 	// NodeGroupBackoffResetTimeout is the time after last failed scale-up when the backoff duration is reset.
 	NodeGroupBackoffResetTimeout time.Duration
+	// NodeGroupBackoffPolicies override the scope and durations of node group backoff for errors of a given
+	// class and code. Errors not matching any policy back off only the failed node group.
+	NodeGroupBackoffPolicies []BackoffPolicy
+	// BackoffStateConfigMapName is the name of the ConfigMap in which node group backoff state is persisted
+	// across restarts. The state is not persisted if empty. State restored from StateCheckpointStore takes precedence.
+	BackoffStateConfigMapName string
+	// StateCheckpointStore is the type of object ("configmap" or "lease") in which autoscaler state is
+	// checkpointed every loop and restored from on startup. State is not checkpointed if empty.
+	StateCheckpointStore string
+	// StateCheckpointName is the name of the object in which autoscaler state is checkpointed.
+	StateCheckpointName string
+	// StateCheckpointMaxAge is the maximum age of a checkpoint restored on startup.
+	StateCheckpointMaxAge time.Duration
+	// NodeInfoCacheExpireTime is the time after which node infos cached for node groups expire.
+	NodeInfoCacheExpireTime time.Duration
+	// NodeInfoCacheConfigMapName is the name of the ConfigMap in which node infos cached for node groups are
+	// persisted, so that node groups without nodes have a template right after a restart. The cache is not
+	// persisted if empty.
+	NodeInfoCacheConfigMapName string
+	// ConfigFile is the path to a YAML file overriding options set by flags. It is reloaded every loop,
+	// so changes are applied without a restart.
+	ConfigFile string
+	// ConfigConfigMapName is the name of a ConfigMap holding the same configuration as ConfigFile.
+	ConfigConfigMapName string
+	// DryRun makes CA run its whole loop, but record mutating calls (node group resizes, node taints,
+	// pod evictions, status writes) instead of executing them. Persisted state is restored, but not saved.
+	DryRun bool
+	// ConsolidationEnabled makes CA replace several underutilized nodes with fewer or cheaper nodes from
+	// another node group, when their pods don't fit on the remaining nodes.
+	ConsolidationEnabled bool
+	// ConsolidationMaxNodes is the maximum number of nodes replaced by a single consolidation.
+	ConsolidationMaxNodes int
+	// ConsolidationMaxPodsToReschedule is the maximum number of pods evicted by a single consolidation.
+	ConsolidationMaxPodsToReschedule int
+	// ConsolidationMinSavingsRatio is the minimum fraction of the cost of replaced nodes a consolidation has to save.
+	ConsolidationMinSavingsRatio float64
+	// ScaleDownDisruptionBudget limits how many nodes may be deleted and pods evicted at once by scale-down,
+	// and when scale-down is forbidden entirely.
+	ScaleDownDisruptionBudget DisruptionBudget
 }
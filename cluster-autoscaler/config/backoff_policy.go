@@ -0,0 +1,136 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BackoffScope is the set of node groups backed off together after a failed scale-up.
+type BackoffScope string
+
+const (
+	// NodeGroupBackoffScope backs off only the node group which failed to scale up.
+	NodeGroupBackoffScope BackoffScope = "node-group"
+	// ZoneBackoffScope backs off all node groups in the zone of the node group which failed to scale up.
+	ZoneBackoffScope BackoffScope = "zone"
+	// FlavorBackoffScope backs off all node groups with the instance type of the node group which failed to scale up.
+	FlavorBackoffScope BackoffScope = "flavor"
+	// ProjectBackoffScope backs off all node groups managed by cluster autoscaler. Cluster autoscaler
+	// doesn't know cloud projects of node groups, so node groups of all projects it manages are
+	// backed off together.
+	ProjectBackoffScope BackoffScope = "project"
+)
+
+var backoffScopes = []BackoffScope{NodeGroupBackoffScope, ZoneBackoffScope, FlavorBackoffScope, ProjectBackoffScope}
+
+// backoffErrorClasses are the names of cloudprovider.InstanceErrorClass values.
+var backoffErrorClasses = []string{"OutOfResource", "Other"}
+
+// BackoffPolicy defines how node groups are backed off after a scale-up fails
+// with a given class of error, and optionally a given error code.
+type BackoffPolicy struct {
+	// ErrorClass is the name of the instance error class, e.g. "OutOfResource".
+	ErrorClass string
+	// ErrorCode is the cloud provider specific error code. Empty matches any code.
+	ErrorCode string
+	// Scope is the set of node groups backed off together.
+	Scope BackoffScope
+	// InitialBackoffDuration is the duration of the first backoff.
+	InitialBackoffDuration time.Duration
+	// MaxBackoffDuration is the maximum duration of a backoff.
+	MaxBackoffDuration time.Duration
+}
+
+// Matches checks if the policy applies to errors of the given class and code.
+func (p BackoffPolicy) Matches(errorClass, errorCode string) bool {
+	return p.ErrorClass == errorClass && (p.ErrorCode == "" || p.ErrorCode == errorCode)
+}
+
+// Selector returns the error class and code matched by the policy.
+func (p BackoffPolicy) Selector() string {
+	if p.ErrorCode == "" {
+		return p.ErrorClass
+	}
+	return p.ErrorClass + "/" + p.ErrorCode
+}
+
+// String returns the policy in the format accepted by ParseBackoffPolicy.
+func (p BackoffPolicy) String() string {
+	return fmt.Sprintf("%s=%s:%v:%v", p.Selector(), p.Scope, p.InitialBackoffDuration, p.MaxBackoffDuration)
+}
+
+// ParseBackoffPolicy parses a backoff policy given in the format
+// <error-class>[/<error-code>]=<scope>:<initial-duration>:<max-duration>,
+// e.g. "OutOfResource/QUOTA_EXCEEDED=project:30m:3h".
+func ParseBackoffPolicy(value string) (BackoffPolicy, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return BackoffPolicy{}, fmt.Errorf("invalid backoff policy %q: expected <error-class>[/<error-code>]=<scope>:<initial-duration>:<max-duration>", value)
+	}
+	policy := BackoffPolicy{}
+	selector := strings.SplitN(parts[0], "/", 2)
+	policy.ErrorClass = selector[0]
+	if len(selector) == 2 {
+		if selector[1] == "" {
+			return BackoffPolicy{}, fmt.Errorf("invalid backoff policy %q: empty error code", value)
+		}
+		policy.ErrorCode = selector[1]
+	}
+	if !containsString(backoffErrorClasses, policy.ErrorClass) {
+		return BackoffPolicy{}, fmt.Errorf("invalid backoff policy %q: unknown error class %q, expected one of %v", value, policy.ErrorClass, backoffErrorClasses)
+	}
+	settings := strings.Split(parts[1], ":")
+	if len(settings) != 3 {
+		return BackoffPolicy{}, fmt.Errorf("invalid backoff policy %q: expected <scope>:<initial-duration>:<max-duration> after '='", value)
+	}
+	policy.Scope = BackoffScope(settings[0])
+	if !isValidBackoffScope(policy.Scope) {
+		return BackoffPolicy{}, fmt.Errorf("invalid backoff policy %q: unknown scope %q, expected one of %v", value, settings[0], backoffScopes)
+	}
+	var err error
+	if policy.InitialBackoffDuration, err = time.ParseDuration(settings[1]); err != nil {
+		return BackoffPolicy{}, fmt.Errorf("invalid backoff policy %q: %v", value, err)
+	}
+	if policy.MaxBackoffDuration, err = time.ParseDuration(settings[2]); err != nil {
+		return BackoffPolicy{}, fmt.Errorf("invalid backoff policy %q: %v", value, err)
+	}
+	if policy.InitialBackoffDuration <= 0 || policy.MaxBackoffDuration < policy.InitialBackoffDuration {
+		return BackoffPolicy{}, fmt.Errorf("invalid backoff policy %q: durations must be positive and the initial duration must not exceed the maximum", value)
+	}
+	return policy, nil
+}
+
+func isValidBackoffScope(scope BackoffScope) bool {
+	for _, s := range backoffScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBackoffPolicy(t *testing.T) {
+	testCases := []struct {
+		value   string
+		want    BackoffPolicy
+		wantErr bool
+	}{
+		{
+			value: "OutOfResource=zone:5m:30m",
+			want:  BackoffPolicy{ErrorClass: "OutOfResource", Scope: ZoneBackoffScope, InitialBackoffDuration: 5 * time.Minute, MaxBackoffDuration: 30 * time.Minute},
+		},
+		{
+			value: "OutOfResource/QUOTA_EXCEEDED=project:30m:3h",
+			want: BackoffPolicy{ErrorClass: "OutOfResource", ErrorCode: "QUOTA_EXCEEDED", Scope: ProjectBackoffScope,
+				InitialBackoffDuration: 30 * time.Minute, MaxBackoffDuration: 3 * time.Hour},
+		},
+		{
+			value: "Other=flavor:1m:1m",
+			want:  BackoffPolicy{ErrorClass: "Other", Scope: FlavorBackoffScope, InitialBackoffDuration: time.Minute, MaxBackoffDuration: time.Minute},
+		},
+		{value: "OutOfResource", wantErr: true},
+		{value: "OutOfResource/=zone:5m:30m", wantErr: true},
+		{value: "Stockout=zone:5m:30m", wantErr: true},
+		{value: "OutOfResource=region:5m:30m", wantErr: true},
+		{value: "OutOfResource=zone:5m", wantErr: true},
+		{value: "OutOfResource=zone:five:30m", wantErr: true},
+		{value: "OutOfResource=zone:30m:5m", wantErr: true},
+		{value: "OutOfResource=zone:0s:5m", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := ParseBackoffPolicy(tc.value)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			reparsed, err := ParseBackoffPolicy(got.String())
+			assert.NoError(t, err)
+			assert.Equal(t, got, reparsed)
+		})
+	}
+}
+
+func TestBackoffPolicyMatches(t *testing.T) {
+	anyCode := BackoffPolicy{ErrorClass: "OutOfResource"}
+	assert.True(t, anyCode.Matches("OutOfResource", ""))
+	assert.True(t, anyCode.Matches("OutOfResource", "STOCKOUT"))
+	assert.False(t, anyCode.Matches("Other", "STOCKOUT"))
+
+	oneCode := BackoffPolicy{ErrorClass: "OutOfResource", ErrorCode: "STOCKOUT"}
+	assert.True(t, oneCode.Matches("OutOfResource", "STOCKOUT"))
+	assert.False(t, oneCode.Matches("OutOfResource", "QUOTA_EXCEEDED"))
+}
@@ -0,0 +1,310 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configfile
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/nodes"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the autoscaler configuration read from a YAML file. It covers the
+// options which are read by the autoscaler every loop, so that they can be
+// changed without a restart. Options not set in the file keep the values set
+// by flags.
+type Config struct {
+	// NodeGroupDefaults override default options of all node groups.
+	NodeGroupDefaults *NodeGroupOptions `json:"nodeGroupDefaults,omitempty"`
+	// NodeGroups override options of node groups with given ids.
+	NodeGroups map[string]NodeGroupOptions `json:"nodeGroups,omitempty"`
+
+	ScaleDownEnabled                 *bool            `json:"scaleDownEnabled,omitempty"`
+	ScaleDownDelayAfterAdd           *metav1.Duration `json:"scaleDownDelayAfterAdd,omitempty"`
+	ScaleDownDelayAfterDelete        *metav1.Duration `json:"scaleDownDelayAfterDelete,omitempty"`
+	ScaleDownDelayAfterFailure       *metav1.Duration `json:"scaleDownDelayAfterFailure,omitempty"`
+	ScaleDownNonEmptyCandidatesCount *int             `json:"scaleDownNonEmptyCandidatesCount,omitempty"`
+	ScaleDownCandidatesPoolRatio     *float64         `json:"scaleDownCandidatesPoolRatio,omitempty"`
+	ScaleDownCandidatesPoolMinCount  *int             `json:"scaleDownCandidatesPoolMinCount,omitempty"`
+	MaxEmptyBulkDelete               *int             `json:"maxEmptyBulkDelete,omitempty"`
+	MaxNodesTotal                    *int             `json:"maxNodesTotal,omitempty"`
+	MaxGracefulTerminationSec        *int             `json:"maxGracefulTerminationSec,omitempty"`
+	MaxPodEvictionTime               *metav1.Duration `json:"maxPodEvictionTime,omitempty"`
+	NodeDeletionDelayTimeout         *metav1.Duration `json:"nodeDeletionDelayTimeout,omitempty"`
+	UnremovableNodeRecheckTimeout    *metav1.Duration `json:"unremovableNodeRecheckTimeout,omitempty"`
+	MaxBulkSoftTaintCount            *int             `json:"maxBulkSoftTaintCount,omitempty"`
+	MaxBulkSoftTaintTime             *metav1.Duration `json:"maxBulkSoftTaintTime,omitempty"`
+	NewPodScaleUpDelay               *metav1.Duration `json:"newPodScaleUpDelay,omitempty"`
+	PodBatchingWindow                *metav1.Duration `json:"podBatchingWindow,omitempty"`
+	PodBatchingMaxDelay              *metav1.Duration `json:"podBatchingMaxDelay,omitempty"`
+	ExpendablePodsPriorityCutoff     *int             `json:"expendablePodsPriorityCutoff,omitempty"`
+	BalanceSimilarNodeGroups         *bool            `json:"balanceSimilarNodeGroups,omitempty"`
+	IgnoreDaemonSetsUtilization      *bool            `json:"ignoreDaemonSetsUtilization,omitempty"`
+	IgnoreMirrorPodsUtilization      *bool            `json:"ignoreMirrorPodsUtilization,omitempty"`
+	// QuotaGroups replace all quota groups when set.
+	QuotaGroups []QuotaGroupOptions `json:"quotaGroups,omitempty"`
+}
+
+// QuotaGroupOptions define a quota group limiting resources of node groups
+// selected by id or by labels of their template nodes.
+type QuotaGroupOptions struct {
+	Name              string             `json:"name"`
+	NodeGroupIds      string             `json:"nodeGroupIds,omitempty"`
+	NodeGroupSelector string             `json:"nodeGroupSelector,omitempty"`
+	MaxNodes          int                `json:"maxNodes,omitempty"`
+	MaxCores          int64              `json:"maxCores,omitempty"`
+	MaxMemory         *resource.Quantity `json:"maxMemory,omitempty"`
+	MaxGpus           int64              `json:"maxGpus,omitempty"`
+	MaxHourlyCost     float64            `json:"maxHourlyCost,omitempty"`
+}
+
+// NodeGroupOptions are options which can be set per node group.
+type NodeGroupOptions struct {
+	ScaleDownUtilizationThreshold    *float64         `json:"scaleDownUtilizationThreshold,omitempty"`
+	ScaleDownGpuUtilizationThreshold *float64         `json:"scaleDownGpuUtilizationThreshold,omitempty"`
+	ScaleDownUnneededTime            *metav1.Duration `json:"scaleDownUnneededTime,omitempty"`
+	ScaleDownUnreadyTime             *metav1.Duration `json:"scaleDownUnreadyTime,omitempty"`
+	ScaleDownSelectionPolicies       []string         `json:"scaleDownSelectionPolicies,omitempty"`
+}
+
+// Parse parses and validates the YAML configuration. Unknown fields are
+// rejected, so that typos don't go unnoticed.
+func Parse(data []byte) (*Config, error) {
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate checks that all values set in the configuration are valid.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.NodeGroupDefaults != nil {
+		errs = append(errs, c.NodeGroupDefaults.validate("nodeGroupDefaults")...)
+	}
+	for id, options := range c.NodeGroups {
+		if id == "" {
+			errs = append(errs, fmt.Errorf("nodeGroups: node group id must not be empty"))
+		}
+		errs = append(errs, options.validate(fmt.Sprintf("nodeGroups[%s]", id))...)
+	}
+	names := make(map[string]bool)
+	for i, quotaGroup := range c.QuotaGroups {
+		path := fmt.Sprintf("quotaGroups[%d]", i)
+		if quotaGroup.Name == "" {
+			errs = append(errs, fmt.Errorf("%s: name must not be empty", path))
+		} else if names[quotaGroup.Name] {
+			errs = append(errs, fmt.Errorf("%s: duplicate name %s", path, quotaGroup.Name))
+		}
+		names[quotaGroup.Name] = true
+		errs = append(errs, quotaGroup.validate(path)...)
+	}
+	errs = append(errs,
+		validateDuration("scaleDownDelayAfterAdd", c.ScaleDownDelayAfterAdd),
+		validateDuration("scaleDownDelayAfterDelete", c.ScaleDownDelayAfterDelete),
+		validateDuration("scaleDownDelayAfterFailure", c.ScaleDownDelayAfterFailure),
+		validateCount("scaleDownNonEmptyCandidatesCount", c.ScaleDownNonEmptyCandidatesCount),
+		validateRatio("scaleDownCandidatesPoolRatio", c.ScaleDownCandidatesPoolRatio),
+		validateCount("scaleDownCandidatesPoolMinCount", c.ScaleDownCandidatesPoolMinCount),
+		validateCount("maxEmptyBulkDelete", c.MaxEmptyBulkDelete),
+		validateCount("maxNodesTotal", c.MaxNodesTotal),
+		validateCount("maxGracefulTerminationSec", c.MaxGracefulTerminationSec),
+		validateDuration("maxPodEvictionTime", c.MaxPodEvictionTime),
+		validateDuration("nodeDeletionDelayTimeout", c.NodeDeletionDelayTimeout),
+		validateDuration("unremovableNodeRecheckTimeout", c.UnremovableNodeRecheckTimeout),
+		validateCount("maxBulkSoftTaintCount", c.MaxBulkSoftTaintCount),
+		validateDuration("maxBulkSoftTaintTime", c.MaxBulkSoftTaintTime),
+		validateDuration("newPodScaleUpDelay", c.NewPodScaleUpDelay),
+		validateDuration("podBatchingWindow", c.PodBatchingWindow),
+		validateDuration("podBatchingMaxDelay", c.PodBatchingMaxDelay),
+	)
+	return utilerrors.NewAggregate(errs)
+}
+
+func (o NodeGroupOptions) validate(path string) []error {
+	errs := []error{
+		validateRatio(path+".scaleDownUtilizationThreshold", o.ScaleDownUtilizationThreshold),
+		validateRatio(path+".scaleDownGpuUtilizationThreshold", o.ScaleDownGpuUtilizationThreshold),
+		validateDuration(path+".scaleDownUnneededTime", o.ScaleDownUnneededTime),
+		validateDuration(path+".scaleDownUnreadyTime", o.ScaleDownUnreadyTime),
+	}
+	if o.ScaleDownSelectionPolicies != nil {
+		if err := nodes.ValidateScaleDownSelectionPolicies(o.ScaleDownSelectionPolicies); err != nil {
+			errs = append(errs, fmt.Errorf("%s.scaleDownSelectionPolicies: %v", path, err))
+		}
+	}
+	return errs
+}
+
+func (o QuotaGroupOptions) validate(path string) []error {
+	var errs []error
+	if _, err := regexp.Compile(o.NodeGroupIds); err != nil {
+		errs = append(errs, fmt.Errorf("%s.nodeGroupIds: %v", path, err))
+	}
+	if _, err := labels.Parse(o.NodeGroupSelector); err != nil {
+		errs = append(errs, fmt.Errorf("%s.nodeGroupSelector: %v", path, err))
+	}
+	limits := map[string]float64{
+		"maxNodes":      float64(o.MaxNodes),
+		"maxCores":      float64(o.MaxCores),
+		"maxGpus":       float64(o.MaxGpus),
+		"maxHourlyCost": o.MaxHourlyCost,
+	}
+	if o.MaxMemory != nil {
+		limits["maxMemory"] = o.MaxMemory.AsApproximateFloat64()
+	}
+	for name, limit := range limits {
+		if limit < 0 {
+			errs = append(errs, fmt.Errorf("%s.%s: must not be negative, got %v", path, name, limit))
+		}
+	}
+	return errs
+}
+
+// Apply returns the options with values set in the configuration replaced.
+func (c *Config) Apply(options config.AutoscalingOptions) config.AutoscalingOptions {
+	if c.NodeGroupDefaults != nil {
+		options.NodeGroupDefaults = c.NodeGroupDefaults.override().Apply(options.NodeGroupDefaults)
+	}
+	if len(c.NodeGroups) > 0 {
+		overrides := make(map[string]config.NodeGroupAutoscalingOptionsOverride, len(c.NodeGroups))
+		for id, override := range options.NodeGroupOverrides {
+			overrides[id] = override
+		}
+		for id, ngOptions := range c.NodeGroups {
+			overrides[id] = ngOptions.override()
+		}
+		options.NodeGroupOverrides = overrides
+	}
+	setBool(&options.ScaleDownEnabled, c.ScaleDownEnabled)
+	setDuration(&options.ScaleDownDelayAfterAdd, c.ScaleDownDelayAfterAdd)
+	setDuration(&options.ScaleDownDelayAfterDelete, c.ScaleDownDelayAfterDelete)
+	setDuration(&options.ScaleDownDelayAfterFailure, c.ScaleDownDelayAfterFailure)
+	setInt(&options.ScaleDownNonEmptyCandidatesCount, c.ScaleDownNonEmptyCandidatesCount)
+	setFloat(&options.ScaleDownCandidatesPoolRatio, c.ScaleDownCandidatesPoolRatio)
+	setInt(&options.ScaleDownCandidatesPoolMinCount, c.ScaleDownCandidatesPoolMinCount)
+	setInt(&options.MaxEmptyBulkDelete, c.MaxEmptyBulkDelete)
+	setInt(&options.MaxNodesTotal, c.MaxNodesTotal)
+	setInt(&options.MaxGracefulTerminationSec, c.MaxGracefulTerminationSec)
+	setDuration(&options.MaxPodEvictionTime, c.MaxPodEvictionTime)
+	setDuration(&options.NodeDeletionDelayTimeout, c.NodeDeletionDelayTimeout)
+	setDuration(&options.UnremovableNodeRecheckTimeout, c.UnremovableNodeRecheckTimeout)
+	setInt(&options.MaxBulkSoftTaintCount, c.MaxBulkSoftTaintCount)
+	setDuration(&options.MaxBulkSoftTaintTime, c.MaxBulkSoftTaintTime)
+	setDuration(&options.NewPodScaleUpDelay, c.NewPodScaleUpDelay)
+	setDuration(&options.PodBatchingWindow, c.PodBatchingWindow)
+	setDuration(&options.PodBatchingMaxDelay, c.PodBatchingMaxDelay)
+	setInt(&options.ExpendablePodsPriorityCutoff, c.ExpendablePodsPriorityCutoff)
+	setBool(&options.BalanceSimilarNodeGroups, c.BalanceSimilarNodeGroups)
+	setBool(&options.IgnoreDaemonSetsUtilization, c.IgnoreDaemonSetsUtilization)
+	setBool(&options.IgnoreMirrorPodsUtilization, c.IgnoreMirrorPodsUtilization)
+	if c.QuotaGroups != nil {
+		options.QuotaGroups = make([]config.QuotaGroup, 0, len(c.QuotaGroups))
+		for _, quotaGroup := range c.QuotaGroups {
+			options.QuotaGroups = append(options.QuotaGroups, quotaGroup.quotaGroup())
+		}
+	}
+	return options
+}
+
+func (o QuotaGroupOptions) quotaGroup() config.QuotaGroup {
+	quotaGroup := config.QuotaGroup{
+		Name:              o.Name,
+		NodeGroupIds:      o.NodeGroupIds,
+		NodeGroupSelector: o.NodeGroupSelector,
+		MaxNodes:          o.MaxNodes,
+		MaxCores:          o.MaxCores,
+		MaxGpus:           o.MaxGpus,
+		MaxHourlyCost:     o.MaxHourlyCost,
+	}
+	if o.MaxMemory != nil {
+		quotaGroup.MaxMemory = o.MaxMemory.Value()
+	}
+	return quotaGroup
+}
+
+func (o NodeGroupOptions) override() config.NodeGroupAutoscalingOptionsOverride {
+	override := config.NodeGroupAutoscalingOptionsOverride{
+		ScaleDownUtilizationThreshold:    o.ScaleDownUtilizationThreshold,
+		ScaleDownGpuUtilizationThreshold: o.ScaleDownGpuUtilizationThreshold,
+		ScaleDownSelectionPolicies:       o.ScaleDownSelectionPolicies,
+	}
+	if o.ScaleDownUnneededTime != nil {
+		override.ScaleDownUnneededTime = &o.ScaleDownUnneededTime.Duration
+	}
+	if o.ScaleDownUnreadyTime != nil {
+		override.ScaleDownUnreadyTime = &o.ScaleDownUnreadyTime.Duration
+	}
+	return override
+}
+
+func validateDuration(path string, value *metav1.Duration) error {
+	if value != nil && value.Duration < 0 {
+		return fmt.Errorf("%s: must not be negative, got %v", path, value.Duration)
+	}
+	return nil
+}
+
+func validateCount(path string, value *int) error {
+	if value != nil && *value < 0 {
+		return fmt.Errorf("%s: must not be negative, got %d", path, *value)
+	}
+	return nil
+}
+
+func validateRatio(path string, value *float64) error {
+	if value != nil && (*value < 0 || *value > 1) {
+		return fmt.Errorf("%s: must be between 0 and 1, got %v", path, *value)
+	}
+	return nil
+}
+
+func setBool(dst *bool, value *bool) {
+	if value != nil {
+		*dst = *value
+	}
+}
+
+func setInt(dst *int, value *int) {
+	if value != nil {
+		*dst = *value
+	}
+}
+
+func setFloat(dst *float64, value *float64) {
+	if value != nil {
+		*dst = *value
+	}
+}
+
+func setDuration(dst *time.Duration, value *metav1.Duration) {
+	if value != nil {
+		*dst = value.Duration
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configfile
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+)
+
+func TestParseAndApply(t *testing.T) {
+	data := `
+nodeGroupDefaults:
+  scaleDownUtilizationThreshold: 0.6
+  scaleDownUnneededTime: 5m
+nodeGroups:
+  ng1:
+    scaleDownUnneededTime: 1h
+    scaleDownSelectionPolicies: [oldest]
+scaleDownEnabled: false
+scaleDownDelayAfterAdd: 2m
+maxNodesTotal: 100
+scaleDownCandidatesPoolRatio: 0.2
+`
+	c, err := Parse([]byte(data))
+	assert.NoError(t, err)
+
+	flagOptions := config.AutoscalingOptions{
+		NodeGroupDefaults: config.NodeGroupAutoscalingOptions{
+			ScaleDownUtilizationThreshold:    0.5,
+			ScaleDownGpuUtilizationThreshold: 0.5,
+			ScaleDownUnneededTime:            10 * time.Minute,
+			ScaleDownUnreadyTime:             20 * time.Minute,
+		},
+		ScaleDownEnabled:       true,
+		ScaleDownDelayAfterAdd: 10 * time.Minute,
+		MaxNodesTotal:          50,
+		MaxEmptyBulkDelete:     10,
+	}
+	options := c.Apply(flagOptions)
+	assert.Equal(t, config.NodeGroupAutoscalingOptions{
+		ScaleDownUtilizationThreshold:    0.6,
+		ScaleDownGpuUtilizationThreshold: 0.5,
+		ScaleDownUnneededTime:            5 * time.Minute,
+		ScaleDownUnreadyTime:             20 * time.Minute,
+	}, options.NodeGroupDefaults)
+	assert.Equal(t, false, options.ScaleDownEnabled)
+	assert.Equal(t, 2*time.Minute, options.ScaleDownDelayAfterAdd)
+	assert.Equal(t, 100, options.MaxNodesTotal)
+	assert.Equal(t, 0.2, options.ScaleDownCandidatesPoolRatio)
+	assert.Equal(t, 10, options.MaxEmptyBulkDelete)
+
+	override := options.NodeGroupOverrides["ng1"]
+	assert.Equal(t, config.NodeGroupAutoscalingOptions{
+		ScaleDownUtilizationThreshold:    0.6,
+		ScaleDownGpuUtilizationThreshold: 0.5,
+		ScaleDownUnneededTime:            time.Hour,
+		ScaleDownUnreadyTime:             20 * time.Minute,
+		ScaleDownSelectionPolicies:       []string{"oldest"},
+	}, override.Apply(options.NodeGroupDefaults))
+
+	// Flag options are not modified.
+	assert.Equal(t, true, flagOptions.ScaleDownEnabled)
+	assert.Nil(t, flagOptions.NodeGroupOverrides)
+}
+
+func TestParseQuotaGroups(t *testing.T) {
+	data := `
+quotaGroups:
+- name: team-a
+  nodeGroupIds: ^team-a-
+  maxNodes: 20
+  maxMemory: 64Gi
+- name: gpus
+  nodeGroupSelector: accelerator=nvidia
+  maxGpus: 8
+  maxHourlyCost: 12.5
+`
+	c, err := Parse([]byte(data))
+	assert.NoError(t, err)
+
+	options := c.Apply(config.AutoscalingOptions{
+		QuotaGroups: []config.QuotaGroup{{Name: "flags", MaxNodes: 1}},
+	})
+	assert.Equal(t, []config.QuotaGroup{
+		{Name: "team-a", NodeGroupIds: "^team-a-", MaxNodes: 20, MaxMemory: 64 * 1024 * 1024 * 1024},
+		{Name: "gpus", NodeGroupSelector: "accelerator=nvidia", MaxGpus: 8, MaxHourlyCost: 12.5},
+	}, options.QuotaGroups)
+
+	// Quota groups are kept when the configuration doesn't set them.
+	c, err = Parse([]byte("maxNodesTotal: 10"))
+	assert.NoError(t, err)
+	options = c.Apply(options)
+	assert.Len(t, options.QuotaGroups, 2)
+}
+
+func TestParseInvalid(t *testing.T) {
+	testCases := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name:    "not yaml",
+			data:    "maxNodesTotal: [",
+			wantErr: "failed to parse configuration",
+		},
+		{
+			name:    "unknown field",
+			data:    "maxNodeTotal: 10",
+			wantErr: "unknown field",
+		},
+		{
+			name:    "option which needs a restart",
+			data:    "cloudProviderName: gce",
+			wantErr: "unknown field",
+		},
+		{
+			name:    "invalid duration",
+			data:    "scaleDownDelayAfterAdd: 10",
+			wantErr: "failed to parse configuration",
+		},
+		{
+			name:    "negative duration",
+			data:    "scaleDownDelayAfterAdd: -10m",
+			wantErr: "scaleDownDelayAfterAdd: must not be negative",
+		},
+		{
+			name:    "negative count",
+			data:    "maxEmptyBulkDelete: -1",
+			wantErr: "maxEmptyBulkDelete: must not be negative",
+		},
+		{
+			name:    "threshold out of range",
+			data:    "nodeGroupDefaults:\n  scaleDownUtilizationThreshold: 1.5",
+			wantErr: "nodeGroupDefaults.scaleDownUtilizationThreshold: must be between 0 and 1",
+		},
+		{
+			name:    "unknown selection policy",
+			data:    "nodeGroups:\n  ng1:\n    scaleDownSelectionPolicies: [random]",
+			wantErr: "nodeGroups[ng1].scaleDownSelectionPolicies",
+		},
+		{
+			name:    "quota group without name",
+			data:    "quotaGroups:\n- maxNodes: 10",
+			wantErr: "quotaGroups[0]: name must not be empty",
+		},
+		{
+			name:    "duplicate quota group",
+			data:    "quotaGroups:\n- name: a\n- name: a",
+			wantErr: "quotaGroups[1]: duplicate name a",
+		},
+		{
+			name:    "invalid quota group selector",
+			data:    "quotaGroups:\n- name: a\n  nodeGroupSelector: 'team in'",
+			wantErr: "quotaGroups[0].nodeGroupSelector",
+		},
+		{
+			name:    "invalid quota group ids",
+			data:    "quotaGroups:\n- name: a\n  nodeGroupIds: 'ng-('",
+			wantErr: "quotaGroups[0].nodeGroupIds",
+		},
+		{
+			name:    "negative quota",
+			data:    "quotaGroups:\n- name: a\n  maxMemory: -1Gi",
+			wantErr: "quotaGroups[0].maxMemory: must not be negative",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse([]byte(tc.data))
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.wantErr)
+			}
+		})
+	}
+}
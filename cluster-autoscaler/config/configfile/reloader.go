@@ -0,0 +1,161 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configfile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+
+	"k8s.io/autoscaler/cluster-autoscaler/clusterstate/utils"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	"k8s.io/autoscaler/cluster-autoscaler/metrics"
+
+	apiv1 "k8s.io/api/core/v1"
+	kube_errors "k8s.io/apimachinery/pkg/api/errors"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	klog "k8s.io/klog/v2"
+)
+
+// ConfigMapKey is the ConfigMap data key holding the configuration.
+const ConfigMapKey = "config.yaml"
+
+// Source provides the content of the configuration file.
+type Source interface {
+	// Read returns the configuration, or nil if there is none.
+	Read() ([]byte, error)
+	// String describes the source in logs and events.
+	String() string
+}
+
+type fileSource struct {
+	path string
+}
+
+// NewFileSource returns a source reading the configuration from a file.
+func NewFileSource(path string) Source {
+	return &fileSource{path: path}
+}
+
+func (s *fileSource) Read() ([]byte, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (s *fileSource) String() string {
+	return "file " + s.path
+}
+
+type configMapSource struct {
+	lister v1lister.ConfigMapNamespaceLister
+	name   string
+}
+
+// NewConfigMapSource returns a source reading the configuration from
+// the ConfigMapKey key of a ConfigMap.
+func NewConfigMapSource(lister v1lister.ConfigMapNamespaceLister, name string) Source {
+	return &configMapSource{lister: lister, name: name}
+}
+
+func (s *configMapSource) Read() ([]byte, error) {
+	configMap, err := s.lister.Get(s.name)
+	if kube_errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, found := configMap.Data[ConfigMapKey]
+	if !found {
+		return nil, fmt.Errorf("configmap doesn't contain %s key", ConfigMapKey)
+	}
+	return []byte(data), nil
+}
+
+func (s *configMapSource) String() string {
+	return "configmap " + s.name
+}
+
+// Reloader applies the configuration read from a Source on top of options set
+// by flags. Invalid configuration is rejected, keeping the options of the last
+// valid one, or the flags if there was none.
+type Reloader struct {
+	source      Source
+	flagOptions config.AutoscalingOptions
+	logRecorder *utils.LogEventRecorder
+
+	loaded  bool
+	data    []byte
+	lastErr string
+	options config.AutoscalingOptions
+}
+
+// NewReloader creates a Reloader of the configuration from the given source.
+func NewReloader(source Source, flagOptions config.AutoscalingOptions, logRecorder *utils.LogEventRecorder) *Reloader {
+	return &Reloader{
+		source:      source,
+		flagOptions: flagOptions,
+		logRecorder: logRecorder,
+		options:     flagOptions,
+	}
+}
+
+// Reload reads the configuration and returns the options to use. The returned
+// bool is true if the options differ from the ones returned by the previous call.
+func (r *Reloader) Reload() (config.AutoscalingOptions, bool) {
+	data, err := r.source.Read()
+	if err == nil && r.loaded && bytes.Equal(data, r.data) {
+		r.lastErr = ""
+		return r.options, false
+	}
+	options := r.flagOptions
+	if err == nil && data != nil {
+		var c *Config
+		if c, err = Parse(data); err == nil {
+			options = c.Apply(options)
+		}
+	}
+	if err != nil {
+		// Rejections are reported once, not every loop.
+		if err.Error() != r.lastErr {
+			r.lastErr = err.Error()
+			klog.Errorf("Ignoring invalid configuration from %s: %v", r.source, err)
+			r.logRecorder.Eventf(apiv1.EventTypeWarning, "ConfigInvalid", "Ignoring invalid configuration from %s: %v", r.source, err)
+			metrics.RegisterConfigReload(err)
+		}
+		return r.options, false
+	}
+
+	changed := !reflect.DeepEqual(options, r.options)
+	if data != nil {
+		klog.V(1).Infof("Loaded configuration from %s", r.source)
+		r.logRecorder.Eventf(apiv1.EventTypeNormal, "ConfigLoaded", "Loaded configuration from %s", r.source)
+		metrics.RegisterConfigReload(nil)
+	} else if r.data != nil {
+		klog.V(1).Infof("Configuration removed from %s, using flags", r.source)
+		r.logRecorder.Eventf(apiv1.EventTypeNormal, "ConfigLoaded", "Configuration removed from %s, using flags", r.source)
+	}
+	r.loaded = true
+	r.data = data
+	r.lastErr = ""
+	r.options = options
+	return options, changed
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/autoscaler/cluster-autoscaler/clusterstate/utils"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func newTestLogRecorder(t *testing.T) *utils.LogEventRecorder {
+	logRecorder, err := utils.NewStatusMapRecorder(fake.NewSimpleClientset(), "kube-system", record.NewFakeRecorder(10), false, "my-cool-configmap")
+	assert.NoError(t, err)
+	return logRecorder
+}
+
+func TestReloadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	flagOptions := config.AutoscalingOptions{MaxNodesTotal: 10, MaxEmptyBulkDelete: 5}
+	reloader := NewReloader(NewFileSource(path), flagOptions, newTestLogRecorder(t))
+
+	// Flags are used until there is a configuration file.
+	options, changed := reloader.Reload()
+	assert.False(t, changed)
+	assert.Equal(t, flagOptions, options)
+
+	assert.NoError(t, os.WriteFile(path, []byte("maxNodesTotal: 20"), 0644))
+	options, changed = reloader.Reload()
+	assert.True(t, changed)
+	assert.Equal(t, 20, options.MaxNodesTotal)
+	assert.Equal(t, 5, options.MaxEmptyBulkDelete)
+	options, changed = reloader.Reload()
+	assert.False(t, changed)
+	assert.Equal(t, 20, options.MaxNodesTotal)
+
+	// Invalid changes are rejected.
+	assert.NoError(t, os.WriteFile(path, []byte("maxNodesTotal: -1"), 0644))
+	options, changed = reloader.Reload()
+	assert.False(t, changed)
+	assert.Equal(t, 20, options.MaxNodesTotal)
+
+	// Fields removed from the file fall back to flags.
+	assert.NoError(t, os.WriteFile(path, []byte("maxEmptyBulkDelete: 1"), 0644))
+	options, changed = reloader.Reload()
+	assert.True(t, changed)
+	assert.Equal(t, 10, options.MaxNodesTotal)
+	assert.Equal(t, 1, options.MaxEmptyBulkDelete)
+
+	assert.NoError(t, os.Remove(path))
+	options, changed = reloader.Reload()
+	assert.True(t, changed)
+	assert.Equal(t, flagOptions, options)
+}
+
+func TestReloadInvalidOnStartup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("maxNodesTotal: x"), 0644))
+	flagOptions := config.AutoscalingOptions{MaxNodesTotal: 10}
+	reloader := NewReloader(NewFileSource(path), flagOptions, newTestLogRecorder(t))
+
+	options, changed := reloader.Reload()
+	assert.False(t, changed)
+	assert.Equal(t, flagOptions, options)
+}
+
+func TestConfigMapSource(t *testing.T) {
+	lister, err := kube_util.NewTestConfigMapLister([]*apiv1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "ca-config"},
+			Data:       map[string]string{ConfigMapKey: "maxNodesTotal: 20"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "other"},
+			Data:       map[string]string{"other": "maxNodesTotal: 20"},
+		},
+	})
+	assert.NoError(t, err)
+
+	data, err := NewConfigMapSource(lister.ConfigMaps("kube-system"), "ca-config").Read()
+	assert.NoError(t, err)
+	assert.Equal(t, "maxNodesTotal: 20", string(data))
+
+	data, err = NewConfigMapSource(lister.ConfigMaps("kube-system"), "missing").Read()
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+
+	_, err = NewConfigMapSource(lister.ConfigMaps("kube-system"), "other").Read()
+	assert.Error(t, err)
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// DisruptionBudget limits how much of the cluster scale-down may disrupt at once.
+type DisruptionBudget struct {
+	// MaxNodesDeleting is the maximum number, or percentage of all nodes, of
+	// nodes being deleted at once. Zero means no limit.
+	MaxNodesDeleting intstr.IntOrString
+	// MaxNodesDeletingPerNodeGroup is the maximum number, or percentage of the
+	// node group target size, of nodes of a single node group being deleted at
+	// once. Zero means no limit.
+	MaxNodesDeletingPerNodeGroup intstr.IntOrString
+	// MaxEvictionsPerMinutePerNamespace is the maximum number of pods evicted
+	// from a single namespace within a minute. Zero means no limit.
+	MaxEvictionsPerMinutePerNamespace int
+	// BlackoutWindows are periods during which scale-down is forbidden.
+	BlackoutWindows []TimeWindow
+}
+
+// TimeWindow is a period of time, including its start and excluding its end.
+type TimeWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Contains checks if the given time is within the window.
+func (w TimeWindow) Contains(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// String returns the window in the format accepted by ParseTimeWindow.
+func (w TimeWindow) String() string {
+	return w.Start.Format(time.RFC3339) + "/" + w.End.Format(time.RFC3339)
+}
+
+// ActiveBlackoutWindow returns the blackout window containing the given time,
+// or nil if there is none.
+func (b DisruptionBudget) ActiveBlackoutWindow(now time.Time) *TimeWindow {
+	for i := range b.BlackoutWindows {
+		if b.BlackoutWindows[i].Contains(now) {
+			return &b.BlackoutWindows[i]
+		}
+	}
+	return nil
+}
+
+// MaxNodesDeletingOf returns the maximum number of nodes being deleted at
+// once out of total nodes, or 0 if there is no limit.
+func (b DisruptionBudget) MaxNodesDeletingOf(total int) int {
+	return scaledLimit(b.MaxNodesDeleting, total)
+}
+
+// MaxNodesDeletingPerNodeGroupOf returns the maximum number of nodes being
+// deleted at once in a node group of the given target size, or 0 if there is
+// no limit.
+func (b DisruptionBudget) MaxNodesDeletingPerNodeGroupOf(size int) int {
+	return scaledLimit(b.MaxNodesDeletingPerNodeGroup, size)
+}
+
+// scaledLimit resolves a number or percentage limit. Percentages are rounded
+// down, but always allow at least one node, as a zero limit would mean no limit.
+func scaledLimit(limit intstr.IntOrString, total int) int {
+	if limit.Type == intstr.Int {
+		return limit.IntValue()
+	}
+	value, err := intstr.GetScaledValueFromIntOrPercent(&limit, total, false)
+	if err != nil || value < 1 {
+		return 1
+	}
+	return value
+}
+
+// ParseNodeCountLimit parses a limit given either as a number of nodes (e.g. "5")
+// or as a percentage (e.g. "10%").
+func ParseNodeCountLimit(value string) (intstr.IntOrString, error) {
+	limit := intstr.Parse(value)
+	if limit.Type == intstr.String {
+		if !strings.HasSuffix(limit.StrVal, "%") {
+			return limit, fmt.Errorf("invalid node count limit %q: expected a number or a percentage", value)
+		}
+		if _, err := intstr.GetScaledValueFromIntOrPercent(&limit, 100, false); err != nil {
+			return limit, fmt.Errorf("invalid node count limit %q: %v", value, err)
+		}
+		if strings.HasPrefix(limit.StrVal, "-") {
+			return limit, fmt.Errorf("invalid node count limit %q: must not be negative", value)
+		}
+		return limit, nil
+	}
+	if limit.IntValue() < 0 {
+		return limit, fmt.Errorf("invalid node count limit %q: must not be negative", value)
+	}
+	return limit, nil
+}
+
+// ParseTimeWindow parses a time window given as two RFC3339 timestamps
+// separated by a slash, e.g. "2022-12-19T00:00:00Z/2023-01-02T00:00:00Z".
+func ParseTimeWindow(value string) (TimeWindow, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 {
+		return TimeWindow{}, fmt.Errorf("invalid time window %q: expected <start>/<end>", value)
+	}
+	start, err := time.Parse(time.RFC3339, parts[0])
+	if err != nil {
+		return TimeWindow{}, fmt.Errorf("invalid time window %q: %v", value, err)
+	}
+	end, err := time.Parse(time.RFC3339, parts[1])
+	if err != nil {
+		return TimeWindow{}, fmt.Errorf("invalid time window %q: %v", value, err)
+	}
+	if !end.After(start) {
+		return TimeWindow{}, fmt.Errorf("invalid time window %q: end must be after start", value)
+	}
+	return TimeWindow{Start: start, End: end}, nil
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestParseNodeCountLimit(t *testing.T) {
+	testCases := []struct {
+		value   string
+		want    intstr.IntOrString
+		wantErr bool
+	}{
+		{value: "0", want: intstr.FromInt(0)},
+		{value: "5", want: intstr.FromInt(5)},
+		{value: "10%", want: intstr.FromString("10%")},
+		{value: "-1", wantErr: true},
+		{value: "-10%", wantErr: true},
+		{value: "ten", wantErr: true},
+		{value: "x%", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := ParseNodeCountLimit(tc.value)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestParseTimeWindow(t *testing.T) {
+	window, err := ParseTimeWindow("2022-12-19T00:00:00Z/2023-01-02T00:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2022, 12, 19, 0, 0, 0, 0, time.UTC), window.Start)
+	assert.Equal(t, time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), window.End)
+	assert.Equal(t, "2022-12-19T00:00:00Z/2023-01-02T00:00:00Z", window.String())
+
+	for _, value := range []string{
+		"2022-12-19T00:00:00Z",
+		"2022-12-19/2023-01-02",
+		"2023-01-02T00:00:00Z/2022-12-19T00:00:00Z",
+		"2022-12-19T00:00:00Z/2023-01-02T00:00:00Z/2023-01-03T00:00:00Z",
+	} {
+		_, err := ParseTimeWindow(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestActiveBlackoutWindow(t *testing.T) {
+	start := time.Date(2022, 12, 19, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	budget := DisruptionBudget{BlackoutWindows: []TimeWindow{{Start: start, End: end}}}
+
+	assert.Nil(t, budget.ActiveBlackoutWindow(start.Add(-time.Second)))
+	assert.NotNil(t, budget.ActiveBlackoutWindow(start))
+	assert.NotNil(t, budget.ActiveBlackoutWindow(end.Add(-time.Second)))
+	assert.Nil(t, budget.ActiveBlackoutWindow(end))
+}
@@ -26,7 +26,9 @@ import (
 	processor_callbacks "k8s.io/autoscaler/cluster-autoscaler/processors/callbacks"
 	"k8s.io/autoscaler/cluster-autoscaler/simulator"
 	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/podgroup"
 	kube_client "k8s.io/client-go/kubernetes"
+	v1batchlister "k8s.io/client-go/listers/batch/v1"
 	kube_record "k8s.io/client-go/tools/record"
 	klog "k8s.io/klog/v2"
 )
@@ -53,6 +55,10 @@ type AutoscalingContext struct {
 	ProcessorCallbacks processor_callbacks.ProcessorCallbacks
 	// DebuggingSnapshotter is the interface for capturing the debugging snapshot
 	DebuggingSnapshotter debuggingsnapshot.DebuggingSnapshotter
+	// PodReservations remember which pending pods upcoming nodes were provisioned for.
+	PodReservations *simulator.PodReservations
+	// PodGroupFinder finds pod groups which trigger scale-up only if all their pods fit.
+	PodGroupFinder *podgroup.Finder
 }
 
 // AutoscalingKubeClients contains all Kubernetes API clients,
@@ -84,6 +90,10 @@ func NewResourceLimiterFromAutoscalingOptions(options config.AutoscalingOptions)
 		minResources[gpuLimits.GpuType] = gpuLimits.Min
 		maxResources[gpuLimits.GpuType] = gpuLimits.Max
 	}
+	for _, limits := range options.ExtendedResourceTotal {
+		minResources[limits.Resource] = limits.Min
+		maxResources[limits.Resource] = limits.Max
+	}
 	return cloudprovider.NewResourceLimiter(minResources, maxResources)
 }
 
@@ -98,6 +108,10 @@ func NewAutoscalingContext(
 	estimatorBuilder estimator.EstimatorBuilder,
 	processorCallbacks processor_callbacks.ProcessorCallbacks,
 	debuggingSnapshotter debuggingsnapshot.DebuggingSnapshotter) *AutoscalingContext {
+	var jobLister v1batchlister.JobLister
+	if options.PodGroupsFromJobs && autoscalingKubeClients.ListerRegistry != nil {
+		jobLister = autoscalingKubeClients.JobLister()
+	}
 	return &AutoscalingContext{
 		AutoscalingOptions:     options,
 		CloudProvider:          cloudProvider,
@@ -108,6 +122,8 @@ func NewAutoscalingContext(
 		EstimatorBuilder:       estimatorBuilder,
 		ProcessorCallbacks:     processorCallbacks,
 		DebuggingSnapshotter:   debuggingSnapshotter,
+		PodReservations:        simulator.NewPodReservations(),
+		PodGroupFinder:         podgroup.NewFinder(jobLister),
 	}
 }
 
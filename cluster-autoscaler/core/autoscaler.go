@@ -22,8 +22,10 @@ import (
 
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
 	cloudBuilder "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/builder"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/instrumented"
 	"k8s.io/autoscaler/cluster-autoscaler/config"
 	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/core/dryrun"
 	"k8s.io/autoscaler/cluster-autoscaler/debuggingsnapshot"
 	"k8s.io/autoscaler/cluster-autoscaler/estimator"
 	"k8s.io/autoscaler/cluster-autoscaler/expander"
@@ -33,6 +35,7 @@ import (
 	"k8s.io/autoscaler/cluster-autoscaler/utils/backoff"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
 	kube_client "k8s.io/client-go/kubernetes"
+	klog "k8s.io/klog/v2"
 )
 
 // AutoscalerOptions is the whole set of options for configuring an autoscaler
@@ -68,7 +71,7 @@ func NewAutoscaler(opts AutoscalerOptions) (Autoscaler, errors.AutoscalerError)
 	if err != nil {
 		return nil, errors.ToAutoscalerError(errors.InternalError, err)
 	}
-	return NewStaticAutoscaler(
+	autoscaler, autoscalerErr := NewStaticAutoscaler(
 		opts.AutoscalingOptions,
 		opts.PredicateChecker,
 		opts.ClusterSnapshot,
@@ -78,7 +81,11 @@ func NewAutoscaler(opts AutoscalerOptions) (Autoscaler, errors.AutoscalerError)
 		opts.ExpanderStrategy,
 		opts.EstimatorBuilder,
 		opts.Backoff,
-		opts.DebuggingSnapshotter), nil
+		opts.DebuggingSnapshotter)
+	if autoscalerErr != nil {
+		return nil, autoscalerErr
+	}
+	return autoscaler, nil
 }
 
 // Initialize default options if not provided.
@@ -101,7 +108,12 @@ func initializeDefaultOptions(opts *AutoscalerOptions) error {
 		opts.ClusterSnapshot = simulator.NewBasicClusterSnapshot()
 	}
 	if opts.CloudProvider == nil {
-		opts.CloudProvider = cloudBuilder.NewCloudProvider(opts.AutoscalingOptions)
+		if cloudProvider := cloudBuilder.NewCloudProvider(opts.AutoscalingOptions); cloudProvider != nil {
+			opts.CloudProvider = instrumented.NewCloudProvider(cloudProvider)
+		}
+	}
+	if opts.DryRun && opts.CloudProvider != nil {
+		opts.CloudProvider = dryrun.NewCloudProvider(opts.CloudProvider, opts.AutoscalingKubeClients.LogRecorder)
 	}
 	if opts.ExpanderStrategy == nil {
 		expanderStrategy, err := factory.ExpanderStrategyFromStrings(strings.Split(opts.ExpanderNames, ","), opts.CloudProvider,
@@ -119,8 +131,16 @@ func initializeDefaultOptions(opts *AutoscalerOptions) error {
 		opts.EstimatorBuilder = estimatorBuilder
 	}
 	if opts.Backoff == nil {
-		opts.Backoff =
-			backoff.NewIdBasedExponentialBackoff(opts.InitialNodeGroupBackoffDuration, opts.MaxNodeGroupBackoffDuration, opts.NodeGroupBackoffResetTimeout)
+		if len(opts.NodeGroupBackoffPolicies) > 0 || opts.BackoffStateConfigMapName != "" {
+			if opts.DryRun && opts.BackoffStateConfigMapName != "" {
+				klog.Warningf("Dry run: backoff state is loaded from %s, but not persisted", opts.BackoffStateConfigMapName)
+			}
+			opts.Backoff = backoff.NewPolicyBasedBackoff(opts.InitialNodeGroupBackoffDuration, opts.MaxNodeGroupBackoffDuration, opts.NodeGroupBackoffResetTimeout,
+				opts.NodeGroupBackoffPolicies, opts.KubeClient, opts.ConfigNamespace, opts.BackoffStateConfigMapName)
+		} else {
+			opts.Backoff =
+				backoff.NewIdBasedExponentialBackoff(opts.InitialNodeGroupBackoffDuration, opts.MaxNodeGroupBackoffDuration, opts.NodeGroupBackoffResetTimeout)
+		}
 	}
 
 	return nil
@@ -0,0 +1,252 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dryrun
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/clusterstate/utils"
+	"k8s.io/autoscaler/cluster-autoscaler/metrics"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/checkpoint"
+
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	increaseSizeCall       = "IncreaseSize"
+	deleteNodesCall        = "DeleteNodes"
+	decreaseTargetSizeCall = "DecreaseTargetSize"
+	createCall             = "Create"
+	deleteCall             = "Delete"
+)
+
+// cloudProvider wraps a CloudProvider, so that all node groups it returns
+// record mutating calls instead of executing them.
+type cloudProvider struct {
+	cloudprovider.CloudProvider
+	logRecorder *utils.LogEventRecorder
+	targetSizes *targetSizes
+}
+
+// targetSizes are simulated target sizes of node groups by their ids. Without
+// them, a recorded scale-up would look like it never happened, so the same
+// scale-up would be repeated every loop.
+type targetSizes struct {
+	sync.Mutex
+	sizes map[string]targetSize
+}
+
+// targetSize is a simulated target size of a node group, along with the
+// target size of the wrapped node group when it was simulated.
+type targetSize struct {
+	simulated int
+	real      int
+}
+
+// caughtUp tells if the wrapped node group reached the simulated target size,
+// e.g. because the same resize was executed by the autoscaler managing the cluster.
+func (s targetSize) caughtUp(size int) bool {
+	if s.simulated >= s.real {
+		return size >= s.simulated
+	}
+	return size <= s.simulated
+}
+
+// NewCloudProvider returns a CloudProvider which never resizes, creates or
+// deletes node groups. Instead, each such call is logged, reported as an event
+// through logRecorder and counted in the dry run metrics.
+func NewCloudProvider(cp cloudprovider.CloudProvider, logRecorder *utils.LogEventRecorder) cloudprovider.CloudProvider {
+	return &cloudProvider{
+		CloudProvider: cp,
+		logRecorder:   logRecorder,
+		targetSizes:   &targetSizes{sizes: make(map[string]targetSize)},
+	}
+}
+
+// NodeGroups returns all node groups of the wrapped cloud provider.
+func (cp *cloudProvider) NodeGroups() []cloudprovider.NodeGroup {
+	nodeGroups := cp.CloudProvider.NodeGroups()
+	result := make([]cloudprovider.NodeGroup, 0, len(nodeGroups))
+	for _, ng := range nodeGroups {
+		result = append(result, cp.wrap(ng))
+	}
+	return result
+}
+
+// NodeGroupForNode returns the node group for the given node.
+func (cp *cloudProvider) NodeGroupForNode(node *apiv1.Node) (cloudprovider.NodeGroup, error) {
+	ng, err := cp.CloudProvider.NodeGroupForNode(node)
+	if err != nil || ng == nil || reflect.ValueOf(ng).IsNil() {
+		return ng, err
+	}
+	return cp.wrap(ng), nil
+}
+
+// NewNodeGroup builds a theoretical node group, which will not be created on
+// the cloud provider side even if asked to.
+func (cp *cloudProvider) NewNodeGroup(machineType string, labels map[string]string, systemLabels map[string]string,
+	taints []apiv1.Taint, extraResources map[string]resource.Quantity) (cloudprovider.NodeGroup, error) {
+	ng, err := cp.CloudProvider.NewNodeGroup(machineType, labels, systemLabels, taints, extraResources)
+	if err != nil {
+		return nil, err
+	}
+	return cp.wrap(ng), nil
+}
+
+// ChangedTemplates returns node groups whose templates changed, if the wrapped
+// cloud provider reports them.
+func (cp *cloudProvider) ChangedTemplates() []string {
+	if reporter, ok := cp.CloudProvider.(cloudprovider.TemplateChangeReporter); ok {
+		return reporter.ChangedTemplates()
+	}
+	return nil
+}
+
+// CheckpointState returns the checkpointed state of the wrapped cloud provider, if it has any.
+func (cp *cloudProvider) CheckpointState() ([]byte, error) {
+	if component, ok := cp.CloudProvider.(checkpoint.Component); ok {
+		return component.CheckpointState()
+	}
+	return nil, nil
+}
+
+// RestoreState restores the state of the wrapped cloud provider, if it has any.
+func (cp *cloudProvider) RestoreState(data []byte) error {
+	if component, ok := cp.CloudProvider.(checkpoint.Component); ok {
+		return component.RestoreState(data)
+	}
+	return nil
+}
+
+func (cp *cloudProvider) wrap(ng cloudprovider.NodeGroup) cloudprovider.NodeGroup {
+	if wrapped, ok := ng.(*nodeGroup); ok {
+		return wrapped
+	}
+	return &nodeGroup{
+		NodeGroup:   ng,
+		logRecorder: cp.logRecorder,
+		targetSizes: cp.targetSizes,
+	}
+}
+
+// nodeGroup records calls changing its size instead of passing them to
+// the wrapped node group.
+type nodeGroup struct {
+	cloudprovider.NodeGroup
+	logRecorder *utils.LogEventRecorder
+	targetSizes *targetSizes
+}
+
+// TargetSize returns the simulated target size of the node group, if recorded
+// resizes changed it and the wrapped node group hasn't caught up yet.
+func (ng *nodeGroup) TargetSize() (int, error) {
+	size, err := ng.NodeGroup.TargetSize()
+	if err != nil {
+		return size, err
+	}
+	ng.targetSizes.Lock()
+	defer ng.targetSizes.Unlock()
+	simulated, found := ng.targetSizes.sizes[ng.Id()]
+	if !found {
+		return size, nil
+	}
+	if simulated.caughtUp(size) {
+		delete(ng.targetSizes.sizes, ng.Id())
+		return size, nil
+	}
+	return simulated.simulated, nil
+}
+
+// IncreaseSize records the scale-up without executing it. The target size of
+// the node group is increased only in the simulation.
+func (ng *nodeGroup) IncreaseSize(delta int) error {
+	size, err := ng.TargetSize()
+	if err != nil {
+		return err
+	}
+	if err := ng.setTargetSize(size + delta); err != nil {
+		return err
+	}
+	ng.record(increaseSizeCall, delta, "would increase node group %s size by %d", ng.Id(), delta)
+	return nil
+}
+
+// DeleteNodes records the node deletion without executing it.
+func (ng *nodeGroup) DeleteNodes(nodes []*apiv1.Node) error {
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	ng.record(deleteNodesCall, len(nodes), "would delete nodes %s from node group %s", strings.Join(names, ","), ng.Id())
+	return nil
+}
+
+// DecreaseTargetSize records the target size change without executing it.
+func (ng *nodeGroup) DecreaseTargetSize(delta int) error {
+	size, err := ng.TargetSize()
+	if err != nil {
+		return err
+	}
+	if err := ng.setTargetSize(size + delta); err != nil {
+		return err
+	}
+	ng.record(decreaseTargetSizeCall, -delta, "would decrease node group %s target size by %d", ng.Id(), -delta)
+	return nil
+}
+
+// Create records the node group creation. The returned node group is still
+// only a theoretical one.
+func (ng *nodeGroup) Create() (cloudprovider.NodeGroup, error) {
+	ng.record(createCall, 0, "would create node group %s", ng.Id())
+	return ng, nil
+}
+
+// Delete records the node group deletion without executing it.
+func (ng *nodeGroup) Delete() error {
+	ng.record(deleteCall, 0, "would delete node group %s", ng.Id())
+	return nil
+}
+
+func (ng *nodeGroup) setTargetSize(size int) error {
+	realSize, err := ng.NodeGroup.TargetSize()
+	if err != nil {
+		return err
+	}
+	ng.targetSizes.Lock()
+	defer ng.targetSizes.Unlock()
+	if previous, found := ng.targetSizes.sizes[ng.Id()]; found {
+		// Keep comparing with the size the first recorded resize started from.
+		realSize = previous.real
+	}
+	ng.targetSizes.sizes[ng.Id()] = targetSize{simulated: size, real: realSize}
+	return nil
+}
+
+func (ng *nodeGroup) record(call string, nodesCount int, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	klog.V(0).Infof("Dry run: %s", msg)
+	if ng.logRecorder != nil {
+		ng.logRecorder.Eventf(apiv1.EventTypeNormal, "DryRun"+call, "Dry run: %s", msg)
+	}
+	metrics.RegisterDryRunNodeGroupCall(ng.Id(), call, nodesCount)
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dryrun
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	testprovider "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/test"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+)
+
+func TestDryRunNodeGroupCallsAreNotExecuted(t *testing.T) {
+	provider := testprovider.NewTestCloudProvider(
+		func(nodeGroup string, delta int) error {
+			t.Fatalf("unexpected scale up of %s by %d", nodeGroup, delta)
+			return nil
+		}, func(nodeGroup string, node string) error {
+			t.Fatalf("unexpected deletion of %s from %s", node, nodeGroup)
+			return nil
+		})
+	provider.AddNodeGroup("ng1", 0, 10, 3)
+	n1 := BuildTestNode("n1", 1000, 1000)
+	provider.AddNode("ng1", n1)
+	cp := NewCloudProvider(provider, nil)
+
+	ngs := cp.NodeGroups()
+	assert.Equal(t, 1, len(ngs))
+	assert.NoError(t, ngs[0].IncreaseSize(2))
+	assert.NoError(t, ngs[0].DecreaseTargetSize(-1))
+
+	ng, err := cp.NodeGroupForNode(n1)
+	assert.NoError(t, err)
+	assert.Equal(t, "ng1", ng.Id())
+	assert.NoError(t, ng.DeleteNodes([]*apiv1.Node{n1}))
+
+	size, err := ng.TargetSize()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, size)
+	realSize, err := provider.GetNodeGroup("ng1").TargetSize()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, realSize)
+}
+
+func TestDryRunTargetSize(t *testing.T) {
+	provider := testprovider.NewTestCloudProvider(nil, nil)
+	provider.AddNodeGroup("ng1", 0, 10, 3)
+	cp := NewCloudProvider(provider, nil)
+
+	ng := cp.NodeGroups()[0]
+	assert.NoError(t, ng.IncreaseSize(2))
+	// Node groups returned later share the simulated target size.
+	size, err := cp.NodeGroups()[0].TargetSize()
+	assert.NoError(t, err)
+	assert.Equal(t, 5, size)
+
+	// The simulated target size is dropped once the real one catches up.
+	provider.GetNodeGroup("ng1").(*testprovider.TestNodeGroup).SetTargetSize(6)
+	size, err = ng.TargetSize()
+	assert.NoError(t, err)
+	assert.Equal(t, 6, size)
+	provider.GetNodeGroup("ng1").(*testprovider.TestNodeGroup).SetTargetSize(3)
+	size, err = ng.TargetSize()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, size)
+}
+
+func TestDryRunDecreaseTargetSize(t *testing.T) {
+	provider := testprovider.NewTestCloudProvider(nil, nil)
+	provider.AddNodeGroup("ng1", 0, 10, 3)
+	cp := NewCloudProvider(provider, nil)
+
+	ng := cp.NodeGroups()[0]
+	assert.NoError(t, ng.DecreaseTargetSize(-1))
+	// The decrease isn't dropped although the real target size is larger.
+	size, err := cp.NodeGroups()[0].TargetSize()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, size)
+	size, err = ng.TargetSize()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, size)
+
+	// The simulated target size is dropped once the real one catches up.
+	provider.GetNodeGroup("ng1").(*testprovider.TestNodeGroup).SetTargetSize(2)
+	size, err = ng.TargetSize()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, size)
+	provider.GetNodeGroup("ng1").(*testprovider.TestNodeGroup).SetTargetSize(4)
+	size, err = ng.TargetSize()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, size)
+}
+
+func TestDryRunIncreaseAndDecreaseTargetSize(t *testing.T) {
+	provider := testprovider.NewTestCloudProvider(nil, nil)
+	provider.AddNodeGroup("ng1", 0, 10, 3)
+	cp := NewCloudProvider(provider, nil)
+
+	ng := cp.NodeGroups()[0]
+	assert.NoError(t, ng.IncreaseSize(2))
+	assert.NoError(t, ng.DecreaseTargetSize(-1))
+	size, err := ng.TargetSize()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, size)
+}
+
+func TestDryRunNodeGroupForUnknownNode(t *testing.T) {
+	provider := testprovider.NewTestCloudProvider(nil, nil)
+	cp := NewCloudProvider(provider, nil)
+
+	ng, err := cp.NodeGroupForNode(BuildTestNode("n1", 1000, 1000))
+	assert.NoError(t, err)
+	assert.Nil(t, ng)
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dryrun
+
+import (
+	"net/http"
+	"strings"
+
+	"k8s.io/autoscaler/cluster-autoscaler/metrics"
+	"k8s.io/client-go/rest"
+
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	dryRunParam = "dryRun"
+	dryRunAll   = "All"
+)
+
+// WrapKubeConfig makes every mutating request sent by clients built from
+// the config a server-side dry run one. The API server validates such
+// requests (including admission and PodDisruptionBudget checks for
+// evictions), but doesn't persist them.
+func WrapKubeConfig(config *rest.Config) {
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &roundTripper{delegate: rt}
+	})
+}
+
+type roundTripper struct {
+	delegate http.RoundTripper
+}
+
+// RoundTrip adds dryRun=All to mutating requests and records them.
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isMutating(req.Method) {
+		return rt.delegate.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	query := req.URL.Query()
+	query.Set(dryRunParam, dryRunAll)
+	req.URL.RawQuery = query.Encode()
+
+	klog.V(1).Infof("Dry run: %s %s", req.Method, req.URL.Path)
+	metrics.RegisterDryRunAPIRequest(req.Method, resourceFromPath(req.URL.Path))
+	return rt.delegate.RoundTrip(req)
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// resourceFromPath extracts resource (and subresource, if any) name from
+// an API request path, e.g. "pods/eviction" for
+// /api/v1/namespaces/default/pods/foo/eviction.
+func resourceFromPath(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) > 2 && parts[0] == "api":
+		parts = parts[2:]
+	case len(parts) > 3 && parts[0] == "apis":
+		parts = parts[3:]
+	default:
+		return "unknown"
+	}
+	if len(parts) > 2 && parts[0] == "namespaces" {
+		parts = parts[2:]
+	}
+	if len(parts) > 2 {
+		return parts[0] + "/" + parts[2]
+	}
+	return parts[0]
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dryrun
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRoundTripperAddsDryRun(t *testing.T) {
+	for _, tc := range []struct {
+		method     string
+		url        string
+		wantDryRun bool
+	}{
+		{http.MethodGet, "https://apiserver/api/v1/nodes", false},
+		{http.MethodPut, "https://apiserver/api/v1/nodes/n1", true},
+		{http.MethodPost, "https://apiserver/api/v1/namespaces/default/pods/p1/eviction", true},
+		{http.MethodDelete, "https://apiserver/api/v1/namespaces/kube-system/configmaps/status?gracePeriodSeconds=0", true},
+	} {
+		t.Run(tc.method+" "+tc.url, func(t *testing.T) {
+			var sent *http.Request
+			rt := &roundTripper{delegate: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				sent = req
+				return &http.Response{StatusCode: http.StatusOK}, nil
+			})}
+			req, err := http.NewRequest(tc.method, tc.url, nil)
+			assert.NoError(t, err)
+
+			_, err = rt.RoundTrip(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantDryRun, sent.URL.Query().Get(dryRunParam) == dryRunAll)
+			// The original request must not be modified.
+			assert.Equal(t, "", req.URL.Query().Get(dryRunParam))
+		})
+	}
+}
+
+func TestResourceFromPath(t *testing.T) {
+	for path, want := range map[string]string{
+		"/api/v1/nodes/n1": "nodes",
+		"/api/v1/namespaces/default/pods/p1/eviction":           "pods/eviction",
+		"/api/v1/namespaces/kube-system/configmaps":             "configmaps",
+		"/apis/apps/v1/namespaces/default/deployments/d1/scale": "deployments/scale",
+		"/apis/coordination.k8s.io/v1/namespaces/ns/leases":     "leases",
+		"/healthz": "unknown",
+	} {
+		assert.Equal(t, want, resourceFromPath(path), path)
+	}
+}
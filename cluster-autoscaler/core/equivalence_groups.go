@@ -93,7 +93,8 @@ func groupPodsBySchedulingProperties(pods []*apiv1.Pod) map[equivalenceGroupId][
 // group id or nil if the group can't be found.
 func match(egs []equivalenceGroup, pod *apiv1.Pod) *equivalenceGroupId {
 	for _, g := range egs {
-		if reflect.DeepEqual(pod.Labels, g.representant.Labels) && utils.PodSpecSemanticallyEqual(pod.Spec, g.representant.Spec) {
+		if reflect.DeepEqual(pod.Labels, g.representant.Labels) && utils.PodSpecSemanticallyEqual(pod.Spec, g.representant.Spec) &&
+			pod.Annotations[pod_utils.NodeGroupSelectorAnnotationKey] == g.representant.Annotations[pod_utils.NodeGroupSelectorAnnotationKey] {
 			return &g.id
 		}
 	}
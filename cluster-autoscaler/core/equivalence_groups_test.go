@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"testing"
 
+	pod_utils "k8s.io/autoscaler/cluster-autoscaler/utils/pod"
 	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
 
 	appsv1 "k8s.io/api/apps/v1"
@@ -184,3 +185,23 @@ func TestEquivalenceGroupIgnoresDaemonSets(t *testing.T) {
 	podGroups := groupPodsBySchedulingProperties(pods)
 	assert.Equal(t, 2, len(podGroups))
 }
+
+func TestEquivalenceGroupNodeGroupSelector(t *testing.T) {
+	rc := apiv1.ReplicationController{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "rc",
+			Namespace: "default",
+			SelfLink:  "api/v1/namespaces/default/replicationcontrollers/rc",
+			UID:       "12345678-1234-1234-1234-123456789012",
+		},
+	}
+	pods := make([]*apiv1.Pod, 3)
+	for i := range pods {
+		pods[i] = BuildTestPod(fmt.Sprintf("p%d", i), 3000, 200000)
+		pods[i].OwnerReferences = GenerateOwnerReferences(rc.Name, "ReplicationController", "extensions/v1beta1", rc.UID)
+	}
+	pods[1].Annotations = map[string]string{pod_utils.NodeGroupSelectorAnnotationKey: "pool=a"}
+	pods[2].Annotations = map[string]string{pod_utils.NodeGroupSelectorAnnotationKey: "pool=b"}
+	podGroups := groupPodsBySchedulingProperties(pods)
+	assert.Equal(t, 3, len(podGroups))
+}
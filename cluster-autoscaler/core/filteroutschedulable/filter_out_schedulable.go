@@ -25,6 +25,7 @@ import (
 	"k8s.io/autoscaler/cluster-autoscaler/core/utils"
 	"k8s.io/autoscaler/cluster-autoscaler/metrics"
 	"k8s.io/autoscaler/cluster-autoscaler/simulator"
+	"k8s.io/autoscaler/cluster-autoscaler/tracing"
 
 	apiv1 "k8s.io/api/core/v1"
 	corev1helpers "k8s.io/component-helpers/scheduling/corev1"
@@ -66,8 +67,12 @@ func (p *filterOutSchedulablePodListProcessor) Process(
 	filterOutSchedulableStart := time.Now()
 	var unschedulablePodsToHelp []*apiv1.Pod
 
+	span := tracing.Start("FilterOutSchedulable", tracing.Int("unschedulable_pods", len(unschedulablePods)))
 	unschedulablePodsToHelp, err := p.filterOutSchedulableByPacking(unschedulablePods, context.ClusterSnapshot,
-		context.PredicateChecker)
+		context.PredicateChecker, context.PodReservations)
+	span.SetAttributes(tracing.Int("pods_to_help", len(unschedulablePodsToHelp)))
+	span.RecordError(err)
+	span.End()
 
 	if err != nil {
 		return nil, err
@@ -95,11 +100,14 @@ func (p *filterOutSchedulablePodListProcessor) CleanUp() {
 // filterOutSchedulableByPacking checks whether pods from <unschedulableCandidates> marked as
 // unschedulable can be scheduled on free capacity on existing nodes by trying to pack the pods. It
 // tries to pack the higher priority pods first. It takes into account pods that are bound to node
-// and will be scheduled after lower priority pod preemption.
+// and will be scheduled after lower priority pod preemption. Pods with reservations are placed on
+// the upcoming nodes reserved for them before any other pod, so that other pods don't claim capacity
+// provisioned for them.
 func (p *filterOutSchedulablePodListProcessor) filterOutSchedulableByPacking(
 	unschedulableCandidates []*apiv1.Pod,
 	clusterSnapshot simulator.ClusterSnapshot,
-	predicateChecker simulator.PredicateChecker) ([]*apiv1.Pod, error) {
+	predicateChecker simulator.PredicateChecker,
+	podReservations *simulator.PodReservations) ([]*apiv1.Pod, error) {
 	unschedulablePodsCache := utils.NewPodSchedulableMap()
 
 	// Sort unschedulable pods by importance
@@ -110,10 +118,20 @@ func (p *filterOutSchedulablePodListProcessor) filterOutSchedulableByPacking(
 	// Pods which remain unschedulable
 	var unschedulablePods []*apiv1.Pod
 
+	// Try to schedule on reserved upcoming nodes
+	podsToCheckUsingHints := unschedulableCandidates
+	if podReservations != nil {
+		var err error
+		podsToCheckUsingHints, err = filterOutReservedPods(unschedulableCandidates, clusterSnapshot, predicateChecker, podReservations)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Try to schedule based on hints
 	podsFilteredUsingHints := 0
-	podsToCheckAgainstAllNodes := make([]*apiv1.Pod, 0, len(unschedulableCandidates))
-	for _, pod := range unschedulableCandidates {
+	podsToCheckAgainstAllNodes := make([]*apiv1.Pod, 0, len(podsToCheckUsingHints))
+	for _, pod := range podsToCheckUsingHints {
 		scheduledOnHintedNode := false
 		if hintedNodeName, hintFound := p.schedulablePodsNodeHints[pod.UID]; hintFound {
 			if predicateChecker.CheckPredicates(clusterSnapshot, pod, hintedNodeName) == nil {
@@ -178,6 +196,34 @@ func (p *filterOutSchedulablePodListProcessor) filterOutSchedulableByPacking(
 	return unschedulablePods, nil
 }
 
+// filterOutReservedPods places pods with reservations on the upcoming nodes reserved for them and
+// returns the remaining pods. Reservations of pods which aren't pending anymore are released.
+func filterOutReservedPods(
+	unschedulableCandidates []*apiv1.Pod,
+	clusterSnapshot simulator.ClusterSnapshot,
+	predicateChecker simulator.PredicateChecker,
+	podReservations *simulator.PodReservations) ([]*apiv1.Pod, error) {
+	podReservations.Retain(unschedulableCandidates)
+
+	podsFilteredUsingReservations := 0
+	remainingPods := make([]*apiv1.Pod, 0, len(unschedulableCandidates))
+	for _, pod := range unschedulableCandidates {
+		nodeName, found := podReservations.ReservedNode(pod)
+		if !found || predicateChecker.CheckPredicates(clusterSnapshot, pod, nodeName) != nil {
+			remainingPods = append(remainingPods, pod)
+			continue
+		}
+		klog.V(4).Infof("Pod %s.%s marked as unschedulable can be scheduled on upcoming node %s reserved for it."+
+			" Ignoring in scale up.", pod.Namespace, pod.Name, nodeName)
+		if err := clusterSnapshot.AddPod(pod, nodeName); err != nil {
+			return nil, err
+		}
+		podsFilteredUsingReservations++
+	}
+	klog.V(4).Infof("Filtered out %d pods using reservations", podsFilteredUsingReservations)
+	return remainingPods, nil
+}
+
 func moreImportantPod(pod1, pod2 *apiv1.Pod) bool {
 	// based on schedulers MoreImportantPod but does not compare Pod.Status.StartTime which does not make sense
 	// for unschedulable pods
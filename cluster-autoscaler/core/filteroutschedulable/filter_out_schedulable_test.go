@@ -136,7 +136,7 @@ func TestFilterOutSchedulableByPacking(t *testing.T) {
 				}
 			}
 
-			stillPendingPods, err := filterOutSchedulablePodListProcessor.filterOutSchedulableByPacking(tt.pendingPods, clusterSnapshot, predicateChecker)
+			stillPendingPods, err := filterOutSchedulablePodListProcessor.filterOutSchedulableByPacking(tt.pendingPods, clusterSnapshot, predicateChecker, nil)
 			assert.NoError(t, err)
 			assert.ElementsMatch(t, stillPendingPods, expectedPendingPods, "pending pods differ")
 
@@ -168,7 +168,7 @@ func TestFilterOutSchedulableByPacking(t *testing.T) {
 			err = clusterSnapshot.Fork()
 			assert.NoError(t, err)
 
-			stillPendingPods, err = filterOutSchedulablePodListProcessor.filterOutSchedulableByPacking(tt.pendingPods, clusterSnapshot, predicateChecker)
+			stillPendingPods, err = filterOutSchedulablePodListProcessor.filterOutSchedulableByPacking(tt.pendingPods, clusterSnapshot, predicateChecker, nil)
 			assert.NoError(t, err)
 			assert.ElementsMatch(t, stillPendingPods, expectedPendingPods, "pending pods differ (with hints map)")
 
@@ -176,6 +176,118 @@ func TestFilterOutSchedulableByPacking(t *testing.T) {
 	}
 }
 
+func TestFilterOutSchedulableByPackingWithReservations(t *testing.T) {
+	now := time.Now()
+	var priority100 int32 = 100
+	otherPod := BuildTestPod("other", 1500, 200000)
+	otherPod.Spec.Priority = &priority100
+	reservedPod := BuildTestPod("reserved", 1500, 200000)
+	releasedPod := BuildTestPod("released", 1500, 200000)
+
+	upcomingNode := BuildTestNode("ng1-upcoming", 2000, 2000000)
+	SetNodeReadyState(upcomingNode, true, time.Time{})
+
+	for _, tc := range []struct {
+		name                    string
+		reservedPods            []*apiv1.Pod
+		pendingPods             []*apiv1.Pod
+		expectedFilteredOutPods []*apiv1.Pod
+	}{
+		{
+			name:                    "no reservations",
+			pendingPods:             []*apiv1.Pod{otherPod, reservedPod},
+			expectedFilteredOutPods: []*apiv1.Pod{otherPod},
+		},
+		{
+			name:                    "reserved pod claims upcoming node first",
+			reservedPods:            []*apiv1.Pod{reservedPod},
+			pendingPods:             []*apiv1.Pod{otherPod, reservedPod},
+			expectedFilteredOutPods: []*apiv1.Pod{reservedPod},
+		},
+		{
+			name:                    "reservation of pod no longer pending is released",
+			reservedPods:            []*apiv1.Pod{releasedPod},
+			pendingPods:             []*apiv1.Pod{otherPod, reservedPod},
+			expectedFilteredOutPods: []*apiv1.Pod{otherPod},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			predicateChecker, err := simulator.NewTestPredicateChecker()
+			assert.NoError(t, err)
+			clusterSnapshot := simulator.NewBasicClusterSnapshot()
+			assert.NoError(t, clusterSnapshot.AddNode(upcomingNode))
+
+			podReservations := simulator.NewPodReservations()
+			podReservations.Reserve("ng1", [][]*apiv1.Pod{tc.reservedPods}, now.Add(time.Hour))
+			podReservations.Update(map[string][]string{"ng1": {upcomingNode.Name}}, now)
+
+			processor := NewFilterOutSchedulablePodListProcessor()
+			stillPendingPods, err := processor.filterOutSchedulableByPacking(tc.pendingPods, clusterSnapshot, predicateChecker, podReservations)
+			assert.NoError(t, err)
+
+			var expectedPendingPods []*apiv1.Pod
+			for _, pod := range tc.pendingPods {
+				if !containsPod(tc.expectedFilteredOutPods, pod) {
+					expectedPendingPods = append(expectedPendingPods, pod)
+				}
+			}
+			assert.ElementsMatch(t, expectedPendingPods, stillPendingPods)
+
+			nodeInfo, err := clusterSnapshot.NodeInfos().Get(upcomingNode.Name)
+			assert.NoError(t, err)
+			var podsOnUpcomingNode []*apiv1.Pod
+			for _, podInfo := range nodeInfo.Pods {
+				podsOnUpcomingNode = append(podsOnUpcomingNode, podInfo.Pod)
+			}
+			assert.ElementsMatch(t, tc.expectedFilteredOutPods, podsOnUpcomingNode)
+
+			_, found := podReservations.Get(releasedPod)
+			assert.False(t, found)
+		})
+	}
+}
+
+func TestFilterOutSchedulableByPackingOnReservedNode(t *testing.T) {
+	now := time.Now()
+	reservedPod := BuildTestPod("reserved", 1500, 200000)
+	otherReservedPod := BuildTestPod("other-reserved", 1500, 200000)
+
+	upcomingNode1 := BuildTestNode("ng1-upcoming-1", 2000, 2000000)
+	SetNodeReadyState(upcomingNode1, true, time.Time{})
+	upcomingNode2 := BuildTestNode("ng1-upcoming-2", 2000, 2000000)
+	SetNodeReadyState(upcomingNode2, true, time.Time{})
+
+	predicateChecker, err := simulator.NewTestPredicateChecker()
+	assert.NoError(t, err)
+	clusterSnapshot := simulator.NewBasicClusterSnapshot()
+	assert.NoError(t, clusterSnapshot.AddNode(upcomingNode1))
+	// The upcoming node reserved for the other pod is already full.
+	assert.NoError(t, clusterSnapshot.AddNodeWithPods(upcomingNode2, []*apiv1.Pod{BuildTestPod("filler", 1500, 200000)}))
+
+	podReservations := simulator.NewPodReservations()
+	podReservations.Reserve("ng1", [][]*apiv1.Pod{{reservedPod}, {otherReservedPod}}, now.Add(time.Hour))
+	podReservations.Update(map[string][]string{"ng1": {upcomingNode2.Name, upcomingNode1.Name}}, now)
+
+	// The other pod isn't placed on the upcoming node reserved for reservedPod.
+	stillPendingPods, err := filterOutReservedPods([]*apiv1.Pod{otherReservedPod, reservedPod}, clusterSnapshot, predicateChecker, podReservations)
+	assert.NoError(t, err)
+	assert.Equal(t, []*apiv1.Pod{otherReservedPod}, stillPendingPods)
+
+	nodeInfo, err := clusterSnapshot.NodeInfos().Get(upcomingNode1.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(nodeInfo.Pods))
+	assert.Equal(t, reservedPod, nodeInfo.Pods[0].Pod)
+}
+
+func containsPod(pods []*apiv1.Pod, pod *apiv1.Pod) bool {
+	for _, p := range pods {
+		if p == pod {
+			return true
+		}
+	}
+	return false
+}
+
 func BenchmarkFilterOutSchedulableByPacking(b *testing.B) {
 	// All pending pods in this scenario are unschedulable - predicates will fail.
 	tests := []struct {
@@ -259,7 +371,7 @@ func BenchmarkFilterOutSchedulableByPacking(b *testing.B) {
 
 				for i := 0; i < b.N; i++ {
 					filterOutSchedulablePodListProcessor := NewFilterOutSchedulablePodListProcessor()
-					if stillPending, err := filterOutSchedulablePodListProcessor.filterOutSchedulableByPacking(pendingPods, clusterSnapshot, predicateChecker); err != nil {
+					if stillPending, err := filterOutSchedulablePodListProcessor.filterOutSchedulableByPacking(pendingPods, clusterSnapshot, predicateChecker, nil); err != nil {
 						assert.NoError(b, err)
 					} else if len(stillPending) < tc.pendingPods {
 						assert.Equal(b, len(stillPending), tc.pendingPods)
@@ -0,0 +1,362 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/clusterstate/api"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	"k8s.io/autoscaler/cluster-autoscaler/metrics"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/customresources"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/gpu"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/units"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+
+	klog "k8s.io/klog/v2"
+)
+
+// Names of resources limited by quota groups.
+const (
+	ResourceNodes      = "nodes"
+	ResourceCores      = "cores"
+	ResourceMemory     = "memory"
+	ResourceGpus       = "gpus"
+	ResourceHourlyCost = "hourly_cost"
+)
+
+// Usage is the amount of resources used by a node, a node group or a quota group.
+type Usage struct {
+	Nodes      int
+	Cores      int64
+	Memory     int64
+	Gpus       int64
+	HourlyCost float64
+}
+
+func (u *Usage) add(other Usage, count int) {
+	u.Nodes += other.Nodes * count
+	u.Cores += other.Cores * int64(count)
+	u.Memory += other.Memory * int64(count)
+	u.Gpus += other.Gpus * int64(count)
+	u.HourlyCost += other.HourlyCost * float64(count)
+}
+
+// Group is the state of a quota group.
+type Group struct {
+	config.QuotaGroup
+	// NodeGroups are ids of node groups in the quota group.
+	NodeGroups []string
+	// Usage is the current usage of the quota group, including upcoming nodes.
+	Usage Usage
+	// UnknownNodeGroups are ids of node groups in the quota group whose
+	// target size couldn't be read. While there are any, the usage isn't
+	// known and no nodes are added to the quota group.
+	UnknownNodeGroups []string
+
+	nodeGroupIds      *regexp.Regexp
+	nodeGroupSelector labels.Selector
+}
+
+// newGroup creates the state of a quota group, compiling its node group ids
+// and selector.
+func newGroup(quotaGroup config.QuotaGroup) (*Group, error) {
+	group := &Group{QuotaGroup: quotaGroup}
+	if quotaGroup.NodeGroupIds != "" {
+		re, err := regexp.Compile(quotaGroup.NodeGroupIds)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node group ids of quota group %s: %v", quotaGroup.Name, err)
+		}
+		group.nodeGroupIds = re
+	}
+	if quotaGroup.NodeGroupSelector != "" {
+		selector, err := labels.Parse(quotaGroup.NodeGroupSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node group selector of quota group %s: %v", quotaGroup.Name, err)
+		}
+		group.nodeGroupSelector = selector
+	}
+	return group, nil
+}
+
+// matches returns whether the node group belongs to the quota group.
+func (g *Group) matches(id string, nodeInfo *schedulerframework.NodeInfo) bool {
+	if g.nodeGroupIds != nil && !g.nodeGroupIds.MatchString(id) {
+		return false
+	}
+	if g.nodeGroupSelector != nil {
+		if nodeInfo.Node() == nil || !g.nodeGroupSelector.Matches(labels.Set(nodeInfo.Node().Labels)) {
+			return false
+		}
+	}
+	return true
+}
+
+// exceeded returns resources whose limits would be exceeded by adding count nodes.
+func (g *Group) exceeded(node Usage, count int) []string {
+	usage := g.Usage
+	usage.add(node, count)
+	var exceeded []string
+	if g.MaxNodes > 0 && usage.Nodes > g.MaxNodes {
+		exceeded = append(exceeded, ResourceNodes)
+	}
+	if g.MaxCores > 0 && usage.Cores > g.MaxCores {
+		exceeded = append(exceeded, ResourceCores)
+	}
+	if g.MaxMemory > 0 && usage.Memory > g.MaxMemory {
+		exceeded = append(exceeded, ResourceMemory)
+	}
+	if g.MaxGpus > 0 && usage.Gpus > g.MaxGpus {
+		exceeded = append(exceeded, ResourceGpus)
+	}
+	if g.MaxHourlyCost > 0 && usage.HourlyCost > g.MaxHourlyCost {
+		exceeded = append(exceeded, ResourceHourlyCost)
+	}
+	return exceeded
+}
+
+// Quotas tracks usage of quota groups. A nil Quotas has no quota groups and
+// doesn't limit anything.
+type Quotas struct {
+	groups      []*Group
+	nodeUsage   map[string]Usage
+	memberships map[string][]*Group
+	gpuLabel    string
+	pricing     cloudprovider.PricingModel
+	now         time.Time
+}
+
+// Compute computes the usage of quota groups using the GPU label and the
+// pricing model of the cloud provider, if it has one. It returns nil if there
+// are no quota groups.
+func Compute(quotaGroups []config.QuotaGroup, cloudProvider cloudprovider.CloudProvider, nodeGroups []cloudprovider.NodeGroup, nodeInfos map[string]*schedulerframework.NodeInfo, now time.Time) (*Quotas, error) {
+	if len(quotaGroups) == 0 {
+		return nil, nil
+	}
+	pricing, err := cloudProvider.Pricing()
+	if err != nil {
+		if err != cloudprovider.ErrNotImplemented {
+			klog.Warningf("Failed to get pricing model, node costs are not counted in quotas: %v", err)
+		}
+		pricing = nil
+	}
+	return NewQuotas(quotaGroups, nodeGroups, nodeInfos, cloudProvider.GPULabel(), pricing, now)
+}
+
+// NewQuotas computes the usage of quota groups from target sizes and template
+// node infos of node groups. Node groups without a node info are not counted.
+func NewQuotas(quotaGroups []config.QuotaGroup, nodeGroups []cloudprovider.NodeGroup, nodeInfos map[string]*schedulerframework.NodeInfo, gpuLabel string, pricing cloudprovider.PricingModel, now time.Time) (*Quotas, error) {
+	q := &Quotas{
+		nodeUsage:   make(map[string]Usage),
+		memberships: make(map[string][]*Group),
+		gpuLabel:    gpuLabel,
+		pricing:     pricing,
+		now:         now,
+	}
+	for _, quotaGroup := range quotaGroups {
+		group, err := newGroup(quotaGroup)
+		if err != nil {
+			return nil, err
+		}
+		q.groups = append(q.groups, group)
+	}
+	for _, nodeGroup := range nodeGroups {
+		id := nodeGroup.Id()
+		nodeInfo, found := nodeInfos[id]
+		if !found {
+			continue
+		}
+		q.addNodeGroup(id, nodeGroup, nodeInfo)
+		if len(q.memberships[id]) == 0 {
+			continue
+		}
+		size := 0
+		if nodeGroup.Exist() {
+			targetSize, err := nodeGroup.TargetSize()
+			if err != nil {
+				klog.Warningf("Failed to get target size of %s, usage of its quota groups is unknown: %v", id, err)
+				for _, group := range q.memberships[id] {
+					group.UnknownNodeGroups = append(group.UnknownNodeGroups, id)
+				}
+				continue
+			}
+			size = targetSize
+		}
+		for _, group := range q.memberships[id] {
+			group.Usage.add(q.nodeUsage[id], size)
+		}
+	}
+	return q, nil
+}
+
+// addNodeGroup records quota groups the node group belongs to and the usage
+// of its nodes. The node group is nil if it doesn't exist yet.
+func (q *Quotas) addNodeGroup(id string, nodeGroup cloudprovider.NodeGroup, nodeInfo *schedulerframework.NodeInfo) {
+	q.memberships[id] = nil
+	for _, group := range q.groups {
+		if group.matches(id, nodeInfo) {
+			group.NodeGroups = append(group.NodeGroups, id)
+			q.memberships[id] = append(q.memberships[id], group)
+		}
+	}
+	if len(q.memberships[id]) > 0 {
+		q.nodeUsage[id] = q.usageOf(nodeGroup, nodeInfo)
+	}
+}
+
+// usageOf returns the usage of a node of the node group.
+func (q *Quotas) usageOf(nodeGroup cloudprovider.NodeGroup, nodeInfo *schedulerframework.NodeInfo) Usage {
+	node := nodeInfo.Node()
+	usage := Usage{Nodes: 1}
+	if node == nil {
+		return usage
+	}
+	usage.Cores = node.Status.Capacity.Cpu().Value()
+	usage.Memory = node.Status.Capacity.Memory().Value()
+	usage.Gpus = q.gpus(nodeGroup, node)
+	if q.pricing != nil {
+		now := q.now
+		price, err := q.pricing.NodePrice(node, now, now.Add(time.Hour))
+		if err != nil {
+			klog.Warningf("Failed to get price of %s, its cost is not counted in quotas: %v", node.Name, err)
+		} else {
+			usage.HourlyCost = price
+		}
+	}
+	return usage
+}
+
+// gpus returns the number of GPUs of a node of the node group. Nodes with the
+// GPU label of the cloud provider whose GPUs aren't allocatable yet, like ones
+// node infos are built from before GPU drivers are installed, have as many
+// GPUs as the node group template.
+func (q *Quotas) gpus(nodeGroup cloudprovider.NodeGroup, node *apiv1.Node) int64 {
+	if _, found := node.Labels[q.gpuLabel]; found && q.gpuLabel != "" && nodeGroup != nil {
+		processor := customresources.GpuCustomResourcesProcessor{}
+		target, err := processor.GetNodeGpuTarget(q.gpuLabel, node, nodeGroup)
+		if err == nil {
+			return target.ResourceCount
+		}
+		klog.Warningf("Failed to get GPUs of %s, counting allocatable ones in quotas: %v", nodeGroup.Id(), err)
+	}
+	if gpus, found := node.Status.Capacity[gpu.ResourceNvidiaGPU]; found {
+		return gpus.Value()
+	}
+	return 0
+}
+
+// Exceeded returns messages describing quotas which would be exceeded by
+// adding a node to the node group, or nil if there are none. Node groups
+// which weren't known when the quotas were computed, like node groups which
+// may be autoprovisioned, are matched against quota groups using nodeInfo.
+func (q *Quotas) Exceeded(nodeGroupId string, nodeInfo *schedulerframework.NodeInfo) []string {
+	if q == nil {
+		return nil
+	}
+	if _, found := q.memberships[nodeGroupId]; !found && nodeInfo != nil {
+		q.addNodeGroup(nodeGroupId, nil, nodeInfo)
+	}
+	var messages []string
+	for _, group := range q.memberships[nodeGroupId] {
+		if len(group.UnknownNodeGroups) > 0 {
+			messages = append(messages, fmt.Sprintf("quota group %s usage unknown, failed to get target size of %s", group.Name, strings.Join(group.UnknownNodeGroups, ", ")))
+			continue
+		}
+		if exceeded := group.exceeded(q.nodeUsage[nodeGroupId], 1); len(exceeded) > 0 {
+			messages = append(messages, fmt.Sprintf("quota group %s %s limit reached", group.Name, strings.Join(exceeded, ", ")))
+		}
+	}
+	return messages
+}
+
+// MaxNewNodes returns the number of nodes, up to newNodes, which can be added
+// to the given node groups without exceeding their quotas. Nodes are assumed
+// to be added to any of the node groups, so the most expensive one is counted.
+func (q *Quotas) MaxNewNodes(nodeGroupIds []string, newNodes int) int {
+	if q == nil {
+		return newNodes
+	}
+	for _, id := range nodeGroupIds {
+		for _, group := range q.memberships[id] {
+			if len(group.UnknownNodeGroups) > 0 {
+				return 0
+			}
+			for newNodes > 0 && len(group.exceeded(q.nodeUsage[id], newNodes)) > 0 {
+				newNodes--
+			}
+		}
+	}
+	return newNodes
+}
+
+// Groups returns the state of all quota groups.
+func (q *Quotas) Groups() []*Group {
+	if q == nil {
+		return nil
+	}
+	return q.groups
+}
+
+// Statuses returns the state of all quota groups for the status ConfigMap.
+func (q *Quotas) Statuses() []api.QuotaGroupStatus {
+	var statuses []api.QuotaGroupStatus
+	for _, group := range q.Groups() {
+		statuses = append(statuses, api.QuotaGroupStatus{
+			Name:       group.Name,
+			NodeGroups: group.NodeGroups,
+			Usage:      group.summary(),
+		})
+	}
+	return statuses
+}
+
+// UpdateMetrics records usage and limits of quota groups.
+func (q *Quotas) UpdateMetrics() {
+	metrics.ResetQuotaGroups()
+	for _, group := range q.Groups() {
+		metrics.UpdateQuotaGroup(group.Name, ResourceNodes, float64(group.Usage.Nodes), float64(group.MaxNodes))
+		metrics.UpdateQuotaGroup(group.Name, ResourceCores, float64(group.Usage.Cores), float64(group.MaxCores))
+		metrics.UpdateQuotaGroup(group.Name, ResourceMemory, float64(group.Usage.Memory), float64(group.MaxMemory))
+		metrics.UpdateQuotaGroup(group.Name, ResourceGpus, float64(group.Usage.Gpus), float64(group.MaxGpus))
+		metrics.UpdateQuotaGroup(group.Name, ResourceHourlyCost, group.Usage.HourlyCost, group.MaxHourlyCost)
+	}
+}
+
+// summary returns usage and limits of the quota group as readable strings,
+// keyed by resource name.
+func (g *Group) summary() map[string]string {
+	return map[string]string{
+		ResourceNodes:      fmt.Sprintf("%d/%s", g.Usage.Nodes, limitString(fmt.Sprint(g.MaxNodes), g.MaxNodes > 0)),
+		ResourceCores:      fmt.Sprintf("%d/%s", g.Usage.Cores, limitString(fmt.Sprint(g.MaxCores), g.MaxCores > 0)),
+		ResourceMemory:     fmt.Sprintf("%dGi/%s", g.Usage.Memory/units.GiB, limitString(fmt.Sprintf("%dGi", g.MaxMemory/units.GiB), g.MaxMemory > 0)),
+		ResourceGpus:       fmt.Sprintf("%d/%s", g.Usage.Gpus, limitString(fmt.Sprint(g.MaxGpus), g.MaxGpus > 0)),
+		ResourceHourlyCost: fmt.Sprintf("%.2f/%s", g.Usage.HourlyCost, limitString(fmt.Sprintf("%.2f", g.MaxHourlyCost), g.MaxHourlyCost > 0)),
+	}
+}
+
+func limitString(limit string, set bool) string {
+	if !set {
+		return "unlimited"
+	}
+	return limit
+}
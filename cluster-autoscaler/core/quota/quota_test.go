@@ -0,0 +1,265 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	testprovider "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/test"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/units"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+type testPricingModel struct {
+	hourlyPrice map[string]float64
+}
+
+func (m *testPricingModel) NodePrice(node *apiv1.Node, startTime time.Time, endTime time.Time) (float64, error) {
+	return m.hourlyPrice[node.Labels["pool"]] * endTime.Sub(startTime).Hours(), nil
+}
+
+func (m *testPricingModel) PodPrice(pod *apiv1.Pod, startTime time.Time, endTime time.Time) (float64, error) {
+	return 0, nil
+}
+
+func buildTemplate(name, pool string, cores int64, gpus int64) *schedulerframework.NodeInfo {
+	node := BuildTestNode(name, cores*1000, 4*units.GiB)
+	node.Labels = map[string]string{"pool": pool}
+	if gpus > 0 {
+		AddGpusToNode(node, gpus)
+	}
+	nodeInfo := schedulerframework.NewNodeInfo()
+	nodeInfo.SetNode(node)
+	return nodeInfo
+}
+
+func setUpProvider(pricing bool) (*testprovider.TestCloudProvider, map[string]*schedulerframework.NodeInfo) {
+	provider := testprovider.NewTestCloudProvider(nil, nil)
+	provider.AddNodeGroup("team-a-cpu", 0, 10, 3)
+	provider.AddNodeGroup("team-a-gpu", 0, 10, 1)
+	provider.AddNodeGroup("team-b-cpu", 0, 10, 2)
+	if pricing {
+		provider.SetPricingModel(&testPricingModel{hourlyPrice: map[string]float64{"cpu": 0.5, "gpu": 3}})
+	}
+	nodeInfos := map[string]*schedulerframework.NodeInfo{
+		"team-a-cpu": buildTemplate("a-cpu", "cpu", 4, 0),
+		"team-a-gpu": buildTemplate("a-gpu", "gpu", 8, 2),
+		"team-b-cpu": buildTemplate("b-cpu", "cpu", 4, 0),
+	}
+	return provider, nodeInfos
+}
+
+func TestCompute(t *testing.T) {
+	provider, nodeInfos := setUpProvider(true)
+	quotaGroups := []config.QuotaGroup{
+		{Name: "team-a", NodeGroupIds: "^team-a-", MaxNodes: 10},
+		{Name: "cpu", NodeGroupSelector: "pool=cpu"},
+		{Name: "all"},
+	}
+
+	quotas, err := Compute(quotaGroups, provider, provider.NodeGroups(), nodeInfos, time.Now())
+	assert.NoError(t, err)
+	groups := quotas.Groups()
+	assert.Len(t, groups, 3)
+
+	assert.ElementsMatch(t, []string{"team-a-cpu", "team-a-gpu"}, groups[0].NodeGroups)
+	assert.Equal(t, 4, groups[0].Usage.Nodes)
+	assert.Equal(t, int64(20), groups[0].Usage.Cores)
+	assert.Equal(t, int64(16*units.GiB), groups[0].Usage.Memory)
+	assert.Equal(t, int64(2), groups[0].Usage.Gpus)
+	assert.InDelta(t, 4.5, groups[0].Usage.HourlyCost, 0.001)
+
+	assert.ElementsMatch(t, []string{"team-a-cpu", "team-b-cpu"}, groups[1].NodeGroups)
+	assert.Equal(t, 5, groups[1].Usage.Nodes)
+
+	assert.Len(t, groups[2].NodeGroups, 3)
+	assert.Equal(t, 6, groups[2].Usage.Nodes)
+
+	statuses := quotas.Statuses()
+	assert.Len(t, statuses, 3)
+	assert.Equal(t, "team-a", statuses[0].Name)
+	assert.Equal(t, "4/10", statuses[0].Usage[ResourceNodes])
+	assert.Equal(t, "20/unlimited", statuses[0].Usage[ResourceCores])
+	assert.Equal(t, "4.50/unlimited", statuses[0].Usage[ResourceHourlyCost])
+}
+
+func TestComputeWithoutQuotaGroups(t *testing.T) {
+	provider, nodeInfos := setUpProvider(false)
+	quotas, err := Compute(nil, provider, provider.NodeGroups(), nodeInfos, time.Now())
+	assert.NoError(t, err)
+	assert.Nil(t, quotas)
+
+	exceeded := quotas.Exceeded("team-a-cpu", nodeInfos["team-a-cpu"])
+	assert.Empty(t, exceeded)
+	assert.Equal(t, 5, quotas.MaxNewNodes([]string{"team-a-cpu"}, 5))
+	assert.Empty(t, quotas.Statuses())
+}
+
+func TestComputeInvalidQuotaGroup(t *testing.T) {
+	provider, nodeInfos := setUpProvider(false)
+	_, err := Compute([]config.QuotaGroup{{Name: "bad", NodeGroupIds: "("}}, provider, provider.NodeGroups(), nodeInfos, time.Now())
+	assert.Error(t, err)
+	// Quota groups are validated even if no node group is matched against them.
+	_, err = Compute([]config.QuotaGroup{{Name: "bad", NodeGroupSelector: "pool in (gpu"}}, provider, nil, nodeInfos, time.Now())
+	assert.Error(t, err)
+}
+
+func TestExceeded(t *testing.T) {
+	testCases := []struct {
+		name        string
+		quotaGroup  config.QuotaGroup
+		nodeGroupId string
+		want        []string
+	}{
+		{
+			name:        "within limits",
+			quotaGroup:  config.QuotaGroup{Name: "team-a", NodeGroupIds: "^team-a-", MaxNodes: 5, MaxCores: 100},
+			nodeGroupId: "team-a-cpu",
+		},
+		{
+			name:        "node group not in quota group",
+			quotaGroup:  config.QuotaGroup{Name: "team-a", NodeGroupIds: "^team-a-", MaxNodes: 4},
+			nodeGroupId: "team-b-cpu",
+		},
+		{
+			name:        "nodes and cores limit",
+			quotaGroup:  config.QuotaGroup{Name: "team-a", NodeGroupIds: "^team-a-", MaxNodes: 4, MaxCores: 22},
+			nodeGroupId: "team-a-cpu",
+			want:        []string{"quota group team-a nodes, cores limit reached"},
+		},
+		{
+			name:        "gpu limit only applies to nodes with gpus",
+			quotaGroup:  config.QuotaGroup{Name: "team-a", NodeGroupIds: "^team-a-", MaxGpus: 3},
+			nodeGroupId: "team-a-gpu",
+			want:        []string{"quota group team-a gpus limit reached"},
+		},
+		{
+			name:        "gpu limit doesn't block nodes without gpus",
+			quotaGroup:  config.QuotaGroup{Name: "team-a", NodeGroupIds: "^team-a-", MaxGpus: 2},
+			nodeGroupId: "team-a-cpu",
+		},
+		{
+			name:        "hourly cost limit",
+			quotaGroup:  config.QuotaGroup{Name: "team-a", NodeGroupIds: "^team-a-", MaxHourlyCost: 7},
+			nodeGroupId: "team-a-gpu",
+			want:        []string{"quota group team-a hourly_cost limit reached"},
+		},
+		{
+			name:        "memory limit of a label selected quota group",
+			quotaGroup:  config.QuotaGroup{Name: "cpu", NodeGroupSelector: "pool=cpu", MaxMemory: 20 * units.GiB},
+			nodeGroupId: "team-b-cpu",
+			want:        []string{"quota group cpu memory limit reached"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			provider, nodeInfos := setUpProvider(true)
+			quotas, err := Compute([]config.QuotaGroup{tc.quotaGroup}, provider, provider.NodeGroups(), nodeInfos, time.Now())
+			assert.NoError(t, err)
+			exceeded := quotas.Exceeded(tc.nodeGroupId, nodeInfos[tc.nodeGroupId])
+			assert.Equal(t, tc.want, exceeded)
+		})
+	}
+}
+
+func TestExceededNewNodeGroup(t *testing.T) {
+	provider, nodeInfos := setUpProvider(false)
+	quotas, err := Compute([]config.QuotaGroup{{Name: "gpu", NodeGroupSelector: "pool=gpu", MaxGpus: 2}}, provider, provider.NodeGroups(), nodeInfos, time.Now())
+	assert.NoError(t, err)
+
+	// Node groups which may be autoprovisioned are matched using their template.
+	exceeded := quotas.Exceeded("autoprovisioned-gpu", buildTemplate("new-gpu", "gpu", 8, 1))
+	assert.Equal(t, []string{"quota group gpu gpus limit reached"}, exceeded)
+}
+
+func TestMaxNewNodes(t *testing.T) {
+	provider, nodeInfos := setUpProvider(false)
+	quotaGroups := []config.QuotaGroup{
+		{Name: "team-a", NodeGroupIds: "^team-a-", MaxNodes: 10, MaxCores: 40},
+		{Name: "team-b", NodeGroupIds: "^team-b-", MaxNodes: 5},
+	}
+	quotas, err := Compute(quotaGroups, provider, provider.NodeGroups(), nodeInfos, time.Now())
+	assert.NoError(t, err)
+
+	// 20 of 40 cores are used, so 5 more 4-core nodes fit.
+	assert.Equal(t, 5, quotas.MaxNewNodes([]string{"team-a-cpu"}, 10))
+	// 8-core nodes are counted when scaling up both node groups.
+	assert.Equal(t, 2, quotas.MaxNewNodes([]string{"team-a-cpu", "team-a-gpu"}, 10))
+	assert.Equal(t, 3, quotas.MaxNewNodes([]string{"team-b-cpu"}, 10))
+	assert.Equal(t, 2, quotas.MaxNewNodes([]string{"team-b-cpu"}, 2))
+}
+
+type failingTargetSizeNodeGroup struct {
+	cloudprovider.NodeGroup
+}
+
+func (ng *failingTargetSizeNodeGroup) TargetSize() (int, error) {
+	return 0, fmt.Errorf("cloud provider unavailable")
+}
+
+func TestComputeTargetSizeError(t *testing.T) {
+	provider, nodeInfos := setUpProvider(false)
+	quotaGroups := []config.QuotaGroup{
+		{Name: "team-a", NodeGroupIds: "^team-a-", MaxNodes: 10},
+		{Name: "team-b", NodeGroupIds: "^team-b-", MaxNodes: 5},
+	}
+	var nodeGroups []cloudprovider.NodeGroup
+	for _, nodeGroup := range provider.NodeGroups() {
+		if nodeGroup.Id() == "team-a-gpu" {
+			nodeGroup = &failingTargetSizeNodeGroup{NodeGroup: nodeGroup}
+		}
+		nodeGroups = append(nodeGroups, nodeGroup)
+	}
+	quotas, err := Compute(quotaGroups, provider, nodeGroups, nodeInfos, time.Now())
+	assert.NoError(t, err)
+
+	// Only the quota group of the failing node group is affected.
+	groups := quotas.Groups()
+	assert.Equal(t, []string{"team-a-gpu"}, groups[0].UnknownNodeGroups)
+	exceeded := quotas.Exceeded("team-a-cpu", nil)
+	assert.Equal(t, []string{"quota group team-a usage unknown, failed to get target size of team-a-gpu"}, exceeded)
+	assert.Equal(t, 0, quotas.MaxNewNodes([]string{"team-a-cpu"}, 10))
+
+	assert.Empty(t, groups[1].UnknownNodeGroups)
+	assert.Equal(t, 2, groups[1].Usage.Nodes)
+	assert.Equal(t, 3, quotas.MaxNewNodes([]string{"team-b-cpu"}, 10))
+}
+
+func TestComputeGpusFromTemplate(t *testing.T) {
+	template := buildTemplate("gpu-template", "gpu", 8, 2)
+	template.Node().Labels["TestGPULabel/accelerator"] = "nvidia-tesla-k80"
+	provider := testprovider.NewTestAutoprovisioningCloudProvider(nil, nil, nil, nil, nil,
+		map[string]*schedulerframework.NodeInfo{"gpu": template})
+	provider.AddNodeGroup("gpu", 0, 10, 3)
+
+	// The node info is built from a node whose GPU drivers aren't installed yet.
+	nodeInfo := buildTemplate("gpu-node", "gpu", 8, 0)
+	nodeInfo.Node().Labels["TestGPULabel/accelerator"] = "nvidia-tesla-k80"
+	nodeInfos := map[string]*schedulerframework.NodeInfo{"gpu": nodeInfo}
+
+	quotas, err := Compute([]config.QuotaGroup{{Name: "gpu", MaxGpus: 8}}, provider, provider.NodeGroups(), nodeInfos, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), quotas.Groups()[0].Usage.Gpus)
+	assert.Equal(t, 1, quotas.MaxNewNodes([]string{"gpu"}, 10))
+}
@@ -32,15 +32,20 @@ import (
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
 	"k8s.io/autoscaler/cluster-autoscaler/clusterstate"
 	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/core/quota"
+	"k8s.io/autoscaler/cluster-autoscaler/estimator"
 	"k8s.io/autoscaler/cluster-autoscaler/expander"
 	"k8s.io/autoscaler/cluster-autoscaler/metrics"
 	ca_processors "k8s.io/autoscaler/cluster-autoscaler/processors"
 	"k8s.io/autoscaler/cluster-autoscaler/processors/nodegroups"
 	"k8s.io/autoscaler/cluster-autoscaler/processors/nodegroupset"
 	"k8s.io/autoscaler/cluster-autoscaler/processors/status"
+	"k8s.io/autoscaler/cluster-autoscaler/tracing"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/gpu"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/klogx"
+	pod_utils "k8s.io/autoscaler/cluster-autoscaler/utils/pod"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/podgroup"
 	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
 
 	klog "k8s.io/klog/v2"
@@ -257,17 +262,24 @@ var (
 	backoffReason         = &skippedReasons{[]string{"in backoff after failed scale-up"}}
 	maxLimitReachedReason = &skippedReasons{[]string{"max node group size reached"}}
 	notReadyReason        = &skippedReasons{[]string{"not ready for scale-up"}}
+	notSelectedReason     = &skippedReasons{[]string{"not selected by pod's node group selector"}}
 )
 
 func maxResourceLimitReached(resources []string) *skippedReasons {
 	return &skippedReasons{[]string{fmt.Sprintf("max cluster %s limit reached", strings.Join(resources, ", "))}}
 }
 
-func computeExpansionOption(context *context.AutoscalingContext, podEquivalenceGroups []*podEquivalenceGroup, nodeGroup cloudprovider.NodeGroup, nodeInfo *schedulerframework.NodeInfo, upcomingNodes []*schedulerframework.NodeInfo) (expander.Option, error) {
+func quotaExceeded(messages []string) *skippedReasons {
+	return &skippedReasons{messages}
+}
+
+func computeExpansionOption(context *context.AutoscalingContext, podEquivalenceGroups []*podEquivalenceGroup, pendingPodGroups map[string]*podgroup.Members, nodeGroup cloudprovider.NodeGroup, nodeInfo *schedulerframework.NodeInfo, upcomingNodes []*schedulerframework.NodeInfo) (expander.Option, error) {
 	option := expander.Option{
 		NodeGroup: nodeGroup,
 		Pods:      make([]*apiv1.Pod, 0),
 	}
+	span := tracing.Start("ComputeExpansionOption", tracing.String("node_group", nodeGroup.Id()), tracing.Int("pod_groups", len(podEquivalenceGroups)))
+	defer span.End()
 
 	if err := context.ClusterSnapshot.Fork(); err != nil {
 		klog.Errorf("Error while calling ClusterSnapshot.Fork; %v", err)
@@ -291,6 +303,11 @@ func computeExpansionOption(context *context.AutoscalingContext, podEquivalenceG
 
 	for _, eg := range podEquivalenceGroups {
 		samplePod := eg.pods[0]
+		if !pod_utils.MayScaleUpNodeGroup(samplePod, nodeInfo.Node()) {
+			klog.V(2).Infof("Pod %s can't trigger scale-up of %s, which is not selected by its node group selector", samplePod.Name, nodeGroup.Id())
+			eg.schedulingErrors[nodeGroup.Id()] = notSelectedReason
+			continue
+		}
 		if err := context.PredicateChecker.CheckPredicates(context.ClusterSnapshot, samplePod, nodeInfo.Node().Name); err == nil {
 			// add pods to option
 			option.Pods = append(option.Pods, eg.pods...)
@@ -311,9 +328,15 @@ func computeExpansionOption(context *context.AutoscalingContext, podEquivalenceG
 	}
 
 	if len(option.Pods) > 0 {
-		estimator := context.EstimatorBuilder(context.PredicateChecker, context.ClusterSnapshot)
-		option.NodeCount = estimator.Estimate(option.Pods, nodeInfo)
+		nodeEstimator := context.EstimatorBuilder(context.PredicateChecker, context.ClusterSnapshot)
+		if placementEstimator, ok := nodeEstimator.(estimator.PlacementEstimator); ok {
+			option.PodsPerNode = placementEstimator.EstimatePlacement(option.Pods, nodeInfo)
+			option.NodeCount = limitToCompletePodGroups(context, &option, pendingPodGroups, nodeInfo, len(option.PodsPerNode))
+		} else {
+			option.NodeCount = nodeEstimator.Estimate(option.Pods, nodeInfo)
+		}
 	}
+	span.SetAttributes(tracing.Int("pods", len(option.Pods)), tracing.Int("node_count", option.NodeCount))
 
 	return option, nil
 }
@@ -339,25 +362,13 @@ func ScaleUp(context *context.AutoscalingContext, processors *ca_processors.Auto
 	}
 	klogx.V(1).Over(loggingQuota).Infof("%v other pods are also unschedulable", -loggingQuota.Left())
 
-	nodesFromNotAutoscaledGroups, err := utils.FilterOutNodesFromNotAutoscaledGroups(nodes, context.CloudProvider)
-	if err != nil {
-		return scaleUpError(&status.ScaleUpStatus{}, err.AddPrefix("failed to filter out nodes which are from not autoscaled groups: "))
-	}
-
 	nodeGroups := context.CloudProvider.NodeGroups()
 	gpuLabel := context.CloudProvider.GPULabel()
 	availableGPUTypes := context.CloudProvider.GetAvailableGPUTypes()
 
-	resourceLimiter, errCP := context.CloudProvider.GetResourceLimiter()
-	if errCP != nil {
-		return scaleUpError(&status.ScaleUpStatus{}, errors.ToAutoscalerError(
-			errors.CloudProviderError,
-			errCP))
-	}
-
-	scaleUpResourcesLeft, errLimits := computeScaleUpResourcesLeftLimits(context, processors, nodeGroups, nodeInfos, nodesFromNotAutoscaledGroups, resourceLimiter)
-	if errLimits != nil {
-		return scaleUpError(&status.ScaleUpStatus{}, errLimits.AddPrefix("Could not compute total resources: "))
+	limits, err := computeScaleUpLimits(context, processors, clusterStateRegistry, nodes, nodeGroups, nodeInfos, now)
+	if err != nil {
+		return scaleUpError(&status.ScaleUpStatus{}, err)
 	}
 
 	upcomingNodes := make([]*schedulerframework.NodeInfo, 0)
@@ -386,6 +397,10 @@ func ScaleUp(context *context.AutoscalingContext, processors *ca_processors.Auto
 	}
 
 	podEquivalenceGroups := buildPodEquivalenceGroups(unschedulablePods)
+	var pendingPodGroups map[string]*podgroup.Members
+	if context.PodGroupFinder != nil {
+		pendingPodGroups = context.PodGroupFinder.Group(unschedulablePods)
+	}
 
 	skippedNodeGroups := map[string]status.Reasons{}
 	for _, nodeGroup := range nodeGroups {
@@ -421,20 +436,18 @@ func ScaleUp(context *context.AutoscalingContext, processors *ca_processors.Auto
 			continue
 		}
 
-		scaleUpResourcesDelta, err := computeScaleUpResourcesDelta(context, processors, nodeInfo, nodeGroup, resourceLimiter)
+		skipReason, err := limits.skipReason(nodeGroup, nodeInfo)
 		if err != nil {
 			klog.Errorf("Skipping node group %s; error getting node group resources: %v", nodeGroup.Id(), err)
 			skippedNodeGroups[nodeGroup.Id()] = notReadyReason
 			continue
 		}
-		checkResult := scaleUpResourcesLeft.checkScaleUpDeltaWithinLimits(scaleUpResourcesDelta)
-		if checkResult.exceeded {
-			klog.V(4).Infof("Skipping node group %s; maximal limit exceeded for %v", nodeGroup.Id(), checkResult.exceededResources)
-			skippedNodeGroups[nodeGroup.Id()] = maxResourceLimitReached(checkResult.exceededResources)
+		if skipReason != nil {
+			skippedNodeGroups[nodeGroup.Id()] = skipReason
 			continue
 		}
 
-		option, err := computeExpansionOption(context, podEquivalenceGroups, nodeGroup, nodeInfo, upcomingNodes)
+		option, err := computeExpansionOption(context, podEquivalenceGroups, pendingPodGroups, nodeGroup, nodeInfo, upcomingNodes)
 		if err != nil {
 			return scaleUpError(&status.ScaleUpStatus{}, errors.ToAutoscalerError(errors.InternalError, err))
 		}
@@ -463,7 +476,12 @@ func ScaleUp(context *context.AutoscalingContext, processors *ca_processors.Auto
 	for _, o := range expansionOptions {
 		options = append(options, o)
 	}
+	span := tracing.Start("Expander", tracing.Int("options", len(options)))
 	bestOption := context.ExpanderStrategy.BestOption(options, nodeInfos)
+	if bestOption != nil {
+		span.SetAttributes(tracing.String("node_group", bestOption.NodeGroup.Id()), tracing.Int("node_count", bestOption.NodeCount))
+	}
+	span.End()
 	if bestOption != nil && bestOption.NodeCount > 0 {
 		klog.V(1).Infof("Best option to resize: %s", bestOption.NodeGroup.Id())
 		if len(bestOption.Debug) > 0 {
@@ -473,9 +491,9 @@ func ScaleUp(context *context.AutoscalingContext, processors *ca_processors.Auto
 
 		newNodes := bestOption.NodeCount
 
-		if context.MaxNodesTotal > 0 && len(nodes)+newNodes+len(upcomingNodes) > context.MaxNodesTotal {
+		if totalNewNodes := limits.capToMaxNodesTotal(newNodes); totalNewNodes < newNodes {
 			klog.V(1).Infof("Capping size to max cluster total size (%d)", context.MaxNodesTotal)
-			newNodes = context.MaxNodesTotal - len(nodes) - len(upcomingNodes)
+			newNodes = totalNewNodes
 			context.LogRecorder.Eventf(apiv1.EventTypeWarning, "MaxNodesTotalReached", "Max total nodes in cluster reached: %v", context.MaxNodesTotal)
 			if newNodes < 1 {
 				return scaleUpError(&status.ScaleUpStatus{PodsTriggeredScaleUp: bestOption.Pods},
@@ -519,7 +537,7 @@ func ScaleUp(context *context.AutoscalingContext, processors *ca_processors.Auto
 				}
 				nodeInfos[nodeGroup.Id()] = nodeInfo
 
-				option, err2 := computeExpansionOption(context, podEquivalenceGroups, nodeGroup, nodeInfo, upcomingNodes)
+				option, err2 := computeExpansionOption(context, podEquivalenceGroups, pendingPodGroups, nodeGroup, nodeInfo, upcomingNodes)
 				if err2 != nil {
 					return scaleUpError(&status.ScaleUpStatus{PodsTriggeredScaleUp: bestOption.Pods}, errors.ToAutoscalerError(errors.InternalError, err))
 				}
@@ -548,7 +566,7 @@ func ScaleUp(context *context.AutoscalingContext, processors *ca_processors.Auto
 		}
 
 		// apply upper limits for CPU and memory
-		newNodes, err = applyScaleUpResourcesLimits(context, processors, newNodes, scaleUpResourcesLeft, nodeInfo, bestOption.NodeGroup, resourceLimiter)
+		newNodes, err = limits.capToResources(newNodes, bestOption.NodeGroup, nodeInfo)
 		if err != nil {
 			return scaleUpError(
 				&status.ScaleUpStatus{CreateNodeGroupResults: createNodeGroupResults, PodsTriggeredScaleUp: bestOption.Pods},
@@ -556,6 +574,8 @@ func ScaleUp(context *context.AutoscalingContext, processors *ca_processors.Auto
 		}
 
 		targetNodeGroups := []cloudprovider.NodeGroup{bestOption.NodeGroup}
+		zoneAwareProcessor, balanceByZone := processors.NodeGroupSetProcessor.(nodegroupset.ZoneAwareNodeGroupSetProcessor)
+		balanceByZone = balanceByZone && context.BalanceSimilarNodeGroups && context.BalanceSimilarNodeGroupsByZone
 		if context.BalanceSimilarNodeGroups {
 			similarNodeGroups, typedErr := processors.NodeGroupSetProcessor.FindSimilarNodeGroups(context, bestOption.NodeGroup, nodeInfos)
 			if typedErr != nil {
@@ -563,7 +583,11 @@ func ScaleUp(context *context.AutoscalingContext, processors *ca_processors.Auto
 					&status.ScaleUpStatus{CreateNodeGroupResults: createNodeGroupResults, PodsTriggeredScaleUp: bestOption.Pods},
 					typedErr.AddPrefix("Failed to find matching node groups: "))
 			}
-			similarNodeGroups = filterNodeGroupsByPods(similarNodeGroups, bestOption.Pods, expansionOptions)
+			if balanceByZone {
+				similarNodeGroups = filterNodeGroupsByAnyPod(similarNodeGroups, bestOption.Pods, expansionOptions)
+			} else {
+				similarNodeGroups = filterNodeGroupsByPods(similarNodeGroups, bestOption.Pods, expansionOptions)
+			}
 			for _, ng := range similarNodeGroups {
 				if clusterStateRegistry.IsNodeGroupSafeToScaleUp(ng, now) {
 					targetNodeGroups = append(targetNodeGroups, ng)
@@ -585,8 +609,57 @@ func ScaleUp(context *context.AutoscalingContext, processors *ca_processors.Auto
 				klog.V(1).Infof("Splitting scale-up between %v similar node groups: {%v}", len(targetNodeGroups), buffer.String())
 			}
 		}
-		scaleUpInfos, typedErr := processors.NodeGroupSetProcessor.BalanceScaleUpBetweenGroups(
-			context, targetNodeGroups, newNodes)
+		targetNodeGroupIds := make([]string, 0, len(targetNodeGroups))
+		for _, ng := range targetNodeGroups {
+			targetNodeGroupIds = append(targetNodeGroupIds, ng.Id())
+		}
+		if quotaNewNodes := limits.capToQuotas(targetNodeGroupIds, newNodes); quotaNewNodes < newNodes {
+			klog.V(1).Infof("Capping size to %d to stay within quotas", quotaNewNodes)
+			newNodes = quotaNewNodes
+			if newNodes < 1 {
+				return scaleUpError(
+					&status.ScaleUpStatus{CreateNodeGroupResults: createNodeGroupResults, PodsTriggeredScaleUp: bestOption.Pods},
+					errors.NewAutoscalerError(errors.TransientError, "quota limits reached"))
+			}
+		}
+		if completeNewNodes := limitToCompletePodGroups(context, bestOption, pendingPodGroups, nodeInfo, newNodes); completeNewNodes < newNodes {
+			klog.V(1).Infof("Capping size to %d to scale up only for complete pod groups", completeNewNodes)
+			newNodes = completeNewNodes
+			if newNodes < 1 {
+				return scaleUpError(
+					&status.ScaleUpStatus{CreateNodeGroupResults: createNodeGroupResults, PodsTriggeredScaleUp: bestOption.Pods},
+					errors.NewAutoscalerError(errors.TransientError, "no complete pod group fits within limits"))
+			}
+		}
+
+		balance := func(newNodes int) ([]nodegroupset.ScaleUpInfo, errors.AutoscalerError) {
+			if balanceByZone && len(targetNodeGroups) > 1 {
+				podsPerGroup := podsFittingNodeGroups(targetNodeGroups, bestOption.Pods, expansionOptions)
+				return zoneAwareProcessor.BalanceScaleUpBetweenZones(
+					context, targetNodeGroups, nodeInfos, podsPerGroup, newNodes)
+			}
+			return processors.NodeGroupSetProcessor.BalanceScaleUpBetweenGroups(
+				context, targetNodeGroups, newNodes)
+		}
+		scaleUpInfos, typedErr := balance(newNodes)
+		if typedErr == nil {
+			// Balancing caps the scale-up at max sizes of node groups, which may leave pod groups incomplete.
+			plannedNewNodes := 0
+			for _, info := range scaleUpInfos {
+				plannedNewNodes += info.NewSize - info.CurrentSize
+			}
+			if plannedNewNodes < newNodes {
+				if completeNewNodes := limitToCompletePodGroups(context, bestOption, pendingPodGroups, nodeInfo, plannedNewNodes); completeNewNodes < plannedNewNodes {
+					klog.V(1).Infof("Capping size to %d to scale up only for complete pod groups", completeNewNodes)
+					if completeNewNodes < 1 {
+						return scaleUpError(
+							&status.ScaleUpStatus{CreateNodeGroupResults: createNodeGroupResults, PodsTriggeredScaleUp: bestOption.Pods},
+							errors.NewAutoscalerError(errors.TransientError, "no complete pod group fits within limits"))
+					}
+					scaleUpInfos, typedErr = balance(completeNewNodes)
+				}
+			}
+		}
 		if typedErr != nil {
 			return scaleUpError(
 				&status.ScaleUpStatus{CreateNodeGroupResults: createNodeGroupResults, PodsTriggeredScaleUp: bestOption.Pods},
@@ -607,6 +680,8 @@ func ScaleUp(context *context.AutoscalingContext, processors *ca_processors.Auto
 			}
 		}
 
+		reservePods(context, bestOption.NodeGroup.Id(), bestOption.PodsPerNode, scaleUpInfos, now)
+
 		clusterStateRegistry.Recalculate()
 		return &status.ScaleUpStatus{
 			Result:                  status.ScaleUpSuccessful,
@@ -626,6 +701,73 @@ func ScaleUp(context *context.AutoscalingContext, processors *ca_processors.Auto
 	}, nil
 }
 
+// reservePods reserves nodes added by scale-up to the given node group for pods
+// the estimator packed on them. The estimator packed pods on nodes of that node
+// group's template only, so nodes added to other node groups while balancing,
+// e.g. in other zones, aren't reserved. Pods on nodes which weren't added, e.g.
+// due to resource limits, aren't reserved either.
+func reservePods(context *context.AutoscalingContext, nodeGroupId string, podsPerNode [][]*apiv1.Pod, scaleUpInfos []nodegroupset.ScaleUpInfo, now time.Time) {
+	if context.PodReservations == nil {
+		return
+	}
+	for _, info := range scaleUpInfos {
+		if info.Group.Id() != nodeGroupId {
+			continue
+		}
+		delta := info.NewSize - info.CurrentSize
+		if delta > len(podsPerNode) {
+			delta = len(podsPerNode)
+		}
+		context.PodReservations.Reserve(nodeGroupId, podsPerNode[:delta], now.Add(context.MaxNodeProvisionTime))
+	}
+}
+
+// limitToCompletePodGroups removes pods of pod groups which wouldn't all be
+// scheduled on the first newNodes nodes of the option from it, and returns
+// the number of nodes needed by the remaining pods. Remaining pods are packed
+// again, as they may need fewer nodes without the removed ones. Pods of a pod
+// group spanning several options, or which the estimator couldn't place,
+// never trigger scale-up. Options without placement of pods on nodes aren't
+// limited.
+func limitToCompletePodGroups(context *context.AutoscalingContext, option *expander.Option, pendingPodGroups map[string]*podgroup.Members, nodeInfo *schedulerframework.NodeInfo, newNodes int) int {
+	if len(pendingPodGroups) == 0 || option.PodsPerNode == nil {
+		return newNodes
+	}
+	placementEstimator, ok := context.EstimatorBuilder(context.PredicateChecker, context.ClusterSnapshot).(estimator.PlacementEstimator)
+	if !ok {
+		return newNodes
+	}
+	for {
+		if newNodes > len(option.PodsPerNode) {
+			newNodes = len(option.PodsPerNode)
+		}
+		scheduled := make(map[string]int)
+		for _, pods := range option.PodsPerNode[:newNodes] {
+			for _, pod := range pods {
+				if podGroup, found := context.PodGroupFinder.PodGroup(pod); found {
+					scheduled[podGroup.Key()]++
+				}
+			}
+		}
+		var pods []*apiv1.Pod
+		for _, pod := range option.Pods {
+			if podGroup, found := context.PodGroupFinder.PodGroup(pod); found {
+				if members, found := pendingPodGroups[podGroup.Key()]; found && scheduled[podGroup.Key()] < len(members.Pods) {
+					klog.V(4).Infof("Pod %s/%s belongs to a pod group which doesn't fit %s entirely, ignoring it in scale-up", pod.Namespace, pod.Name, option.NodeGroup.Id())
+					continue
+				}
+			}
+			pods = append(pods, pod)
+		}
+		if len(pods) == len(option.Pods) {
+			option.PodsPerNode = option.PodsPerNode[:newNodes]
+			return newNodes
+		}
+		option.Pods = pods
+		option.PodsPerNode = placementEstimator.EstimatePlacement(pods, nodeInfo)
+	}
+}
+
 func getRemainingPods(egs []*podEquivalenceGroup, skipped map[string]status.Reasons) []status.NoScaleUpInfo {
 	remaining := []status.NoScaleUpInfo{}
 	for _, eg := range egs {
@@ -687,6 +829,52 @@ groupsloop:
 	return result
 }
 
+// filterNodeGroupsByAnyPod returns the groups which can fit at least one of
+// the given pods.
+func filterNodeGroupsByAnyPod(
+	groups []cloudprovider.NodeGroup,
+	pods []*apiv1.Pod,
+	expansionOptions map[string]expander.Option) []cloudprovider.NodeGroup {
+
+	podsPerGroup := podsFittingNodeGroups(groups, pods, expansionOptions)
+	result := make([]cloudprovider.NodeGroup, 0)
+	for _, group := range groups {
+		if len(podsPerGroup[group.Id()]) > 0 {
+			result = append(result, group)
+		} else {
+			klog.V(1).Infof("Group %v can't fit any of the pods, removing from scale-up consideration", group.Id())
+		}
+	}
+	return result
+}
+
+// podsFittingNodeGroups returns, for each group, the subset of given pods which
+// can fit on a node from that group.
+func podsFittingNodeGroups(
+	groups []cloudprovider.NodeGroup,
+	pods []*apiv1.Pod,
+	expansionOptions map[string]expander.Option) map[string][]*apiv1.Pod {
+
+	podSet := make(map[*apiv1.Pod]bool, len(pods))
+	for _, pod := range pods {
+		podSet[pod] = true
+	}
+	result := make(map[string][]*apiv1.Pod, len(groups))
+	for _, group := range groups {
+		option, found := expansionOptions[group.Id()]
+		if !found {
+			klog.V(1).Infof("No info about pods passing predicates found for group %v, skipping it from scale-up consideration", group.Id())
+			continue
+		}
+		for _, pod := range option.Pods {
+			if podSet[pod] {
+				result[group.Id()] = append(result[group.Id()], pod)
+			}
+		}
+	}
+	return result
+}
+
 func executeScaleUp(context *context.AutoscalingContext, clusterStateRegistry *clusterstate.ClusterStateRegistry, info nodegroupset.ScaleUpInfo, gpuType string, now time.Time) errors.AutoscalerError {
 	klog.V(0).Infof("Scale-up: setting group %s size to %d", info.Group.Id(), info.NewSize)
 	context.LogRecorder.Eventf(apiv1.EventTypeNormal, "ScaledUpGroup",
@@ -703,6 +891,7 @@ func executeScaleUp(context *context.AutoscalingContext, clusterStateRegistry *c
 		increase,
 		time.Now())
 	metrics.RegisterScaleUp(increase, gpuType)
+	metrics.RegisterNodeGroupScaleUp(info.Group.Id(), increase)
 	context.LogRecorder.Eventf(apiv1.EventTypeNormal, "ScaledUpGroup",
 		"Scale-up: group %s size set to %d instead of %d (max: %d)", info.Group.Id(), info.NewSize, info.CurrentSize, info.MaxSize)
 	return nil
@@ -750,6 +939,148 @@ func applyScaleUpResourcesLimits(
 	return newNodes, nil
 }
 
+// scaleUpLimits are limits of scale-ups shared by all node groups: the max
+// total number of nodes, the cluster-wide resource limits and the quotas.
+type scaleUpLimits struct {
+	context         *context.AutoscalingContext
+	processors      *ca_processors.AutoscalingProcessors
+	resourceLimiter *cloudprovider.ResourceLimiter
+	resourcesLeft   scaleUpResourcesLimits
+	quotas          *quota.Quotas
+	// nodesTotal is the number of nodes, including upcoming ones, counted
+	// against the max total number of nodes.
+	nodesTotal int
+}
+
+// computeScaleUpLimits computes how much the cluster can grow from the given
+// nodes and the upcoming nodes of the cluster state.
+func computeScaleUpLimits(context *context.AutoscalingContext, processors *ca_processors.AutoscalingProcessors, clusterStateRegistry *clusterstate.ClusterStateRegistry,
+	nodes []*apiv1.Node, nodeGroups []cloudprovider.NodeGroup, nodeInfos map[string]*schedulerframework.NodeInfo, now time.Time) (*scaleUpLimits, errors.AutoscalerError) {
+	nodesFromNotAutoscaledGroups, typedErr := utils.FilterOutNodesFromNotAutoscaledGroups(nodes, context.CloudProvider)
+	if typedErr != nil {
+		return nil, typedErr.AddPrefix("failed to filter out nodes which are from not autoscaled groups: ")
+	}
+	resourceLimiter, err := context.CloudProvider.GetResourceLimiter()
+	if err != nil {
+		return nil, errors.ToAutoscalerError(errors.CloudProviderError, err)
+	}
+	resourcesLeft, typedErr := computeScaleUpResourcesLeftLimits(context, processors, nodeGroups, nodeInfos, nodesFromNotAutoscaledGroups, resourceLimiter)
+	if typedErr != nil {
+		return nil, typedErr.AddPrefix("Could not compute total resources: ")
+	}
+	quotas, err := quota.Compute(context.QuotaGroups, context.CloudProvider, nodeGroups, nodeInfos, now)
+	if err != nil {
+		return nil, errors.ToAutoscalerError(errors.InternalError, err).AddPrefix("Could not compute quota usage: ")
+	}
+	nodesTotal := len(nodes)
+	for _, count := range clusterStateRegistry.GetUpcomingNodes() {
+		nodesTotal += count
+	}
+	return &scaleUpLimits{
+		context:         context,
+		processors:      processors,
+		resourceLimiter: resourceLimiter,
+		resourcesLeft:   resourcesLeft,
+		quotas:          quotas,
+		nodesTotal:      nodesTotal,
+	}, nil
+}
+
+// skipReason returns why no node can be added to the node group within the
+// resource limits and the quotas, or nil if one can.
+func (l *scaleUpLimits) skipReason(nodeGroup cloudprovider.NodeGroup, nodeInfo *schedulerframework.NodeInfo) (status.Reasons, errors.AutoscalerError) {
+	scaleUpResourcesDelta, err := computeScaleUpResourcesDelta(l.context, l.processors, nodeInfo, nodeGroup, l.resourceLimiter)
+	if err != nil {
+		return nil, err
+	}
+	if checkResult := l.resourcesLeft.checkScaleUpDeltaWithinLimits(scaleUpResourcesDelta); checkResult.exceeded {
+		klog.V(4).Infof("Skipping node group %s; maximal limit exceeded for %v", nodeGroup.Id(), checkResult.exceededResources)
+		return maxResourceLimitReached(checkResult.exceededResources), nil
+	}
+	if exceededQuotas := l.quotas.Exceeded(nodeGroup.Id(), nodeInfo); len(exceededQuotas) > 0 {
+		klog.V(4).Infof("Skipping node group %s; %s", nodeGroup.Id(), strings.Join(exceededQuotas, "; "))
+		return quotaExceeded(exceededQuotas), nil
+	}
+	return nil, nil
+}
+
+// capToMaxNodesTotal returns the number of nodes, up to newNodes, which can be
+// added without exceeding the max total number of nodes.
+func (l *scaleUpLimits) capToMaxNodesTotal(newNodes int) int {
+	if l.context.MaxNodesTotal > 0 && l.nodesTotal+newNodes > l.context.MaxNodesTotal {
+		return l.context.MaxNodesTotal - l.nodesTotal
+	}
+	return newNodes
+}
+
+// capToResources returns the number of nodes, up to newNodes, which can be
+// added to the node group without exceeding the cluster-wide resource limits.
+func (l *scaleUpLimits) capToResources(newNodes int, nodeGroup cloudprovider.NodeGroup, nodeInfo *schedulerframework.NodeInfo) (int, errors.AutoscalerError) {
+	return applyScaleUpResourcesLimits(l.context, l.processors, newNodes, l.resourcesLeft, nodeInfo, nodeGroup, l.resourceLimiter)
+}
+
+// capToQuotas returns the number of nodes, up to newNodes, which can be added
+// to any of the node groups without exceeding their quotas.
+func (l *scaleUpLimits) capToQuotas(nodeGroupIds []string, newNodes int) int {
+	return l.quotas.MaxNewNodes(nodeGroupIds, newNodes)
+}
+
+// maxScaleUp returns the number of nodes, up to newNodes, which can be added
+// to the node group within the limits ScaleUp applies: the max size of the
+// node group and the limits shared by all node groups.
+func maxScaleUp(context *context.AutoscalingContext, processors *ca_processors.AutoscalingProcessors, clusterStateRegistry *clusterstate.ClusterStateRegistry,
+	nodes []*apiv1.Node, nodeGroup cloudprovider.NodeGroup, nodeInfos map[string]*schedulerframework.NodeInfo, newNodes int, now time.Time) (int, errors.AutoscalerError) {
+	nodeInfo, found := nodeInfos[nodeGroup.Id()]
+	if !found {
+		return 0, errors.NewAutoscalerError(errors.InternalError, "no node info for %s", nodeGroup.Id())
+	}
+	currentTargetSize, err := nodeGroup.TargetSize()
+	if err != nil {
+		return 0, errors.ToAutoscalerError(errors.CloudProviderError, err).AddPrefix("failed to get node group size: ")
+	}
+	if maxNewNodes := nodeGroup.MaxSize() - currentTargetSize; newNodes > maxNewNodes {
+		newNodes = maxNewNodes
+	}
+	limits, typedErr := computeScaleUpLimits(context, processors, clusterStateRegistry, nodes, context.CloudProvider.NodeGroups(), nodeInfos, now)
+	if typedErr != nil {
+		return 0, typedErr
+	}
+	newNodes = limits.capToMaxNodesTotal(newNodes)
+	if newNodes < 1 {
+		return 0, nil
+	}
+	skipReason, typedErr := limits.skipReason(nodeGroup, nodeInfo)
+	if typedErr != nil {
+		return 0, typedErr
+	}
+	if skipReason != nil {
+		return 0, nil
+	}
+	newNodes, typedErr = limits.capToResources(newNodes, nodeGroup, nodeInfo)
+	if typedErr != nil {
+		return 0, typedErr
+	}
+	return limits.capToQuotas([]string{nodeGroup.Id()}, newNodes), nil
+}
+
+// consolidationScaleUpLimiter applies the limits of ScaleUp to scale-ups
+// started by consolidations.
+type consolidationScaleUpLimiter struct {
+	context              *context.AutoscalingContext
+	processors           *ca_processors.AutoscalingProcessors
+	clusterStateRegistry *clusterstate.ClusterStateRegistry
+}
+
+// MaxNewNodes implements consolidation.ScaleUpLimiter.
+func (l *consolidationScaleUpLimiter) MaxNewNodes(nodeGroup cloudprovider.NodeGroup, nodeInfos map[string]*schedulerframework.NodeInfo,
+	newNodes int, currentTime time.Time) (int, errors.AutoscalerError) {
+	nodes, err := l.context.ReadyNodeLister().List()
+	if err != nil {
+		return 0, errors.ToAutoscalerError(errors.ApiCallError, err).AddPrefix("failed to list ready nodes: ")
+	}
+	return maxScaleUp(l.context, l.processors, l.clusterStateRegistry, nodes, nodeGroup, nodeInfos, newNodes, currentTime)
+}
+
 func scaleUpError(s *status.ScaleUpStatus, err errors.AutoscalerError) (*status.ScaleUpStatus, errors.AutoscalerError) {
 	s.ScaleUpError = &err
 	s.Result = status.ScaleUpError
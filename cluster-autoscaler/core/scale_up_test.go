@@ -30,6 +30,7 @@ import (
 	testprovider "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/test"
 	"k8s.io/autoscaler/cluster-autoscaler/clusterstate"
 	"k8s.io/autoscaler/cluster-autoscaler/config"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
 	. "k8s.io/autoscaler/cluster-autoscaler/core/test"
 	"k8s.io/autoscaler/cluster-autoscaler/core/utils"
 	"k8s.io/autoscaler/cluster-autoscaler/estimator"
@@ -37,8 +38,11 @@ import (
 	"k8s.io/autoscaler/cluster-autoscaler/processors/nodegroupset"
 	"k8s.io/autoscaler/cluster-autoscaler/processors/nodeinfosprovider"
 	"k8s.io/autoscaler/cluster-autoscaler/processors/status"
+	"k8s.io/autoscaler/cluster-autoscaler/simulator"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
 	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
+	pod_utils "k8s.io/autoscaler/cluster-autoscaler/utils/pod"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/podgroup"
 	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/units"
 	kube_record "k8s.io/client-go/tools/record"
@@ -402,6 +406,36 @@ func TestWillConsiderAllPoolsWhichFitTwoPodsRequiringGpus(t *testing.T) {
 	simpleScaleUpTest(t, config, results)
 }
 
+func TestScaleUpCapToQuotaGroupLimit(t *testing.T) {
+	options := defaultOptions
+	options.QuotaGroups = []config.QuotaGroup{{Name: "team", NodeGroupIds: "^ng2$", MaxCores: 12}}
+	config := &ScaleTestConfig{
+		Nodes: []NodeConfig{
+			{"n1", 2000, 100 * utils.MiB, 0, true, "ng1"},
+			{"n2", 4000, 1000 * utils.MiB, 0, true, "ng2"},
+		},
+		Pods: []PodConfig{
+			{"p1", 1000, 0, 0, "n1", false},
+			{"p2", 3000, 0, 0, "n2", false},
+		},
+		ExtraPods: []PodConfig{
+			{"p-new-1", 4000, 100 * utils.MiB, 0, "", false},
+			{"p-new-2", 4000, 100 * utils.MiB, 0, "", false},
+			{"p-new-3", 4000, 100 * utils.MiB, 0, "", false},
+		},
+		ExpansionOptionToChoose: GroupSizeChange{GroupName: "ng2", SizeChange: 3},
+		Options:                 options,
+	}
+	results := &ScaleTestResults{
+		FinalOption: GroupSizeChange{GroupName: "ng2", SizeChange: 2},
+		ScaleUpStatus: ScaleUpStatusInfo{
+			PodsTriggeredScaleUp: []string{"p-new-1", "p-new-2", "p-new-3"},
+		},
+	}
+
+	simpleScaleUpTest(t, config, results)
+}
+
 // No scale up scenarios.
 func TestNoScaleUpMaxCoresLimitHit(t *testing.T) {
 	options := defaultOptions
@@ -432,6 +466,34 @@ func TestNoScaleUpMaxCoresLimitHit(t *testing.T) {
 	simpleNoScaleUpTest(t, config, results)
 }
 
+func TestNoScaleUpQuotaGroupLimitHit(t *testing.T) {
+	options := defaultOptions
+	options.QuotaGroups = []config.QuotaGroup{{Name: "team", MaxNodes: 2}}
+	config := &ScaleTestConfig{
+		Nodes: []NodeConfig{
+			{"n1", 2000, 100, 0, true, "ng1"},
+			{"n2", 4000, 1000, 0, true, "ng2"},
+		},
+		Pods: []PodConfig{
+			{"p1", 1000, 0, 0, "n1", false},
+			{"p2", 3000, 0, 0, "n2", false},
+		},
+		ExtraPods: []PodConfig{
+			{"p-new-1", 2000, 0, 0, "", false},
+			{"p-new-2", 2000, 0, 0, "", false},
+		},
+		Options: options,
+	}
+	results := &ScaleTestResults{
+		NoScaleUpReason: "quota group team nodes limit reached",
+		ScaleUpStatus: ScaleUpStatusInfo{
+			PodsRemainUnschedulable: []string{"p-new-1", "p-new-2"},
+		},
+	}
+
+	simpleNoScaleUpTest(t, config, results)
+}
+
 // To implement expander.Strategy, BestOption method must have a struct receiver.
 // This prevents it from modifying fields of reportingStrategy, so we need a thin
 // pointer wrapper for mutable parts.
@@ -1030,3 +1092,363 @@ func simplifyScaleUpStatus(scaleUpStatus *status.ScaleUpStatus) ScaleUpStatusInf
 		PodsAwaitEvaluation:     ExtractPodNames(scaleUpStatus.PodsAwaitEvaluation),
 	}
 }
+
+func TestScaleUpNodeGroupSelector(t *testing.T) {
+	now := time.Now()
+	n1 := BuildTestNode("n1", 1000, 1000)
+	SetNodeReadyState(n1, true, now.Add(-2*time.Minute))
+	n2 := BuildTestNode("n2", 1000, 1000)
+	n2.Labels["pool"] = "pinned"
+	SetNodeReadyState(n2, true, now.Add(-2*time.Minute))
+
+	podLister := kube_util.NewTestPodLister([]*apiv1.Pod{})
+	listers := kube_util.NewListerRegistry(nil, nil, podLister, nil, nil, nil, nil, nil, nil, nil)
+
+	expandedGroups := make(chan string, 10)
+	provider := testprovider.NewTestCloudProvider(func(nodeGroup string, increase int) error {
+		expandedGroups <- nodeGroup
+		return nil
+	}, nil)
+	provider.AddNodeGroup("ng1", 1, 10, 1)
+	provider.AddNode("ng1", n1)
+	provider.AddNodeGroup("ng2", 1, 10, 1)
+	provider.AddNode("ng2", n2)
+
+	options := config.AutoscalingOptions{
+		EstimatorName:  estimator.BinpackingEstimatorName,
+		MaxCoresTotal:  config.DefaultMaxClusterCores,
+		MaxMemoryTotal: config.DefaultMaxClusterMemory,
+	}
+	context, err := NewScaleTestAutoscalingContext(options, &fake.Clientset{}, listers, provider, nil, nil)
+	assert.NoError(t, err)
+
+	nodes := []*apiv1.Node{n1, n2}
+	nodeInfos, _ := nodeinfosprovider.NewDefaultTemplateNodeInfoProvider(nil).Process(&context, nodes, []*appsv1.DaemonSet{}, nil, now)
+	clusterState := clusterstate.NewClusterStateRegistry(provider, clusterstate.ClusterStateRegistryConfig{}, context.LogRecorder, NewBackoff())
+	clusterState.UpdateNodes(nodes, nodeInfos, time.Now())
+
+	// The pod fits both node groups, but may only trigger scale-up of ng2.
+	pinned := BuildTestPod("pinned", 500, 0)
+	pinned.Annotations = map[string]string{pod_utils.NodeGroupSelectorAnnotationKey: "pool=pinned"}
+	processors := NewTestProcessors()
+	scaleUpStatus, err := ScaleUp(&context, processors, clusterState, []*apiv1.Pod{pinned}, nodes, []*appsv1.DaemonSet{}, nodeInfos, nil)
+	assert.NoError(t, err)
+	assert.True(t, scaleUpStatus.WasSuccessful())
+	assert.Equal(t, "ng2", <-expandedGroups)
+
+	// No node group matches the selector.
+	notMatching := BuildTestPod("not-matching", 500, 0)
+	notMatching.Annotations = map[string]string{pod_utils.NodeGroupSelectorAnnotationKey: "pool=other"}
+	scaleUpStatus, err = ScaleUp(&context, processors, clusterState, []*apiv1.Pod{notMatching}, nodes, []*appsv1.DaemonSet{}, nodeInfos, nil)
+	assert.NoError(t, err)
+	assert.False(t, scaleUpStatus.WasSuccessful())
+	assert.Equal(t, status.ScaleUpNoOptionsAvailable, scaleUpStatus.Result)
+	if assert.Len(t, scaleUpStatus.PodsRemainUnschedulable, 1) {
+		assert.Len(t, scaleUpStatus.PodsRemainUnschedulable[0].RejectedNodeGroups, 2)
+	}
+	processors.ScaleUpStatusProcessor.Process(&context, scaleUpStatus)
+	var event string
+	select {
+	case event = <-context.Recorder.(*kube_record.FakeRecorder).Events:
+	default:
+		t.Fatal("No Event recorded, expected NotTriggerScaleUp event")
+	}
+	assert.Contains(t, event, "NotTriggerScaleUp")
+	assert.Contains(t, event, "2 not selected by pod's node group selector")
+	assert.Contains(t, event, `pod may only trigger scale-up of node groups matching "pool=other"`)
+}
+
+func buildPodGroupPod(name string, cpu int64, group string, minMember int) *apiv1.Pod {
+	pod := BuildTestPod(name, cpu, 0)
+	pod.Labels = map[string]string{podgroup.PodGroupLabelKey: group}
+	pod.Annotations[podgroup.PodGroupMinMemberAnnotationKey] = fmt.Sprint(minMember)
+	return pod
+}
+
+func TestScaleUpPodGroups(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		pods             []*apiv1.Pod
+		expectedIncrease int
+	}{
+		{
+			name: "pod group fits within max size",
+			pods: []*apiv1.Pod{
+				buildPodGroupPod("g1", 800, "g", 2),
+				buildPodGroupPod("g2", 800, "g", 2),
+			},
+			expectedIncrease: 2,
+		},
+		{
+			name: "pod group exceeds max size",
+			pods: []*apiv1.Pod{
+				buildPodGroupPod("g1", 800, "g", 3),
+				buildPodGroupPod("g2", 800, "g", 3),
+				buildPodGroupPod("g3", 800, "g", 3),
+			},
+		},
+		{
+			name: "only pods outside of the pod group fit within max size",
+			pods: []*apiv1.Pod{
+				BuildTestPod("p1", 900, 0),
+				buildPodGroupPod("g1", 800, "g", 2),
+				buildPodGroupPod("g2", 800, "g", 2),
+			},
+			expectedIncrease: 1,
+		},
+		{
+			name: "pods outside of the pod group are packed again",
+			pods: []*apiv1.Pod{
+				BuildTestPod("p1", 300, 0),
+				BuildTestPod("p2", 300, 0),
+				buildPodGroupPod("g1", 600, "g", 3),
+				buildPodGroupPod("g2", 600, "g", 3),
+				buildPodGroupPod("g3", 600, "g", 3),
+			},
+			expectedIncrease: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Now()
+			n1 := BuildTestNode("n1", 1000, 1000)
+			SetNodeReadyState(n1, true, now.Add(-2*time.Minute))
+
+			podLister := kube_util.NewTestPodLister([]*apiv1.Pod{})
+			listers := kube_util.NewListerRegistry(nil, nil, podLister, nil, nil, nil, nil, nil, nil, nil)
+
+			increases := make(chan int, 10)
+			provider := testprovider.NewTestCloudProvider(func(nodeGroup string, increase int) error {
+				increases <- increase
+				return nil
+			}, nil)
+			provider.AddNodeGroup("ng1", 1, 3, 1)
+			provider.AddNode("ng1", n1)
+
+			context, err := NewScaleTestAutoscalingContext(defaultOptions, &fake.Clientset{}, listers, provider, nil, nil)
+			assert.NoError(t, err)
+			context.PodGroupFinder = podgroup.NewFinder(nil)
+
+			nodes := []*apiv1.Node{n1}
+			nodeInfos, _ := nodeinfosprovider.NewDefaultTemplateNodeInfoProvider(nil).Process(&context, nodes, []*appsv1.DaemonSet{}, nil, now)
+			clusterState := clusterstate.NewClusterStateRegistry(provider, clusterstate.ClusterStateRegistryConfig{}, context.LogRecorder, NewBackoff())
+			clusterState.UpdateNodes(nodes, nodeInfos, now)
+
+			scaleUpStatus, err := ScaleUp(&context, NewTestProcessors(), clusterState, tc.pods, nodes, []*appsv1.DaemonSet{}, nodeInfos, nil)
+			if tc.expectedIncrease == 0 {
+				assert.Error(t, err)
+				assert.Empty(t, increases)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, scaleUpStatus.WasSuccessful())
+			assert.Equal(t, tc.expectedIncrease, <-increases)
+		})
+	}
+}
+
+// zoneBalancingRecorder balances scale-up between zones up to a limit and
+// records the number of nodes it was asked to add.
+type zoneBalancingRecorder struct {
+	nodegroupset.NoOpNodeGroupSetProcessor
+	t           *testing.T
+	maxNewNodes int
+	newNodes    []int
+}
+
+func (r *zoneBalancingRecorder) FindSimilarNodeGroups(context *context.AutoscalingContext, nodeGroup cloudprovider.NodeGroup,
+	nodeInfosForGroups map[string]*schedulerframework.NodeInfo) ([]cloudprovider.NodeGroup, errors.AutoscalerError) {
+	var result []cloudprovider.NodeGroup
+	for _, ng := range context.CloudProvider.NodeGroups() {
+		if ng.Id() != nodeGroup.Id() {
+			result = append(result, ng)
+		}
+	}
+	return result, nil
+}
+
+func (r *zoneBalancingRecorder) BalanceScaleUpBetweenGroups(context *context.AutoscalingContext, groups []cloudprovider.NodeGroup, newNodes int) ([]nodegroupset.ScaleUpInfo, errors.AutoscalerError) {
+	r.t.Errorf("BalanceScaleUpBetweenGroups called for %d nodes, want BalanceScaleUpBetweenZones", newNodes)
+	return nil, errors.NewAutoscalerError(errors.InternalError, "unexpected call")
+}
+
+func (r *zoneBalancingRecorder) BalanceScaleUpBetweenZones(context *context.AutoscalingContext, groups []cloudprovider.NodeGroup,
+	nodeInfos map[string]*schedulerframework.NodeInfo, podsPerGroup map[string][]*apiv1.Pod, newNodes int) ([]nodegroupset.ScaleUpInfo, errors.AutoscalerError) {
+	r.newNodes = append(r.newNodes, newNodes)
+	if newNodes > r.maxNewNodes {
+		newNodes = r.maxNewNodes
+	}
+	var result []nodegroupset.ScaleUpInfo
+	for i, group := range groups {
+		delta := newNodes / len(groups)
+		if i < newNodes%len(groups) {
+			delta++
+		}
+		if delta == 0 {
+			continue
+		}
+		size, _ := group.TargetSize()
+		result = append(result, nodegroupset.ScaleUpInfo{Group: group, CurrentSize: size, NewSize: size + delta, MaxSize: group.MaxSize()})
+	}
+	return result, nil
+}
+
+func TestScaleUpPodGroupsRebalancesBetweenZones(t *testing.T) {
+	now := time.Now()
+	n1 := BuildTestNode("n1", 1000, 1000)
+	SetNodeReadyState(n1, true, now.Add(-2*time.Minute))
+	n2 := BuildTestNode("n2", 1000, 1000)
+	SetNodeReadyState(n2, true, now.Add(-2*time.Minute))
+
+	podLister := kube_util.NewTestPodLister([]*apiv1.Pod{})
+	listers := kube_util.NewListerRegistry(nil, nil, podLister, nil, nil, nil, nil, nil, nil, nil)
+
+	increases := make(chan int, 10)
+	provider := testprovider.NewTestCloudProvider(func(nodeGroup string, increase int) error {
+		increases <- increase
+		return nil
+	}, nil)
+	provider.AddNodeGroup("ng1", 1, 4, 1)
+	provider.AddNode("ng1", n1)
+	provider.AddNodeGroup("ng2", 1, 4, 1)
+	provider.AddNode("ng2", n2)
+
+	options := defaultOptions
+	options.BalanceSimilarNodeGroups = true
+	options.BalanceSimilarNodeGroupsByZone = true
+	context, err := NewScaleTestAutoscalingContext(options, &fake.Clientset{}, listers, provider, nil, nil)
+	assert.NoError(t, err)
+	context.PodGroupFinder = podgroup.NewFinder(nil)
+
+	nodes := []*apiv1.Node{n1, n2}
+	nodeInfos, _ := nodeinfosprovider.NewDefaultTemplateNodeInfoProvider(nil).Process(&context, nodes, []*appsv1.DaemonSet{}, nil, now)
+	clusterState := clusterstate.NewClusterStateRegistry(provider, clusterstate.ClusterStateRegistryConfig{}, context.LogRecorder, NewBackoff())
+	clusterState.UpdateNodes(nodes, nodeInfos, now)
+
+	processors := NewTestProcessors()
+	recorder := &zoneBalancingRecorder{t: t, maxNewNodes: 2}
+	processors.NodeGroupSetProcessor = recorder
+	pods := []*apiv1.Pod{
+		BuildTestPod("p1", 900, 0),
+		buildPodGroupPod("g1", 800, "g", 2),
+		buildPodGroupPod("g2", 800, "g", 2),
+	}
+
+	// Balancing caps the scale-up at 2 nodes, leaving the pod group incomplete,
+	// so the scale-up for the remaining pod is balanced between zones again.
+	scaleUpStatus, err := ScaleUp(&context, processors, clusterState, pods, nodes, []*appsv1.DaemonSet{}, nodeInfos, nil)
+	assert.NoError(t, err)
+	assert.True(t, scaleUpStatus.WasSuccessful())
+	assert.Equal(t, []int{3, 1}, recorder.newNodes)
+	if assert.Len(t, increases, 1) {
+		assert.Equal(t, 1, <-increases)
+	}
+}
+
+func TestReservePodsOnlyOnBestOptionNodeGroup(t *testing.T) {
+	provider := testprovider.NewTestCloudProvider(nil, nil)
+	provider.AddNodeGroup("ng1", 0, 10, 0)
+	provider.AddNodeGroup("ng2", 0, 10, 0)
+	p1 := BuildTestPod("p1", 100, 0)
+	p2 := BuildTestPod("p2", 100, 0)
+	p3 := BuildTestPod("p3", 100, 0)
+	autoscalingContext := &context.AutoscalingContext{
+		AutoscalingOptions: config.AutoscalingOptions{MaxNodeProvisionTime: 15 * time.Minute},
+		PodReservations:    simulator.NewPodReservations(),
+	}
+
+	// Balancing split the scale-up of ng2 with ng1, which is sorted first.
+	scaleUpInfos := []nodegroupset.ScaleUpInfo{
+		{Group: provider.GetNodeGroup("ng1"), CurrentSize: 0, NewSize: 1, MaxSize: 10},
+		{Group: provider.GetNodeGroup("ng2"), CurrentSize: 0, NewSize: 2, MaxSize: 10},
+	}
+	reservePods(autoscalingContext, "ng2", [][]*apiv1.Pod{{p1}, {p2}, {p3}}, scaleUpInfos, time.Now())
+
+	for _, pod := range []*apiv1.Pod{p1, p2} {
+		reservation, found := autoscalingContext.PodReservations.Get(pod)
+		assert.True(t, found)
+		assert.Equal(t, "ng2", reservation.NodeGroupId)
+	}
+	_, found := autoscalingContext.PodReservations.Get(p3)
+	assert.False(t, found)
+}
+
+func TestMaxScaleUp(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		maxCores      int64
+		maxNodesTotal int
+		quotaMaxNodes int
+		newNodes      int
+		expected      int
+	}{
+		{
+			name:     "no limit reached",
+			maxCores: 100,
+			newNodes: 4,
+			expected: 4,
+		},
+		{
+			name:     "capped at max size",
+			maxCores: 100,
+			newNodes: 20,
+			expected: 9,
+		},
+		{
+			name:          "capped at max total nodes",
+			maxCores:      100,
+			maxNodesTotal: 3,
+			newNodes:      4,
+			expected:      2,
+		},
+		{
+			name:     "capped at cores limit",
+			maxCores: 3,
+			newNodes: 4,
+			expected: 2,
+		},
+		{
+			name:     "cores limit reached",
+			maxCores: 1,
+			newNodes: 4,
+			expected: 0,
+		},
+		{
+			name:          "capped at quota",
+			maxCores:      100,
+			quotaMaxNodes: 3,
+			newNodes:      4,
+			expected:      2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Now()
+			n1 := BuildTestNode("n1", 1000, 1000)
+			SetNodeReadyState(n1, true, now.Add(-2*time.Minute))
+
+			provider := testprovider.NewTestCloudProvider(nil, nil)
+			provider.AddNodeGroup("ng1", 1, 10, 1)
+			provider.AddNode("ng1", n1)
+			provider.SetResourceLimiter(cloudprovider.NewResourceLimiter(
+				map[string]int64{cloudprovider.ResourceNameCores: 0, cloudprovider.ResourceNameMemory: 0},
+				map[string]int64{cloudprovider.ResourceNameCores: tc.maxCores, cloudprovider.ResourceNameMemory: config.DefaultMaxClusterMemory * units.GiB}))
+
+			options := defaultOptions
+			options.MaxNodesTotal = tc.maxNodesTotal
+			if tc.quotaMaxNodes > 0 {
+				options.QuotaGroups = []config.QuotaGroup{{Name: "all", MaxNodes: tc.quotaMaxNodes}}
+			}
+			listers := kube_util.NewListerRegistry(nil, nil, kube_util.NewTestPodLister(nil), nil, nil, nil, nil, nil, nil, nil)
+			context, err := NewScaleTestAutoscalingContext(options, &fake.Clientset{}, listers, provider, nil, nil)
+			assert.NoError(t, err)
+
+			nodes := []*apiv1.Node{n1}
+			nodeInfos, _ := nodeinfosprovider.NewDefaultTemplateNodeInfoProvider(nil).Process(&context, nodes, []*appsv1.DaemonSet{}, nil, now)
+			clusterState := clusterstate.NewClusterStateRegistry(provider, clusterstate.ClusterStateRegistryConfig{}, context.LogRecorder, NewBackoff())
+			clusterState.UpdateNodes(nodes, nodeInfos, now)
+
+			maxNewNodes, typedErr := maxScaleUp(&context, NewTestProcessors(), clusterState, nodes, provider.GetNodeGroup("ng1"), nodeInfos, tc.newNodes, now)
+			assert.NoError(t, typedErr)
+			assert.Equal(t, tc.expected, maxNewNodes)
+		})
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consolidation
+
+import (
+	"strings"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/clusterstate"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/metrics"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/status"
+	"k8s.io/autoscaler/cluster-autoscaler/simulator"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/gpu"
+
+	apiv1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1beta1"
+	klog "k8s.io/klog/v2"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// Drainer drains and deletes nodes.
+type Drainer interface {
+	// DrainNodes starts draining and deleting the given nodes.
+	DrainNodes(nodesToRemove []simulator.NodeToBeRemoved, currentTime time.Time) (*status.ScaleDownStatus, errors.AutoscalerError)
+}
+
+// ScaleUpLimiter applies the limits of regular scale-ups to scale-ups started
+// by consolidations.
+type ScaleUpLimiter interface {
+	// MaxNewNodes returns the number of nodes, up to newNodes, which can be
+	// added to the node group without exceeding its max size, the max total
+	// number of nodes, the cluster-wide resource limits and the quotas.
+	MaxNewNodes(nodeGroup cloudprovider.NodeGroup, nodeInfos map[string]*schedulerframework.NodeInfo, newNodes int, currentTime time.Time) (int, errors.AutoscalerError)
+}
+
+// Consolidator carries out consolidations, one at a time. A consolidation
+// first scales the replacing node group up. Once the new nodes are ready, the
+// replaced nodes are drained, if their pods still fit on the other nodes.
+type Consolidator struct {
+	context              *context.AutoscalingContext
+	clusterStateRegistry *clusterstate.ClusterStateRegistry
+	planner              *Planner
+	drainer              Drainer
+	limiter              ScaleUpLimiter
+	inProgress           *Plan
+	scaleUpTime          time.Time
+}
+
+// NewConsolidator returns a new Consolidator.
+func NewConsolidator(context *context.AutoscalingContext, clusterStateRegistry *clusterstate.ClusterStateRegistry, drainer Drainer, limiter ScaleUpLimiter) *Consolidator {
+	return &Consolidator{
+		context:              context,
+		clusterStateRegistry: clusterStateRegistry,
+		planner:              NewPlanner(context, clusterStateRegistry),
+		drainer:              drainer,
+		limiter:              limiter,
+	}
+}
+
+// InProgress returns the consolidation waiting for its new nodes, if any.
+func (c *Consolidator) InProgress() *Plan {
+	return c.inProgress
+}
+
+// RunOnce moves consolidation forward. If no consolidation is in progress, it
+// looks for one among the candidates and scales the replacing node group up.
+// Otherwise, once the new nodes are ready, it starts draining the replaced
+// nodes. The returned status is non-nil only if draining was attempted.
+func (c *Consolidator) RunOnce(candidates []*apiv1.Node, nodeInfos map[string]*schedulerframework.NodeInfo, pdbs []*policyv1.PodDisruptionBudget,
+	currentTime time.Time) (*status.ScaleDownStatus, errors.AutoscalerError) {
+	if c.inProgress == nil {
+		plan, err := c.planner.Plan(candidates, nodeInfos, pdbs, currentTime)
+		if err != nil || plan == nil {
+			return nil, err
+		}
+		return nil, c.startScaleUp(plan, nodeInfos, currentTime)
+	}
+
+	plan := c.inProgress
+	if c.scaleUpTime.Add(c.context.MaxNodeProvisionTime).Before(currentTime) {
+		klog.Warningf("Consolidation: new nodes in %s didn't become ready in %v, giving up", plan.NodeGroup.Id(), c.context.MaxNodeProvisionTime)
+		c.context.LogRecorder.Eventf(apiv1.EventTypeWarning, "ConsolidationFailed",
+			"Consolidation: new nodes in %s didn't become ready in %v", plan.NodeGroup.Id(), c.context.MaxNodeProvisionTime)
+		c.inProgress = nil
+		return nil, nil
+	}
+	if c.clusterStateRegistry.IsNodeGroupScalingUp(plan.NodeGroup.Id()) {
+		klog.V(2).Infof("Consolidation: waiting for %d new nodes in %s", plan.NewNodes, plan.NodeGroup.Id())
+		return nil, nil
+	}
+	c.inProgress = nil
+
+	nodesToRemove, err := c.stillRemovable(plan, pdbs, currentTime)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodesToRemove) == 0 {
+		klog.Warningf("Consolidation: pods of the replaced nodes no longer fit in the cluster, giving up")
+		c.context.LogRecorder.Eventf(apiv1.EventTypeWarning, "ConsolidationFailed",
+			"Consolidation: pods of %s no longer fit in the cluster", nodeNames(plan.NodesToRemove))
+		return nil, nil
+	}
+	klog.V(0).Infof("Consolidation: removing nodes %s", nodeNames(nodesToRemove))
+	c.context.LogRecorder.Eventf(apiv1.EventTypeNormal, "Consolidation", "Consolidation: removing nodes %s", nodeNames(nodesToRemove))
+	return c.drainer.DrainNodes(nodesToRemove, currentTime)
+}
+
+func (c *Consolidator) startScaleUp(plan *Plan, nodeInfos map[string]*schedulerframework.NodeInfo, currentTime time.Time) errors.AutoscalerError {
+	nodeGroup := plan.NodeGroup
+	// The replaced nodes are only drained if pods of all of them fit on the
+	// new nodes, so a capped scale-up wouldn't help.
+	maxNewNodes, err := c.limiter.MaxNewNodes(nodeGroup, nodeInfos, plan.NewNodes, currentTime)
+	if err != nil {
+		return err.AddPrefix("failed to check scale-up limits: ")
+	}
+	if maxNewNodes < plan.NewNodes {
+		klog.V(1).Infof("Consolidation: adding %d nodes to %s would exceed scale-up limits, skipping replacement of %s",
+			plan.NewNodes, nodeGroup.Id(), nodeNames(plan.NodesToRemove))
+		return nil
+	}
+	klog.V(0).Infof("Consolidation: adding %d nodes to %s to replace %s, saving %.0f%% of their cost",
+		plan.NewNodes, nodeGroup.Id(), nodeNames(plan.NodesToRemove), plan.Savings*100)
+	c.context.LogRecorder.Eventf(apiv1.EventTypeNormal, "Consolidation", "Consolidation: adding %d nodes to %s to replace %s",
+		plan.NewNodes, nodeGroup.Id(), nodeNames(plan.NodesToRemove))
+	if err := nodeGroup.IncreaseSize(plan.NewNodes); err != nil {
+		c.context.LogRecorder.Eventf(apiv1.EventTypeWarning, "FailedToScaleUpGroup", "Scale-up failed for group %s: %v", nodeGroup.Id(), err)
+		aerr := errors.ToAutoscalerError(errors.CloudProviderError, err).AddPrefix("failed to increase node group size: ")
+		c.clusterStateRegistry.RegisterFailedScaleUp(nodeGroup, metrics.FailedScaleUpReason(string(aerr.Type())), currentTime)
+		return aerr
+	}
+	c.clusterStateRegistry.RegisterOrUpdateScaleUp(nodeGroup, plan.NewNodes, currentTime)
+	gpuType := ""
+	if nodeInfo, found := nodeInfos[nodeGroup.Id()]; found {
+		gpuType = gpu.GetGpuTypeForMetrics(c.context.CloudProvider.GPULabel(), c.context.CloudProvider.GetAvailableGPUTypes(), nodeInfo.Node(), nodeGroup)
+	}
+	metrics.RegisterScaleUp(plan.NewNodes, gpuType)
+	metrics.RegisterNodeGroupScaleUp(nodeGroup.Id(), plan.NewNodes)
+	c.inProgress = plan
+	c.scaleUpTime = currentTime
+	return nil
+}
+
+// stillRemovable returns the nodes of the plan which can still be drained,
+// with pods of all of them fitting on the remaining nodes together.
+func (c *Consolidator) stillRemovable(plan *Plan, pdbs []*policyv1.PodDisruptionBudget, currentTime time.Time) ([]simulator.NodeToBeRemoved, errors.AutoscalerError) {
+	snapshot := c.context.ClusterSnapshot
+	if err := snapshot.Fork(); err != nil {
+		return nil, errors.ToAutoscalerError(errors.InternalError, err)
+	}
+	defer func() {
+		if err := snapshot.Revert(); err != nil {
+			klog.Fatalf("Error while calling ClusterSnapshot.Revert; %v", err)
+		}
+	}()
+
+	removed := make(map[string]bool)
+	var drainable []simulator.NodeToBeRemoved
+	for _, planned := range plan.NodesToRemove {
+		toRemove, unremovable := c.planner.removalSimulator.CheckNodeDrain(planned.Node.Name, currentTime, pdbs)
+		if unremovable != nil {
+			klog.V(2).Infof("Consolidation: %s can no longer be drained", planned.Node.Name)
+			continue
+		}
+		removed[toRemove.Node.Name] = true
+		drainable = append(drainable, *toRemove)
+	}
+
+	var result []simulator.NodeToBeRemoved
+	for _, toRemove := range drainable {
+		if err := snapshot.RemoveNode(toRemove.Node.Name); err != nil {
+			return nil, errors.ToAutoscalerError(errors.InternalError, err)
+		}
+	}
+	for _, toRemove := range drainable {
+		fits := true
+		for _, pod := range movedPods(toRemove.PodsToReschedule) {
+			nodeName, err := c.context.PredicateChecker.FitsAnyNodeMatching(snapshot, pod, func(nodeInfo *schedulerframework.NodeInfo) bool {
+				return !removed[nodeInfo.Node().Name]
+			})
+			if err == nil {
+				err = snapshot.AddPod(pod, nodeName)
+			}
+			if err != nil {
+				klog.V(2).Infof("Consolidation: no place for %s/%s from %s", pod.Namespace, pod.Name, toRemove.Node.Name)
+				fits = false
+				break
+			}
+		}
+		if fits {
+			result = append(result, toRemove)
+		}
+	}
+	return result, nil
+}
+
+func nodeNames(nodes []simulator.NodeToBeRemoved) string {
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Node.Name)
+	}
+	return strings.Join(names, ",")
+}
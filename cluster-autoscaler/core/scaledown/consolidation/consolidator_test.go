@@ -0,0 +1,152 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consolidation
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/status"
+	"k8s.io/autoscaler/cluster-autoscaler/simulator"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+
+	"github.com/stretchr/testify/assert"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+type fakeDrainer struct {
+	drained []string
+}
+
+func (d *fakeDrainer) DrainNodes(nodesToRemove []simulator.NodeToBeRemoved, currentTime time.Time) (*status.ScaleDownStatus, errors.AutoscalerError) {
+	for _, toRemove := range nodesToRemove {
+		d.drained = append(d.drained, toRemove.Node.Name)
+	}
+	return &status.ScaleDownStatus{Result: status.ScaleDownNodeDeleteStarted}, nil
+}
+
+type fakeLimiter struct {
+	maxNewNodes int
+}
+
+func (l *fakeLimiter) MaxNewNodes(nodeGroup cloudprovider.NodeGroup, nodeInfos map[string]*schedulerframework.NodeInfo, newNodes int, currentTime time.Time) (int, errors.AutoscalerError) {
+	if newNodes > l.maxNewNodes {
+		return l.maxNewNodes, nil
+	}
+	return newNodes, nil
+}
+
+var unlimited = &fakeLimiter{maxNewNodes: 100}
+
+func TestConsolidatorRunOnce(t *testing.T) {
+	now := time.Now()
+	cluster := newTestCluster(t, defaultOptions(), 0, 2000)
+	drainer := &fakeDrainer{}
+	consolidator := NewConsolidator(cluster.context, cluster.csr, drainer, unlimited)
+
+	// No consolidation in progress, the replacing node group is scaled up.
+	scaleDownStatus, err := consolidator.RunOnce(cluster.nodes, cluster.nodeInfos, nil, now)
+	assert.NoError(t, err)
+	assert.Nil(t, scaleDownStatus)
+	if assert.NotNil(t, consolidator.InProgress()) {
+		assert.Equal(t, "big", consolidator.InProgress().NodeGroup.Id())
+	}
+	size, _ := cluster.provider.GetNodeGroup("big").TargetSize()
+	assert.Equal(t, 1, size)
+	assert.Empty(t, drainer.drained)
+
+	// The new node hasn't registered yet.
+	now = now.Add(time.Minute)
+	assert.NoError(t, cluster.csr.UpdateNodes(cluster.nodes, cluster.nodeInfos, now))
+	scaleDownStatus, err = consolidator.RunOnce(cluster.nodes, cluster.nodeInfos, nil, now)
+	assert.NoError(t, err)
+	assert.Nil(t, scaleDownStatus)
+	assert.NotNil(t, consolidator.InProgress())
+	assert.Empty(t, drainer.drained)
+
+	// The new node is ready, the replaced nodes are drained.
+	now = now.Add(time.Minute)
+	newNode := BuildTestNode("b1", 2000, 1000)
+	SetNodeReadyState(newNode, true, time.Time{})
+	cluster.provider.AddNode("big", newNode)
+	assert.NoError(t, cluster.context.ClusterSnapshot.AddNode(newNode))
+	allNodes := append(cluster.nodes, newNode)
+	assert.NoError(t, cluster.csr.UpdateNodes(allNodes, cluster.nodeInfos, now))
+	scaleDownStatus, err = consolidator.RunOnce(cluster.nodes, cluster.nodeInfos, nil, now)
+	assert.NoError(t, err)
+	if assert.NotNil(t, scaleDownStatus) {
+		assert.Equal(t, status.ScaleDownNodeDeleteStarted, scaleDownStatus.Result)
+	}
+	assert.ElementsMatch(t, []string{"s1", "s2", "s3"}, drainer.drained)
+	assert.Nil(t, consolidator.InProgress())
+}
+
+func TestConsolidatorNewNodesNotReady(t *testing.T) {
+	now := time.Now()
+	cluster := newTestCluster(t, defaultOptions(), 0, 2000)
+	drainer := &fakeDrainer{}
+	consolidator := NewConsolidator(cluster.context, cluster.csr, drainer, unlimited)
+
+	_, err := consolidator.RunOnce(cluster.nodes, cluster.nodeInfos, nil, now)
+	assert.NoError(t, err)
+	assert.NotNil(t, consolidator.InProgress())
+
+	// The new node never showed up.
+	now = now.Add(cluster.context.MaxNodeProvisionTime + time.Minute)
+	scaleDownStatus, err := consolidator.RunOnce(cluster.nodes, cluster.nodeInfos, nil, now)
+	assert.NoError(t, err)
+	assert.Nil(t, scaleDownStatus)
+	assert.Nil(t, consolidator.InProgress())
+	assert.Empty(t, drainer.drained)
+}
+
+func TestConsolidatorPodsNoLongerFit(t *testing.T) {
+	now := time.Now()
+	cluster := newTestCluster(t, defaultOptions(), 0, 2000)
+	drainer := &fakeDrainer{}
+	consolidator := NewConsolidator(cluster.context, cluster.csr, drainer, unlimited)
+
+	_, err := consolidator.RunOnce(cluster.nodes, cluster.nodeInfos, nil, now)
+	assert.NoError(t, err)
+	assert.NotNil(t, consolidator.InProgress())
+
+	// The scale-up finished, but no new node is in the cluster to take the pods.
+	now = now.Add(time.Minute)
+	scaleDownStatus, err := consolidator.RunOnce(cluster.nodes, cluster.nodeInfos, nil, now)
+	assert.NoError(t, err)
+	assert.Nil(t, scaleDownStatus)
+	assert.Nil(t, consolidator.InProgress())
+	assert.Empty(t, drainer.drained)
+}
+
+func TestConsolidatorScaleUpLimited(t *testing.T) {
+	now := time.Now()
+	cluster := newTestCluster(t, defaultOptions(), 0, 2000)
+	drainer := &fakeDrainer{}
+	consolidator := NewConsolidator(cluster.context, cluster.csr, drainer, &fakeLimiter{maxNewNodes: 0})
+
+	// Adding the replacing node would exceed scale-up limits.
+	scaleDownStatus, err := consolidator.RunOnce(cluster.nodes, cluster.nodeInfos, nil, now)
+	assert.NoError(t, err)
+	assert.Nil(t, scaleDownStatus)
+	assert.Nil(t, consolidator.InProgress())
+	size, _ := cluster.provider.GetNodeGroup("big").TargetSize()
+	assert.Equal(t, 0, size)
+	assert.Empty(t, drainer.drained)
+}
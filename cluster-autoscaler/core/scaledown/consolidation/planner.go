@@ -0,0 +1,354 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consolidation
+
+import (
+	"reflect"
+	"sort"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/clusterstate"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/core/scaledown/legacy"
+	"k8s.io/autoscaler/cluster-autoscaler/expander"
+	"k8s.io/autoscaler/cluster-autoscaler/simulator"
+	"k8s.io/autoscaler/cluster-autoscaler/simulator/utilization"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/scheduler"
+
+	apiv1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1beta1"
+	klog "k8s.io/klog/v2"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+const templateNodeName = "consolidation-template"
+
+// Plan describes a consolidation: a set of nodes to be replaced by new nodes
+// from a single node group.
+type Plan struct {
+	// NodeGroup is the node group to which new nodes are added.
+	NodeGroup cloudprovider.NodeGroup
+	// NewNodes is the number of nodes to add.
+	NewNodes int
+	// NodesToRemove are the nodes to drain once the new nodes are ready.
+	NodesToRemove []simulator.NodeToBeRemoved
+	// Savings is the fraction of the cost of removed nodes saved by the consolidation.
+	Savings float64
+}
+
+// Planner looks for sets of nodes which can be replaced by fewer or cheaper
+// nodes from a single node group.
+type Planner struct {
+	context              *context.AutoscalingContext
+	clusterStateRegistry *clusterstate.ClusterStateRegistry
+	removalSimulator     *simulator.RemovalSimulator
+}
+
+// NewPlanner returns a new Planner.
+func NewPlanner(context *context.AutoscalingContext, clusterStateRegistry *clusterstate.ClusterStateRegistry) *Planner {
+	removalSimulator := simulator.NewRemovalSimulator(context.ListerRegistry, context.ClusterSnapshot, context.PredicateChecker, simulator.NewUsageTracker())
+	removalSimulator.SetMaxEvictableEmptyDirSize(context.MaxEvictableEmptyDirSize)
+	return &Planner{
+		context:              context,
+		clusterStateRegistry: clusterStateRegistry,
+		removalSimulator:     removalSimulator,
+	}
+}
+
+// candidate is a node which can be drained.
+type candidate struct {
+	toRemove    simulator.NodeToBeRemoved
+	nodeGroup   cloudprovider.NodeGroup
+	utilization float64
+	cost        float64
+}
+
+// replacement is a node group able to replace a set of nodes.
+type replacement struct {
+	option  expander.Option
+	savings float64
+	saved   float64
+}
+
+// Plan returns the most profitable consolidation of the given candidates, or
+// nil if there is none.
+//
+// Candidates are considered from the least utilized one, up to the configured
+// maximum number of nodes and pods to reschedule. For each prefix of that list
+// of at least two nodes, the pods running on them are bin-packed on new nodes
+// from each node group. Node groups which would need fewer or cheaper nodes,
+// saving at least the configured fraction of the cost of the removed nodes,
+// are compared by the expander. The consolidation saving the most is returned.
+func (p *Planner) Plan(candidates []*apiv1.Node, nodeInfos map[string]*schedulerframework.NodeInfo, pdbs []*policyv1.PodDisruptionBudget, now time.Time) (*Plan, errors.AutoscalerError) {
+	costs := newCostModel(p.context.CloudProvider, now)
+	selected := p.selectCandidates(candidates, pdbs, costs, now)
+	if len(selected) < 2 {
+		klog.V(4).Infof("Consolidation: not enough nodes to consolidate")
+		return nil, nil
+	}
+
+	snapshot, err := p.copySnapshot()
+	if err != nil {
+		return nil, err
+	}
+	nodeGroups := make(map[string]cloudprovider.NodeGroup)
+	for _, nodeGroup := range p.context.CloudProvider.NodeGroups() {
+		nodeGroups[nodeGroup.Id()] = nodeGroup
+	}
+
+	var best *Plan
+	var bestSaved float64
+	var pods []*apiv1.Pod
+	removedCost := 0.0
+	for k, c := range selected {
+		if err := snapshot.RemoveNode(c.toRemove.Node.Name); err != nil {
+			return nil, errors.ToAutoscalerError(errors.InternalError, err)
+		}
+		pods = append(pods, movedPods(c.toRemove.PodsToReschedule)...)
+		removedCost += c.cost
+		if k == 0 {
+			continue
+		}
+		removed := selected[:k+1]
+		replacements := p.findReplacements(snapshot, removed, pods, removedCost, nodeGroups, nodeInfos, costs, now)
+		if len(replacements) == 0 {
+			continue
+		}
+		options := make([]expander.Option, 0, len(replacements))
+		for _, r := range replacements {
+			options = append(options, r.option)
+		}
+		chosen := p.context.ExpanderStrategy.BestOption(options, nodeInfos)
+		if chosen == nil {
+			continue
+		}
+		r := replacements[chosen.NodeGroup.Id()]
+		if best != nil && r.saved <= bestSaved {
+			continue
+		}
+		toRemove := make([]simulator.NodeToBeRemoved, 0, len(removed))
+		for _, c := range removed {
+			toRemove = append(toRemove, c.toRemove)
+		}
+		best = &Plan{
+			NodeGroup:     chosen.NodeGroup,
+			NewNodes:      chosen.NodeCount,
+			NodesToRemove: toRemove,
+			Savings:       r.savings,
+		}
+		bestSaved = r.saved
+	}
+	return best, nil
+}
+
+// selectCandidates returns drainable candidates, from the least utilized
+// one, within the configured disruption limits.
+func (p *Planner) selectCandidates(candidates []*apiv1.Node, pdbs []*policyv1.PodDisruptionBudget, costs *costModel, now time.Time) []candidate {
+	drainable := make([]candidate, 0, len(candidates))
+	for _, node := range candidates {
+		if node.Annotations[legacy.ScaleDownDisabledKey] == "true" {
+			continue
+		}
+		nodeGroup, err := p.context.CloudProvider.NodeGroupForNode(node)
+		if err != nil || nodeGroup == nil || reflect.ValueOf(nodeGroup).IsNil() {
+			continue
+		}
+		toRemove, unremovable := p.removalSimulator.CheckNodeDrain(node.Name, now, pdbs)
+		if unremovable != nil {
+			continue
+		}
+		nodeInfo, err := p.context.ClusterSnapshot.NodeInfos().Get(node.Name)
+		if err != nil {
+			continue
+		}
+		utilInfo, err := utilization.Calculate(node, nodeInfo, p.context.IgnoreDaemonSetsUtilization, p.context.IgnoreMirrorPodsUtilization, p.context.CloudProvider.GPULabel(), now)
+		if err != nil {
+			klog.Warningf("Consolidation: failed to calculate utilization of %s: %v", node.Name, err)
+			continue
+		}
+		cost, err := costs.nodeCost(node)
+		if err != nil {
+			klog.Warningf("Consolidation: failed to get price of %s: %v", node.Name, err)
+			continue
+		}
+		drainable = append(drainable, candidate{toRemove: *toRemove, nodeGroup: nodeGroup, utilization: utilInfo.Utilization, cost: cost})
+	}
+	sort.SliceStable(drainable, func(i, j int) bool {
+		return drainable[i].utilization < drainable[j].utilization
+	})
+
+	selected := make([]candidate, 0, p.context.ConsolidationMaxNodes)
+	removedPerGroup := make(map[string]int)
+	podCount := 0
+	for _, c := range drainable {
+		if len(selected) >= p.context.ConsolidationMaxNodes {
+			break
+		}
+		if podCount+len(c.toRemove.PodsToReschedule) > p.context.ConsolidationMaxPodsToReschedule {
+			continue
+		}
+		size, err := c.nodeGroup.TargetSize()
+		if err != nil {
+			klog.Warningf("Consolidation: failed to get target size of %s: %v", c.nodeGroup.Id(), err)
+			continue
+		}
+		if size-removedPerGroup[c.nodeGroup.Id()] <= c.nodeGroup.MinSize() {
+			continue
+		}
+		removedPerGroup[c.nodeGroup.Id()]++
+		podCount += len(c.toRemove.PodsToReschedule)
+		selected = append(selected, c)
+	}
+	return selected
+}
+
+// findReplacements returns node groups able to replace removed nodes,
+// keyed by node group id. The snapshot must not contain the removed nodes.
+func (p *Planner) findReplacements(snapshot simulator.ClusterSnapshot, removed []candidate, pods []*apiv1.Pod, removedCost float64,
+	nodeGroups map[string]cloudprovider.NodeGroup, nodeInfos map[string]*schedulerframework.NodeInfo, costs *costModel, now time.Time) map[string]replacement {
+	estimator := p.context.EstimatorBuilder(p.context.PredicateChecker, snapshot)
+	ids := make([]string, 0, len(nodeInfos))
+	for id := range nodeInfos {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	result := make(map[string]replacement)
+	for _, id := range ids {
+		nodeInfo := nodeInfos[id]
+		nodeGroup, found := nodeGroups[id]
+		if !found || !nodeGroup.Exist() {
+			continue
+		}
+		if p.clusterStateRegistry != nil && !p.clusterStateRegistry.IsNodeGroupSafeToScaleUp(nodeGroup, now) {
+			continue
+		}
+		currentSize, err := nodeGroup.TargetSize()
+		if err != nil {
+			klog.Warningf("Consolidation: failed to get target size of %s: %v", id, err)
+			continue
+		}
+		if !p.allPodsFit(snapshot, pods, nodeInfo) {
+			continue
+		}
+		newNodes := estimator.Estimate(pods, nodeInfo)
+		if newNodes == 0 || currentSize+newNodes > nodeGroup.MaxSize() {
+			continue
+		}
+		nodeCost, err := costs.nodeCost(nodeInfo.Node())
+		if err != nil {
+			klog.Warningf("Consolidation: failed to get price of a node from %s: %v", id, err)
+			continue
+		}
+		addedCost := float64(newNodes) * nodeCost
+		saved := removedCost - addedCost
+		if saved <= 0 || saved < removedCost*p.context.ConsolidationMinSavingsRatio {
+			continue
+		}
+		klog.V(4).Infof("Consolidation: %d nodes from %s can replace %d nodes, saving %.2f of %.2f", newNodes, id, len(removed), saved, removedCost)
+		result[id] = replacement{
+			option: expander.Option{
+				NodeGroup: nodeGroup,
+				NodeCount: newNodes,
+				Pods:      pods,
+				Debug:     "consolidation",
+			},
+			savings: saved / removedCost,
+			saved:   saved,
+		}
+	}
+	return result
+}
+
+// allPodsFit checks if every pod would fit on an empty node built from the template.
+func (p *Planner) allPodsFit(snapshot simulator.ClusterSnapshot, pods []*apiv1.Pod, template *schedulerframework.NodeInfo) bool {
+	nodeInfo := scheduler.DeepCopyTemplateNode(template, templateNodeName)
+	var templatePods []*apiv1.Pod
+	for _, podInfo := range nodeInfo.Pods {
+		templatePods = append(templatePods, podInfo.Pod)
+	}
+	if err := snapshot.AddNodeWithPods(nodeInfo.Node(), templatePods); err != nil {
+		klog.Errorf("Consolidation: failed to add template node to snapshot: %v", err)
+		return false
+	}
+	defer func() {
+		if err := snapshot.RemoveNode(nodeInfo.Node().Name); err != nil {
+			klog.Errorf("Consolidation: failed to remove template node from snapshot: %v", err)
+		}
+	}()
+	for _, pod := range pods {
+		if err := p.context.PredicateChecker.CheckPredicates(snapshot, pod, nodeInfo.Node().Name); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// copySnapshot returns a copy of the cluster snapshot, which can be modified
+// and forked by the estimator independently of the cluster snapshot.
+func (p *Planner) copySnapshot() (simulator.ClusterSnapshot, errors.AutoscalerError) {
+	nodeInfos, err := p.context.ClusterSnapshot.NodeInfos().List()
+	if err != nil {
+		return nil, errors.ToAutoscalerError(errors.InternalError, err)
+	}
+	snapshot := simulator.NewBasicClusterSnapshot()
+	for _, nodeInfo := range nodeInfos {
+		pods := make([]*apiv1.Pod, 0, len(nodeInfo.Pods))
+		for _, podInfo := range nodeInfo.Pods {
+			pods = append(pods, podInfo.Pod)
+		}
+		if err := snapshot.AddNodeWithPods(nodeInfo.Node(), pods); err != nil {
+			return nil, errors.ToAutoscalerError(errors.InternalError, err)
+		}
+	}
+	return snapshot, nil
+}
+
+// movedPods returns copies of the pods, not assigned to any node.
+func movedPods(pods []*apiv1.Pod) []*apiv1.Pod {
+	result := make([]*apiv1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		moved := pod.DeepCopy()
+		moved.Spec.NodeName = ""
+		result = append(result, moved)
+	}
+	return result
+}
+
+// costModel returns the cost of running nodes for an hour. If the cloud
+// provider has no pricing model, all nodes cost the same.
+type costModel struct {
+	pricing cloudprovider.PricingModel
+	now     time.Time
+}
+
+func newCostModel(cloudProvider cloudprovider.CloudProvider, now time.Time) *costModel {
+	pricing, err := cloudProvider.Pricing()
+	if err != nil {
+		klog.V(4).Infof("Consolidation: pricing model not available, comparing node counts: %v", err)
+		pricing = nil
+	}
+	return &costModel{pricing: pricing, now: now}
+}
+
+func (c *costModel) nodeCost(node *apiv1.Node) (float64, error) {
+	if c.pricing == nil {
+		return 1.0, nil
+	}
+	return c.pricing.NodePrice(node, c.now, c.now.Add(time.Hour))
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consolidation
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	testprovider "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/test"
+	"k8s.io/autoscaler/cluster-autoscaler/clusterstate"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/core/scaledown/legacy"
+	. "k8s.io/autoscaler/cluster-autoscaler/core/test"
+	"k8s.io/autoscaler/cluster-autoscaler/estimator"
+	"k8s.io/autoscaler/cluster-autoscaler/simulator"
+	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+type testPricingModel struct {
+	nodePrice map[string]float64
+}
+
+func (tpm *testPricingModel) NodePrice(node *apiv1.Node, startTime time.Time, endTime time.Time) (float64, error) {
+	if price, found := tpm.nodePrice[node.Name]; found {
+		return price, nil
+	}
+	return 0.0, fmt.Errorf("price for node %v not found", node.Name)
+}
+
+func (tpm *testPricingModel) PodPrice(pod *apiv1.Pod, startTime time.Time, endTime time.Time) (float64, error) {
+	return 0.0, nil
+}
+
+type testCluster struct {
+	provider  *testprovider.TestCloudProvider
+	context   *context.AutoscalingContext
+	csr       *clusterstate.ClusterStateRegistry
+	nodes     []*apiv1.Node
+	pods      []*apiv1.Pod
+	nodeInfos map[string]*schedulerframework.NodeInfo
+}
+
+func defaultOptions() config.AutoscalingOptions {
+	return config.AutoscalingOptions{
+		EstimatorName:                    estimator.BinpackingEstimatorName,
+		MaxNodeProvisionTime:             15 * time.Minute,
+		ConsolidationEnabled:             true,
+		ConsolidationMaxNodes:            5,
+		ConsolidationMaxPodsToReschedule: 100,
+		ConsolidationMinSavingsRatio:     0.2,
+	}
+}
+
+// newTestCluster builds three 1000m nodes in "small", each running a 500m
+// replicated pod, and an empty "big" node group of 2000m nodes.
+func newTestCluster(t *testing.T, options config.AutoscalingOptions, smallMin int, bigTemplateCpu int64) *testCluster {
+	provider := testprovider.NewTestCloudProvider(func(string, int) error { return nil }, nil)
+	provider.AddNodeGroup("small", smallMin, 10, 3)
+	provider.AddNodeGroup("big", 0, 5, 0)
+
+	var nodes []*apiv1.Node
+	var pods []*apiv1.Pod
+	ownerRefs := GenerateOwnerReferences("rs", "ReplicaSet", "extensions/v1beta1", "")
+	for i := 1; i <= 3; i++ {
+		node := BuildTestNode(fmt.Sprintf("s%d", i), 1000, 1000)
+		SetNodeReadyState(node, true, time.Time{})
+		provider.AddNode("small", node)
+		nodes = append(nodes, node)
+		pod := BuildTestPod(fmt.Sprintf("p%d", i), 500, 0)
+		pod.Spec.NodeName = node.Name
+		pod.OwnerReferences = ownerRefs
+		pods = append(pods, pod)
+	}
+
+	replicas := int32(5)
+	rsLister, err := kube_util.NewTestReplicaSetLister([]*appsv1.ReplicaSet{{
+		ObjectMeta: metav1.ObjectMeta{Name: "rs", Namespace: "default", SelfLink: "api/v1/namespaces/default/replicasets/rs"},
+		Spec:       appsv1.ReplicaSetSpec{Replicas: &replicas},
+	}})
+	assert.NoError(t, err)
+	registry := kube_util.NewListerRegistry(nil, nil, nil, nil, nil, nil, nil, nil, rsLister, nil)
+
+	ctx, err := NewScaleTestAutoscalingContext(options, &fake.Clientset{}, registry, provider, nil, nil)
+	assert.NoError(t, err)
+	simulator.InitializeClusterSnapshotOrDie(t, ctx.ClusterSnapshot, nodes, pods)
+	csr := clusterstate.NewClusterStateRegistry(provider, clusterstate.ClusterStateRegistryConfig{MaxNodeProvisionTime: options.MaxNodeProvisionTime}, ctx.LogRecorder, NewBackoff())
+
+	bigTemplate := BuildTestNode("big-template", bigTemplateCpu, 1000)
+	SetNodeReadyState(bigTemplate, true, time.Time{})
+	bigNodeInfo := schedulerframework.NewNodeInfo()
+	bigNodeInfo.SetNode(bigTemplate)
+	nodeInfos := map[string]*schedulerframework.NodeInfo{"big": bigNodeInfo}
+	assert.NoError(t, csr.UpdateNodes(nodes, nodeInfos, time.Now()))
+
+	return &testCluster{
+		provider:  provider,
+		context:   &ctx,
+		csr:       csr,
+		nodes:     nodes,
+		pods:      pods,
+		nodeInfos: nodeInfos,
+	}
+}
+
+func TestPlan(t *testing.T) {
+	testCases := []struct {
+		name           string
+		modifyOptions  func(*config.AutoscalingOptions)
+		smallMin       int
+		bigTemplateCpu int64
+		prices         map[string]float64
+		disabledNodes  []string
+		wantNewNodes   int
+		wantRemoved    int
+		wantSavings    float64
+	}{
+		{
+			name:           "three nodes replaced by one",
+			bigTemplateCpu: 2000,
+			wantNewNodes:   1,
+			wantRemoved:    3,
+			wantSavings:    2.0 / 3.0,
+		},
+		{
+			name:           "savings below minimum ratio",
+			modifyOptions:  func(o *config.AutoscalingOptions) { o.ConsolidationMinSavingsRatio = 0.7 },
+			bigTemplateCpu: 2000,
+		},
+		{
+			name:           "limited number of nodes",
+			modifyOptions:  func(o *config.AutoscalingOptions) { o.ConsolidationMaxNodes = 2 },
+			bigTemplateCpu: 2000,
+			wantNewNodes:   1,
+			wantRemoved:    2,
+			wantSavings:    0.5,
+		},
+		{
+			name:           "limited number of pods to reschedule",
+			modifyOptions:  func(o *config.AutoscalingOptions) { o.ConsolidationMaxPodsToReschedule = 2 },
+			bigTemplateCpu: 2000,
+			wantNewNodes:   1,
+			wantRemoved:    2,
+			wantSavings:    0.5,
+		},
+		{
+			name:           "node group at min size",
+			smallMin:       2,
+			bigTemplateCpu: 2000,
+		},
+		{
+			name:           "scale down disabled on nodes",
+			bigTemplateCpu: 2000,
+			disabledNodes:  []string{"s1", "s2"},
+		},
+		{
+			name:           "pods don't fit the template",
+			bigTemplateCpu: 400,
+		},
+		{
+			name:           "cheaper nodes",
+			bigTemplateCpu: 2000,
+			prices:         map[string]float64{"s1": 1, "s2": 1, "s3": 1, "big-template": 1.5},
+			wantNewNodes:   1,
+			wantRemoved:    3,
+			wantSavings:    0.5,
+		},
+		{
+			name:           "more expensive nodes",
+			bigTemplateCpu: 2000,
+			prices:         map[string]float64{"s1": 1, "s2": 1, "s3": 1, "big-template": 3},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			options := defaultOptions()
+			if tc.modifyOptions != nil {
+				tc.modifyOptions(&options)
+			}
+			cluster := newTestCluster(t, options, tc.smallMin, tc.bigTemplateCpu)
+			if tc.prices != nil {
+				cluster.provider.SetPricingModel(&testPricingModel{nodePrice: tc.prices})
+			}
+			for _, name := range tc.disabledNodes {
+				for _, node := range cluster.nodes {
+					if node.Name == name {
+						node.Annotations = map[string]string{legacy.ScaleDownDisabledKey: "true"}
+					}
+				}
+			}
+
+			planner := NewPlanner(cluster.context, cluster.csr)
+			plan, err := planner.Plan(cluster.nodes, cluster.nodeInfos, nil, time.Now())
+			assert.NoError(t, err)
+			if tc.wantNewNodes == 0 {
+				assert.Nil(t, plan)
+				return
+			}
+			if assert.NotNil(t, plan) {
+				assert.Equal(t, "big", plan.NodeGroup.Id())
+				assert.Equal(t, tc.wantNewNodes, plan.NewNodes)
+				assert.Len(t, plan.NodesToRemove, tc.wantRemoved)
+				assert.InDelta(t, tc.wantSavings, plan.Savings, 0.001)
+			}
+
+			// Planning must leave the cluster snapshot untouched.
+			nodeInfos, listErr := cluster.context.ClusterSnapshot.NodeInfos().List()
+			assert.NoError(t, listErr)
+			assert.Len(t, nodeInfos, len(cluster.nodes))
+		})
+	}
+}
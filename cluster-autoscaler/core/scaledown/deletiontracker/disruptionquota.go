@@ -0,0 +1,84 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deletiontracker
+
+import (
+	"fmt"
+
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// DisruptionQuota is the part of the disruption budget left for new node
+// removals. It is not updated by the NodeDeletionTracker, removals decided
+// on within a single scale-down attempt have to be reserved in the quota.
+type DisruptionQuota struct {
+	budget                config.DisruptionBudget
+	clusterSize           int
+	deletions             int
+	deletionsPerNodeGroup map[string]int
+	evictionsPerNamespace map[string]int
+}
+
+// Check returns an error describing the exceeded limit if removing a node from
+// a node group of the given target size, evicting the given pods, doesn't fit
+// in the quota. A node with more pods from a namespace than the per-namespace
+// eviction limit fits if no pods were evicted from the namespace recently, its
+// evictions are paced during the drain.
+func (q *DisruptionQuota) Check(nodeGroupId string, nodeGroupSize int, pods []*apiv1.Pod) error {
+	if limit := q.budget.MaxNodesDeletingOf(q.clusterSize); limit > 0 && q.deletions >= limit {
+		return fmt.Errorf("%d nodes are already being deleted in the cluster, the limit is %d", q.deletions, limit)
+	}
+	if limit := q.budget.MaxNodesDeletingPerNodeGroupOf(nodeGroupSize); limit > 0 && q.deletionsPerNodeGroup[nodeGroupId] >= limit {
+		return fmt.Errorf("%d nodes are already being deleted in node group %s, the limit is %d", q.deletionsPerNodeGroup[nodeGroupId], nodeGroupId, limit)
+	}
+	if limit := q.budget.MaxEvictionsPerMinutePerNamespace; limit > 0 {
+		for namespace, count := range podsPerNamespace(pods) {
+			if count > limit && q.evictionsPerNamespace[namespace] == 0 {
+				continue
+			}
+			if q.evictionsPerNamespace[namespace]+count > limit {
+				return fmt.Errorf("evicting %d pods from namespace %s would exceed the limit of %d evictions per minute, %d pods were evicted in the last minute",
+					count, namespace, limit, q.evictionsPerNamespace[namespace])
+			}
+		}
+	}
+	return nil
+}
+
+// Reserve checks if removing a node fits in the quota, as Check does, and if so
+// counts the removal against the quota.
+func (q *DisruptionQuota) Reserve(nodeGroupId string, nodeGroupSize int, pods []*apiv1.Pod) error {
+	if err := q.Check(nodeGroupId, nodeGroupSize, pods); err != nil {
+		return err
+	}
+	q.deletions++
+	q.deletionsPerNodeGroup[nodeGroupId]++
+	for namespace, count := range podsPerNamespace(pods) {
+		q.evictionsPerNamespace[namespace] += count
+	}
+	return nil
+}
+
+func podsPerNamespace(pods []*apiv1.Pod) map[string]int {
+	result := make(map[string]int)
+	for _, pod := range pods {
+		result[pod.Namespace]++
+	}
+	return result
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deletiontracker
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestDisruptionQuota(t *testing.T) {
+	inNamespace := func(name, namespace string) *apiv1.Pod {
+		pod := BuildTestPod(name, 100, 0)
+		pod.Namespace = namespace
+		return pod
+	}
+
+	testCases := []struct {
+		name           string
+		budget         config.DisruptionBudget
+		clusterSize    int
+		deletions      map[string]int
+		evictions      []string
+		nodeGroupId    string
+		nodeGroupSize  int
+		pods           []*apiv1.Pod
+		wantReserved   int
+		wantFirstError bool
+	}{
+		{
+			name:          "no limits",
+			clusterSize:   10,
+			deletions:     map[string]int{"ng1": 5},
+			nodeGroupId:   "ng1",
+			nodeGroupSize: 10,
+			wantReserved:  3,
+		},
+		{
+			name:          "nodes deleting in cluster",
+			budget:        config.DisruptionBudget{MaxNodesDeleting: intstr.FromInt(3)},
+			clusterSize:   10,
+			deletions:     map[string]int{"ng1": 1, "ng2": 1},
+			nodeGroupId:   "ng1",
+			nodeGroupSize: 5,
+			wantReserved:  1,
+		},
+		{
+			name:           "percentage of nodes deleting in cluster",
+			budget:         config.DisruptionBudget{MaxNodesDeleting: intstr.FromString("20%")},
+			clusterSize:    10,
+			deletions:      map[string]int{"ng2": 2},
+			nodeGroupId:    "ng1",
+			nodeGroupSize:  5,
+			wantFirstError: true,
+		},
+		{
+			name:          "small percentage allows one node",
+			budget:        config.DisruptionBudget{MaxNodesDeleting: intstr.FromString("1%")},
+			clusterSize:   10,
+			nodeGroupId:   "ng1",
+			nodeGroupSize: 5,
+			wantReserved:  1,
+		},
+		{
+			name:          "nodes deleting in node group",
+			budget:        config.DisruptionBudget{MaxNodesDeletingPerNodeGroup: intstr.FromString("50%")},
+			clusterSize:   20,
+			deletions:     map[string]int{"ng1": 1, "ng2": 3},
+			nodeGroupId:   "ng1",
+			nodeGroupSize: 4,
+			wantReserved:  1,
+		},
+		{
+			name:          "evictions per namespace",
+			budget:        config.DisruptionBudget{MaxEvictionsPerMinutePerNamespace: 5},
+			clusterSize:   10,
+			evictions:     []string{"a", "a", "b"},
+			nodeGroupId:   "ng1",
+			nodeGroupSize: 10,
+			pods:          []*apiv1.Pod{inNamespace("p1", "a"), inNamespace("p2", "b")},
+			wantReserved:  3,
+		},
+		{
+			name:          "more pods from a namespace than the limit",
+			budget:        config.DisruptionBudget{MaxEvictionsPerMinutePerNamespace: 1},
+			clusterSize:   10,
+			nodeGroupId:   "ng1",
+			nodeGroupSize: 10,
+			pods:          []*apiv1.Pod{inNamespace("p1", "a"), inNamespace("p2", "a")},
+			wantReserved:  1,
+		},
+		{
+			name:           "more pods from a namespace than the limit after recent evictions",
+			budget:         config.DisruptionBudget{MaxEvictionsPerMinutePerNamespace: 1},
+			clusterSize:    10,
+			evictions:      []string{"a"},
+			nodeGroupId:    "ng1",
+			nodeGroupSize:  10,
+			pods:           []*apiv1.Pod{inNamespace("p1", "a"), inNamespace("p2", "a")},
+			wantFirstError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tracker := NewNodeDeletionTracker(0 * time.Second)
+			for nodeGroupId, count := range tc.deletions {
+				for i := 0; i < count; i++ {
+					tracker.StartDeletion(nodeGroupId, nodeGroupId+string(rune('a'+i)))
+				}
+			}
+			for _, namespace := range tc.evictions {
+				tracker.ReserveNamespaceEviction(namespace, 0)
+			}
+			quota := tracker.DisruptionQuota(tc.budget, tc.clusterSize)
+
+			err := quota.Check(tc.nodeGroupId, tc.nodeGroupSize, tc.pods)
+			if tc.wantFirstError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			reserved := 0
+			for ; reserved < 3; reserved++ {
+				if err := quota.Reserve(tc.nodeGroupId, tc.nodeGroupSize, tc.pods); err != nil {
+					break
+				}
+			}
+			assert.Equal(t, tc.wantReserved, reserved)
+		})
+	}
+}
+
+func TestReserveNamespaceEviction(t *testing.T) {
+	tracker := NewNodeDeletionTracker(0 * time.Second)
+
+	assert.True(t, tracker.ReserveNamespaceEviction("a", 2))
+	assert.True(t, tracker.ReserveNamespaceEviction("a", 2))
+	assert.False(t, tracker.ReserveNamespaceEviction("a", 2))
+	assert.True(t, tracker.ReserveNamespaceEviction("b", 2))
+	assert.True(t, tracker.ReserveNamespaceEviction("a", 0))
+
+	quota := tracker.DisruptionQuota(config.DisruptionBudget{MaxEvictionsPerMinutePerNamespace: 3}, 10)
+	pod := BuildTestPod("p1", 100, 0)
+	pod.Namespace = "a"
+	assert.Error(t, quota.Check("ng1", 10, []*apiv1.Pod{pod}))
+	pod.Namespace = "b"
+	assert.NoError(t, quota.Check("ng1", 10, []*apiv1.Pod{pod}))
+}
@@ -20,6 +20,7 @@ import (
 	"sync"
 	"time"
 
+	"k8s.io/autoscaler/cluster-autoscaler/config"
 	"k8s.io/autoscaler/cluster-autoscaler/processors/status"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/expiring"
 
@@ -28,6 +29,10 @@ import (
 	"k8s.io/utils/clock"
 )
 
+// deletedNodesTTL is how long successfully deleted nodes are reported by
+// DeletedNodes, covering the time it takes to remove their Node objects.
+const deletedNodesTTL = time.Hour
+
 // NodeDeletionTracker keeps track of node deletions.
 type NodeDeletionTracker struct {
 	sync.Mutex
@@ -46,6 +51,10 @@ type NodeDeletionTracker struct {
 	evictionsTTL time.Duration
 	// Helper struct for tracking deletion results.
 	deletionResults *expiring.List
+	// Helper struct for tracking evictions counted against the disruption budget.
+	budgetEvictions *expiring.List
+	// Helper struct for tracking names of successfully deleted nodes.
+	deletedNodes *expiring.List
 }
 
 type deletionResult struct {
@@ -63,6 +72,8 @@ func NewNodeDeletionTracker(podEvictionsTTL time.Duration) *NodeDeletionTracker
 		evictions:             expiring.NewList(),
 		evictionsTTL:          podEvictionsTTL,
 		deletionResults:       expiring.NewList(),
+		budgetEvictions:       expiring.NewList(),
+		deletedNodes:          expiring.NewList(),
 	}
 }
 
@@ -88,6 +99,9 @@ func (n *NodeDeletionTracker) EndDeletion(nodeGroupId, nodeName string, result s
 	defer n.Unlock()
 
 	n.deletionResults.RegisterElement(&deletionResult{nodeName, result})
+	if result.ResultType == status.NodeDeleteOk {
+		n.deletedNodes.RegisterElement(nodeName)
+	}
 	value, found := n.deletionsPerNodeGroup[nodeGroupId]
 	if !found {
 		klog.Errorf("This should never happen, counter for %s in NodeDeletionTracker wasn't found", nodeGroupId)
@@ -111,6 +125,19 @@ func (n *NodeDeletionTracker) DeletionsInProgress() ([]string, []string) {
 	return mapKeysSlice(n.emptyNodeDeletions), mapKeysSlice(n.drainedNodeDeletions)
 }
 
+// DeletedNodes returns names of nodes undergoing deletion and of nodes
+// successfully deleted recently.
+func (n *NodeDeletionTracker) DeletedNodes() []string {
+	n.Lock()
+	defer n.Unlock()
+	n.deletedNodes.DropNotNewerThan(n.clock.Now().Add(-deletedNodesTTL))
+	result := append(mapKeysSlice(n.emptyNodeDeletions), mapKeysSlice(n.drainedNodeDeletions)...)
+	for _, nodeName := range n.deletedNodes.ToSlice() {
+		result = append(result, nodeName.(string))
+	}
+	return result
+}
+
 func mapKeysSlice(m map[string]bool) []string {
 	s := make([]string, len(m))
 	i := 0
@@ -128,6 +155,29 @@ func (n *NodeDeletionTracker) RegisterEviction(pod *apiv1.Pod) {
 	n.evictions.RegisterElement(pod)
 }
 
+// ReserveNamespaceEviction registers an eviction from the namespace against
+// the disruption budget, unless limit pods were already evicted from the
+// namespace in the last minute. It returns whether the eviction was registered.
+// A limit of 0 means no limit.
+func (n *NodeDeletionTracker) ReserveNamespaceEviction(namespace string, limit int) bool {
+	n.Lock()
+	defer n.Unlock()
+	if limit > 0 && n.recentNamespaceEvictions()[namespace] >= limit {
+		return false
+	}
+	n.budgetEvictions.RegisterElement(namespace)
+	return true
+}
+
+func (n *NodeDeletionTracker) recentNamespaceEvictions() map[string]int {
+	n.budgetEvictions.DropNotNewerThan(n.clock.Now().Add(-time.Minute))
+	result := make(map[string]int)
+	for _, namespace := range n.budgetEvictions.ToSlice() {
+		result[namespace.(string)]++
+	}
+	return result
+}
+
 // RecentEvictions returns a list of pods that were recently evicted by Cluster Autoscaler.
 func (n *NodeDeletionTracker) RecentEvictions() []*apiv1.Pod {
 	n.Lock()
@@ -148,6 +198,25 @@ func (n *NodeDeletionTracker) DeletionsCount(nodeGroupId string) int {
 	return n.deletionsPerNodeGroup[nodeGroupId]
 }
 
+// DisruptionQuota returns the part of the disruption budget not used by
+// ongoing deletions and evictions from the last minute, in a cluster of
+// the given number of nodes.
+func (n *NodeDeletionTracker) DisruptionQuota(budget config.DisruptionBudget, clusterSize int) *DisruptionQuota {
+	n.Lock()
+	defer n.Unlock()
+	quota := &DisruptionQuota{
+		budget:                budget,
+		clusterSize:           clusterSize,
+		deletionsPerNodeGroup: make(map[string]int, len(n.deletionsPerNodeGroup)),
+		evictionsPerNamespace: n.recentNamespaceEvictions(),
+	}
+	for nodeGroupId, deletions := range n.deletionsPerNodeGroup {
+		quota.deletionsPerNodeGroup[nodeGroupId] = deletions
+		quota.deletions += deletions
+	}
+	return quota
+}
+
 // DeletionResults returns deletion results in a map form, along with the timestamp of last result.
 func (n *NodeDeletionTracker) DeletionResults() (map[string]status.NodeDeleteResult, time.Time) {
 	n.Lock()
@@ -0,0 +1,540 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package legacy
+
+import (
+	ctx "context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/metrics"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/status"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
+	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
+
+	apiv1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1beta1"
+	kube_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	kube_client "k8s.io/client-go/kubernetes"
+	kube_record "k8s.io/client-go/tools/record"
+	klog "k8s.io/klog/v2"
+	podv1 "k8s.io/kubernetes/pkg/api/v1/pod"
+)
+
+// MaxEvictionBackoff is the maximum time CA waits before retrying an eviction rejected with 429 TooManyRequests.
+const MaxEvictionBackoff = 2 * time.Minute
+
+// drainPollInterval is the maximum time between checks of pods waiting to be evicted or to leave the node.
+var drainPollInterval = 5 * time.Second
+
+// drainProgressEventInterval is the minimum time between events reporting progress of a node drain.
+var drainProgressEventInterval = 30 * time.Second
+
+// podDrainState is the state of a single pod in a node drain.
+type podDrainState int
+
+const (
+	// podWaiting - the pod waits for its eviction to be accepted.
+	podWaiting podDrainState = iota
+	// podEvicted - the eviction of the pod was accepted, the pod waits to leave the node.
+	podEvicted
+	// podDone - the pod left the node, or the drain gave up on it. Final state.
+	podDone
+)
+
+// podDrain tracks a single pod through the drain of its node.
+type podDrain struct {
+	pod   *apiv1.Pod
+	state podDrainState
+	// pdbs are the keys of PodDisruptionBudgets matching the pod.
+	pdbs []string
+	// controller is the UID of the controller of the pod, if any.
+	controller  types.UID
+	attempts    int
+	nextAttempt time.Time
+	backoff     time.Duration
+	// blocked tells if the eviction of the pod has to wait for other pods.
+	blocked bool
+	// reserved tells if the eviction of the pod was counted against the eviction limit of its namespace.
+	reserved  bool
+	evictedAt time.Time
+	// outcome is the outcome of the pod if the drain ended now.
+	outcome status.PodEvictionOutcome
+	lastErr error
+}
+
+// nodeDrain evicts pods from a node one state transition at a time. A pod is
+// only evicted if this doesn't exceed the number of disruptions allowed by its
+// PodDisruptionBudgets, counting pods evicted earlier that haven't left the node
+// yet, and if replacements of pods evicted earlier from the same controller are
+// ready. If reserveEviction is set, a pod is only evicted once it reserves an
+// eviction from its namespace. Evictions rejected with 429 TooManyRequests are
+// retried with backoff.
+type nodeDrain struct {
+	node                      *apiv1.Node
+	client                    kube_client.Interface
+	recorder                  kube_record.EventRecorder
+	podLister                 kube_util.PodLister
+	maxGracefulTerminationSec int
+	waitBetweenRetries        time.Duration
+	podEvictionHeadroom       time.Duration
+	waitForRemoval            bool
+	// reserveEviction counts an eviction from the namespace against the disruption budget,
+	// it returns false if the eviction limit of the namespace is reached.
+	reserveEviction func(namespace string) bool
+
+	pods []*podDrain
+	// pdbLimits is the maximum number of evictions in flight per PodDisruptionBudget.
+	pdbLimits map[string]int
+	// pdbInFlight is the number of evicted pods per PodDisruptionBudget which haven't left the node yet.
+	pdbInFlight map[string]int
+	// replacementsNeeded is the number of ready pods outside of the node a controller needs to have
+	// before the next of its pods is evicted.
+	replacementsNeeded map[types.UID]int
+	// readyPods caches the number of ready pods outside of the node per controller within a single pass.
+	readyPods map[types.UID]int
+}
+
+func newNodeDrain(node *apiv1.Node, pods []*apiv1.Pod, pdbs []*policyv1.PodDisruptionBudget, podLister kube_util.PodLister,
+	client kube_client.Interface, recorder kube_record.EventRecorder, maxGracefulTerminationSec int, waitBetweenRetries time.Duration,
+	podEvictionHeadroom time.Duration, waitForRemoval bool) *nodeDrain {
+	d := &nodeDrain{
+		node:                      node,
+		client:                    client,
+		recorder:                  recorder,
+		podLister:                 podLister,
+		maxGracefulTerminationSec: maxGracefulTerminationSec,
+		waitBetweenRetries:        waitBetweenRetries,
+		podEvictionHeadroom:       podEvictionHeadroom,
+		waitForRemoval:            waitForRemoval,
+		pdbLimits:                 make(map[string]int),
+		pdbInFlight:               make(map[string]int),
+		replacementsNeeded:        make(map[types.UID]int),
+	}
+	for _, pod := range pods {
+		p := &podDrain{pod: pod}
+		if controllerRef := metav1.GetControllerOf(pod); controllerRef != nil {
+			p.controller = controllerRef.UID
+		}
+		for _, pdb := range pdbs {
+			if pdb.Namespace != pod.Namespace {
+				continue
+			}
+			selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+			if err != nil {
+				klog.Errorf("Failed to parse selector of PodDisruptionBudget %s/%s: %v", pdb.Namespace, pdb.Name, err)
+				continue
+			}
+			if !selector.Matches(labels.Set(pod.Labels)) {
+				continue
+			}
+			key := pdb.Namespace + "/" + pdb.Name
+			p.pdbs = append(p.pdbs, key)
+			// Always allow a single eviction, the API server will reject it if the budget doesn't allow it.
+			d.pdbLimits[key] = 1
+			if allowed := int(pdb.Status.DisruptionsAllowed); allowed > 1 {
+				d.pdbLimits[key] = allowed
+			}
+		}
+		d.pods = append(d.pods, p)
+	}
+	return d
+}
+
+// run drives all pods to their final state. Evictions are retried until
+// maxPodEvictionTime passes without any pod being evicted or leaving the node,
+// so time spent pacing evictions doesn't count against pods evicted later.
+// Evicted pods are waited for up to their termination grace period plus
+// podEvictionHeadroom.
+func (d *nodeDrain) run(maxPodEvictionTime time.Duration) {
+	retryUntil := time.Now().Add(maxPodEvictionTime)
+	lastProgressEvent := time.Now()
+	for {
+		now := time.Now()
+		d.readyPods = nil
+		wait := drainPollInterval
+		progress := false
+		for _, p := range d.pods {
+			state := p.state
+			if p.state == podWaiting {
+				d.tryEvict(p, now, retryUntil)
+			}
+			if p.state == podEvicted {
+				d.checkRemoved(p, now)
+			}
+			if p.state != state && p.outcome == status.PodEvicted {
+				progress = true
+			}
+		}
+		if progress {
+			retryUntil = now.Add(maxPodEvictionTime)
+		}
+		if d.finished() {
+			return
+		}
+		for _, p := range d.pods {
+			wait = minDuration(wait, d.nextCheck(p, now, retryUntil))
+		}
+		if now.Sub(lastProgressEvent) >= drainProgressEventInterval {
+			d.recordProgress()
+			lastProgressEvent = now
+		}
+		time.Sleep(wait)
+	}
+}
+
+// recordProgress emits an event on the node summarizing the state of the drain.
+func (d *nodeDrain) recordProgress() {
+	evicted, removed := 0, 0
+	waiting := make(map[status.PodEvictionOutcome]int)
+	for _, p := range d.pods {
+		switch {
+		case p.state == podEvicted:
+			evicted++
+		case p.state == podDone && p.outcome == status.PodEvicted:
+			removed++
+		case p.state == podWaiting:
+			waiting[p.outcome]++
+		}
+	}
+	var reasons []string
+	for outcome, count := range waiting {
+		reasons = append(reasons, fmt.Sprintf("%d %s", count, waitingReason(outcome)))
+	}
+	sort.Strings(reasons)
+	message := fmt.Sprintf("draining the node: %d of %d pods removed, %d evicted and terminating", removed, len(d.pods), evicted)
+	if len(reasons) > 0 {
+		message += ", waiting for eviction: " + strings.Join(reasons, ", ")
+	}
+	d.recorder.Event(d.node, apiv1.EventTypeNormal, "ScaleDown", message)
+}
+
+// waitingReason describes why pods with the given outcome so far are waiting to be evicted.
+func waitingReason(outcome status.PodEvictionOutcome) string {
+	switch outcome {
+	case status.PodEvictionBlockedByPdb:
+		return "blocked by PodDisruptionBudget"
+	case status.PodReplacementNotReady:
+		return "waiting for replacement pods"
+	case status.PodEvictionRateLimited:
+		return "rate limited in namespace"
+	case status.PodEvictionFailed:
+		return "retrying after error"
+	}
+	return "pending"
+}
+
+func (d *nodeDrain) finished() bool {
+	for _, p := range d.pods {
+		if p.state != podDone {
+			return false
+		}
+	}
+	return true
+}
+
+// nextCheck returns how long the pod can wait before its state has to be checked again.
+func (d *nodeDrain) nextCheck(p *podDrain, now, retryUntil time.Time) time.Duration {
+	switch p.state {
+	case podWaiting:
+		if p.blocked {
+			return minDuration(drainPollInterval, retryUntil.Sub(now))
+		}
+		return minDuration(p.nextAttempt.Sub(now), retryUntil.Sub(now))
+	case podEvicted:
+		return d.removalDeadline(p).Sub(now)
+	}
+	return drainPollInterval
+}
+
+func (d *nodeDrain) tryEvict(p *podDrain, now, retryUntil time.Time) {
+	if now.Before(p.nextAttempt) {
+		if !now.Before(retryUntil) {
+			d.fail(p, true, fmt.Errorf("failed to evict pod %s/%s within allowed timeout (last error: %v)", p.pod.Namespace, p.pod.Name, p.lastErr))
+		}
+		return
+	}
+	blocked, outcome, reason := d.blocked(p)
+	p.blocked = blocked
+	if blocked {
+		p.outcome = outcome
+		p.lastErr = fmt.Errorf("%s", reason)
+		if !now.Before(retryUntil) {
+			d.fail(p, true, fmt.Errorf("failed to evict pod %s/%s within allowed timeout: %s", p.pod.Namespace, p.pod.Name, reason))
+		}
+		return
+	}
+
+	if p.attempts == 0 {
+		d.recorder.Eventf(p.pod, apiv1.EventTypeNormal, "ScaleDown", "deleting pod for node scale down")
+	}
+	p.attempts++
+	err := d.evict(p.pod)
+	if err == nil || kube_errors.IsNotFound(err) {
+		p.state = podEvicted
+		p.evictedAt = now
+		p.outcome = status.PodEvicted
+		p.lastErr = nil
+		metrics.RegisterEvictions(1)
+		for _, key := range p.pdbs {
+			d.pdbInFlight[key]++
+		}
+		if p.controller != "" && d.podLister != nil && d.waitForRemoval {
+			d.replacementsNeeded[p.controller] = d.readyPodsOf(p.controller) + 1
+		}
+		return
+	}
+
+	p.lastErr = err
+	if kube_errors.IsTooManyRequests(err) {
+		p.outcome = status.PodEvictionBlockedByPdb
+		p.backoff = nextEvictionBackoff(p.backoff, d.waitBetweenRetries)
+		if delay, ok := kube_errors.SuggestsClientDelay(err); ok && time.Duration(delay)*time.Second > p.backoff {
+			p.backoff = time.Duration(delay) * time.Second
+		}
+		p.nextAttempt = now.Add(p.backoff)
+		klog.V(2).Infof("Eviction of pod %s/%s rejected, retrying in %v: %v", p.pod.Namespace, p.pod.Name, p.backoff, err)
+	} else {
+		p.outcome = status.PodEvictionFailed
+		p.nextAttempt = now.Add(d.waitBetweenRetries)
+	}
+	if !now.Before(retryUntil) {
+		d.fail(p, true, fmt.Errorf("failed to evict pod %s/%s within allowed timeout (last error: %v)", p.pod.Namespace, p.pod.Name, err))
+	}
+}
+
+// blocked checks whether evicting the pod now would exceed the disruptions
+// allowed by its PodDisruptionBudgets, happen before replacements of pods
+// evicted earlier from its controller are ready or exceed the eviction limit
+// of its namespace. Otherwise the eviction is reserved in the namespace.
+func (d *nodeDrain) blocked(p *podDrain) (bool, status.PodEvictionOutcome, string) {
+	for _, key := range p.pdbs {
+		if d.pdbInFlight[key] >= d.pdbLimits[key] {
+			return true, status.PodEvictionBlockedByPdb, fmt.Sprintf("%d pods covered by PodDisruptionBudget %s are already being evicted", d.pdbInFlight[key], key)
+		}
+	}
+	if needed, found := d.replacementsNeeded[p.controller]; found && p.controller != "" {
+		if ready := d.readyPodsOf(p.controller); ready < needed {
+			return true, status.PodReplacementNotReady, fmt.Sprintf("%d of %d pods of its controller are ready outside of the node", ready, needed)
+		}
+	}
+	if d.reserveEviction != nil && !p.reserved {
+		if !d.reserveEviction(p.pod.Namespace) {
+			return true, status.PodEvictionRateLimited, fmt.Sprintf("eviction limit of namespace %s reached", p.pod.Namespace)
+		}
+		p.reserved = true
+	}
+	return false, status.PodEvictionNotFinished, ""
+}
+
+func (d *nodeDrain) evict(pod *apiv1.Pod) error {
+	maxTermination := int64(apiv1.DefaultTerminationGracePeriodSeconds)
+	if pod.Spec.TerminationGracePeriodSeconds != nil {
+		if *pod.Spec.TerminationGracePeriodSeconds < int64(d.maxGracefulTerminationSec) {
+			maxTermination = *pod.Spec.TerminationGracePeriodSeconds
+		} else {
+			maxTermination = int64(d.maxGracefulTerminationSec)
+		}
+	}
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+		},
+		DeleteOptions: &metav1.DeleteOptions{
+			GracePeriodSeconds: &maxTermination,
+		},
+	}
+	return d.client.CoreV1().Pods(pod.Namespace).Evict(ctx.TODO(), eviction)
+}
+
+func (d *nodeDrain) removalDeadline(p *podDrain) time.Time {
+	return p.evictedAt.Add(time.Duration(d.maxGracefulTerminationSec)*time.Second + d.podEvictionHeadroom)
+}
+
+func (d *nodeDrain) checkRemoved(p *podDrain, now time.Time) {
+	removed := true
+	if d.waitForRemoval {
+		podReturned, err := d.client.CoreV1().Pods(p.pod.Namespace).Get(ctx.TODO(), p.pod.Name, metav1.GetOptions{})
+		if err == nil && (podReturned == nil || podReturned.Spec.NodeName == d.node.Name) {
+			klog.V(1).Infof("Not deleted yet %s/%s", p.pod.Namespace, p.pod.Name)
+			removed = false
+		} else if err != nil && !kube_errors.IsNotFound(err) {
+			klog.Errorf("Failed to check pod %s/%s: %v", p.pod.Namespace, p.pod.Name, err)
+			p.lastErr = err
+			removed = false
+		}
+	}
+	if removed {
+		p.state = podDone
+		p.lastErr = nil
+		d.release(p)
+		return
+	}
+	if !now.Before(d.removalDeadline(p)) {
+		p.outcome = status.PodNotRemoved
+		d.fail(p, false, p.lastErr)
+	}
+}
+
+func (d *nodeDrain) fail(p *podDrain, evictionFailed bool, err error) {
+	p.state = podDone
+	p.lastErr = err
+	d.release(p)
+	if evictionFailed {
+		klog.Errorf("Failed to evict pod %s/%s, error: %v", p.pod.Namespace, p.pod.Name, err)
+	}
+	d.recorder.Eventf(p.pod, apiv1.EventTypeWarning, "ScaleDownFailed", "failed to delete pod for ScaleDown: %s after %d attempts", p.outcome, p.attempts)
+}
+
+// release frees the PodDisruptionBudget slots of an evicted pod.
+func (d *nodeDrain) release(p *podDrain) {
+	if p.evictedAt.IsZero() {
+		return
+	}
+	for _, key := range p.pdbs {
+		d.pdbInFlight[key]--
+	}
+}
+
+// readyPodsOf returns the number of ready pods of the controller running outside of the node.
+func (d *nodeDrain) readyPodsOf(controller types.UID) int {
+	if d.readyPods == nil {
+		d.readyPods = make(map[types.UID]int)
+		pods, err := d.podLister.List()
+		if err != nil {
+			klog.Errorf("Failed to list pods: %v", err)
+		}
+		for _, pod := range pods {
+			if pod.Spec.NodeName == d.node.Name || pod.DeletionTimestamp != nil || !podv1.IsPodReady(pod) {
+				continue
+			}
+			if controllerRef := metav1.GetControllerOf(pod); controllerRef != nil {
+				d.readyPods[controllerRef.UID]++
+			}
+		}
+	}
+	return d.readyPods[controller]
+}
+
+// results returns the eviction results of all pods and an error if any of them failed.
+func (d *nodeDrain) results() (map[string]status.PodEvictionResult, errors.AutoscalerError) {
+	evictionResults := make(map[string]status.PodEvictionResult)
+	var evictionErrs []error
+	notRemoved := false
+	for _, p := range d.pods {
+		result := status.PodEvictionResult{Pod: p.pod, Outcome: p.outcome, Attempts: p.attempts}
+		switch p.outcome {
+		case status.PodEvicted:
+		case status.PodNotRemoved:
+			result.TimedOut, result.Err = true, p.lastErr
+			notRemoved = true
+		default:
+			result.TimedOut, result.Err = true, p.lastErr
+			evictionErrs = append(evictionErrs, p.lastErr)
+		}
+		evictionResults[p.pod.Name] = result
+	}
+	if len(evictionErrs) != 0 {
+		return evictionResults, errors.NewAutoscalerError(errors.ApiCallError, "Failed to drain node %s/%s, due to following errors: %v", d.node.Namespace, d.node.Name, evictionErrs)
+	}
+	if notRemoved {
+		return evictionResults, errors.NewAutoscalerError(errors.TransientError, "Failed to drain node %s/%s: pods remaining after timeout", d.node.Namespace, d.node.Name)
+	}
+	return evictionResults, nil
+}
+
+// Performs drain logic on the node. Marks the node as unschedulable and later removes all pods, giving
+// them up to MaxGracefulTerminationTime to finish. Evictions are paced according to the given
+// PodDisruptionBudgets, if podLister is provided, readiness of replacement pods and, if reserveEviction
+// is provided, eviction limits of namespaces.
+func drainNode(node *apiv1.Node, pods []*apiv1.Pod, daemonSetPods []*apiv1.Pod, pdbs []*policyv1.PodDisruptionBudget,
+	podLister kube_util.PodLister, client kube_client.Interface, recorder kube_record.EventRecorder,
+	maxGracefulTerminationSec int, maxPodEvictionTime time.Duration, waitBetweenRetries time.Duration,
+	podEvictionHeadroom time.Duration, reserveEviction func(namespace string) bool) (evictionResults map[string]status.PodEvictionResult, err error) {
+
+	d := newNodeDrain(node, pods, pdbs, podLister, client, recorder, maxGracefulTerminationSec, waitBetweenRetries, podEvictionHeadroom, true)
+	d.reserveEviction = reserveEviction
+	return runNodeDrain(d, daemonSetPods, maxPodEvictionTime)
+}
+
+// evictPodsFromNode creates evictions for all pods on the node, retrying each of them for up to maxPodEvictionTime.
+// It doesn't wait for the evicted pods to actually go away.
+func evictPodsFromNode(node *apiv1.Node, pods []*apiv1.Pod, daemonSetPods []*apiv1.Pod, client kube_client.Interface, recorder kube_record.EventRecorder,
+	maxGracefulTerminationSec int, maxPodEvictionTime time.Duration, waitBetweenRetries time.Duration) (evictionResults map[string]status.PodEvictionResult, err error) {
+
+	d := newNodeDrain(node, pods, nil, nil, client, recorder, maxGracefulTerminationSec, waitBetweenRetries, 0, false)
+	return runNodeDrain(d, daemonSetPods, maxPodEvictionTime)
+}
+
+func runNodeDrain(d *nodeDrain, daemonSetPods []*apiv1.Pod, maxPodEvictionTime time.Duration) (map[string]status.PodEvictionResult, error) {
+	start := time.Now()
+	retryUntil := start.Add(maxPodEvictionTime)
+
+	// Perform eviction of daemonset. We don't want to raise an error if daemonsetPod wasn't evict properly
+	daemonSetConfirmations := make(chan status.PodEvictionResult, len(daemonSetPods))
+	for _, daemonSetPod := range daemonSetPods {
+		go func(podToEvict *apiv1.Pod) {
+			daemonSetConfirmations <- evictPod(podToEvict, true, d.client, d.recorder, d.maxGracefulTerminationSec, retryUntil, d.waitBetweenRetries)
+		}(daemonSetPod)
+	}
+
+	d.run(maxPodEvictionTime)
+
+	for range daemonSetPods {
+		select {
+		case <-daemonSetConfirmations:
+			continue
+		case <-time.After(time.Until(retryUntil) + 5*time.Second):
+			klog.Infof("Timeout when waiting for creating daemonSetPods eviction")
+		}
+		break
+	}
+	evictionResults, err := d.results()
+	if err != nil {
+		return evictionResults, err
+	}
+	if len(d.pods) > 0 {
+		d.recorder.Eventf(d.node, apiv1.EventTypeNormal, "ScaleDown", "drained the node: %d pods evicted in %v", len(d.pods), time.Since(start).Round(time.Second))
+	}
+	return evictionResults, nil
+}
+
+func nextEvictionBackoff(backoff, initial time.Duration) time.Duration {
+	if backoff == 0 {
+		if initial > 0 {
+			return initial
+		}
+		return time.Second
+	}
+	if backoff*2 > MaxEvictionBackoff {
+		return MaxEvictionBackoff
+	}
+	return backoff * 2
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,370 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package legacy
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/processors/status"
+	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+// fakeDrainCluster simulates pods leaving the node after eviction. Evicted
+// pods are reported as still running on the node for removalChecks checks.
+type fakeDrainCluster struct {
+	sync.Mutex
+	node          string
+	removalChecks int
+	rejections    map[string]int
+	evicted       []string
+	removed       map[string]bool
+	checks        map[string]int
+	// inFlightAtEviction is the number of evicted pods still on the node at each eviction.
+	inFlightAtEviction []int
+}
+
+func newFakeDrainCluster(node string, removalChecks int) *fakeDrainCluster {
+	return &fakeDrainCluster{
+		node:          node,
+		removalChecks: removalChecks,
+		rejections:    make(map[string]int),
+		removed:       make(map[string]bool),
+		checks:        make(map[string]int),
+	}
+}
+
+func (c *fakeDrainCluster) client() *fake.Clientset {
+	fakeClient := &fake.Clientset{}
+	fakeClient.Fake.AddReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		c.Lock()
+		defer c.Unlock()
+		eviction := action.(core.CreateAction).GetObject().(*policyv1.Eviction)
+		if c.rejections[eviction.Name] > 0 {
+			c.rejections[eviction.Name]--
+			return true, nil, errors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+		}
+		inFlight := 0
+		for _, name := range c.evicted {
+			if !c.removed[name] {
+				inFlight++
+			}
+		}
+		c.inFlightAtEviction = append(c.inFlightAtEviction, inFlight)
+		c.evicted = append(c.evicted, eviction.Name)
+		return true, nil, nil
+	})
+	fakeClient.Fake.AddReactor("get", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		c.Lock()
+		defer c.Unlock()
+		name := action.(core.GetAction).GetName()
+		c.checks[name]++
+		if c.checks[name] > c.removalChecks {
+			c.removed[name] = true
+			return true, nil, errors.NewNotFound(apiv1.Resource("pod"), name)
+		}
+		pod := BuildTestPod(name, 100, 0)
+		pod.Spec.NodeName = c.node
+		return true, pod, nil
+	})
+	return fakeClient
+}
+
+func (c *fakeDrainCluster) isRemoved(name string) bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.removed[name]
+}
+
+type fakePodLister struct {
+	list func() []*apiv1.Pod
+}
+
+func (l *fakePodLister) List() ([]*apiv1.Pod, error) {
+	return l.list(), nil
+}
+
+func withFastDrainPolling(t *testing.T) {
+	interval := drainPollInterval
+	drainPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { drainPollInterval = interval })
+}
+
+func buildDrainTestPod(name string, labels map[string]string, controller types.UID) *apiv1.Pod {
+	pod := BuildTestPod(name, 100, 0)
+	pod.Labels = labels
+	if controller != "" {
+		pod.OwnerReferences = GenerateOwnerReferences("rs", "ReplicaSet", "apps/v1", controller)
+	}
+	return pod
+}
+
+func TestDrainNodePdbPacing(t *testing.T) {
+	withFastDrainPolling(t)
+	n1 := BuildTestNode("n1", 1000, 1000)
+	cluster := newFakeDrainCluster("n1", 2)
+	fakeClient := cluster.client()
+
+	pods := []*apiv1.Pod{
+		buildDrainTestPod("p1", map[string]string{"app": "a"}, ""),
+		buildDrainTestPod("p2", map[string]string{"app": "a"}, ""),
+		buildDrainTestPod("p3", map[string]string{"app": "a"}, ""),
+	}
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: "pdb", Namespace: "default"},
+		Spec:       policyv1.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "a"}}},
+		Status:     policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: 1},
+	}
+
+	evictionResults, err := drainNode(n1, pods, nil, []*policyv1.PodDisruptionBudget{pdb}, nil, fakeClient,
+		kube_util.CreateEventRecorder(fakeClient), 20, 5*time.Second, 0, PodEvictionHeadroom, nil)
+	assert.NoError(t, err)
+	assert.Len(t, cluster.evicted, 3)
+	// Only one pod covered by the budget was evicted at a time.
+	assert.Equal(t, []int{0, 0, 0}, cluster.inFlightAtEviction)
+	for _, pod := range pods {
+		assert.Equal(t, status.PodEvicted, evictionResults[pod.Name].Outcome)
+		assert.True(t, evictionResults[pod.Name].WasEvictionSuccessful())
+	}
+}
+
+func TestDrainNodeTooManyRequests(t *testing.T) {
+	withFastDrainPolling(t)
+	n1 := BuildTestNode("n1", 1000, 1000)
+	cluster := newFakeDrainCluster("n1", 0)
+	cluster.rejections["p1"] = 2
+	cluster.rejections["p2"] = 1000
+	fakeClient := cluster.client()
+
+	p1 := BuildTestPod("p1", 100, 0)
+	p2 := BuildTestPod("p2", 100, 0)
+	p3 := BuildTestPod("p3", 100, 0)
+
+	evictionResults, err := drainNode(n1, []*apiv1.Pod{p1, p2, p3}, nil, nil, nil, fakeClient,
+		kube_util.CreateEventRecorder(fakeClient), 20, 500*time.Millisecond, 10*time.Millisecond, PodEvictionHeadroom, nil)
+	assert.Error(t, err)
+	assert.Len(t, evictionResults, 3)
+
+	// Rejected twice, evicted on the third attempt.
+	assert.True(t, evictionResults["p1"].WasEvictionSuccessful())
+	assert.Equal(t, status.PodEvicted, evictionResults["p1"].Outcome)
+	assert.Equal(t, 3, evictionResults["p1"].Attempts)
+
+	// Rejected until the timeout, with backoff between the attempts.
+	assert.False(t, evictionResults["p2"].WasEvictionSuccessful())
+	assert.True(t, evictionResults["p2"].TimedOut)
+	assert.Equal(t, status.PodEvictionBlockedByPdb, evictionResults["p2"].Outcome)
+	assert.Greater(t, evictionResults["p2"].Attempts, 1)
+	assert.Less(t, evictionResults["p2"].Attempts, 10)
+
+	// A rejected pod doesn't fail other pods.
+	assert.True(t, evictionResults["p3"].WasEvictionSuccessful())
+	assert.Equal(t, 1, evictionResults["p3"].Attempts)
+}
+
+func TestDrainNodeWaitsForReplacements(t *testing.T) {
+	withFastDrainPolling(t)
+	n1 := BuildTestNode("n1", 1000, 1000)
+	cluster := newFakeDrainCluster("n1", 0)
+	fakeClient := cluster.client()
+
+	p1 := buildDrainTestPod("p1", nil, "rs-uid")
+	p2 := buildDrainTestPod("p2", nil, "rs-uid")
+	replacement := buildDrainTestPod("r1", nil, "rs-uid")
+	replacement.Spec.NodeName = "n2"
+	replacement.Status.Conditions = []apiv1.PodCondition{{Type: apiv1.PodReady, Status: apiv1.ConditionTrue}}
+
+	var listsAfterFirstEviction int
+	podLister := &fakePodLister{list: func() []*apiv1.Pod {
+		if !cluster.isRemoved("p1") {
+			return nil
+		}
+		// The replacement becomes ready a few checks after p1 is gone.
+		listsAfterFirstEviction++
+		if listsAfterFirstEviction < 3 {
+			return nil
+		}
+		return []*apiv1.Pod{replacement}
+	}}
+
+	evictionResults, err := drainNode(n1, []*apiv1.Pod{p1, p2}, nil, nil, podLister, fakeClient,
+		kube_util.CreateEventRecorder(fakeClient), 20, 5*time.Second, 0, PodEvictionHeadroom, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"p1", "p2"}, cluster.evicted)
+	assert.GreaterOrEqual(t, listsAfterFirstEviction, 3)
+	assert.Equal(t, status.PodEvicted, evictionResults["p2"].Outcome)
+}
+
+func TestDrainNodeReplacementNotReady(t *testing.T) {
+	withFastDrainPolling(t)
+	n1 := BuildTestNode("n1", 1000, 1000)
+	cluster := newFakeDrainCluster("n1", 0)
+	fakeClient := cluster.client()
+
+	p1 := buildDrainTestPod("p1", nil, "rs-uid")
+	p2 := buildDrainTestPod("p2", nil, "rs-uid")
+	podLister := &fakePodLister{list: func() []*apiv1.Pod { return nil }}
+
+	evictionResults, err := drainNode(n1, []*apiv1.Pod{p1, p2}, nil, nil, podLister, fakeClient,
+		kube_util.CreateEventRecorder(fakeClient), 20, 100*time.Millisecond, 0, PodEvictionHeadroom, nil)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"p1"}, cluster.evicted)
+	assert.Equal(t, status.PodEvicted, evictionResults["p1"].Outcome)
+	assert.Equal(t, status.PodReplacementNotReady, evictionResults["p2"].Outcome)
+	assert.Equal(t, 0, evictionResults["p2"].Attempts)
+	assert.True(t, evictionResults["p2"].TimedOut)
+}
+
+func TestDrainNodeNamespaceEvictionLimit(t *testing.T) {
+	withFastDrainPolling(t)
+	n1 := BuildTestNode("n1", 1000, 1000)
+	cluster := newFakeDrainCluster("n1", 0)
+	fakeClient := cluster.client()
+
+	p1 := BuildTestPod("p1", 100, 0)
+	p2 := BuildTestPod("p2", 100, 0)
+	p3 := BuildTestPod("p3", 100, 0)
+	p3.Namespace = "other"
+
+	reserved := map[string]int{}
+	var reservations int
+	reserveEviction := func(namespace string) bool {
+		reservations++
+		// The limit of the default namespace is lifted after a few checks.
+		if namespace == "default" && reserved[namespace] >= 1 && reservations < 5 {
+			return false
+		}
+		reserved[namespace]++
+		return true
+	}
+
+	evictionResults, err := drainNode(n1, []*apiv1.Pod{p1, p2, p3}, nil, nil, nil, fakeClient,
+		kube_util.CreateEventRecorder(fakeClient), 20, 5*time.Second, 0, PodEvictionHeadroom, reserveEviction)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"p1", "p2", "p3"}, cluster.evicted)
+	assert.Equal(t, map[string]int{"default": 2, "other": 1}, reserved)
+	assert.GreaterOrEqual(t, reservations, 5)
+	for _, pod := range []*apiv1.Pod{p1, p2, p3} {
+		assert.Equal(t, status.PodEvicted, evictionResults[pod.Name].Outcome)
+	}
+}
+
+func TestDrainNodeNamespaceEvictionLimitTimeout(t *testing.T) {
+	withFastDrainPolling(t)
+	n1 := BuildTestNode("n1", 1000, 1000)
+	cluster := newFakeDrainCluster("n1", 0)
+	fakeClient := cluster.client()
+
+	p1 := BuildTestPod("p1", 100, 0)
+	p2 := BuildTestPod("p2", 100, 0)
+	var evictions int
+	reserveEviction := func(namespace string) bool {
+		if evictions >= 1 {
+			return false
+		}
+		evictions++
+		return true
+	}
+
+	evictionResults, err := drainNode(n1, []*apiv1.Pod{p1, p2}, nil, nil, nil, fakeClient,
+		kube_util.CreateEventRecorder(fakeClient), 20, 100*time.Millisecond, 0, PodEvictionHeadroom, reserveEviction)
+	assert.Error(t, err)
+	assert.Len(t, cluster.evicted, 1)
+	blocked := evictionResults["p2"]
+	if cluster.evicted[0] == "p2" {
+		blocked = evictionResults["p1"]
+	}
+	assert.Equal(t, status.PodEvictionRateLimited, blocked.Outcome)
+	assert.Equal(t, 0, blocked.Attempts)
+	assert.True(t, blocked.TimedOut)
+}
+
+func TestNamespaceEvictionPacingTime(t *testing.T) {
+	inNamespace := func(name, namespace string) *apiv1.Pod {
+		pod := BuildTestPod(name, 100, 0)
+		pod.Namespace = namespace
+		return pod
+	}
+	pods := []*apiv1.Pod{inNamespace("p1", "a"), inNamespace("p2", "a"), inNamespace("p3", "a"), inNamespace("p4", "a"), inNamespace("p5", "b")}
+	assert.Equal(t, time.Duration(0), namespaceEvictionPacingTime(pods, 4))
+	assert.Equal(t, time.Minute, namespaceEvictionPacingTime(pods, 3))
+	assert.Equal(t, time.Minute, namespaceEvictionPacingTime(pods, 2))
+	assert.Equal(t, 3*time.Minute, namespaceEvictionPacingTime(pods, 1))
+	assert.Equal(t, time.Duration(0), namespaceEvictionPacingTime(nil, 1))
+}
+
+func TestDrainNodePacingDoesNotTimeOut(t *testing.T) {
+	withFastDrainPolling(t)
+	interval := drainProgressEventInterval
+	drainProgressEventInterval = 50 * time.Millisecond
+	t.Cleanup(func() { drainProgressEventInterval = interval })
+
+	n1 := BuildTestNode("n1", 1000, 1000)
+	// Each pod stays on the node for ~10 polls after its eviction.
+	cluster := newFakeDrainCluster("n1", 10)
+	fakeClient := cluster.client()
+	recorder := record.NewFakeRecorder(100)
+
+	var pods []*apiv1.Pod
+	for _, name := range []string{"p1", "p2", "p3", "p4"} {
+		pods = append(pods, buildDrainTestPod(name, map[string]string{"app": "a"}, ""))
+	}
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: "pdb", Namespace: "default"},
+		Spec:       policyv1.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "a"}}},
+		Status:     policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: 1},
+	}
+
+	// Evicting the pods one at a time takes longer than maxPodEvictionTime,
+	// but every eviction extends the time left for the remaining pods.
+	start := time.Now()
+	evictionResults, err := drainNode(n1, pods, nil, []*policyv1.PodDisruptionBudget{pdb}, nil, fakeClient,
+		recorder, 20, 150*time.Millisecond, 0, PodEvictionHeadroom, nil)
+	assert.NoError(t, err)
+	assert.Greater(t, int64(time.Since(start)), int64(150*time.Millisecond))
+	assert.Len(t, cluster.evicted, 4)
+	for _, pod := range pods {
+		assert.Equal(t, status.PodEvicted, evictionResults[pod.Name].Outcome)
+	}
+
+	close(recorder.Events)
+	var progress, drained int
+	for event := range recorder.Events {
+		if strings.Contains(event, "draining the node") && strings.Contains(event, "blocked by PodDisruptionBudget") {
+			progress++
+		}
+		if strings.Contains(event, "drained the node: 4 pods evicted") {
+			drained++
+		}
+	}
+	assert.Greater(t, progress, 0)
+	assert.Equal(t, 1, drained)
+}
@@ -18,6 +18,7 @@ package legacy
 
 import (
 	ctx "context"
+	"encoding/json"
 	"fmt"
 	"math"
 	"reflect"
@@ -34,18 +35,22 @@ import (
 	"k8s.io/autoscaler/cluster-autoscaler/processors/customresources"
 	"k8s.io/autoscaler/cluster-autoscaler/simulator"
 	"k8s.io/autoscaler/cluster-autoscaler/simulator/utilization"
+	"k8s.io/autoscaler/cluster-autoscaler/tracing"
 	"k8s.io/autoscaler/cluster-autoscaler/utils"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/daemonset"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/deletetaint"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
 	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
+	pod_util "k8s.io/autoscaler/cluster-autoscaler/utils/pod"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/podgroup"
 	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
 
 	apiv1 "k8s.io/api/core/v1"
 	policyv1 "k8s.io/api/policy/v1beta1"
 	kube_errors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/autoscaler/cluster-autoscaler/processors/status"
@@ -286,6 +291,9 @@ type ScaleDown struct {
 func NewScaleDown(context *context.AutoscalingContext, processors *processors.AutoscalingProcessors, clusterStateRegistry *clusterstate.ClusterStateRegistry) *ScaleDown {
 	usageTracker := simulator.NewUsageTracker()
 	removalSimulator := simulator.NewRemovalSimulator(context.ListerRegistry, context.ClusterSnapshot, context.PredicateChecker, usageTracker)
+	removalSimulator.SetParallelism(context.ScaleDownSimulationParallelism)
+	removalSimulator.SetMaxEvictableEmptyDirSize(context.MaxEvictableEmptyDirSize)
+	nodeDeletionTracker := deletiontracker.NewNodeDeletionTracker(0 * time.Second)
 	return &ScaleDown{
 		context:                context,
 		processors:             processors,
@@ -296,7 +304,7 @@ func NewScaleDown(context *context.AutoscalingContext, processors *processors.Au
 		nodeUtilizationMap:     make(map[string]utilization.Info),
 		usageTracker:           usageTracker,
 		unneededNodesList:      make([]*apiv1.Node, 0),
-		nodeDeletionTracker:    deletiontracker.NewNodeDeletionTracker(0 * time.Second),
+		nodeDeletionTracker:    nodeDeletionTracker,
 		unremovableNodeReasons: make(map[string]*simulator.UnremovableNode),
 		removalSimulator:       removalSimulator,
 	}
@@ -316,6 +324,30 @@ func (sd *ScaleDown) CleanUpUnneededNodes() {
 	sd.unneededNodes = make(map[string]time.Time)
 }
 
+// CheckpointState returns the times since which nodes are unneeded, so that
+// they don't have to be unneeded for ScaleDownUnneededTime again after a restart.
+func (sd *ScaleDown) CheckpointState() ([]byte, error) {
+	if len(sd.unneededNodes) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(sd.unneededNodes)
+}
+
+// RestoreState restores the times since which nodes are unneeded. Nodes which
+// are no longer unneeded are dropped on the next UpdateUnneededNodes call.
+func (sd *ScaleDown) RestoreState(data []byte) error {
+	unneededNodes := make(map[string]time.Time)
+	if err := json.Unmarshal(data, &unneededNodes); err != nil {
+		return err
+	}
+	for name, since := range unneededNodes {
+		if _, found := sd.unneededNodes[name]; !found {
+			sd.unneededNodes[name] = since
+		}
+	}
+	return nil
+}
+
 // UnneededNodes returns a list of nodes that can potentially be scaled down.
 func (sd *ScaleDown) UnneededNodes() []*apiv1.Node {
 	return sd.unneededNodesList
@@ -689,6 +721,10 @@ func (sd *ScaleDown) TryToScaleDown(
 	}
 	ndr, ts := sd.nodeDeletionTracker.DeletionResults()
 	scaleDownStatus := &status.ScaleDownStatus{NodeDeleteResults: ndr, NodeDeleteResultsAsOf: ts}
+	if sd.inBlackoutWindow(sd.unneededNodesList, currentTime) {
+		scaleDownStatus.Result = status.ScaleDownInCooldown
+		return scaleDownStatus, nil
+	}
 	nodeDeletionDuration := time.Duration(0)
 	findNodesToRemoveDuration := time.Duration(0)
 	defer updateScaleDownMetrics(time.Now(), &findNodesToRemoveDuration, &nodeDeletionDuration)
@@ -708,8 +744,6 @@ func (sd *ScaleDown) TryToScaleDown(
 	candidateNames := make([]string, 0)
 	readinessMap := make(map[string]bool)
 	candidateNodeGroups := make(map[string]cloudprovider.NodeGroup)
-	gpuLabel := sd.context.CloudProvider.GPULabel()
-	availableGPUTypes := sd.context.CloudProvider.GetAvailableGPUTypes()
 
 	resourceLimiter, errCP := sd.context.CloudProvider.GetResourceLimiter()
 	if errCP != nil {
@@ -721,6 +755,14 @@ func (sd *ScaleDown) TryToScaleDown(
 
 	nodeGroupSize := utils.GetNodeGroupSizeMap(sd.context.CloudProvider)
 	resourcesWithLimits := resourceLimiter.GetResources()
+	var podGroupNodes map[string]bool
+	if sd.context.PodGroupFinder != nil && sd.context.PodGroupScaleDownUnneededTime > 0 {
+		if pendingPods, err := sd.context.UnschedulablePodLister().List(); err != nil {
+			klog.Errorf("Failed to list unschedulable pods, not scaling down nodes of incomplete pod groups sooner: %v", err)
+		} else {
+			podGroupNodes = nodesWithOnlyIncompletePodGroups(sd.context.PodGroupFinder, sd.context.PodReservations, allNodeInfos, pendingPods, currentTime)
+		}
+	}
 	for nodeName, unneededSince := range sd.unneededNodes {
 		klog.V(2).Infof("%s was unneeded for %s", nodeName, currentTime.Sub(unneededSince).String())
 
@@ -761,6 +803,10 @@ func (sd *ScaleDown) TryToScaleDown(
 				klog.Errorf("Error trying to get ScaleDownUnneededTime for node %s (in group: %s)", node.Name, nodeGroup.Id())
 				continue
 			}
+			// Capacity holding only pods of incomplete pod groups is idle, so it's released sooner.
+			if podGroupNodes[node.Name] && sd.context.PodGroupScaleDownUnneededTime < unneededTime {
+				unneededTime = sd.context.PodGroupScaleDownUnneededTime
+			}
 			if !unneededSince.Add(unneededTime).Before(currentTime) {
 				sd.addUnremovableNodeReason(node, simulator.NotUnneededLongEnough)
 				continue
@@ -821,6 +867,8 @@ func (sd *ScaleDown) TryToScaleDown(
 	// to recreate on other nodes.
 	emptyNodesToRemove := sd.getEmptyNodesToRemove(candidateNames, scaleDownResourcesLeft, currentTime)
 	emptyNodesToRemove = sd.processors.ScaleDownSetProcessor.GetNodesToRemove(sd.context, emptyNodesToRemove, sd.context.MaxEmptyBulkDelete)
+	quota := sd.nodeDeletionTracker.DisruptionQuota(sd.context.ScaleDownDisruptionBudget, len(nodesWithoutMaster))
+	emptyNodesToRemove = sd.filterByDisruptionQuota(emptyNodesToRemove, candidateNodeGroups, nodeGroupSize, quota.Reserve)
 	if len(emptyNodesToRemove) > 0 {
 		nodeDeletionStart := time.Now()
 		deletedNodes, err := sd.scheduleDeleteEmptyNodes(emptyNodesToRemove, sd.context.ClientSet, sd.context.Recorder, readinessMap, candidateNodeGroups)
@@ -858,6 +906,7 @@ func (sd *ScaleDown) TryToScaleDown(
 		scaleDownStatus.Result = status.ScaleDownError
 		return scaleDownStatus, err.AddPrefix("Find node to remove failed: ")
 	}
+	nodesToRemove = sd.filterByDisruptionQuota(nodesToRemove, candidateNodeGroups, nodeGroupSize, quota.Check)
 	nodesToRemove = sd.processors.ScaleDownSetProcessor.GetNodesToRemove(sd.context, nodesToRemove, 1)
 	if len(nodesToRemove) == 0 {
 		klog.V(1).Infof("No node to remove")
@@ -885,27 +934,136 @@ func (sd *ScaleDown) TryToScaleDown(
 	if !found {
 		return scaleDownStatus, errors.NewAutoscalerError(errors.InternalError, "failed to find node group for %s", toRemove.Node.Name)
 	}
+	reason := metrics.Underutilized
+	if !readinessMap[toRemove.Node.Name] {
+		reason = metrics.Unready
+	}
+	sd.scheduleDrainNode(toRemove, nodeGroup, reason, pdbs)
+
+	scaleDownStatus.ScaledDownNodes = sd.mapNodesToStatusScaleDownNodes([]*apiv1.Node{toRemove.Node}, candidateNodeGroups, map[string][]*apiv1.Pod{toRemove.Node.Name: toRemove.PodsToReschedule})
+	scaleDownStatus.Result = status.ScaleDownNodeDeleteStarted
+	return scaleDownStatus, nil
+}
+
+// DrainNodes starts draining and deleting the given nodes, regardless of
+// whether they were found unneeded. It is used to remove nodes which were
+// replaced by a consolidation.
+func (sd *ScaleDown) DrainNodes(nodesToRemove []simulator.NodeToBeRemoved, currentTime time.Time) (*status.ScaleDownStatus, errors.AutoscalerError) {
+	ndr, ts := sd.nodeDeletionTracker.DeletionResults()
+	scaleDownStatus := &status.ScaleDownStatus{NodeDeleteResults: ndr, NodeDeleteResultsAsOf: ts}
+	var nodes []*apiv1.Node
+	for _, toRemove := range nodesToRemove {
+		nodes = append(nodes, toRemove.Node)
+	}
+	if sd.inBlackoutWindow(nodes, currentTime) {
+		scaleDownStatus.Result = status.ScaleDownInCooldown
+		return scaleDownStatus, nil
+	}
+	allNodeInfos, err := sd.context.ClusterSnapshot.NodeInfos().List()
+	if err != nil {
+		return scaleDownStatus, errors.ToAutoscalerError(errors.InternalError, err)
+	}
+
+	nodeGroups := make(map[string]cloudprovider.NodeGroup)
+	var withNodeGroup []simulator.NodeToBeRemoved
+	for _, toRemove := range nodesToRemove {
+		nodeGroup, err := sd.context.CloudProvider.NodeGroupForNode(toRemove.Node)
+		if err != nil || nodeGroup == nil || reflect.ValueOf(nodeGroup).IsNil() {
+			klog.Errorf("Failed to find node group for %s: %v", toRemove.Node.Name, err)
+			continue
+		}
+		nodeGroups[toRemove.Node.Name] = nodeGroup
+		withNodeGroup = append(withNodeGroup, toRemove)
+	}
+	quota := sd.nodeDeletionTracker.DisruptionQuota(sd.context.ScaleDownDisruptionBudget, len(filterOutMasters(allNodeInfos)))
+	nodeGroupSize := utils.GetNodeGroupSizeMap(sd.context.CloudProvider)
+
+	evictedPods := make(map[string][]*apiv1.Pod)
+	pdbs := sd.podDisruptionBudgets()
+	nodes = nil
+	for _, toRemove := range sd.filterByDisruptionQuota(withNodeGroup, nodeGroups, nodeGroupSize, quota.Reserve) {
+		nodeGroup := nodeGroups[toRemove.Node.Name]
+		simulator.RemoveNodeFromTracker(sd.usageTracker, toRemove.Node.Name, sd.unneededNodes)
+		sd.scheduleDrainNode(toRemove, nodeGroup, metrics.Consolidated, pdbs)
+		evictedPods[toRemove.Node.Name] = toRemove.PodsToReschedule
+		nodes = append(nodes, toRemove.Node)
+	}
+	if len(nodes) == 0 {
+		scaleDownStatus.Result = status.ScaleDownNoNodeDeleted
+		return scaleDownStatus, nil
+	}
+	scaleDownStatus.ScaledDownNodes = sd.mapNodesToStatusScaleDownNodes(nodes, nodeGroups, evictedPods)
+	scaleDownStatus.Result = status.ScaleDownNodeDeleteStarted
+	return scaleDownStatus, nil
+}
+
+// inBlackoutWindow checks if scale-down is forbidden by a blackout window.
+// If so, the given nodes are marked unremovable.
+func (sd *ScaleDown) inBlackoutWindow(nodes []*apiv1.Node, currentTime time.Time) bool {
+	window := sd.context.ScaleDownDisruptionBudget.ActiveBlackoutWindow(currentTime)
+	if window == nil {
+		return false
+	}
+	klog.V(1).Infof("Scale-down forbidden by blackout window %s", window)
+	if len(nodes) > 0 {
+		sd.context.LogRecorder.Eventf(apiv1.EventTypeNormal, "ScaleDownBlackout",
+			"Scale-down: %d nodes not removed, scale-down is forbidden by blackout window %s", len(nodes), window)
+	}
+	for _, node := range nodes {
+		sd.addUnremovableNodeReason(node, simulator.InBlackoutWindow)
+	}
+	return true
+}
+
+// filterByDisruptionQuota returns nodes whose removal fits in the disruption
+// quota, as checked by fits. Other nodes are marked unremovable.
+func (sd *ScaleDown) filterByDisruptionQuota(nodesToRemove []simulator.NodeToBeRemoved, nodeGroups map[string]cloudprovider.NodeGroup,
+	nodeGroupSize map[string]int, fits func(nodeGroupId string, nodeGroupSize int, pods []*apiv1.Pod) error) []simulator.NodeToBeRemoved {
+	result := make([]simulator.NodeToBeRemoved, 0, len(nodesToRemove))
+	for _, toRemove := range nodesToRemove {
+		nodeGroup, found := nodeGroups[toRemove.Node.Name]
+		if !found {
+			result = append(result, toRemove)
+			continue
+		}
+		if err := fits(nodeGroup.Id(), nodeGroupSize[nodeGroup.Id()], toRemove.PodsToReschedule); err != nil {
+			klog.V(1).Infof("Skipping %s - disruption budget exceeded: %v", toRemove.Node.Name, err)
+			sd.context.Recorder.Eventf(toRemove.Node, apiv1.EventTypeNormal, "ScaleDownBlocked", "node removal blocked by disruption budget: %v", err)
+			sd.addUnremovableNodeReason(toRemove.Node, simulator.DisruptionBudgetExceeded)
+			continue
+		}
+		result = append(result, toRemove)
+	}
+	return result
+}
+
+// scheduleDrainNode drains and deletes a node in the background.
+func (sd *ScaleDown) scheduleDrainNode(toRemove simulator.NodeToBeRemoved, nodeGroup cloudprovider.NodeGroup, reason metrics.NodeScaleDownReason,
+	pdbs []*policyv1.PodDisruptionBudget) {
+	gpuLabel := sd.context.CloudProvider.GPULabel()
+	availableGPUTypes := sd.context.CloudProvider.GetAvailableGPUTypes()
 	sd.nodeDeletionTracker.StartDeletionWithDrain(nodeGroup.Id(), toRemove.Node.Name)
+	for _, pod := range toRemove.PodsToReschedule {
+		sd.nodeDeletionTracker.RegisterEviction(pod)
+	}
+	parentSpan := tracing.Current()
 
 	go func() {
 		// Finishing the delete process once this goroutine is over.
 		var result status.NodeDeleteResult
 		defer func() { sd.nodeDeletionTracker.EndDeletion(nodeGroup.Id(), toRemove.Node.Name, result) }()
-		result = sd.deleteNode(toRemove.Node, toRemove.PodsToReschedule, toRemove.DaemonSetPods, nodeGroup)
+		span := parentSpan.StartChild("DrainNode", tracing.String("node", toRemove.Node.Name), tracing.String("node_group", nodeGroup.Id()),
+			tracing.Int("pods", len(toRemove.PodsToReschedule)), tracing.Int("daemonset_pods", len(toRemove.DaemonSetPods)))
+		result = sd.deleteNode(toRemove.Node, toRemove.PodsToReschedule, toRemove.DaemonSetPods, pdbs, nodeGroup)
+		span.RecordError(result.Err)
+		span.End()
 		if result.ResultType != status.NodeDeleteOk {
 			klog.Errorf("Failed to delete %s: %v", toRemove.Node.Name, result.Err)
 			return
 		}
-		if readinessMap[toRemove.Node.Name] {
-			metrics.RegisterScaleDown(1, gpu.GetGpuTypeForMetrics(gpuLabel, availableGPUTypes, toRemove.Node, nodeGroup), metrics.Underutilized)
-		} else {
-			metrics.RegisterScaleDown(1, gpu.GetGpuTypeForMetrics(gpuLabel, availableGPUTypes, toRemove.Node, nodeGroup), metrics.Unready)
-		}
+		metrics.RegisterScaleDown(1, gpu.GetGpuTypeForMetrics(gpuLabel, availableGPUTypes, toRemove.Node, nodeGroup), reason)
+		metrics.RegisterNodeGroupScaleDown(nodeGroup.Id(), 1, reason)
 	}()
-
-	scaleDownStatus.ScaledDownNodes = sd.mapNodesToStatusScaleDownNodes([]*apiv1.Node{toRemove.Node}, candidateNodeGroups, map[string][]*apiv1.Pod{toRemove.Node.Name: toRemove.PodsToReschedule})
-	scaleDownStatus.Result = status.ScaleDownNodeDeleteStarted
-	return scaleDownStatus, nil
 }
 
 // updateScaleDownMetrics registers duration of different parts of scale down.
@@ -1034,11 +1192,12 @@ func (sd *ScaleDown) scheduleDeleteEmptyNodes(emptyNodesToRemove []simulator.Nod
 				result = status.NodeDeleteResult{ResultType: status.NodeDeleteErrorFailedToDelete, Err: deleteErr}
 				return
 			}
-			if readinessMap[nodeToDelete.Name] {
-				metrics.RegisterScaleDown(1, gpu.GetGpuTypeForMetrics(sd.context.CloudProvider.GPULabel(), sd.context.CloudProvider.GetAvailableGPUTypes(), nodeToDelete, nodeGroupForDeletedNode), metrics.Empty)
-			} else {
-				metrics.RegisterScaleDown(1, gpu.GetGpuTypeForMetrics(sd.context.CloudProvider.GPULabel(), sd.context.CloudProvider.GetAvailableGPUTypes(), nodeToDelete, nodeGroupForDeletedNode), metrics.Unready)
+			reason := metrics.Empty
+			if !readinessMap[nodeToDelete.Name] {
+				reason = metrics.Unready
 			}
+			metrics.RegisterScaleDown(1, gpu.GetGpuTypeForMetrics(sd.context.CloudProvider.GPULabel(), sd.context.CloudProvider.GetAvailableGPUTypes(), nodeToDelete, nodeGroupForDeletedNode), reason)
+			metrics.RegisterNodeGroupScaleDown(nodeGroupForDeletedNode.Id(), 1, reason)
 			result = status.NodeDeleteResult{ResultType: status.NodeDeleteOk}
 		}(empty.Node, nodeGroup, sd.context.DaemonSetEvictionForEmptyNodes)
 	}
@@ -1087,7 +1246,24 @@ func evictDaemonSetPods(clusterSnapshot simulator.ClusterSnapshot, nodeToDelete
 	return nil
 }
 
-func (sd *ScaleDown) deleteNode(node *apiv1.Node, pods []*apiv1.Pod, daemonSetPods []*apiv1.Pod,
+// namespaceEvictionPacingTime returns how much longer than usual evicting the
+// pods may take, if evictions from each namespace are limited to limit per minute.
+func namespaceEvictionPacingTime(pods []*apiv1.Pod, limit int) time.Duration {
+	perNamespace := make(map[string]int)
+	maxPods := 0
+	for _, pod := range pods {
+		perNamespace[pod.Namespace]++
+		if perNamespace[pod.Namespace] > maxPods {
+			maxPods = perNamespace[pod.Namespace]
+		}
+	}
+	if maxPods <= limit {
+		return 0
+	}
+	return time.Duration((maxPods-1)/limit) * time.Minute
+}
+
+func (sd *ScaleDown) deleteNode(node *apiv1.Node, pods []*apiv1.Pod, daemonSetPods []*apiv1.Pod, pdbs []*policyv1.PodDisruptionBudget,
 	nodeGroup cloudprovider.NodeGroup) status.NodeDeleteResult {
 	deleteSuccessful := false
 	drainSuccessful := false
@@ -1114,8 +1290,29 @@ func (sd *ScaleDown) deleteNode(node *apiv1.Node, pods []*apiv1.Pod, daemonSetPo
 	daemonSetPods = daemonset.PodsToEvict(daemonSetPods, sd.context.DaemonSetEvictionForOccupiedNodes)
 
 	// attempt drain
-	evictionResults, err := drainNode(node, pods, daemonSetPods, sd.context.ClientSet, sd.context.Recorder, sd.context.MaxGracefulTerminationSec, sd.context.AutoscalingOptions.MaxPodEvictionTime, EvictionRetryTime, PodEvictionHeadroom)
+	var evictionResults map[string]status.PodEvictionResult
+	var err error
+	if sd.context.DryRun {
+		// Dry run evictions never remove the pods, so there is nothing to wait for.
+		evictionResults, err = evictPodsFromNode(node, pods, daemonSetPods, sd.context.ClientSet, sd.context.Recorder, sd.context.MaxGracefulTerminationSec, sd.context.AutoscalingOptions.MaxPodEvictionTime, EvictionRetryTime)
+	} else {
+		maxPodEvictionTime := sd.context.AutoscalingOptions.MaxPodEvictionTime
+		var reserveEviction func(namespace string) bool
+		if limit := sd.context.ScaleDownDisruptionBudget.MaxEvictionsPerMinutePerNamespace; limit > 0 {
+			reserveEviction = func(namespace string) bool {
+				return sd.nodeDeletionTracker.ReserveNamespaceEviction(namespace, limit)
+			}
+			maxPodEvictionTime += namespaceEvictionPacingTime(pods, limit)
+		}
+		evictionResults, err = drainNode(node, pods, daemonSetPods, pdbs, sd.context.ListerRegistry.ScheduledPodLister(), sd.context.ClientSet,
+			sd.context.Recorder, sd.context.MaxGracefulTerminationSec, maxPodEvictionTime, EvictionRetryTime, PodEvictionHeadroom, reserveEviction)
+	}
 	if err != nil {
+		for _, result := range evictionResults {
+			if !result.WasEvictionSuccessful() {
+				klog.Warningf("Pod %s/%s blocks drain of %s: %s after %d attempts", result.Pod.Namespace, result.Pod.Name, node.Name, result.Outcome, result.Attempts)
+			}
+		}
 		return status.NodeDeleteResult{ResultType: status.NodeDeleteErrorFailedToEvictPods, Err: err, PodEvictionResults: evictionResults}
 	}
 	drainSuccessful = true
@@ -1134,6 +1331,19 @@ func (sd *ScaleDown) deleteNode(node *apiv1.Node, pods []*apiv1.Pod, daemonSetPo
 	return status.NodeDeleteResult{ResultType: status.NodeDeleteOk}
 }
 
+// podDisruptionBudgets returns all PodDisruptionBudgets, or nil if they can't be listed.
+func (sd *ScaleDown) podDisruptionBudgets() []*policyv1.PodDisruptionBudget {
+	if sd.context.ListerRegistry.PodDisruptionBudgetLister() == nil {
+		return nil
+	}
+	pdbs, err := sd.context.ListerRegistry.PodDisruptionBudgetLister().List()
+	if err != nil {
+		klog.Errorf("Failed to list PodDisruptionBudgets, evictions won't be paced: %v", err)
+		return nil
+	}
+	return pdbs
+}
+
 func evictPod(podToEvict *apiv1.Pod, isDaemonSetPod bool, client kube_client.Interface, recorder kube_record.EventRecorder,
 	maxGracefulTerminationSec int, retryUntil time.Time, waitBetweenRetries time.Duration) status.PodEvictionResult {
 	recorder.Eventf(podToEvict, apiv1.EventTypeNormal, "ScaleDown", "deleting pod for node scale down")
@@ -1171,98 +1381,6 @@ func evictPod(podToEvict *apiv1.Pod, isDaemonSetPod bool, client kube_client.Int
 	return status.PodEvictionResult{Pod: podToEvict, TimedOut: true, Err: fmt.Errorf("failed to evict pod %s/%s within allowed timeout (last error: %v)", podToEvict.Namespace, podToEvict.Name, lastError)}
 }
 
-// Performs drain logic on the node. Marks the node as unschedulable and later removes all pods, giving
-// them up to MaxGracefulTerminationTime to finish.
-func drainNode(node *apiv1.Node, pods []*apiv1.Pod, daemonSetPods []*apiv1.Pod, client kube_client.Interface, recorder kube_record.EventRecorder,
-	maxGracefulTerminationSec int, maxPodEvictionTime time.Duration, waitBetweenRetries time.Duration,
-	podEvictionHeadroom time.Duration) (evictionResults map[string]status.PodEvictionResult, err error) {
-
-	evictionResults = make(map[string]status.PodEvictionResult)
-	retryUntil := time.Now().Add(maxPodEvictionTime)
-	confirmations := make(chan status.PodEvictionResult, len(pods))
-	daemonSetConfirmations := make(chan status.PodEvictionResult, len(daemonSetPods))
-	for _, pod := range pods {
-		evictionResults[pod.Name] = status.PodEvictionResult{Pod: pod, TimedOut: true, Err: nil}
-		go func(podToEvict *apiv1.Pod) {
-			confirmations <- evictPod(podToEvict, false, client, recorder, maxGracefulTerminationSec, retryUntil, waitBetweenRetries)
-		}(pod)
-	}
-
-	// Perform eviction of daemonset. We don't want to raise an error if daemonsetPod wasn't evict properly
-	for _, daemonSetPod := range daemonSetPods {
-		go func(podToEvict *apiv1.Pod) {
-			daemonSetConfirmations <- evictPod(podToEvict, true, client, recorder, maxGracefulTerminationSec, retryUntil, waitBetweenRetries)
-		}(daemonSetPod)
-
-	}
-
-	podsEvictionCounter := 0
-	for i := 0; i < len(pods)+len(daemonSetPods); i++ {
-		select {
-		case evictionResult := <-confirmations:
-			podsEvictionCounter++
-			evictionResults[evictionResult.Pod.Name] = evictionResult
-			if evictionResult.WasEvictionSuccessful() {
-				metrics.RegisterEvictions(1)
-			}
-		case <-daemonSetConfirmations:
-		case <-time.After(retryUntil.Sub(time.Now()) + 5*time.Second):
-			if podsEvictionCounter < len(pods) {
-				// All pods initially had results with TimedOut set to true, so the ones that didn't receive an actual result are correctly marked as timed out.
-				return evictionResults, errors.NewAutoscalerError(errors.ApiCallError, "Failed to drain node %s/%s: timeout when waiting for creating evictions", node.Namespace, node.Name)
-			}
-			klog.Infof("Timeout when waiting for creating daemonSetPods eviction")
-		}
-	}
-
-	evictionErrs := make([]error, 0)
-	for _, result := range evictionResults {
-		if !result.WasEvictionSuccessful() {
-			evictionErrs = append(evictionErrs, result.Err)
-		}
-	}
-	if len(evictionErrs) != 0 {
-		return evictionResults, errors.NewAutoscalerError(errors.ApiCallError, "Failed to drain node %s/%s, due to following errors: %v", node.Namespace, node.Name, evictionErrs)
-	}
-
-	// Evictions created successfully, wait maxGracefulTerminationSec + podEvictionHeadroom to see if pods really disappeared.
-	var allGone bool
-	for start := time.Now(); time.Now().Sub(start) < time.Duration(maxGracefulTerminationSec)*time.Second+podEvictionHeadroom; time.Sleep(5 * time.Second) {
-		allGone = true
-		for _, pod := range pods {
-			podreturned, err := client.CoreV1().Pods(pod.Namespace).Get(ctx.TODO(), pod.Name, metav1.GetOptions{})
-			if err == nil && (podreturned == nil || podreturned.Spec.NodeName == node.Name) {
-				klog.V(1).Infof("Not deleted yet %s/%s", pod.Namespace, pod.Name)
-				allGone = false
-				break
-			}
-			if err != nil && !kube_errors.IsNotFound(err) {
-				klog.Errorf("Failed to check pod %s/%s: %v", pod.Namespace, pod.Name, err)
-				allGone = false
-				break
-			}
-		}
-		if allGone {
-			klog.V(1).Infof("All pods removed from %s", node.Name)
-			// Let the deferred function know there is no need for cleanup
-			return evictionResults, nil
-		}
-	}
-
-	for _, pod := range pods {
-		podReturned, err := client.CoreV1().Pods(pod.Namespace).Get(ctx.TODO(), pod.Name, metav1.GetOptions{})
-		if err == nil && (podReturned == nil || podReturned.Spec.NodeName == node.Name) {
-			evictionResults[pod.Name] = status.PodEvictionResult{Pod: pod, TimedOut: true, Err: nil}
-		} else if err != nil && !kube_errors.IsNotFound(err) {
-			evictionResults[pod.Name] = status.PodEvictionResult{Pod: pod, TimedOut: true, Err: err}
-		} else {
-			evictionResults[pod.Name] = status.PodEvictionResult{Pod: pod, TimedOut: false, Err: nil}
-		}
-	}
-
-	return evictionResults, errors.NewAutoscalerError(errors.TransientError, "Failed to drain node %s/%s: pods remaining after timeout", node.Namespace, node.Name)
-}
-
 // Removes the given node from cloud provider. No extra pre-deletion actions are executed on
 // the Kubernetes side.
 func deleteNodeFromCloudProvider(node *apiv1.Node, cloudProvider cloudprovider.CloudProvider,
@@ -1347,3 +1465,56 @@ func filterOutMasters(nodeInfos []*schedulerframework.NodeInfo) []*apiv1.Node {
 	}
 	return result
 }
+
+// nodesWithOnlyIncompletePodGroups returns names of nodes on which all pods,
+// other than DaemonSet and mirror pods, belong to pod groups with fewer pods
+// running than needed. Only pods bound to nodes and pending pods holding a
+// live reservation on a node being provisioned count towards a pod group, as
+// other pending pods may never be scheduled.
+func nodesWithOnlyIncompletePodGroups(finder *podgroup.Finder, reservations *simulator.PodReservations, nodeInfos []*schedulerframework.NodeInfo, pendingPods []*apiv1.Pod, currentTime time.Time) map[string]bool {
+	var pods []*apiv1.Pod
+	counted := make(map[types.UID]bool)
+	for _, nodeInfo := range nodeInfos {
+		for _, podInfo := range nodeInfo.Pods {
+			// Pending pods may have been placed on nodes in the cluster snapshot.
+			if podInfo.Pod.Spec.NodeName == "" {
+				continue
+			}
+			pods = append(pods, podInfo.Pod)
+			counted[podInfo.Pod.UID] = true
+		}
+	}
+	if reservations != nil {
+		for _, pod := range pendingPods {
+			if counted[pod.UID] {
+				continue
+			}
+			if reservation, found := reservations.Get(pod); found && reservation.ExpireTime.After(currentTime) {
+				pods = append(pods, pod)
+				counted[pod.UID] = true
+			}
+		}
+	}
+	podGroups := finder.Group(pods)
+
+	result := make(map[string]bool)
+	for _, nodeInfo := range nodeInfos {
+		onlyIncomplete := false
+		for _, podInfo := range nodeInfo.Pods {
+			pod := podInfo.Pod
+			if pod_util.IsDaemonSetPod(pod) || pod_util.IsMirrorPod(pod) {
+				continue
+			}
+			podGroup, found := finder.PodGroup(pod)
+			if !found || podGroups[podGroup.Key()].Complete() {
+				onlyIncomplete = false
+				break
+			}
+			onlyIncomplete = true
+		}
+		if onlyIncomplete {
+			result[nodeInfo.Node().Name] = true
+		}
+	}
+	return result
+}
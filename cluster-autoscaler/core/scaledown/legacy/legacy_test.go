@@ -34,6 +34,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	testprovider "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/test"
 	"k8s.io/autoscaler/cluster-autoscaler/clusterstate"
 	"k8s.io/autoscaler/cluster-autoscaler/config"
@@ -44,6 +45,7 @@ import (
 	"k8s.io/autoscaler/cluster-autoscaler/utils/daemonset"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
 	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/podgroup"
 	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/units"
 	"k8s.io/client-go/kubernetes/fake"
@@ -822,7 +824,7 @@ func TestDeleteNode(t *testing.T) {
 			sd := newScaleDownForTesting(&context, clusterStateRegistry)
 
 			// attempt delete
-			result := sd.deleteNode(n1, pods, []*apiv1.Pod{}, provider.GetNodeGroup("ng1"))
+			result := sd.deleteNode(n1, pods, []*apiv1.Pod{}, nil, provider.GetNodeGroup("ng1"))
 
 			// verify
 			if scenario.expectedDeletion {
@@ -871,7 +873,7 @@ func TestDrainNode(t *testing.T) {
 		deletedPods <- eviction.Name
 		return true, nil, nil
 	})
-	_, err := drainNode(n1, []*apiv1.Pod{p1, p2}, []*apiv1.Pod{d1}, fakeClient, kube_util.CreateEventRecorder(fakeClient), 20, 5*time.Second, 0*time.Second, PodEvictionHeadroom)
+	_, err := drainNode(n1, []*apiv1.Pod{p1, p2}, []*apiv1.Pod{d1}, nil, nil, fakeClient, kube_util.CreateEventRecorder(fakeClient), 20, 5*time.Second, 0*time.Second, PodEvictionHeadroom, nil)
 	assert.NoError(t, err)
 	deleted := make([]string, 0)
 	deleted = append(deleted, utils.GetStringFromChan(deletedPods))
@@ -917,7 +919,7 @@ func TestDrainNodeWithRescheduled(t *testing.T) {
 		deletedPods <- eviction.Name
 		return true, nil, nil
 	})
-	_, err := drainNode(n1, []*apiv1.Pod{p1, p2}, []*apiv1.Pod{}, fakeClient, kube_util.CreateEventRecorder(fakeClient), 20, 5*time.Second, 0*time.Second, PodEvictionHeadroom)
+	_, err := drainNode(n1, []*apiv1.Pod{p1, p2}, []*apiv1.Pod{}, nil, nil, fakeClient, kube_util.CreateEventRecorder(fakeClient), 20, 5*time.Second, 0*time.Second, PodEvictionHeadroom, nil)
 	assert.NoError(t, err)
 	deleted := make([]string, 0)
 	deleted = append(deleted, utils.GetStringFromChan(deletedPods))
@@ -967,7 +969,7 @@ func TestDrainNodeWithRetries(t *testing.T) {
 			return true, nil, fmt.Errorf("too many concurrent evictions")
 		}
 	})
-	_, err := drainNode(n1, []*apiv1.Pod{p1, p2, p3}, []*apiv1.Pod{d1}, fakeClient, kube_util.CreateEventRecorder(fakeClient), 20, 5*time.Second, 0*time.Second, PodEvictionHeadroom)
+	_, err := drainNode(n1, []*apiv1.Pod{p1, p2, p3}, []*apiv1.Pod{d1}, nil, nil, fakeClient, kube_util.CreateEventRecorder(fakeClient), 20, 5*time.Second, 0*time.Second, PodEvictionHeadroom, nil)
 	assert.NoError(t, err)
 	deleted := make([]string, 0)
 	deleted = append(deleted, utils.GetStringFromChan(deletedPods))
@@ -1012,7 +1014,7 @@ func TestDrainNodeDaemonSetEvictionFailure(t *testing.T) {
 		}
 		return true, nil, nil
 	})
-	evictionResults, err := drainNode(n1, []*apiv1.Pod{p1, p2}, []*apiv1.Pod{d1, d2}, fakeClient, kube_util.CreateEventRecorder(fakeClient), 20, 0*time.Second, 0*time.Second, PodEvictionHeadroom)
+	evictionResults, err := drainNode(n1, []*apiv1.Pod{p1, p2}, []*apiv1.Pod{d1, d2}, nil, nil, fakeClient, kube_util.CreateEventRecorder(fakeClient), 20, 0*time.Second, 0*time.Second, PodEvictionHeadroom, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, len(evictionResults))
 	assert.Equal(t, p1, evictionResults["p1"].Pod)
@@ -1056,7 +1058,7 @@ func TestDrainNodeEvictionFailure(t *testing.T) {
 		return true, nil, nil
 	})
 
-	evictionResults, err := drainNode(n1, []*apiv1.Pod{p1, p2, p3, p4}, []*apiv1.Pod{}, fakeClient, kube_util.CreateEventRecorder(fakeClient), 20, 0*time.Second, 0*time.Second, PodEvictionHeadroom)
+	evictionResults, err := drainNode(n1, []*apiv1.Pod{p1, p2, p3, p4}, []*apiv1.Pod{}, nil, nil, fakeClient, kube_util.CreateEventRecorder(fakeClient), 20, 0*time.Second, 0*time.Second, PodEvictionHeadroom, nil)
 	assert.Error(t, err)
 	assert.Equal(t, 4, len(evictionResults))
 	assert.Equal(t, *p1, *evictionResults["p1"].Pod)
@@ -1105,7 +1107,7 @@ func TestDrainNodeDisappearanceFailure(t *testing.T) {
 		return true, nil, nil
 	})
 
-	evictionResults, err := drainNode(n1, []*apiv1.Pod{p1, p2, p3, p4}, []*apiv1.Pod{}, fakeClient, kube_util.CreateEventRecorder(fakeClient), 0, 0*time.Second, 0*time.Second, 0*time.Second)
+	evictionResults, err := drainNode(n1, []*apiv1.Pod{p1, p2, p3, p4}, []*apiv1.Pod{}, nil, nil, fakeClient, kube_util.CreateEventRecorder(fakeClient), 0, 0*time.Second, 0*time.Second, 0*time.Second, nil)
 	assert.Error(t, err)
 	assert.Equal(t, 4, len(evictionResults))
 	assert.Equal(t, *p1, *evictionResults["p1"].Pod)
@@ -1218,6 +1220,141 @@ func TestScaleDown(t *testing.T) {
 	assert.Equal(t, n1.Name, utils.GetStringFromChan(updatedNodes))
 }
 
+func TestScaleDownDisruptionBudget(t *testing.T) {
+	now := time.Now()
+	testCases := []struct {
+		name                string
+		budget              config.DisruptionBudget
+		recentEvictions     int
+		deletionsInProgress int
+		expectedResult      status.ScaleDownResult
+		expectedReason      simulator.UnremovableReason
+	}{
+		{
+			name:           "no limits",
+			expectedResult: status.ScaleDownNodeDeleteStarted,
+		},
+		{
+			name: "blackout window",
+			budget: config.DisruptionBudget{
+				BlackoutWindows: []config.TimeWindow{{Start: now.Add(-time.Hour), End: now.Add(time.Hour)}},
+			},
+			expectedResult: status.ScaleDownInCooldown,
+			expectedReason: simulator.InBlackoutWindow,
+		},
+		{
+			name: "past blackout window",
+			budget: config.DisruptionBudget{
+				BlackoutWindows: []config.TimeWindow{{Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)}},
+			},
+			expectedResult: status.ScaleDownNodeDeleteStarted,
+		},
+		{
+			name:            "evictions per namespace exhausted",
+			budget:          config.DisruptionBudget{MaxEvictionsPerMinutePerNamespace: 2},
+			recentEvictions: 2,
+			expectedResult:  status.ScaleDownNoNodeDeleted,
+			expectedReason:  simulator.DisruptionBudgetExceeded,
+		},
+		{
+			name:            "evictions per namespace left",
+			budget:          config.DisruptionBudget{MaxEvictionsPerMinutePerNamespace: 2},
+			recentEvictions: 1,
+			expectedResult:  status.ScaleDownNodeDeleteStarted,
+		},
+		{
+			name:                "nodes deleting in node group",
+			budget:              config.DisruptionBudget{MaxNodesDeletingPerNodeGroup: intstr.FromInt(1)},
+			deletionsInProgress: 1,
+			expectedResult:      status.ScaleDownNoNodeDeleted,
+			expectedReason:      simulator.DisruptionBudgetExceeded,
+		},
+		{
+			name:                "percentage of nodes deleting in cluster",
+			budget:              config.DisruptionBudget{MaxNodesDeleting: intstr.FromString("50%")},
+			deletionsInProgress: 1,
+			expectedResult:      status.ScaleDownNoNodeDeleted,
+			expectedReason:      simulator.DisruptionBudgetExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			deletedNodes := make(chan string, 10)
+			fakeClient := &fake.Clientset{}
+
+			n1 := BuildTestNode("n1", 1000, 1000)
+			SetNodeReadyState(n1, true, time.Time{})
+			n2 := BuildTestNode("n2", 1000, 1000)
+			SetNodeReadyState(n2, true, time.Time{})
+			p1 := BuildTestPod("p1", 100, 0)
+			p1.OwnerReferences = GenerateOwnerReferences("rs", "ReplicaSet", "extensions/v1beta1", "")
+			p1.Spec.NodeName = "n1"
+			p2 := BuildTestPod("p2", 800, 0)
+			p2.Spec.NodeName = "n2"
+
+			fakeClient.Fake.AddReactor("get", "pods", func(action core.Action) (bool, runtime.Object, error) {
+				return true, nil, errors.NewNotFound(apiv1.Resource("pod"), "whatever")
+			})
+			fakeClient.Fake.AddReactor("get", "nodes", func(action core.Action) (bool, runtime.Object, error) {
+				getAction := action.(core.GetAction)
+				switch getAction.GetName() {
+				case n1.Name:
+					return true, n1, nil
+				case n2.Name:
+					return true, n2, nil
+				}
+				return true, nil, fmt.Errorf("wrong node: %v", getAction.GetName())
+			})
+			fakeClient.Fake.AddReactor("update", "nodes", func(action core.Action) (bool, runtime.Object, error) {
+				return true, action.(core.UpdateAction).GetObject(), nil
+			})
+
+			provider := testprovider.NewTestCloudProvider(nil, func(nodeGroup string, node string) error {
+				deletedNodes <- node
+				return nil
+			})
+			provider.AddNodeGroup("ng1", 0, 10, 2)
+			provider.AddNode("ng1", n1)
+			provider.AddNode("ng1", n2)
+
+			options := defaultScaleDownOptions
+			options.ScaleDownDisruptionBudget = tc.budget
+			rsLister, err := kube_util.NewTestReplicaSetLister(generateReplicaSets())
+			assert.NoError(t, err)
+			registry := kube_util.NewListerRegistry(nil, nil, nil, nil, nil, nil, nil, nil, rsLister, nil)
+			context, err := NewScaleTestAutoscalingContext(options, fakeClient, registry, provider, nil, nil)
+			assert.NoError(t, err)
+			nodes := []*apiv1.Node{n1, n2}
+
+			clusterStateRegistry := clusterstate.NewClusterStateRegistry(provider, clusterstate.ClusterStateRegistryConfig{}, context.LogRecorder, NewBackoff())
+			scaleDown := newScaleDownForTesting(&context, clusterStateRegistry)
+			for i := 0; i < tc.recentEvictions; i++ {
+				scaleDown.nodeDeletionTracker.ReserveNamespaceEviction("default", 0)
+			}
+			for i := 0; i < tc.deletionsInProgress; i++ {
+				scaleDown.nodeDeletionTracker.StartDeletion("ng1", fmt.Sprintf("deleted-%d", i))
+			}
+			simulator.InitializeClusterSnapshotOrDie(t, context.ClusterSnapshot, nodes, []*apiv1.Pod{p1, p2})
+			autoscalererr := scaleDown.UpdateUnneededNodes(nodes, nodes, now.Add(-5*time.Minute), nil)
+			assert.NoError(t, autoscalererr)
+			scaleDownStatus, err := scaleDown.TryToScaleDown(now, nil)
+			waitForDeleteToFinish(t, scaleDown)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedResult, scaleDownStatus.Result)
+			if tc.expectedResult == status.ScaleDownNodeDeleteStarted {
+				assert.Equal(t, n1.Name, utils.GetStringFromChan(deletedNodes))
+				return
+			}
+			assert.Equal(t, utils.NothingReturned, utils.GetStringFromChan(deletedNodes))
+			reasons := make(map[string]simulator.UnremovableReason)
+			for _, unremovable := range scaleDown.UnremovableNodes() {
+				reasons[unremovable.Node.Name] = unremovable.Reason
+			}
+			assert.Equal(t, tc.expectedReason, reasons[n1.Name])
+		})
+	}
+}
+
 func waitForDeleteToFinish(t *testing.T, sd *ScaleDown) {
 	for start := time.Now(); time.Since(start) < 20*time.Second; time.Sleep(100 * time.Millisecond) {
 		_, drained := sd.nodeDeletionTracker.DeletionsInProgress()
@@ -2055,3 +2192,123 @@ func generateReplicaSets() []*appsv1.ReplicaSet {
 func newScaleDownForTesting(context *context.AutoscalingContext, clusterStateRegistry *clusterstate.ClusterStateRegistry) *ScaleDown {
 	return NewScaleDown(context, NewTestProcessors(), clusterStateRegistry)
 }
+
+func TestUnneededNodesCheckpoint(t *testing.T) {
+	n1 := BuildTestNode("n1", 1000, 10)
+	n2 := BuildTestNode("n2", 1000, 10)
+	SetNodeReadyState(n1, true, time.Time{})
+	SetNodeReadyState(n2, true, time.Time{})
+	provider := testprovider.NewTestCloudProvider(nil, nil)
+	provider.AddNodeGroup("ng1", 1, 10, 2)
+	provider.AddNode("ng1", n1)
+	provider.AddNode("ng1", n2)
+
+	registry := kube_util.NewListerRegistry(nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	options := config.AutoscalingOptions{
+		NodeGroupDefaults: config.NodeGroupAutoscalingOptions{
+			ScaleDownUtilizationThreshold: 0.5,
+		},
+	}
+	context, err := NewScaleTestAutoscalingContext(options, &fake.Clientset{}, registry, provider, nil, nil)
+	assert.NoError(t, err)
+	clusterStateRegistry := clusterstate.NewClusterStateRegistry(provider, clusterstate.ClusterStateRegistryConfig{}, context.LogRecorder, NewBackoff())
+	allNodes := []*apiv1.Node{n1, n2}
+	simulator.InitializeClusterSnapshotOrDie(t, context.ClusterSnapshot, allNodes, nil)
+
+	startTime := time.Now().UTC().Truncate(time.Second)
+	sd := newScaleDownForTesting(&context, clusterStateRegistry)
+	assert.NoError(t, sd.UpdateUnneededNodes(allNodes, allNodes, startTime, nil))
+	assert.Len(t, sd.unneededNodes, 2)
+	data, err := sd.CheckpointState()
+	assert.NoError(t, err)
+
+	// After a restart nodes are unneeded since the time found before it.
+	restarted := newScaleDownForTesting(&context, clusterStateRegistry)
+	assert.NoError(t, restarted.RestoreState(data))
+	assert.NoError(t, restarted.UpdateUnneededNodes(allNodes, allNodes, startTime.Add(5*time.Minute), nil))
+	assert.Equal(t, map[string]time.Time{"n1": startTime, "n2": startTime}, restarted.unneededNodes)
+}
+
+func TestNodesWithOnlyIncompletePodGroups(t *testing.T) {
+	buildPodGroupPod := func(name, nodeName, group string) *apiv1.Pod {
+		pod := BuildTestPod(name, 100, 0)
+		pod.Spec.NodeName = nodeName
+		pod.Labels = map[string]string{podgroup.PodGroupLabelKey: group}
+		pod.Annotations[podgroup.PodGroupMinMemberAnnotationKey] = "2"
+		return pod
+	}
+	ds := BuildTestPod("ds", 100, 0)
+	ds.OwnerReferences = GenerateOwnerReferences("ds", "DaemonSet", "apps/v1", "")
+	plain := BuildTestPod("plain", 100, 0)
+
+	// Group a has both pods scheduled, groups b and c only one.
+	nodePods := map[string][]*apiv1.Pod{
+		"complete":         {buildPodGroupPod("a1", "complete", "a"), buildPodGroupPod("a2", "complete", "a")},
+		"incomplete":       {buildPodGroupPod("b1", "incomplete", "b"), ds},
+		"incomplete-plain": {buildPodGroupPod("c1", "incomplete-plain", "c"), plain},
+		"empty":            {},
+		"daemon-set-only":  {ds},
+	}
+	var nodeInfos []*schedulerframework.NodeInfo
+	for nodeName, pods := range nodePods {
+		nodeInfo := schedulerframework.NewNodeInfo(pods...)
+		nodeInfo.SetNode(BuildTestNode(nodeName, 1000, 1000))
+		nodeInfos = append(nodeInfos, nodeInfo)
+	}
+
+	now := time.Now()
+	result := nodesWithOnlyIncompletePodGroups(podgroup.NewFinder(nil), nil, nodeInfos, nil, now)
+	assert.Equal(t, map[string]bool{"incomplete": true}, result)
+
+	// A pending pod which may never be scheduled doesn't complete group b.
+	b2 := buildPodGroupPod("b2", "", "b")
+	result = nodesWithOnlyIncompletePodGroups(podgroup.NewFinder(nil), simulator.NewPodReservations(), nodeInfos, []*apiv1.Pod{b2}, now)
+	assert.Equal(t, map[string]bool{"incomplete": true}, result)
+
+	// Neither does a pending pod placed on a node in the cluster snapshot.
+	for _, nodeInfo := range nodeInfos {
+		if nodeInfo.Node().Name == "incomplete" {
+			nodeInfo.AddPod(b2)
+		}
+	}
+	result = nodesWithOnlyIncompletePodGroups(podgroup.NewFinder(nil), nil, nodeInfos, []*apiv1.Pod{b2}, now)
+	assert.Equal(t, map[string]bool{"incomplete": true}, result)
+}
+
+func TestNodesWithOnlyIncompletePodGroupsScaleUpInFlight(t *testing.T) {
+	buildPodGroupPod := func(name, nodeName string) *apiv1.Pod {
+		pod := BuildTestPod(name, 100, 0)
+		pod.Spec.NodeName = nodeName
+		pod.Labels = map[string]string{podgroup.PodGroupLabelKey: "g"}
+		pod.Annotations[podgroup.PodGroupMinMemberAnnotationKey] = "3"
+		return pod
+	}
+	g1 := buildPodGroupPod("g1", "n1")
+	g2 := buildPodGroupPod("g2", "")
+	g3 := buildPodGroupPod("g3", "")
+	nodeInfo := schedulerframework.NewNodeInfo(g1)
+	nodeInfo.SetNode(BuildTestNode("n1", 1000, 1000))
+	nodeInfos := []*schedulerframework.NodeInfo{nodeInfo}
+
+	now := time.Now()
+	result := nodesWithOnlyIncompletePodGroups(podgroup.NewFinder(nil), nil, nodeInfos, []*apiv1.Pod{g2, g3}, now)
+	assert.Equal(t, map[string]bool{"n1": true}, result)
+
+	// Nodes are being provisioned for the pending pods.
+	reservations := simulator.NewPodReservations()
+	reservations.Reserve("ng1", [][]*apiv1.Pod{{g2, g3}}, now.Add(time.Hour))
+	result = nodesWithOnlyIncompletePodGroups(podgroup.NewFinder(nil), reservations, nodeInfos, []*apiv1.Pod{g2, g3}, now)
+	assert.Empty(t, result)
+
+	// Only one of the pending pods holds a reservation.
+	reservations = simulator.NewPodReservations()
+	reservations.Reserve("ng1", [][]*apiv1.Pod{{g2}}, now.Add(time.Hour))
+	result = nodesWithOnlyIncompletePodGroups(podgroup.NewFinder(nil), reservations, nodeInfos, []*apiv1.Pod{g2, g3}, now)
+	assert.Equal(t, map[string]bool{"n1": true}, result)
+
+	// The reservation expired.
+	reservations = simulator.NewPodReservations()
+	reservations.Reserve("ng1", [][]*apiv1.Pod{{g2, g3}}, now.Add(-time.Minute))
+	result = nodesWithOnlyIncompletePodGroups(podgroup.NewFinder(nil), reservations, nodeInfos, []*apiv1.Pod{g2, g3}, now)
+	assert.Equal(t, map[string]bool{"n1": true}, result)
+}
@@ -55,6 +55,16 @@ func (p *ScaleDownWrapper) CleanUpUnneededNodes() {
 	p.sd.CleanUpUnneededNodes()
 }
 
+// CheckpointState returns the checkpointed state of the underlying ScaleDown.
+func (p *ScaleDownWrapper) CheckpointState() ([]byte, error) {
+	return p.sd.CheckpointState()
+}
+
+// RestoreState restores the state of the underlying ScaleDown from a checkpoint.
+func (p *ScaleDownWrapper) RestoreState(data []byte) error {
+	return p.sd.RestoreState(data)
+}
+
 // NodesToDelete lists nodes to delete. Current implementation is a no-op, the
 // wrapper leverages shared state instead.
 // TODO(x13n): Implement this and get rid of sharing state between planning and
@@ -84,6 +94,11 @@ func (p *ScaleDownWrapper) StartDeletion(empty, needDrain []*apiv1.Node, current
 	return p.sd.TryToScaleDown(currentTime, p.pdbs)
 }
 
+// DrainNodes starts draining and deleting the given nodes.
+func (p *ScaleDownWrapper) DrainNodes(nodesToRemove []simulator.NodeToBeRemoved, currentTime time.Time) (*status.ScaleDownStatus, errors.AutoscalerError) {
+	return p.sd.DrainNodes(nodesToRemove, currentTime)
+}
+
 // CheckStatus snapshots current deletion status
 func (p *ScaleDownWrapper) CheckStatus() scaledown.ActuationStatus {
 	// TODO: snapshot information from the tracker instead of keeping live
@@ -91,6 +106,12 @@ func (p *ScaleDownWrapper) CheckStatus() scaledown.ActuationStatus {
 	return p.sd.nodeDeletionTracker
 }
 
+// DeletedNodes returns names of nodes being deleted or recently deleted by
+// the Actuator.
+func (p *ScaleDownWrapper) DeletedNodes() []string {
+	return p.sd.nodeDeletionTracker.DeletedNodes()
+}
+
 // ClearResultsNotNewerThan clears old node deletion results kept by the
 // Actuator.
 func (p *ScaleDownWrapper) ClearResultsNotNewerThan(t time.Time) {
@@ -30,20 +30,27 @@ import (
 	"k8s.io/autoscaler/cluster-autoscaler/clusterstate"
 	"k8s.io/autoscaler/cluster-autoscaler/clusterstate/utils"
 	"k8s.io/autoscaler/cluster-autoscaler/config"
+	"k8s.io/autoscaler/cluster-autoscaler/config/configfile"
 	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/core/quota"
 	"k8s.io/autoscaler/cluster-autoscaler/core/scaledown"
 	"k8s.io/autoscaler/cluster-autoscaler/core/scaledown/actuation"
+	"k8s.io/autoscaler/cluster-autoscaler/core/scaledown/consolidation"
 	"k8s.io/autoscaler/cluster-autoscaler/core/scaledown/legacy"
 	core_utils "k8s.io/autoscaler/cluster-autoscaler/core/utils"
 	"k8s.io/autoscaler/cluster-autoscaler/estimator"
 	"k8s.io/autoscaler/cluster-autoscaler/expander"
 	"k8s.io/autoscaler/cluster-autoscaler/metrics"
 	ca_processors "k8s.io/autoscaler/cluster-autoscaler/processors"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/actionablecluster"
 	"k8s.io/autoscaler/cluster-autoscaler/processors/status"
 	"k8s.io/autoscaler/cluster-autoscaler/simulator"
+	"k8s.io/autoscaler/cluster-autoscaler/tracing"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/backoff"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/checkpoint"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/deletetaint"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
+	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
 	scheduler_utils "k8s.io/autoscaler/cluster-autoscaler/utils/scheduler"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/taints"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/tpu"
@@ -58,6 +65,8 @@ const (
 	// The idea is that nodes with GPU are very expensive and we're ready to sacrifice
 	// a bit more latency to wait for more pods and make a more informed scale-up decision.
 	unschedulablePodWithGpuTimeBuffer = 30 * time.Second
+	// How long to wait for the configuration ConfigMap to be listed on startup.
+	configMapSyncTimeout = time.Minute
 
 	// NodeUpcomingAnnotation is an annotation CA adds to nodes which are upcoming.
 	NodeUpcomingAnnotation = "cluster-autoscaler.k8s.io/upcoming-node"
@@ -74,10 +83,14 @@ type StaticAutoscaler struct {
 	lastScaleDownFailTime   time.Time
 	scaleDownPlanner        scaledown.Planner
 	scaleDownActuator       scaledown.Actuator
+	consolidator            *consolidation.Consolidator
 	processors              *ca_processors.AutoscalingProcessors
 	processorCallbacks      *staticAutoscalerProcessorCallbacks
 	initialized             bool
 	ignoredTaints           taints.TaintKeySet
+	checkpointer            *checkpoint.Checkpointer
+	nodeInfoCheckpointer    *checkpoint.Checkpointer
+	configReloader          *configfile.Reloader
 }
 
 type staticAutoscalerProcessorCallbacks struct {
@@ -125,7 +138,7 @@ func NewStaticAutoscaler(
 	expanderStrategy expander.Strategy,
 	estimatorBuilder estimator.EstimatorBuilder,
 	backoff backoff.Backoff,
-	debuggingSnapshotter debuggingsnapshot.DebuggingSnapshotter) *StaticAutoscaler {
+	debuggingSnapshotter debuggingsnapshot.DebuggingSnapshotter) (*StaticAutoscaler, errors.AutoscalerError) {
 
 	processorCallbacks := newStaticAutoscalerProcessorCallbacks()
 	autoscalingContext := context.NewAutoscalingContext(
@@ -156,6 +169,89 @@ func NewStaticAutoscaler(
 	scaleDown := legacy.NewScaleDown(autoscalingContext, processors, clusterStateRegistry)
 	scaleDownWrapper := legacy.NewScaleDownWrapper(scaleDown)
 	processorCallbacks.scaleDownPlanner = scaleDownWrapper
+	if guardrails, ok := processors.ActionableClusterProcessor.(*actionablecluster.GuardrailsProcessor); ok {
+		guardrails.SetDeletedNodesReporter(scaleDownWrapper)
+		guardrails.SetInstancesReporter(clusterStateRegistry)
+		if opts.ScaleDownKillSwitchConfigMapName != "" {
+			lister, err := kube_util.NewSyncedConfigMapListerForNamespace(autoscalingKubeClients.ClientSet, make(chan struct{}),
+				opts.ConfigNamespace, opts.ScaleDownKillSwitchConfigMapName, configMapSyncTimeout)
+			if err != nil {
+				return nil, errors.ToAutoscalerError(errors.ApiCallError, err)
+			}
+			guardrails.SetKillSwitchLister(lister.ConfigMaps(opts.ConfigNamespace))
+		}
+	}
+
+	var consolidator *consolidation.Consolidator
+	if opts.ConsolidationEnabled {
+		limiter := &consolidationScaleUpLimiter{context: autoscalingContext, processors: processors, clusterStateRegistry: clusterStateRegistry}
+		consolidator = consolidation.NewConsolidator(autoscalingContext, clusterStateRegistry, scaleDownWrapper, limiter)
+	}
+
+	var checkpointer *checkpoint.Checkpointer
+	if opts.StateCheckpointStore != "" {
+		store, err := checkpoint.NewStore(opts.StateCheckpointStore, autoscalingKubeClients.ClientSet, opts.ConfigNamespace, opts.StateCheckpointName)
+		if err != nil {
+			klog.Errorf("State checkpoints are disabled: %v", err)
+		} else {
+			if opts.DryRun {
+				klog.Warningf("Dry run: state is restored from checkpoint %s, but checkpoints aren't persisted", opts.StateCheckpointName)
+			}
+			checkpointer = checkpoint.NewCheckpointer(store, opts.StateCheckpointMaxAge)
+			checkpointer.Register("clusterState", clusterStateRegistry)
+			checkpointer.Register("scaleDown", scaleDownWrapper)
+			if component, ok := backoff.(checkpoint.Component); ok {
+				checkpointer.Register("backoff", component)
+			}
+			if component, ok := autoscalingContext.CloudProvider.(checkpoint.Component); ok {
+				checkpointer.Register("cloudProvider", component)
+			}
+		}
+	}
+
+	var nodeInfoCheckpointer *checkpoint.Checkpointer
+	if opts.NodeInfoCacheConfigMapName != "" {
+		component, ok := processors.TemplateNodeInfoProvider.(checkpoint.Component)
+		if !ok {
+			klog.Warningf("Node info cache is not persisted, template node info provider doesn't support it")
+		} else if store, err := checkpoint.NewStore(checkpoint.ConfigMapStoreType, autoscalingKubeClients.ClientSet, opts.ConfigNamespace, opts.NodeInfoCacheConfigMapName); err != nil {
+			klog.Errorf("Node info cache is not persisted: %v", err)
+		} else {
+			if opts.DryRun {
+				klog.Warningf("Dry run: node info cache is restored from %s, but not persisted", opts.NodeInfoCacheConfigMapName)
+			}
+			nodeInfoCheckpointer = checkpoint.NewCheckpointer(store, opts.NodeInfoCacheExpireTime)
+			nodeInfoCheckpointer.Register("templateNodeInfos", component)
+		}
+	}
+
+	if incrementalSnapshot, ok := clusterSnapshot.(*simulator.IncrementalClusterSnapshot); ok {
+		// The cutoff is read on every Sync, as it may be reloaded.
+		incrementalSnapshot.SetPodFilter(func(pod *apiv1.Pod) bool {
+			return !core_utils.IsExpendablePod(pod, autoscalingContext.ExpendablePodsPriorityCutoff)
+		})
+		if lister, ok := autoscalingKubeClients.ScheduledPodLister().(kube_util.WatchablePodLister); ok {
+			lister.AddEventHandler(incrementalSnapshot)
+		} else {
+			klog.Warningf("Scheduled pod lister doesn't pass pod events, the cluster snapshot will be rebuilt on pod changes")
+		}
+	}
+
+	var configReloader *configfile.Reloader
+	if opts.ConfigFile != "" {
+		configReloader = configfile.NewReloader(configfile.NewFileSource(opts.ConfigFile), opts, autoscalingContext.LogRecorder)
+	} else if opts.ConfigConfigMapName != "" {
+		// Like other listers, this one is never stopped. It's synced before
+		// the first reload, so that the configuration is applied from the
+		// first loop.
+		lister, err := kube_util.NewSyncedConfigMapListerForNamespace(autoscalingKubeClients.ClientSet, make(chan struct{}),
+			opts.ConfigNamespace, opts.ConfigConfigMapName, configMapSyncTimeout)
+		if err != nil {
+			return nil, errors.ToAutoscalerError(errors.ApiCallError, err)
+		}
+		source := configfile.NewConfigMapSource(lister.ConfigMaps(opts.ConfigNamespace), opts.ConfigConfigMapName)
+		configReloader = configfile.NewReloader(source, opts, autoscalingContext.LogRecorder)
+	}
 
 	// Set the initial scale times to be less than the start time so as to
 	// not start in cooldown mode.
@@ -167,11 +263,15 @@ func NewStaticAutoscaler(
 		lastScaleDownFailTime:   initialScaleTime,
 		scaleDownPlanner:        scaleDownWrapper,
 		scaleDownActuator:       scaleDownWrapper,
+		consolidator:            consolidator,
 		processors:              processors,
 		processorCallbacks:      processorCallbacks,
 		clusterStateRegistry:    clusterStateRegistry,
 		ignoredTaints:           ignoredTaints,
-	}
+		checkpointer:            checkpointer,
+		nodeInfoCheckpointer:    nodeInfoCheckpointer,
+		configReloader:          configReloader,
+	}, nil
 }
 
 // Start starts components running in background.
@@ -202,7 +302,16 @@ func (a *StaticAutoscaler) cleanUpIfRequired() {
 	a.initialized = true
 }
 
-func (a *StaticAutoscaler) initializeClusterSnapshot(nodes []*apiv1.Node, scheduledPods []*apiv1.Pod) errors.AutoscalerError {
+func (a *StaticAutoscaler) initializeClusterSnapshot(nodes []*apiv1.Node, scheduledPods []*apiv1.Pod, currentTime time.Time) errors.AutoscalerError {
+	span := tracing.Start("InitializeClusterSnapshot", tracing.Int("nodes", len(nodes)), tracing.Int("scheduled_pods", len(scheduledPods)))
+	defer span.End()
+	if incrementalSnapshot, ok := a.ClusterSnapshot.(*simulator.IncrementalClusterSnapshot); ok {
+		if err := incrementalSnapshot.Sync(nodes, scheduledPods, currentTime); err != nil {
+			klog.Errorf("Failed to sync cluster snapshot: %v", err)
+			return errors.ToAutoscalerError(errors.InternalError, err)
+		}
+		return nil
+	}
 	a.ClusterSnapshot.Clear()
 
 	knownNodes := make(map[string]bool)
@@ -226,9 +335,24 @@ func (a *StaticAutoscaler) initializeClusterSnapshot(nodes []*apiv1.Node, schedu
 
 // RunOnce iterates over node groups and scales them up/down if necessary
 func (a *StaticAutoscaler) RunOnce(currentTime time.Time) errors.AutoscalerError {
+	span := tracing.Start("RunOnce")
+	defer span.End()
+	typedErr := a.runOnce(currentTime)
+	if typedErr != nil {
+		span.RecordError(typedErr)
+	}
+	return typedErr
+}
+
+func (a *StaticAutoscaler) runOnce(currentTime time.Time) errors.AutoscalerError {
+	a.reloadConfig()
 	a.cleanUpIfRequired()
+	defer a.saveCheckpoint(currentTime)
 	a.processorCallbacks.reset()
 	a.clusterStateRegistry.PeriodicCleanup()
+	if a.PodGroupFinder != nil {
+		a.PodGroupFinder.ResetCache()
+	}
 	a.DebuggingSnapshotter.StartDataCollection()
 	defer a.DebuggingSnapshotter.Flush()
 
@@ -277,6 +401,8 @@ func (a *StaticAutoscaler) RunOnce(currentTime time.Time) errors.AutoscalerError
 		klog.Errorf("Failed to refresh cloud provider config: %v", err)
 		return errors.ToAutoscalerError(errors.CloudProviderError, err)
 	}
+	// Node groups are known after the first refresh, so state referring to them can be restored.
+	a.restoreCheckpoint(currentTime)
 
 	// Update node groups min/max after cloud provider refresh
 	for _, nodeGroup := range a.AutoscalingContext.CloudProvider.NodeGroups() {
@@ -286,7 +412,7 @@ func (a *StaticAutoscaler) RunOnce(currentTime time.Time) errors.AutoscalerError
 
 	nonExpendableScheduledPods := core_utils.FilterOutExpendablePods(originalScheduledPods, a.ExpendablePodsPriorityCutoff)
 	// Initialize cluster state to ClusterSnapshot
-	if typedErr := a.initializeClusterSnapshot(allNodes, nonExpendableScheduledPods); typedErr != nil {
+	if typedErr := a.initializeClusterSnapshot(allNodes, nonExpendableScheduledPods, currentTime); typedErr != nil {
 		return typedErr.AddPrefix("Initialize ClusterSnapshot")
 	}
 
@@ -310,6 +436,12 @@ func (a *StaticAutoscaler) RunOnce(currentTime time.Time) errors.AutoscalerError
 	}
 	metrics.UpdateDurationFromStart(metrics.UpdateState, stateUpdateStart)
 
+	quotas, err := quota.Compute(a.QuotaGroups, a.CloudProvider, a.CloudProvider.NodeGroups(), nodeInfosForGroups, currentTime)
+	if err != nil {
+		klog.Warningf("Failed to compute quota usage: %v", err)
+	}
+	quotas.UpdateMetrics()
+
 	scaleUpStatus := &status.ScaleUpStatus{Result: status.ScaleUpNotTried}
 	scaleUpStatusProcessorAlreadyCalled := false
 	scaleDownStatus := &status.ScaleDownStatus{Result: status.ScaleDownNotTried}
@@ -319,6 +451,7 @@ func (a *StaticAutoscaler) RunOnce(currentTime time.Time) errors.AutoscalerError
 		// Update status information when the loop is done (regardless of reason)
 		if autoscalingContext.WriteStatusConfigMap {
 			status := a.clusterStateRegistry.GetStatus(currentTime)
+			status.QuotaGroupStatuses = quotas.Statuses()
 			utils.WriteStatusConfigMap(autoscalingContext.ClientSet, autoscalingContext.ConfigNamespace,
 				status.GetReadableString(), a.AutoscalingContext.LogRecorder, a.AutoscalingContext.StatusConfigMapName)
 		}
@@ -407,18 +540,24 @@ func (a *StaticAutoscaler) RunOnce(currentTime time.Time) errors.AutoscalerError
 	}
 
 	// add upcoming nodes to ClusterSnapshot
-	upcomingNodes := getUpcomingNodeInfos(a.clusterStateRegistry, nodeInfosForGroups)
-	for _, upcomingNode := range upcomingNodes {
-		var pods []*apiv1.Pod
-		for _, podInfo := range upcomingNode.Pods {
-			pods = append(pods, podInfo.Pod)
-		}
-		err = a.ClusterSnapshot.AddNodeWithPods(upcomingNode.Node(), pods)
-		if err != nil {
-			klog.Errorf("Failed to add upcoming node %s to cluster snapshot: %v", upcomingNode.Node().Name, err)
-			return errors.ToAutoscalerError(errors.InternalError, err)
+	upcomingNodeNames := make(map[string][]string)
+	for nodeGroupId, upcomingNodes := range getUpcomingNodeInfos(a.clusterStateRegistry, nodeInfosForGroups) {
+		for _, upcomingNode := range upcomingNodes {
+			var pods []*apiv1.Pod
+			for _, podInfo := range upcomingNode.Pods {
+				pods = append(pods, podInfo.Pod)
+			}
+			err = a.ClusterSnapshot.AddNodeWithPods(upcomingNode.Node(), pods)
+			if err != nil {
+				klog.Errorf("Failed to add upcoming node %s to cluster snapshot: %v", upcomingNode.Node().Name, err)
+				return errors.ToAutoscalerError(errors.InternalError, err)
+			}
+			upcomingNodeNames[nodeGroupId] = append(upcomingNodeNames[nodeGroupId], upcomingNode.Node().Name)
 		}
 	}
+	if a.PodReservations != nil {
+		a.PodReservations.Update(upcomingNodeNames, currentTime)
+	}
 
 	l, err := a.ClusterSnapshot.NodeInfos().List()
 	if err != nil {
@@ -450,7 +589,13 @@ func (a *StaticAutoscaler) RunOnce(currentTime time.Time) errors.AutoscalerError
 		scaleUpStart := time.Now()
 		metrics.UpdateLastTime(metrics.ScaleUp, scaleUpStart)
 
+		span := tracing.Start("ScaleUp", tracing.Int("unschedulable_pods", len(unschedulablePodsToHelp)))
 		scaleUpStatus, typedErr = ScaleUp(autoscalingContext, a.processors, a.clusterStateRegistry, unschedulablePodsToHelp, readyNodes, daemonsets, nodeInfosForGroups, a.ignoredTaints)
+		if scaleUpStatus != nil {
+			span.SetAttributes(tracing.Int("result", int(scaleUpStatus.Result)), tracing.Int("scale_up_infos", len(scaleUpStatus.ScaleUpInfos)))
+		}
+		span.RecordError(typedErr)
+		span.End()
 
 		metrics.UpdateDurationFromStart(metrics.ScaleUp, scaleUpStart)
 
@@ -511,7 +656,11 @@ func (a *StaticAutoscaler) RunOnce(currentTime time.Time) errors.AutoscalerError
 		}
 
 		actuationStatus := a.scaleDownActuator.CheckStatus()
-		if typedErr := a.scaleDownPlanner.UpdateClusterState(podDestinations, scaleDownCandidates, actuationStatus, pdbs, currentTime); typedErr != nil {
+		span := tracing.Start("FindUnneeded", tracing.Int("scale_down_candidates", len(scaleDownCandidates)))
+		typedErr := a.scaleDownPlanner.UpdateClusterState(podDestinations, scaleDownCandidates, actuationStatus, pdbs, currentTime)
+		span.RecordError(typedErr)
+		span.End()
+		if typedErr != nil {
 			scaleDownStatus.Result = status.ScaleDownError
 			klog.Errorf("Failed to scale down: %v", typedErr)
 			return typedErr
@@ -550,7 +699,13 @@ func (a *StaticAutoscaler) RunOnce(currentTime time.Time) errors.AutoscalerError
 			scaleDownStart := time.Now()
 			metrics.UpdateLastTime(metrics.ScaleDown, scaleDownStart)
 			empty, needDrain := a.scaleDownPlanner.NodesToDelete()
+			span := tracing.Start("ScaleDown", tracing.Int("empty_nodes", len(empty)), tracing.Int("nodes_to_drain", len(needDrain)))
 			scaleDownStatus, typedErr := a.scaleDownActuator.StartDeletion(empty, needDrain, currentTime)
+			if scaleDownStatus != nil {
+				span.SetAttributes(tracing.Int("result", int(scaleDownStatus.Result)))
+			}
+			span.RecordError(typedErr)
+			span.End()
 			a.scaleDownActuator.ClearResultsNotNewerThan(scaleDownStatus.NodeDeleteResultsAsOf)
 			metrics.UpdateDurationFromStart(metrics.ScaleDown, scaleDownStart)
 			metrics.UpdateUnremovableNodesCount(countsByReason(a.scaleDownPlanner.UnremovableNodes()))
@@ -570,6 +725,26 @@ func (a *StaticAutoscaler) RunOnce(currentTime time.Time) errors.AutoscalerError
 				actuation.UpdateSoftDeletionTaints(a.AutoscalingContext, taintableNodes, untaintableNodes)
 			}
 
+			if a.consolidator != nil && typedErr == nil && (scaleDownStatus.Result == status.ScaleDownNoNodeDeleted ||
+				scaleDownStatus.Result == status.ScaleDownNoUnneeded) {
+				// Nodes which are unneeded are removed without replacing them.
+				consolidationCandidates := subtractNodes(scaleDownCandidates, a.scaleDownPlanner.UnneededNodes())
+				span := tracing.Start("Consolidation", tracing.Int("candidates", len(consolidationCandidates)))
+				consolidationStatus, err := a.consolidator.RunOnce(consolidationCandidates, nodeInfosForGroups, pdbs, currentTime)
+				span.RecordError(err)
+				span.End()
+				if err != nil {
+					klog.Errorf("Failed to consolidate nodes: %v", err)
+				} else if consolidationStatus != nil {
+					consolidationStatus.RemovedNodeGroups = removedNodeGroups
+					scaleDownStatus = consolidationStatus
+					if scaleDownStatus.Result == status.ScaleDownNodeDeleteStarted {
+						a.lastScaleDownDeleteTime = currentTime
+						a.clusterStateRegistry.Recalculate()
+					}
+				}
+			}
+
 			if a.processors != nil && a.processors.ScaleDownStatusProcessor != nil {
 				scaleDownStatus.SetUnremovableNodesInfo(a.scaleDownPlanner.UnremovableNodes(), a.scaleDownPlanner.NodeUtilizationMap(), a.CloudProvider)
 				a.processors.ScaleDownStatusProcessor.Process(autoscalingContext, scaleDownStatus)
@@ -724,6 +899,53 @@ func (a *StaticAutoscaler) filterOutYoungPods(allUnschedulablePods []*apiv1.Pod,
 	return oldUnschedulablePods
 }
 
+// reloadConfig applies changes of the configuration file, if there is one.
+func (a *StaticAutoscaler) reloadConfig() {
+	if a.configReloader == nil {
+		return
+	}
+	options, changed := a.configReloader.Reload()
+	if !changed {
+		return
+	}
+	cutoffChanged := options.ExpendablePodsPriorityCutoff != a.ExpendablePodsPriorityCutoff
+	a.AutoscalingContext.AutoscalingOptions = options
+	// Pods in the incremental snapshot passed the filter with the previous cutoff.
+	if incrementalSnapshot, ok := a.ClusterSnapshot.(*simulator.IncrementalClusterSnapshot); ok && cutoffChanged {
+		incrementalSnapshot.Clear()
+	}
+}
+
+// restoreCheckpoint restores the state saved by a previous run, if state
+// checkpoints are enabled. Only the first successful restore has any effect.
+func (a *StaticAutoscaler) restoreCheckpoint(currentTime time.Time) {
+	for _, checkpointer := range a.checkpointers() {
+		if err := checkpointer.Restore(currentTime); err != nil {
+			klog.Errorf("Failed to restore state, will retry in the next loop: %v", err)
+		}
+	}
+}
+
+// saveCheckpoint saves the state of the autoscaler, if state checkpoints are enabled.
+func (a *StaticAutoscaler) saveCheckpoint(currentTime time.Time) {
+	for _, checkpointer := range a.checkpointers() {
+		if err := checkpointer.Save(currentTime); err != nil {
+			klog.Errorf("Failed to checkpoint state: %v", err)
+		}
+	}
+}
+
+func (a *StaticAutoscaler) checkpointers() []*checkpoint.Checkpointer {
+	var checkpointers []*checkpoint.Checkpointer
+	if a.checkpointer != nil {
+		checkpointers = append(checkpointers, a.checkpointer)
+	}
+	if a.nodeInfoCheckpointer != nil {
+		checkpointers = append(checkpointers, a.nodeInfoCheckpointer)
+	}
+	return checkpointers
+}
+
 // ExitCleanUp performs all necessary clean-ups when the autoscaler's exiting.
 func (a *StaticAutoscaler) ExitCleanUp() {
 	a.processors.CleanUp()
@@ -779,8 +1001,8 @@ func allPodsAreNew(pods []*apiv1.Pod, currentTime time.Time) bool {
 	return found && oldest.Add(unschedulablePodWithGpuTimeBuffer).After(currentTime)
 }
 
-func getUpcomingNodeInfos(registry *clusterstate.ClusterStateRegistry, nodeInfos map[string]*schedulerframework.NodeInfo) []*schedulerframework.NodeInfo {
-	upcomingNodes := make([]*schedulerframework.NodeInfo, 0)
+func getUpcomingNodeInfos(registry *clusterstate.ClusterStateRegistry, nodeInfos map[string]*schedulerframework.NodeInfo) map[string][]*schedulerframework.NodeInfo {
+	upcomingNodes := make(map[string][]*schedulerframework.NodeInfo)
 	for nodeGroup, numberOfNodes := range registry.GetUpcomingNodes() {
 		nodeTemplate, found := nodeInfos[nodeGroup]
 		if !found {
@@ -797,7 +1019,7 @@ func getUpcomingNodeInfos(registry *clusterstate.ClusterStateRegistry, nodeInfos
 			// Ensure new nodes have different names because nodeName
 			// will be used as a map key. Also deep copy pods (daemonsets &
 			// any pods added by cloud provider on template).
-			upcomingNodes = append(upcomingNodes, scheduler_utils.DeepCopyTemplateNode(nodeTemplate, fmt.Sprintf("upcoming-%d", i)))
+			upcomingNodes[nodeGroup] = append(upcomingNodes[nodeGroup], scheduler_utils.DeepCopyTemplateNode(nodeTemplate, fmt.Sprintf("upcoming-%d", i)))
 		}
 	}
 	return upcomingNodes
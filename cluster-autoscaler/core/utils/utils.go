@@ -126,14 +126,15 @@ func SanitizeNodeInfo(nodeInfo *schedulerframework.NodeInfo, nodeGroupName strin
 func sanitizeTemplateNode(node *apiv1.Node, nodeGroup string, ignoredTaints taints.TaintKeySet) (*apiv1.Node, errors.AutoscalerError) {
 	newNode := node.DeepCopy()
 	nodeName := fmt.Sprintf("template-node-for-%s-%d", nodeGroup, rand.Int63())
-	newNode.Labels = make(map[string]string, len(node.Labels))
+	newNode.Labels = make(map[string]string, len(node.Labels)+1)
 	for k, v := range node.Labels {
-		if k != apiv1.LabelHostname {
-			newNode.Labels[k] = v
-		} else {
-			newNode.Labels[k] = nodeName
-		}
+		newNode.Labels[k] = v
 	}
+	// The hostname label is set even if the template doesn't have it, so that
+	// inter-pod affinity on hostname treats each copy of the template as a
+	// separate node.
+	newNode.Labels[apiv1.LabelHostname] = nodeName
+	labels.UpdateStableTopologyLabels(newNode.Labels)
 	newNode.Name = nodeName
 	newNode.Spec.Taints = taints.SanitizeTaints(newNode.Spec.Taints, ignoredTaints)
 	return newNode, nil
@@ -56,6 +56,27 @@ func TestSanitizeLabels(t *testing.T) {
 	assert.Equal(t, node.Labels[apiv1.LabelHostname], node.Name)
 }
 
+func TestSanitizeTopologyLabels(t *testing.T) {
+	oldNode := BuildTestNode("ng1-1", 1000, 1000)
+	oldNode.Labels = map[string]string{
+		apiv1.LabelZoneFailureDomain: "us-east-1a",
+		apiv1.LabelZoneRegion:        "us-east-1",
+	}
+	node, err := sanitizeTemplateNode(oldNode, "bzium", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, node.Name, node.Labels[apiv1.LabelHostname])
+	assert.Equal(t, "us-east-1a", node.Labels[apiv1.LabelTopologyZone])
+	assert.Equal(t, "us-east-1", node.Labels[apiv1.LabelTopologyRegion])
+	assert.Equal(t, "us-east-1a", node.Labels[apiv1.LabelZoneFailureDomain])
+	assert.Len(t, oldNode.Labels, 2)
+
+	// Stable labels take precedence over deprecated ones.
+	oldNode.Labels[apiv1.LabelTopologyZone] = "us-east-1b"
+	node, err = sanitizeTemplateNode(oldNode, "bzium", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "us-east-1b", node.Labels[apiv1.LabelTopologyZone])
+}
+
 func TestGetNodeResource(t *testing.T) {
 	node := BuildTestNode("n1", 1000, 2*MiB)
 
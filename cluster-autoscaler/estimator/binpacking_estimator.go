@@ -60,14 +60,25 @@ func NewBinpackingNodeEstimator(
 func (estimator *BinpackingNodeEstimator) Estimate(
 	pods []*apiv1.Pod,
 	nodeTemplate *schedulerframework.NodeInfo) int {
+	return len(estimator.EstimatePlacement(pods, nodeTemplate))
+}
+
+// EstimatePlacement works like Estimate, but returns pods packed on each of
+// the needed nodes, in order in which the nodes were added.
+func (estimator *BinpackingNodeEstimator) EstimatePlacement(
+	pods []*apiv1.Pod,
+	nodeTemplate *schedulerframework.NodeInfo) [][]*apiv1.Pod {
 	podInfos := calculatePodScore(pods, nodeTemplate)
 	sort.Slice(podInfos, func(i, j int) bool { return podInfos[i].score > podInfos[j].score })
 
 	newNodeNames := make(map[string]bool)
+	newNodesWithPods := make(map[string]bool)
+	var newNodesOrder []string
+	podsPerNode := make(map[string][]*apiv1.Pod)
 
 	if err := estimator.clusterSnapshot.Fork(); err != nil {
 		klog.Errorf("Error while calling ClusterSnapshot.Fork; %v", err)
-		return 0
+		return nil
 	}
 	defer func() {
 		if err := estimator.clusterSnapshot.Revert(); err != nil {
@@ -76,6 +87,7 @@ func (estimator *BinpackingNodeEstimator) Estimate(
 	}()
 
 	newNodeNameIndex := 0
+	lastNodeName := ""
 
 	for _, podInfo := range podInfos {
 		found := false
@@ -87,27 +99,50 @@ func (estimator *BinpackingNodeEstimator) Estimate(
 			found = true
 			if err := estimator.clusterSnapshot.AddPod(podInfo.pod, nodeName); err != nil {
 				klog.Errorf("Error adding pod %v.%v to node %v in ClusterSnapshot; %v", podInfo.pod.Namespace, podInfo.pod.Name, nodeName, err)
-				return 0
+				return nil
 			}
+			newNodesWithPods[nodeName] = true
+			podsPerNode[nodeName] = append(podsPerNode[nodeName], podInfo.pod)
 		}
 
 		if !found {
-			// Add new node
-			newNodeName, err := estimator.addNewNodeToSnapshot(nodeTemplate, newNodeNameIndex)
-			if err != nil {
-				klog.Errorf("Error while adding new node for template to ClusterSnapshot; %v", err)
-				return 0
+			// Add new node, unless the last one added is still empty: the pod
+			// didn't fit on it, so a pod which fits on a new node might.
+			if lastNodeName == "" || newNodesWithPods[lastNodeName] {
+				newNodeName, err := estimator.addNewNodeToSnapshot(nodeTemplate, newNodeNameIndex)
+				if err != nil {
+					klog.Errorf("Error while adding new node for template to ClusterSnapshot; %v", err)
+					return nil
+				}
+				newNodeNameIndex++
+				newNodeNames[newNodeName] = true
+				newNodesOrder = append(newNodesOrder, newNodeName)
+				lastNodeName = newNodeName
+			}
+			// And try to schedule pod to it. This may still fail, for example
+			// when the pod's topology spread constraints don't allow more pods
+			// in the zone of the template. Such pods can't be helped by the
+			// node group, so they don't count towards its size.
+			if err := estimator.predicateChecker.CheckPredicates(estimator.clusterSnapshot, podInfo.pod, lastNodeName); err != nil {
+				klog.V(4).Infof("Pod %s/%s doesn't fit on a new node %s: %v", podInfo.pod.Namespace, podInfo.pod.Name, lastNodeName, err.VerboseMessage())
+				continue
 			}
-			newNodeNameIndex++
-			// And schedule pod to it
-			if err := estimator.clusterSnapshot.AddPod(podInfo.pod, newNodeName); err != nil {
-				klog.Errorf("Error adding pod %v.%v to node %v in ClusterSnapshot; %v", podInfo.pod.Namespace, podInfo.pod.Name, newNodeName, err)
-				return 0
+			if err := estimator.clusterSnapshot.AddPod(podInfo.pod, lastNodeName); err != nil {
+				klog.Errorf("Error adding pod %v.%v to node %v in ClusterSnapshot; %v", podInfo.pod.Namespace, podInfo.pod.Name, lastNodeName, err)
+				return nil
 			}
-			newNodeNames[newNodeName] = true
+			newNodesWithPods[lastNodeName] = true
+			podsPerNode[lastNodeName] = append(podsPerNode[lastNodeName], podInfo.pod)
+		}
+	}
+
+	result := make([][]*apiv1.Pod, 0, len(newNodesWithPods))
+	for _, nodeName := range newNodesOrder {
+		if newNodesWithPods[nodeName] {
+			result = append(result, podsPerNode[nodeName])
 		}
 	}
-	return len(newNodeNames)
+	return result
 }
 
 func (estimator *BinpackingNodeEstimator) addNewNodeToSnapshot(
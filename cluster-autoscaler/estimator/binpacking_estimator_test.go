@@ -17,11 +17,13 @@ limitations under the License.
 package estimator
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/autoscaler/cluster-autoscaler/simulator"
 	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/units"
@@ -109,6 +111,125 @@ func TestBinpackingEstimateWithPorts(t *testing.T) {
 	assert.Equal(t, 8, estimate)
 }
 
+func TestBinpackingEstimatePlacement(t *testing.T) {
+	estimator := newBinPackingEstimator(t)
+
+	var pods []*apiv1.Pod
+	for i := 0; i < 5; i++ {
+		pods = append(pods, BuildTestPod(fmt.Sprintf("p%d", i), 400, 1000))
+	}
+	node := BuildTestNode("template", 1000, 10000)
+	SetNodeReadyState(node, true, time.Time{})
+	nodeInfo := schedulerframework.NewNodeInfo()
+	nodeInfo.SetNode(node)
+
+	podsPerNode := estimator.EstimatePlacement(pods, nodeInfo)
+	assert.Equal(t, len(podsPerNode), estimator.Estimate(pods, nodeInfo))
+	if assert.Len(t, podsPerNode, 3) {
+		assert.Len(t, podsPerNode[0], 2)
+		assert.Len(t, podsPerNode[1], 2)
+		assert.Len(t, podsPerNode[2], 1)
+	}
+	var placedPods []*apiv1.Pod
+	for _, nodePods := range podsPerNode {
+		placedPods = append(placedPods, nodePods...)
+	}
+	assert.ElementsMatch(t, pods, placedPods)
+}
+
+func buildZonalNode(name, zone string, millicpu int64) *apiv1.Node {
+	node := BuildTestNode(name, millicpu, 10*units.GiB)
+	node.Labels = map[string]string{apiv1.LabelTopologyZone: zone, apiv1.LabelHostname: name}
+	SetNodeReadyState(node, true, time.Time{})
+	return node
+}
+
+func buildWebPod(name string, nodeName string) *apiv1.Pod {
+	pod := BuildTestPod(name, 500, 0)
+	pod.Labels = map[string]string{"app": "web"}
+	pod.Spec.NodeName = nodeName
+	return pod
+}
+
+func TestBinpackingEstimateTopologySpread(t *testing.T) {
+	// Zones b and c already run 3 web pods each, zone a runs none and its
+	// only node is full. Web pods are spread across zones with a max skew of 1.
+	existingNodes := []*apiv1.Node{
+		buildZonalNode("n-a", "a", 1000),
+		buildZonalNode("n-b", "b", 1500),
+		buildZonalNode("n-c", "c", 1500),
+	}
+	existingPods := map[string][]*apiv1.Pod{
+		"n-a": {BuildTestPod("filler", 1000, 0)},
+		"n-b": {buildWebPod("b-0", "n-b"), buildWebPod("b-1", "n-b"), buildWebPod("b-2", "n-b")},
+		"n-c": {buildWebPod("c-0", "n-c"), buildWebPod("c-1", "n-c"), buildWebPod("c-2", "n-c")},
+	}
+	existingPods["n-a"][0].Spec.NodeName = "n-a"
+
+	var pods []*apiv1.Pod
+	for i := 0; i < 6; i++ {
+		pod := buildWebPod(fmt.Sprintf("pending-%d", i), "")
+		pod.Spec.TopologySpreadConstraints = []apiv1.TopologySpreadConstraint{{
+			MaxSkew:           1,
+			TopologyKey:       apiv1.LabelTopologyZone,
+			WhenUnsatisfiable: apiv1.DoNotSchedule,
+			LabelSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		}}
+		pods = append(pods, pod)
+	}
+
+	testCases := []struct {
+		zone      string
+		wantNodes int
+	}{
+		// Zone a may run 4 pods before its skew to zones b and c exceeds 1,
+		// and 2 pods fit on a node.
+		{zone: "a", wantNodes: 2},
+		// Adding pods to zone b would increase its skew to zone a.
+		{zone: "b", wantNodes: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.zone, func(t *testing.T) {
+			estimator := newBinPackingEstimator(t)
+			for _, node := range existingNodes {
+				assert.NoError(t, estimator.clusterSnapshot.AddNodeWithPods(node, existingPods[node.Name]))
+			}
+			template := schedulerframework.NewNodeInfo()
+			template.SetNode(buildZonalNode("template-"+tc.zone, tc.zone, 1000))
+
+			estimate := estimator.Estimate(pods, template)
+			assert.Equal(t, tc.wantNodes, estimate)
+		})
+	}
+}
+
+func TestBinpackingEstimateHostnameAntiAffinity(t *testing.T) {
+	estimator := newBinPackingEstimator(t)
+
+	var pods []*apiv1.Pod
+	for i := 0; i < 4; i++ {
+		pod := buildWebPod(fmt.Sprintf("pending-%d", i), "")
+		pod.Spec.Affinity = &apiv1.Affinity{
+			PodAntiAffinity: &apiv1.PodAntiAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []apiv1.PodAffinityTerm{{
+					LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+					TopologyKey:   apiv1.LabelHostname,
+				}},
+			},
+		}
+		pods = append(pods, pod)
+	}
+	// The template has room for 3 pods, but each copy gets its own hostname,
+	// so anti-affinity allows a single pod per node.
+	node := BuildTestNode("template", 1500, 10*units.GiB)
+	SetNodeReadyState(node, true, time.Time{})
+	template := schedulerframework.NewNodeInfo()
+	template.SetNode(node)
+
+	estimate := estimator.Estimate(pods, template)
+	assert.Equal(t, 4, estimate)
+}
+
 func newBinPackingEstimator(t *testing.T) *BinpackingNodeEstimator {
 	predicateChecker, err := simulator.NewTestPredicateChecker()
 	clusterSnapshot := simulator.NewBasicClusterSnapshot()
@@ -37,6 +37,14 @@ type Estimator interface {
 	Estimate([]*apiv1.Pod, *schedulerframework.NodeInfo) int
 }
 
+// PlacementEstimator is an Estimator which can also tell which of the needed
+// nodes pods were packed on.
+type PlacementEstimator interface {
+	Estimator
+	// EstimatePlacement returns pods packed on each of the needed nodes.
+	EstimatePlacement([]*apiv1.Pod, *schedulerframework.NodeInfo) [][]*apiv1.Pod
+}
+
 // EstimatorBuilder creates a new estimator object.
 type EstimatorBuilder func(simulator.PredicateChecker, simulator.ClusterSnapshot) Estimator
 
@@ -46,6 +46,9 @@ type Option struct {
 	NodeCount int
 	Debug     string
 	Pods      []*apiv1.Pod
+	// PodsPerNode are Pods grouped by new nodes the estimator packed them
+	// on, if the estimator tells that.
+	PodsPerNode [][]*apiv1.Pod
 }
 
 // Strategy describes an interface for selecting the best option when scaling up
@@ -33,21 +33,32 @@ import (
 
 	"github.com/spf13/pflag"
 
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apiserver/pkg/server/mux"
 	"k8s.io/apiserver/pkg/server/routes"
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
 	cloudBuilder "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/builder"
 	"k8s.io/autoscaler/cluster-autoscaler/config"
+	"k8s.io/autoscaler/cluster-autoscaler/config/configfile"
 	"k8s.io/autoscaler/cluster-autoscaler/core"
+	"k8s.io/autoscaler/cluster-autoscaler/core/dryrun"
 	"k8s.io/autoscaler/cluster-autoscaler/core/filteroutschedulable"
 	"k8s.io/autoscaler/cluster-autoscaler/estimator"
 	"k8s.io/autoscaler/cluster-autoscaler/expander"
 	"k8s.io/autoscaler/cluster-autoscaler/metrics"
 	ca_processors "k8s.io/autoscaler/cluster-autoscaler/processors"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/actionablecluster"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/customresources"
 	"k8s.io/autoscaler/cluster-autoscaler/processors/nodegroupset"
 	"k8s.io/autoscaler/cluster-autoscaler/processors/nodeinfosprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/nodes"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/pods"
 	"k8s.io/autoscaler/cluster-autoscaler/simulator"
+	"k8s.io/autoscaler/cluster-autoscaler/tracing"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/checkpoint"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/drain"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
 	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/units"
@@ -107,6 +118,9 @@ var (
 	scaleDownGpuUtilizationThreshold = flag.Float64("scale-down-gpu-utilization-threshold", 0.5,
 		"Sum of gpu requests of all pods running on the node divided by node's allocatable resource, below which a node can be considered for scale down."+
 			"Utilization calculation only cares about gpu resource for accelerator node. cpu and memory utilization will be ignored.")
+	scaleDownSelectionPolicies = flag.String("scale-down-selection-policies", "",
+		"Comma separated list of policies ordering scale down candidates, each breaking ties left by the previous ones. Available values: ["+strings.Join(nodes.AvailableScaleDownSelectionPolicies, ",")+"]. "+
+			"Node groups may override it. Empty means candidates are removed in the order they were found unneeded.")
 	scaleDownNonEmptyCandidatesCount = flag.Int("scale-down-non-empty-candidates-count", 30,
 		"Maximum number of non empty nodes considered in one iteration as candidates for scale down with drain."+
 			"Lower value means better CA responsiveness but possible slower scale down latency."+
@@ -123,12 +137,19 @@ var (
 			"for scale down when some candidates from previous iteration are no longer valid."+
 			"When calculating the pool size for additional candidates we take"+
 			"max(#nodes * scale-down-candidates-pool-ratio, scale-down-candidates-pool-min-count).")
+	scaleDownSimulationParallelism = flag.Int("scale-down-simulation-parallelism", 1,
+		"Maximum number of scale down candidates checked concurrently. Values above 1 require --cluster-snapshot=copy-on-write.")
+	maxEvictableEmptyDirSize = flag.String("max-evictable-empty-dir-size", "",
+		"If set, pods with local storage don't block scale down as long as all their local volumes are EmptyDir volumes "+
+			"listed in the "+drain.PodSafeToEvictLocalVolumesKey+" annotation, with a size limit not larger than this value, e.g. 1Gi")
 	nodeDeletionDelayTimeout = flag.Duration("node-deletion-delay-timeout", 2*time.Minute, "Maximum time CA waits for removing delay-deletion.cluster-autoscaler.kubernetes.io/ annotations before deleting the node.")
 	scanInterval             = flag.Duration("scan-interval", 10*time.Second, "How often cluster is reevaluated for scale up or down")
 	maxNodesTotal            = flag.Int("max-nodes-total", 0, "Maximum number of nodes in all node groups. Cluster autoscaler will not grow the cluster beyond this number.")
 	coresTotal               = flag.String("cores-total", minMaxFlagString(0, config.DefaultMaxClusterCores), "Minimum and maximum number of cores in cluster, in the format <min>:<max>. Cluster autoscaler will not scale the cluster beyond these numbers.")
 	memoryTotal              = flag.String("memory-total", minMaxFlagString(0, config.DefaultMaxClusterMemory), "Minimum and maximum number of gigabytes of memory in cluster, in the format <min>:<max>. Cluster autoscaler will not scale the cluster beyond these numbers.")
 	gpuTotal                 = multiStringFlag("gpu-total", "Minimum and maximum number of different GPUs in cluster, in the format <gpu_type>:<min>:<max>. Cluster autoscaler will not scale the cluster beyond these numbers. Can be passed multiple times. CURRENTLY THIS FLAG ONLY WORKS ON GKE.")
+	extendedResources        = flag.String("extended-resources", "", "Comma separated list of extended resources, like SR-IOV NICs, FPGAs or hugepages, which are handled like GPUs: nodes are considered unready until the resources defined in their node group template become allocatable.")
+	extendedResourceTotal    = multiStringFlag("extended-resource-total", "Minimum and maximum amount of an extended resource in cluster, in the format <resource>:<min>:<max>, in the units of the resource quantity. The resource must be listed in --extended-resources. Can be passed multiple times.")
 	cloudProviderFlag        = flag.String("cloud-provider", cloudBuilder.DefaultCloudProvider,
 		"Cloud provider type. Available values: ["+strings.Join(cloudBuilder.AvailableCloudProviders, ",")+"]")
 	maxBulkSoftTaintCount      = flag.Int("max-bulk-soft-taint-count", 10, "Maximum number of nodes that can be tainted/untainted PreferNoSchedule at the same time. Set to 0 to turn off such tainting.")
@@ -139,7 +160,7 @@ var (
 	okTotalUnreadyCount        = flag.Int("ok-total-unready-count", 3, "Number of allowed unready nodes, irrespective of max-total-unready-percentage")
 	scaleUpFromZero            = flag.Bool("scale-up-from-zero", true, "Should CA scale up when there 0 ready nodes.")
 	maxNodeProvisionTime       = flag.Duration("max-node-provision-time", 15*time.Minute, "Maximum time CA waits for node to be provisioned")
-	maxPodEvictionTime         = flag.Duration("max-pod-eviction-time", 2*time.Minute, "Maximum time CA tries to evict a pod before giving up")
+	maxPodEvictionTime         = flag.Duration("max-pod-eviction-time", 2*time.Minute, "Maximum time CA tries to evict a pod before giving up. While evictions from a node are paced, the time is counted from the last pod evicted or removed from the node")
 	nodeGroupsFlag             = multiStringFlag(
 		"nodes",
 		"sets min,max size and other configuration data for a node group in a format accepted by cloud provider. Can be used multiple times. Format: <min>:<max>:<other...>")
@@ -169,6 +190,7 @@ var (
 	maxInactivityTimeFlag            = flag.Duration("max-inactivity", 10*time.Minute, "Maximum time from last recorded autoscaler activity before automatic restart")
 	maxFailingTimeFlag               = flag.Duration("max-failing-time", 15*time.Minute, "Maximum time from last recorded successful autoscaler run before automatic restart")
 	balanceSimilarNodeGroupsFlag     = flag.Bool("balance-similar-node-groups", false, "Detect similar node groups and balance the number of nodes between them")
+	balanceSimilarNodeGroupsByZone   = flag.Bool("balance-similar-node-groups-by-zone", false, "When balancing similar node groups, split scale-up between zones according to zonal volumes, node affinity and topology spread constraints of pending pods. Requires --balance-similar-node-groups")
 	nodeAutoprovisioningEnabled      = flag.Bool("node-autoprovisioning-enabled", false, "Should CA autoprovision node groups when needed")
 	maxAutoprovisionedNodeGroupCount = flag.Int("max-autoprovisioned-node-group-count", 15, "The maximum number of autoprovisioned groups in the cluster.")
 
@@ -176,6 +198,18 @@ var (
 	expendablePodsPriorityCutoff  = flag.Int("expendable-pods-priority-cutoff", -10, "Pods with priority below cutoff will be expendable. They can be killed without any consideration during scale down and they don't cause scale up. Pods with null priority (PodPriority disabled) are non expendable.")
 	regional                      = flag.Bool("regional", false, "Cluster is regional.")
 	newPodScaleUpDelay            = flag.Duration("new-pod-scale-up-delay", 0*time.Second, "Pods less than this old will not be considered for scale-up.")
+	podBatchingWindow             = flag.Duration("pod-batching-window", 0*time.Second, "Unschedulable pods are held back from scale-up until no new ones appear for this long, so that bursts of pods are handled by a single scale-up. 0 disables pod batching.")
+	podBatchingMaxDelay           = flag.Duration("pod-batching-max-delay", 1*time.Minute, "Maximum time unschedulable pods are held back from scale-up by --pod-batching-window.")
+	podGroupsFromJobs             = flag.Bool("pod-groups-from-jobs", false, "Treat pods of Jobs with parallelism greater than one as pod groups, which trigger scale-up only if all their pods fit.")
+	podGroupScaleDownUnneededTime = flag.Duration("pod-group-scale-down-unneeded-time", 2*time.Minute, "How long a node holding only pods of incomplete pod groups should be unneeded before it is eligible for scale down, if shorter than --scale-down-unneeded-time. 0 disables it.")
+
+	maxNodeCountDropPercentage = flag.Float64("max-node-count-drop-percentage", 0,
+		"Maximum percentage of nodes which may disappear between loops without being deleted by CA before CA assumes the node list is partial and freezes scale-down. 0 disables the check.")
+	maxUnregisteredInstancesPercentage = flag.Float64("max-unregistered-instances-percentage", 0,
+		"Maximum percentage of running cloud provider instances which may be not registered as nodes before CA freezes scale-down. 0 disables the check.")
+	controlPlaneHealthCheck          = flag.Bool("control-plane-health-check", false, "Should CA freeze scale-down while the API server reports it's not ready.")
+	scaleDownKillSwitchConfigMapName = flag.String("scale-down-kill-switch-configmap", "",
+		"Name of the ConfigMap through which scale-down can be paused, by setting its scaleDownPaused key or its "+actionablecluster.ScaleDownPausedAnnotationKey+" annotation to true. The kill switch is disabled if empty.")
 
 	ignoreTaintsFlag                   = multiStringFlag("ignore-taint", "Specifies a taint to ignore in node templates when considering to scale a node group")
 	balancingIgnoreLabelsFlag          = multiStringFlag("balancing-ignore-label", "Specifies a label to ignore in addition to the basic and cloud-provider set of labels when comparing if two node groups are similar")
@@ -190,6 +224,7 @@ var (
 	emitPerNodeGroupMetrics            = flag.Bool("emit-per-nodegroup-metrics", false, "If true, emit per node group metrics.")
 	debuggingSnapshotEnabled           = flag.Bool("debugging-snapshot-enabled", false, "Whether the debugging snapshot of cluster autoscaler feature is enabled")
 	nodeInfoCacheExpireTime            = flag.Duration("node-info-cache-expire-time", 87600*time.Hour, "Node Info cache expire time for each item. Default value is 10 years.")
+	nodeInfoCacheConfigMapName         = flag.String("node-info-cache-configmap", "", "Name of the ConfigMap in which the Node Info cache is persisted, so that scale-up from zero works right after a restart. The cache is not persisted if empty.")
 
 	initialNodeGroupBackoffDuration = flag.Duration("initial-node-group-backoff-duration", 5*time.Minute,
 		"initialNodeGroupBackoffDuration is the duration of first backoff after a new node failed to start.")
@@ -197,6 +232,52 @@ var (
 		"maxNodeGroupBackoffDuration is the maximum backoff duration for a NodeGroup after new nodes failed to start.")
 	nodeGroupBackoffResetTimeout = flag.Duration("node-group-backoff-reset-timeout", 3*time.Hour,
 		"nodeGroupBackoffResetTimeout is the time after last failed scale-up when the backoff duration is reset.")
+	nodeGroupBackoffPolicies = multiStringFlag("node-group-backoff-policy",
+		"Backoff policy for scale-up errors of a given class, and optionally error code, in the format <error-class>[/<error-code>]=<scope>:<initial-duration>:<max-duration>, "+
+			"e.g. OutOfResource/QUOTA_EXCEEDED=project:30m:3h. Error class is one of OutOfResource, Other. Scope is one of node-group, zone, flavor, project and determines which node groups are backed off together. "+
+			"Errors not matching any policy back off only the failed node group. Backoffs persist across restarts with --backoff-state-configmap or --state-checkpoint-store. Can be used multiple times.")
+	backoffStateConfigMapName = flag.String("backoff-state-configmap", "",
+		"Name of the ConfigMap in which node group backoff state is persisted across restarts. The state is not persisted if empty. "+
+			"If --state-checkpoint-store is also set, the backoff state restored from the checkpoint takes precedence.")
+	stateCheckpointStore = flag.String("state-checkpoint-store", "",
+		"Type of object, configmap or lease, in which CA checkpoints its state (unneeded nodes, scale-ups in flight, backoffs and cloud provider state) every loop "+
+			"and restores it from on startup, so that it survives restarts and leader failovers. State is not checkpointed if empty.")
+	stateCheckpointName   = flag.String("state-checkpoint-name", "cluster-autoscaler-state", "Name of the object in which CA checkpoints its state. Must not be the leader election lease.")
+	stateCheckpointMaxAge = flag.Duration("state-checkpoint-max-age", 15*time.Minute, "Maximum age of a checkpoint restored on startup. Older checkpoints are ignored.")
+
+	configFile = flag.String("config-file", "", "Path to a YAML file overriding node group defaults, per node group options and scale-down options set by flags. "+
+		"It is reloaded every loop, so changes are applied without a restart. Invalid changes are rejected, keeping the last valid configuration.")
+	configConfigMapName = flag.String("config-configmap", "", "Name of a ConfigMap holding the same configuration as --config-file under the "+configfile.ConfigMapKey+" key. "+
+		"Can't be used together with --config-file.")
+
+	dryRun = flag.Bool("dry-run", false, "If true, CA runs the whole autoscaling loop, but only records the node group resizes, taints, evictions and status writes it would make, without executing them. "+
+		"State checkpoints, the node info cache and backoff state are restored on startup, but not persisted. "+
+		"Use together with a distinct --leader-elect-resource-name to run a shadow CA next to the active one.")
+
+	consolidationEnabled = flag.Bool("consolidation-enabled", false, "If true, CA replaces several underutilized nodes with fewer or cheaper nodes from another node group, "+
+		"by scaling the other node group up first and draining the replaced nodes once the new nodes are ready.")
+	consolidationMaxNodes            = flag.Int("consolidation-max-nodes", 5, "Maximum number of nodes replaced by a single consolidation.")
+	consolidationMaxPodsToReschedule = flag.Int("consolidation-max-pods-to-reschedule", 100, "Maximum number of pods evicted by a single consolidation.")
+	consolidationMinSavingsRatio     = flag.Float64("consolidation-min-savings-ratio", 0.2, "Minimum fraction of the cost of replaced nodes a consolidation has to save. "+
+		"The cost comes from the cloud provider pricing model if available, otherwise each node costs the same.")
+
+	scaleDownMaxNodesDeleting = flag.String("scale-down-max-nodes-deleting", "0",
+		"Maximum number, or percentage of all nodes (e.g. 10%), of nodes being deleted by scale-down at once. 0 means no limit.")
+	scaleDownMaxNodesDeletingPerNodeGroup = flag.String("scale-down-max-nodes-deleting-per-node-group", "0",
+		"Maximum number, or percentage of the node group target size (e.g. 10%), of nodes of a single node group being deleted by scale-down at once. 0 means no limit.")
+	scaleDownMaxEvictionsPerMinutePerNamespace = flag.Int("scale-down-max-evictions-per-minute-per-namespace", 0,
+		"Maximum number of pods evicted by scale-down from a single namespace within a minute. 0 means no limit.")
+	scaleDownBlackoutWindows = multiStringFlag("scale-down-blackout-window",
+		"Time window during which scale-down is forbidden, as two RFC3339 timestamps separated by a slash, e.g. 2022-12-19T00:00:00Z/2023-01-02T00:00:00Z. Can be used multiple times.")
+
+	otlpTracesEndpoint   = flag.String("otlp-traces-endpoint", "", "OTLP/HTTP endpoint (e.g. http://otel-collector:4318/v1/traces) to which traces of the main loop are exported. Tracing is disabled if empty.")
+	tracingFlushInterval = flag.Duration("tracing-flush-interval", 5*time.Second, "How often recorded spans are sent to the OTLP traces endpoint.")
+	tracingExportTimeout = flag.Duration("tracing-export-timeout", 10*time.Second, "Timeout of a single request to the OTLP traces endpoint.")
+
+	clusterSnapshotImplementation = flag.String("cluster-snapshot", "delta", "Implementation of the cluster snapshot used in simulations. One of: delta, copy-on-write, incremental. "+
+		"The copy-on-write snapshot supports nested forks. The incremental snapshot is a copy-on-write snapshot updated with changes of pods and nodes instead of being rebuilt in every loop.")
+	clusterSnapshotResyncInterval = flag.Duration("cluster-snapshot-resync-interval", 10*time.Minute,
+		"How often pods in the incremental cluster snapshot are compared with listed pods, which rebuilds the snapshot if they differ. Pod counts are compared on every loop.")
 )
 
 func createAutoscalingOptions() config.AutoscalingOptions {
@@ -216,12 +297,66 @@ func createAutoscalingOptions() config.AutoscalingOptions {
 	if err != nil {
 		klog.Fatalf("Failed to parse flags: %v", err)
 	}
+
+	var parsedExtendedResources []string
+	if *extendedResources != "" {
+		parsedExtendedResources = strings.Split(*extendedResources, ",")
+	}
+	parsedExtendedResourceTotal, err := parseExtendedResourceLimits(*extendedResourceTotal, parsedExtendedResources)
+	if err != nil {
+		klog.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	var parsedSelectionPolicies []string
+	if *scaleDownSelectionPolicies != "" {
+		parsedSelectionPolicies = strings.Split(*scaleDownSelectionPolicies, ",")
+	}
+	if err := nodes.ValidateScaleDownSelectionPolicies(parsedSelectionPolicies); err != nil {
+		klog.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	disruptionBudget, err := parseDisruptionBudget()
+	if err != nil {
+		klog.Fatalf("Failed to parse flags: %v", err)
+	}
+	if *stateCheckpointStore != "" && *stateCheckpointStore != checkpoint.ConfigMapStoreType && *stateCheckpointStore != checkpoint.LeaseStoreType {
+		klog.Fatalf("Failed to parse flags: unknown state checkpoint store %q, expected %s or %s", *stateCheckpointStore, checkpoint.ConfigMapStoreType, checkpoint.LeaseStoreType)
+	}
+	if *podGroupScaleDownUnneededTime < 0 {
+		klog.Fatalf("Failed to parse flags: --pod-group-scale-down-unneeded-time must not be negative")
+	}
+	if *podBatchingWindow < 0 || *podBatchingMaxDelay < 0 {
+		klog.Fatalf("Failed to parse flags: --pod-batching-window and --pod-batching-max-delay must not be negative")
+	}
+	if *maxNodeCountDropPercentage < 0 || *maxNodeCountDropPercentage > 100 || *maxUnregisteredInstancesPercentage < 0 || *maxUnregisteredInstancesPercentage > 100 {
+		klog.Fatalf("Failed to parse flags: --max-node-count-drop-percentage and --max-unregistered-instances-percentage must be between 0 and 100")
+	}
+	var parsedMaxEvictableEmptyDirSize *resource.Quantity
+	if *maxEvictableEmptyDirSize != "" {
+		size, err := resource.ParseQuantity(*maxEvictableEmptyDirSize)
+		if err != nil {
+			klog.Fatalf("Failed to parse flags: invalid --max-evictable-empty-dir-size: %v", err)
+		}
+		parsedMaxEvictableEmptyDirSize = &size
+	}
+	if *configFile != "" && *configConfigMapName != "" {
+		klog.Fatalf("Failed to parse flags: --config-file and --config-configmap can't be used together")
+	}
+	backoffPolicies := make([]config.BackoffPolicy, 0, len(*nodeGroupBackoffPolicies))
+	for _, value := range *nodeGroupBackoffPolicies {
+		policy, err := config.ParseBackoffPolicy(value)
+		if err != nil {
+			klog.Fatalf("Failed to parse flags: %v", err)
+		}
+		backoffPolicies = append(backoffPolicies, policy)
+	}
 	return config.AutoscalingOptions{
 		NodeGroupDefaults: config.NodeGroupAutoscalingOptions{
 			ScaleDownUtilizationThreshold:    *scaleDownUtilizationThreshold,
 			ScaleDownGpuUtilizationThreshold: *scaleDownGpuUtilizationThreshold,
 			ScaleDownUnneededTime:            *scaleDownUnneededTime,
 			ScaleDownUnreadyTime:             *scaleDownUnreadyTime,
+			ScaleDownSelectionPolicies:       parsedSelectionPolicies,
 		},
 		CloudConfig:                        *cloudConfig,
 		CloudProviderName:                  *cloudProviderFlag,
@@ -229,6 +364,10 @@ func createAutoscalingOptions() config.AutoscalingOptions {
 		MaxTotalUnreadyPercentage:          *maxTotalUnreadyPercentage,
 		OkTotalUnreadyCount:                *okTotalUnreadyCount,
 		ScaleUpFromZero:                    *scaleUpFromZero,
+		MaxNodeCountDropPercentage:         *maxNodeCountDropPercentage,
+		MaxUnregisteredInstancesPercentage: *maxUnregisteredInstancesPercentage,
+		ControlPlaneHealthCheck:            *controlPlaneHealthCheck,
+		ScaleDownKillSwitchConfigMapName:   *scaleDownKillSwitchConfigMapName,
 		EstimatorName:                      *estimatorFlag,
 		ExpanderNames:                      *expanderFlag,
 		GRPCExpanderCert:                   *grpcExpanderCert,
@@ -247,6 +386,8 @@ func createAutoscalingOptions() config.AutoscalingOptions {
 		MaxMemoryTotal:                     maxMemoryTotal,
 		MinMemoryTotal:                     minMemoryTotal,
 		GpuTotal:                           parsedGpuTotal,
+		ExtendedResources:                  parsedExtendedResources,
+		ExtendedResourceTotal:              parsedExtendedResourceTotal,
 		NodeGroups:                         *nodeGroupsFlag,
 		ScaleDownDelayAfterAdd:             *scaleDownDelayAfterAdd,
 		ScaleDownDelayAfterDelete:          *scaleDownDelayAfterDelete,
@@ -255,9 +396,12 @@ func createAutoscalingOptions() config.AutoscalingOptions {
 		ScaleDownNonEmptyCandidatesCount:   *scaleDownNonEmptyCandidatesCount,
 		ScaleDownCandidatesPoolRatio:       *scaleDownCandidatesPoolRatio,
 		ScaleDownCandidatesPoolMinCount:    *scaleDownCandidatesPoolMinCount,
+		ScaleDownSimulationParallelism:     *scaleDownSimulationParallelism,
+		MaxEvictableEmptyDirSize:           parsedMaxEvictableEmptyDirSize,
 		WriteStatusConfigMap:               *writeStatusConfigMapFlag,
 		StatusConfigMapName:                *statusConfigMapName,
 		BalanceSimilarNodeGroups:           *balanceSimilarNodeGroupsFlag,
+		BalanceSimilarNodeGroupsByZone:     *balanceSimilarNodeGroupsByZone,
 		ConfigNamespace:                    *namespace,
 		ClusterName:                        *clusterName,
 		NodeAutoprovisioningEnabled:        *nodeAutoprovisioningEnabled,
@@ -266,6 +410,10 @@ func createAutoscalingOptions() config.AutoscalingOptions {
 		ExpendablePodsPriorityCutoff:       *expendablePodsPriorityCutoff,
 		Regional:                           *regional,
 		NewPodScaleUpDelay:                 *newPodScaleUpDelay,
+		PodBatchingWindow:                  *podBatchingWindow,
+		PodBatchingMaxDelay:                *podBatchingMaxDelay,
+		PodGroupsFromJobs:                  *podGroupsFromJobs,
+		PodGroupScaleDownUnneededTime:      *podGroupScaleDownUnneededTime,
 		IgnoredTaints:                      *ignoreTaintsFlag,
 		BalancingExtraIgnoredLabels:        *balancingIgnoreLabelsFlag,
 		KubeConfigPath:                     *kubeConfigFile,
@@ -280,6 +428,21 @@ func createAutoscalingOptions() config.AutoscalingOptions {
 		InitialNodeGroupBackoffDuration:    *initialNodeGroupBackoffDuration,
 		MaxNodeGroupBackoffDuration:        *maxNodeGroupBackoffDuration,
 		NodeGroupBackoffResetTimeout:       *nodeGroupBackoffResetTimeout,
+		NodeGroupBackoffPolicies:           backoffPolicies,
+		BackoffStateConfigMapName:          *backoffStateConfigMapName,
+		StateCheckpointStore:               *stateCheckpointStore,
+		StateCheckpointName:                *stateCheckpointName,
+		StateCheckpointMaxAge:              *stateCheckpointMaxAge,
+		NodeInfoCacheExpireTime:            *nodeInfoCacheExpireTime,
+		NodeInfoCacheConfigMapName:         *nodeInfoCacheConfigMapName,
+		ConfigFile:                         *configFile,
+		ConfigConfigMapName:                *configConfigMapName,
+		DryRun:                             *dryRun,
+		ConsolidationEnabled:               *consolidationEnabled,
+		ConsolidationMaxNodes:              *consolidationMaxNodes,
+		ConsolidationMaxPodsToReschedule:   *consolidationMaxPodsToReschedule,
+		ConsolidationMinSavingsRatio:       *consolidationMinSavingsRatio,
+		ScaleDownDisruptionBudget:          disruptionBudget,
 	}
 }
 
@@ -319,40 +482,66 @@ func registerSignalHandlers(autoscaler core.Autoscaler) {
 		<-sigs
 		klog.V(1).Info("Received signal, attempting cleanup")
 		autoscaler.ExitCleanUp()
+		tracing.Shutdown()
 		klog.V(1).Info("Cleaned up, exiting...")
 		klog.Flush()
 		os.Exit(0)
 	}()
 }
 
+func newClusterSnapshot(implementation string) simulator.ClusterSnapshot {
+	switch implementation {
+	case "delta":
+		return simulator.NewDeltaClusterSnapshot()
+	case "copy-on-write":
+		return simulator.NewCopyOnWriteClusterSnapshot()
+	case "incremental":
+		// The pod filter and pod events are set up by the autoscaler.
+		return simulator.NewIncrementalClusterSnapshot(nil, *clusterSnapshotResyncInterval)
+	default:
+		klog.Fatalf("Unknown cluster snapshot implementation: %s", implementation)
+		return nil
+	}
+}
+
 func buildAutoscaler(debuggingSnapshotter debuggingsnapshot.DebuggingSnapshotter) (core.Autoscaler, error) {
 	// Create basic config from flags.
 	autoscalingOptions := createAutoscalingOptions()
-	kubeClient := createKubeClient(getKubeConfig())
+	kubeConfig := getKubeConfig()
+	if autoscalingOptions.DryRun {
+		// Events are still recorded in dry run mode, so only the main client is wrapped.
+		klog.V(1).Info("Running in dry run mode, no changes will be made to the cluster")
+		dryrun.WrapKubeConfig(kubeConfig)
+	}
+	kubeClient := createKubeClient(kubeConfig)
 	eventsKubeClient := createKubeClient(getKubeConfig())
 
 	opts := core.AutoscalerOptions{
 		AutoscalingOptions:   autoscalingOptions,
-		ClusterSnapshot:      simulator.NewDeltaClusterSnapshot(),
+		ClusterSnapshot:      newClusterSnapshot(*clusterSnapshotImplementation),
 		KubeClient:           kubeClient,
 		EventsKubeClient:     eventsKubeClient,
 		DebuggingSnapshotter: debuggingSnapshotter,
 	}
 
 	opts.Processors = ca_processors.DefaultProcessors()
+	if len(autoscalingOptions.ExtendedResources) > 0 {
+		opts.Processors.CustomResourcesProcessor = customresources.NewExtendedResourcesProcessor(autoscalingOptions.ExtendedResources)
+	}
 	opts.Processors.TemplateNodeInfoProvider = nodeinfosprovider.NewDefaultTemplateNodeInfoProvider(nodeInfoCacheExpireTime)
-	opts.Processors.PodListProcessor = filteroutschedulable.NewFilterOutSchedulablePodListProcessor()
+	opts.Processors.PodListProcessor = pods.NewCombinedPodListProcessor([]pods.PodListProcessor{
+		filteroutschedulable.NewFilterOutSchedulablePodListProcessor(),
+		pods.NewScaleUpAnnotationsPodListProcessor(),
+		pods.NewBatchingPodListProcessor(),
+		pods.NewPodGroupPodListProcessor(),
+	})
 
 	nodeInfoComparatorBuilder := nodegroupset.CreateGenericNodeInfoComparator
-	// if autoscalingOptions.CloudProviderName == cloudprovider.AzureProviderName {
-	// 	nodeInfoComparatorBuilder = nodegroupset.CreateAzureNodeInfoComparator
-	// } else if autoscalingOptions.CloudProviderName == cloudprovider.AwsProviderName {
-	// 	nodeInfoComparatorBuilder = nodegroupset.CreateAwsNodeInfoComparator
-	// } else if autoscalingOptions.CloudProviderName == cloudprovider.GceProviderName {
-	// 	nodeInfoComparatorBuilder = nodegroupset.CreateGceNodeInfoComparator
-	// } else if autoscalingOptions.CloudProviderName == cloudprovider.ClusterAPIProviderName {
-	// 	nodeInfoComparatorBuilder = nodegroupset.CreateClusterAPINodeInfoComparator
-	// }
+	if autoscalingOptions.CloudProviderName == cloudprovider.MagnumProviderName {
+		nodeInfoComparatorBuilder = nodegroupset.CreateMagnumNodeInfoComparator
+	} else if autoscalingOptions.CloudProviderName == cloudprovider.IxCloudProviderName {
+		nodeInfoComparatorBuilder = nodegroupset.CreateIxCloudNodeInfoComparator
+	}
 
 	opts.Processors.NodeGroupSetProcessor = &nodegroupset.BalancingNodeGroupSetProcessor{
 		Comparator: nodeInfoComparatorBuilder(autoscalingOptions.BalancingExtraIgnoredLabels),
@@ -371,6 +560,14 @@ func buildAutoscaler(debuggingSnapshotter debuggingsnapshot.DebuggingSnapshotter
 func run(healthCheck *metrics.HealthCheck, debuggingSnapshotter debuggingsnapshot.DebuggingSnapshotter) {
 	metrics.RegisterAll(*emitPerNodeGroupMetrics)
 
+	if *otlpTracesEndpoint != "" {
+		exporter, err := tracing.NewOTLPExporter(ctx.Background(), *otlpTracesEndpoint, *tracingExportTimeout)
+		if err != nil {
+			klog.Fatalf("Failed to create OTLP traces exporter: %v", err)
+		}
+		tracing.Enable(exporter, "cluster-autoscaler", *tracingFlushInterval)
+	}
+
 	autoscaler, err := buildAutoscaler(debuggingSnapshotter)
 	if err != nil {
 		klog.Fatalf("Failed to create autoscaler: %v", err)
@@ -486,6 +683,7 @@ func main() {
 					run(healthCheck, debuggingSnapshotter)
 				},
 				OnStoppedLeading: func() {
+					tracing.Shutdown()
 					klog.Fatalf("lost master")
 				},
 			},
@@ -548,6 +746,57 @@ func minMaxFlagString(min, max int64) string {
 	return fmt.Sprintf("%v:%v", min, max)
 }
 
+func parseDisruptionBudget() (config.DisruptionBudget, error) {
+	maxNodesDeleting, err := config.ParseNodeCountLimit(*scaleDownMaxNodesDeleting)
+	if err != nil {
+		return config.DisruptionBudget{}, err
+	}
+	maxNodesDeletingPerNodeGroup, err := config.ParseNodeCountLimit(*scaleDownMaxNodesDeletingPerNodeGroup)
+	if err != nil {
+		return config.DisruptionBudget{}, err
+	}
+	if *scaleDownMaxEvictionsPerMinutePerNamespace < 0 {
+		return config.DisruptionBudget{}, fmt.Errorf("scale-down-max-evictions-per-minute-per-namespace must not be negative")
+	}
+	blackoutWindows := make([]config.TimeWindow, 0, len(*scaleDownBlackoutWindows))
+	for _, value := range *scaleDownBlackoutWindows {
+		window, err := config.ParseTimeWindow(value)
+		if err != nil {
+			return config.DisruptionBudget{}, err
+		}
+		blackoutWindows = append(blackoutWindows, window)
+	}
+	return config.DisruptionBudget{
+		MaxNodesDeleting:                  maxNodesDeleting,
+		MaxNodesDeletingPerNodeGroup:      maxNodesDeletingPerNodeGroup,
+		MaxEvictionsPerMinutePerNamespace: *scaleDownMaxEvictionsPerMinutePerNamespace,
+		BlackoutWindows:                   blackoutWindows,
+	}, nil
+}
+
+func parseExtendedResourceLimits(flags MultiStringFlag, resources []string) ([]config.ExtendedResourceLimits, error) {
+	parsedFlags := make([]config.ExtendedResourceLimits, 0, len(flags))
+	for _, flag := range flags {
+		tokens := strings.SplitN(flag, ":", 2)
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("incorrect extended resource limit specification: %v", flag)
+		}
+		known := false
+		for _, resource := range resources {
+			known = known || resource == tokens[0]
+		}
+		if !known {
+			return nil, fmt.Errorf("incorrect extended resource limit - %s is not in --extended-resources; %v", tokens[0], flag)
+		}
+		min, max, err := parseMinMaxFlag(tokens[1])
+		if err != nil {
+			return nil, fmt.Errorf("incorrect extended resource limit %v: %v", flag, err)
+		}
+		parsedFlags = append(parsedFlags, config.ExtendedResourceLimits{Resource: tokens[0], Min: min, Max: max})
+	}
+	return parsedFlags, nil
+}
+
 func parseMultipleGpuLimits(flags MultiStringFlag) ([]config.GpuLimits, error) {
 	parsedFlags := make([]config.GpuLimits, 0, len(flags))
 	for _, flag := range flags {
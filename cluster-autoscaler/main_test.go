@@ -91,3 +91,18 @@ func TestParseSingleGpuLimit(t *testing.T) {
 		}
 	}
 }
+
+func TestParseExtendedResourceLimits(t *testing.T) {
+	resources := []string{"intel.com/sriov_netdevice", "hugepages-1Gi"}
+	limits, err := parseExtendedResourceLimits(MultiStringFlag{"intel.com/sriov_netdevice:0:64", "hugepages-1Gi:1:1073741824"}, resources)
+	assert.NoError(t, err)
+	assert.Equal(t, []config.ExtendedResourceLimits{
+		{Resource: "intel.com/sriov_netdevice", Min: 0, Max: 64},
+		{Resource: "hugepages-1Gi", Min: 1, Max: 1073741824},
+	}, limits)
+
+	for _, input := range []string{"intel.com/sriov_netdevice", "intel.com/sriov_netdevice:1", "intel.com/sriov_netdevice:10:1", "xilinx.com/fpga:0:4"} {
+		_, err := parseExtendedResourceLimits(MultiStringFlag{input}, resources)
+		assert.Error(t, err, input)
+	}
+}
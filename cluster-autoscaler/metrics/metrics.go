@@ -51,6 +51,9 @@ const (
 	startingLabel         = "notStarted"
 	unregisteredLabel     = "unregistered"
 	longUnregisteredLabel = "longUnregistered"
+	upcomingLabel         = "upcoming"
+	successLabel          = "success"
+	errorLabel            = "error"
 
 	// Underutilized node was removed because of low utilization
 	Underutilized NodeScaleDownReason = "underutilized"
@@ -58,6 +61,8 @@ const (
 	Empty NodeScaleDownReason = "empty"
 	// Unready node was removed
 	Unready NodeScaleDownReason = "unready"
+	// Consolidated node was replaced by a smaller number of nodes or cheaper nodes
+	Consolidated NodeScaleDownReason = "consolidated"
 
 	// CloudProviderError caused scale-up to fail
 	CloudProviderError FailedScaleUpReason = "cloudProviderError"
@@ -187,6 +192,65 @@ var (
 		}, []string{"node_group"},
 	)
 
+	nodeGroupTargetSize = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "node_group_target_count",
+			Help:      "Target number of nodes in the node group.",
+		}, []string{"node_group"},
+	)
+
+	nodeGroupNodesCount = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "node_group_nodes_count",
+			Help:      "Number of nodes in the node group, by state.",
+		}, []string{"node_group", "state"},
+	)
+
+	nodeGroupBackoffStatus = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "node_group_backoff_status",
+			Help:      "Whether or not scale-up of the node group is backed off. 1 if it is, 0 otherwise.",
+		}, []string{"node_group"},
+	)
+
+	nodeGroupScaleUpCount = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "node_group_scaled_up_nodes_total",
+			Help:      "Number of nodes added by CA to the node group.",
+		}, []string{"node_group"},
+	)
+
+	nodeGroupScaleDownCount = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "node_group_scaled_down_nodes_total",
+			Help:      "Number of nodes removed by CA from the node group, by reason.",
+		}, []string{"node_group", "reason"},
+	)
+
+	nodeGroupNodeRegistrationDuration = k8smetrics.NewHistogramVec(
+		&k8smetrics.HistogramOpts{
+			Namespace: caNamespace,
+			Name:      "node_group_node_registration_duration_seconds",
+			Help:      "Time from a scale-up of the node group until all requested nodes registered.",
+			Buckets:   []float64{30.0, 60.0, 90.0, 120.0, 180.0, 240.0, 300.0, 450.0, 600.0, 900.0, 1200.0, 1800.0},
+		}, []string{"node_group"},
+	)
+
+	/**** Metrics related to cloud provider calls ****/
+	cloudProviderCallDuration = k8smetrics.NewHistogramVec(
+		&k8smetrics.HistogramOpts{
+			Namespace: caNamespace,
+			Name:      "cloud_provider_call_duration_seconds",
+			Help:      "Time taken by node group calls to the cloud provider, by call and result.",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0, 30.0, 60.0, 120.0},
+		}, []string{"call", "result"},
+	)
+
 	/**** Metrics related to autoscaler execution ****/
 	lastActivity = k8smetrics.NewGaugeVec(
 		&k8smetrics.GaugeOpts{
@@ -312,6 +376,47 @@ var (
 		},
 	)
 
+	batchedPodsCount = k8smetrics.NewGauge(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "batched_pods_count",
+			Help:      "Number of unschedulable pods held back from scale-up until pod arrival settles.",
+		},
+	)
+
+	podBatchWaitDuration = k8smetrics.NewHistogram(
+		&k8smetrics.HistogramOpts{
+			Namespace: caNamespace,
+			Name:      "pod_batch_wait_duration_seconds",
+			Help:      "Time unschedulable pods were held back from scale-up before their batch was released.",
+			Buckets:   []float64{1.0, 5.0, 10.0, 15.0, 20.0, 30.0, 45.0, 60.0, 90.0, 120.0, 180.0, 300.0},
+		},
+	)
+
+	quotaGroupUsage = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "quota_group_usage",
+			Help:      "Usage of resources by node groups in a quota group, including upcoming nodes.",
+		}, []string{"quota_group", "resource"},
+	)
+
+	quotaGroupLimit = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "quota_group_limit",
+			Help:      "Maximum usage of resources by node groups in a quota group. 0 if not limited.",
+		}, []string{"quota_group", "resource"},
+	)
+
+	guardrailActive = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "guardrail_active",
+			Help:      "Whether a guardrail aborted the loop or froze scale-down in the last loop, by guardrail.",
+		}, []string{"guardrail"},
+	)
+
 	/**** Metrics related to NodeAutoprovisioning ****/
 	napEnabled = k8smetrics.NewGauge(
 		&k8smetrics.GaugeOpts{
@@ -336,6 +441,48 @@ var (
 			Help:      "Number of node groups deleted by Node Autoprovisioning.",
 		},
 	)
+
+	/**** Metrics related to dry run mode ****/
+	dryRunNodeGroupCallsCount = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "dry_run_node_group_calls_total",
+			Help:      "Number of mutating node group calls recorded, but not executed, in dry run mode.",
+		}, []string{"node_group", "call"},
+	)
+
+	dryRunNodesCount = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "dry_run_nodes_total",
+			Help:      "Number of nodes that would have been added or removed by CA in dry run mode.",
+		}, []string{"node_group", "call"},
+	)
+
+	dryRunAPIRequestsCount = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "dry_run_api_requests_total",
+			Help:      "Number of mutating Kubernetes API requests sent with dryRun=All in dry run mode.",
+		}, []string{"verb", "resource"},
+	)
+
+	/**** Metrics related to the configuration file ****/
+	configReloadsCount = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "config_reloads_total",
+			Help:      "Number of changes of the configuration file, by whether they were applied or rejected.",
+		}, []string{"result"},
+	)
+
+	configValid = k8smetrics.NewGauge(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "config_valid",
+			Help:      "Whether or not the last change of the configuration file was valid. 1 if it was, 0 otherwise.",
+		},
+	)
 )
 
 // RegisterAll registers all metrics.
@@ -364,13 +511,30 @@ func RegisterAll(emitPerNodeGroupMetrics bool) {
 	legacyregistry.MustRegister(scaleDownInCooldown)
 	legacyregistry.MustRegister(oldUnregisteredNodesRemovedCount)
 	legacyregistry.MustRegister(overflowingControllersCount)
+	legacyregistry.MustRegister(batchedPodsCount)
+	legacyregistry.MustRegister(podBatchWaitDuration)
+	legacyregistry.MustRegister(quotaGroupUsage)
+	legacyregistry.MustRegister(quotaGroupLimit)
+	legacyregistry.MustRegister(guardrailActive)
 	legacyregistry.MustRegister(napEnabled)
 	legacyregistry.MustRegister(nodeGroupCreationCount)
 	legacyregistry.MustRegister(nodeGroupDeletionCount)
+	legacyregistry.MustRegister(dryRunNodeGroupCallsCount)
+	legacyregistry.MustRegister(dryRunNodesCount)
+	legacyregistry.MustRegister(dryRunAPIRequestsCount)
+	legacyregistry.MustRegister(configReloadsCount)
+	legacyregistry.MustRegister(configValid)
+	legacyregistry.MustRegister(cloudProviderCallDuration)
 
 	if emitPerNodeGroupMetrics {
 		legacyregistry.MustRegister(nodesGroupMinNodes)
 		legacyregistry.MustRegister(nodesGroupMaxNodes)
+		legacyregistry.MustRegister(nodeGroupTargetSize)
+		legacyregistry.MustRegister(nodeGroupNodesCount)
+		legacyregistry.MustRegister(nodeGroupBackoffStatus)
+		legacyregistry.MustRegister(nodeGroupScaleUpCount)
+		legacyregistry.MustRegister(nodeGroupScaleDownCount)
+		legacyregistry.MustRegister(nodeGroupNodeRegistrationDuration)
 	}
 }
 
@@ -463,6 +627,54 @@ func UpdateNodeGroupMax(nodeGroup string, maxNodes int) {
 	nodesGroupMaxNodes.WithLabelValues(nodeGroup).Set(float64(maxNodes))
 }
 
+// UpdateNodeGroupTargetSize records the node group target size
+func UpdateNodeGroupTargetSize(nodeGroup string, targetSize int) {
+	nodeGroupTargetSize.WithLabelValues(nodeGroup).Set(float64(targetSize))
+}
+
+// UpdateNodeGroupNodesCount records the number of nodes in the node group
+func UpdateNodeGroupNodesCount(nodeGroup string, ready, unready, starting, upcoming int) {
+	nodeGroupNodesCount.WithLabelValues(nodeGroup, readyLabel).Set(float64(ready))
+	nodeGroupNodesCount.WithLabelValues(nodeGroup, unreadyLabel).Set(float64(unready))
+	nodeGroupNodesCount.WithLabelValues(nodeGroup, startingLabel).Set(float64(starting))
+	nodeGroupNodesCount.WithLabelValues(nodeGroup, upcomingLabel).Set(float64(upcoming))
+}
+
+// UpdateNodeGroupBackoffStatus records if scale-up of the node group is backed off
+func UpdateNodeGroupBackoffStatus(nodeGroup string, backedOff bool) {
+	if backedOff {
+		nodeGroupBackoffStatus.WithLabelValues(nodeGroup).Set(1)
+	} else {
+		nodeGroupBackoffStatus.WithLabelValues(nodeGroup).Set(0)
+	}
+}
+
+// RegisterNodeGroupScaleUp records number of nodes added to the node group by scale up
+func RegisterNodeGroupScaleUp(nodeGroup string, nodesCount int) {
+	nodeGroupScaleUpCount.WithLabelValues(nodeGroup).Add(float64(nodesCount))
+}
+
+// RegisterNodeGroupScaleDown records number of nodes removed from the node group by scale down
+func RegisterNodeGroupScaleDown(nodeGroup string, nodesCount int, reason NodeScaleDownReason) {
+	nodeGroupScaleDownCount.WithLabelValues(nodeGroup, string(reason)).Add(float64(nodesCount))
+}
+
+// RegisterNodeGroupNodeRegistration records how long it took for nodes
+// requested by a scale-up of the node group to register
+func RegisterNodeGroupNodeRegistration(nodeGroup string, duration time.Duration) {
+	nodeGroupNodeRegistrationDuration.WithLabelValues(nodeGroup).Observe(duration.Seconds())
+}
+
+// RegisterCloudProviderCall records the duration and result of a node group
+// call to the cloud provider
+func RegisterCloudProviderCall(call string, duration time.Duration, err error) {
+	result := successLabel
+	if err != nil {
+		result = errorLabel
+	}
+	cloudProviderCallDuration.WithLabelValues(call, result).Observe(duration.Seconds())
+}
+
 // RegisterError records any errors preventing Cluster Autoscaler from working.
 // No more than one error should be recorded per loop.
 func RegisterError(err errors.AutoscalerError) {
@@ -547,3 +759,62 @@ func RegisterOldUnregisteredNodesRemoved(nodesCount int) {
 func UpdateOverflowingControllers(count int) {
 	overflowingControllersCount.Set(float64(count))
 }
+
+// UpdateBatchedPodsCount records the number of unschedulable pods held back
+// from scale-up by pod batching.
+func UpdateBatchedPodsCount(podsCount int) {
+	batchedPodsCount.Set(float64(podsCount))
+}
+
+// RegisterPodBatchReleased records how long a batch of unschedulable pods was
+// held back before being considered for scale-up.
+func RegisterPodBatchReleased(wait time.Duration) {
+	podBatchWaitDuration.Observe(wait.Seconds())
+}
+
+// ResetQuotaGroups removes usage and limits of all quota groups, so that
+// removed quota groups are not reported.
+func ResetQuotaGroups() {
+	quotaGroupUsage.Reset()
+	quotaGroupLimit.Reset()
+}
+
+// UpdateQuotaGroup records usage and limit of a resource in a quota group.
+func UpdateQuotaGroup(quotaGroup string, resource string, usage float64, limit float64) {
+	quotaGroupUsage.WithLabelValues(quotaGroup, resource).Set(usage)
+	quotaGroupLimit.WithLabelValues(quotaGroup, resource).Set(limit)
+}
+
+// UpdateGuardrailActive records whether a guardrail was triggered in the last loop.
+func UpdateGuardrailActive(guardrail string, active bool) {
+	if active {
+		guardrailActive.WithLabelValues(guardrail).Set(1)
+	} else {
+		guardrailActive.WithLabelValues(guardrail).Set(0)
+	}
+}
+
+// RegisterDryRunNodeGroupCall records a mutating node group call that was
+// skipped in dry run mode, along with the number of nodes it would affect.
+func RegisterDryRunNodeGroupCall(nodeGroup string, call string, nodesCount int) {
+	dryRunNodeGroupCallsCount.WithLabelValues(nodeGroup, call).Inc()
+	dryRunNodesCount.WithLabelValues(nodeGroup, call).Add(float64(nodesCount))
+}
+
+// RegisterDryRunAPIRequest records a mutating Kubernetes API request sent
+// in dry run mode.
+func RegisterDryRunAPIRequest(verb string, resource string) {
+	dryRunAPIRequestsCount.WithLabelValues(verb, resource).Inc()
+}
+
+// RegisterConfigReload records a change of the configuration file, which was
+// applied if err is nil and rejected otherwise.
+func RegisterConfigReload(err error) {
+	if err != nil {
+		configReloadsCount.WithLabelValues(errorLabel).Inc()
+		configValid.Set(0)
+	} else {
+		configReloadsCount.WithLabelValues(successLabel).Inc()
+		configValid.Set(1)
+	}
+}
@@ -84,7 +84,7 @@ func (e *EmptyClusterProcessor) CleanUp() {
 
 // NewDefaultActionableClusterProcessor returns a new Processor instance
 func NewDefaultActionableClusterProcessor() ActionableClusterProcessor {
-	return NewCustomActionableClusterProcessor(time.Now(), NodesNotReadyAfterStartTimeout)
+	return NewGuardrailsProcessor(NewCustomActionableClusterProcessor(time.Now(), NodesNotReadyAfterStartTimeout))
 }
 
 // NewCustomActionableClusterProcessor returns a new instance with custom values
@@ -0,0 +1,272 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actionablecluster
+
+import (
+	ctx "context"
+	"fmt"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	kube_errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/metrics"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ScaleDownPausedKey is the key of the kill switch ConfigMap which pauses scale-down when set to true.
+	ScaleDownPausedKey = "scaleDownPaused"
+	// ScaleDownPausedAnnotationKey is the annotation of the kill switch ConfigMap which pauses scale-down when set to true.
+	ScaleDownPausedAnnotationKey = "cluster-autoscaler.kubernetes.io/scale-down-paused"
+	// NodeCountDropTimeout is how long a drop of the node count has to last before it's accepted as real.
+	NodeCountDropTimeout = 10 * time.Minute
+)
+
+// Names of guardrails, used in metrics.
+const (
+	NodeCountDropGuardrail         = "node_count_drop"
+	UnregisteredInstancesGuardrail = "unregistered_instances"
+	ControlPlaneUnhealthyGuardrail = "control_plane_unhealthy"
+	KillSwitchGuardrail            = "kill_switch"
+)
+
+// guardrailCheck returns a message describing why the guardrail is
+// triggered, or an empty string if it isn't.
+type guardrailCheck func(context *context.AutoscalingContext, allNodes []*apiv1.Node) string
+
+// InstancesReporter reports instances of node groups known to the autoscaler.
+type InstancesReporter interface {
+	// GetCloudProviderNodeInstances returns instances of node groups listed
+	// when the cluster state was last updated, by node group id.
+	GetCloudProviderNodeInstances() map[string][]cloudprovider.Instance
+}
+
+// DeletedNodesReporter reports nodes deleted by the autoscaler itself.
+type DeletedNodesReporter interface {
+	// DeletedNodes returns names of nodes being deleted or recently deleted.
+	DeletedNodes() []string
+}
+
+// GuardrailsProcessor implements ActionableClusterProcessor by protecting the
+// cluster from actions taken on an inaccurate view of it. It freezes
+// scale-down when nodes not deleted by the autoscaler suddenly disappear,
+// which usually means the node list is partial, when the cloud provider
+// reports many instances which aren't registered as nodes, when the control
+// plane is unhealthy, or when scale-down is paused through the kill switch
+// ConfigMap. Guardrails are checked after the ones of the wrapped processor.
+type GuardrailsProcessor struct {
+	ActionableClusterProcessor
+	lastNodes          map[string]bool
+	nodeCountDropStart time.Time
+	deletedNodes       DeletedNodesReporter
+	instances          InstancesReporter
+	killSwitch         v1lister.ConfigMapNamespaceLister
+	// lastRegistered are provider IDs of nodes in the previous loop, in which
+	// instances reported by the cluster state were listed.
+	lastRegistered map[string]bool
+	active         map[string]bool
+	// controlPlaneHealth checks the health of the control plane, it's replaced in tests.
+	controlPlaneHealth func(context *context.AutoscalingContext) error
+}
+
+// NewGuardrailsProcessor returns a GuardrailsProcessor checking guardrails
+// after the ones of the given processor.
+func NewGuardrailsProcessor(processor ActionableClusterProcessor) *GuardrailsProcessor {
+	return &GuardrailsProcessor{
+		ActionableClusterProcessor: processor,
+		active:                     make(map[string]bool),
+		controlPlaneHealth:         apiServerReadiness,
+	}
+}
+
+// SetDeletedNodesReporter sets the source of nodes deleted by the autoscaler,
+// which aren't counted as dropped nodes.
+func (p *GuardrailsProcessor) SetDeletedNodesReporter(reporter DeletedNodesReporter) {
+	p.deletedNodes = reporter
+}
+
+// SetInstancesReporter sets the source of instances of node groups compared
+// with registered nodes. Unregistered instances aren't checked without it.
+func (p *GuardrailsProcessor) SetInstancesReporter(reporter InstancesReporter) {
+	p.instances = reporter
+}
+
+// SetKillSwitchLister sets the lister of ConfigMaps in the namespace of the
+// kill switch ConfigMap. The kill switch isn't checked without it.
+func (p *GuardrailsProcessor) SetKillSwitchLister(lister v1lister.ConfigMapNamespaceLister) {
+	p.killSwitch = lister
+}
+
+// ShouldAbort aborts the loop if the wrapped processor does, and freezes
+// scale-down if any guardrail is triggered.
+func (p *GuardrailsProcessor) ShouldAbort(context *context.AutoscalingContext, allNodes []*apiv1.Node, readyNodes []*apiv1.Node, currentTime time.Time) (bool, errors.AutoscalerError) {
+	if abort, err := p.ActionableClusterProcessor.ShouldAbort(context, allNodes, readyNodes, currentTime); abort {
+		return abort, err
+	}
+
+	freeze := false
+	for _, guardrail := range []struct {
+		name  string
+		check guardrailCheck
+	}{
+		{NodeCountDropGuardrail, p.checkNodeCountDrop(currentTime)},
+		{UnregisteredInstancesGuardrail, p.checkUnregisteredInstances},
+		{ControlPlaneUnhealthyGuardrail, p.checkControlPlane},
+		{KillSwitchGuardrail, p.checkKillSwitch},
+	} {
+		if p.update(context, guardrail.name, guardrail.check(context, allNodes)) {
+			freeze = true
+		}
+	}
+	if freeze {
+		context.ProcessorCallbacks.DisableScaleDownForLoop()
+	}
+	return false, nil
+}
+
+// update records the state of the guardrail, triggered if message isn't
+// empty, and emits an event when it gets triggered.
+func (p *GuardrailsProcessor) update(context *context.AutoscalingContext, guardrail, message string) bool {
+	triggered := message != ""
+	metrics.UpdateGuardrailActive(guardrail, triggered)
+	if triggered {
+		klog.Warningf("Guardrail %s triggered: %s", guardrail, message)
+		if !p.active[guardrail] {
+			context.LogRecorder.Eventf(apiv1.EventTypeWarning, "GuardrailTriggered", message)
+		}
+	} else if p.active[guardrail] {
+		klog.Infof("Guardrail %s no longer triggered", guardrail)
+	}
+	p.active[guardrail] = triggered
+	return triggered
+}
+
+// checkNodeCountDrop returns a check comparing nodes with the ones accepted
+// in a previous loop. Nodes deleted by the autoscaler don't count as dropped.
+func (p *GuardrailsProcessor) checkNodeCountDrop(currentTime time.Time) guardrailCheck {
+	return func(context *context.AutoscalingContext, allNodes []*apiv1.Node) string {
+		nodes := make(map[string]bool, len(allNodes))
+		for _, node := range allNodes {
+			nodes[node.Name] = true
+		}
+		deleted := make(map[string]bool)
+		if p.deletedNodes != nil {
+			for _, nodeName := range p.deletedNodes.DeletedNodes() {
+				deleted[nodeName] = true
+			}
+		}
+		dropped := 0
+		for nodeName := range p.lastNodes {
+			if !nodes[nodeName] && !deleted[nodeName] {
+				dropped++
+			}
+		}
+		maxDrop := context.MaxNodeCountDropPercentage
+		if maxDrop > 0 && len(p.lastNodes) > 0 && float64(dropped) > float64(len(p.lastNodes))*maxDrop/100 {
+			if p.nodeCountDropStart.IsZero() {
+				p.nodeCountDropStart = currentTime
+			}
+			if currentTime.Sub(p.nodeCountDropStart) < NodeCountDropTimeout {
+				return fmt.Sprintf("%d of %d nodes disappeared without being deleted by the autoscaler, more than %v%%; freezing scale-down, the node list may be partial.", dropped, len(p.lastNodes), maxDrop)
+			}
+			klog.Warningf("%d of %d nodes disappeared more than %v ago, accepting it", dropped, len(p.lastNodes), NodeCountDropTimeout)
+		}
+		p.nodeCountDropStart = time.Time{}
+		p.lastNodes = nodes
+		return ""
+	}
+}
+
+// checkUnregisteredInstances compares running instances of node groups with
+// registered nodes. Instances listed when the cluster state was updated in the
+// previous loop are compared with nodes of that loop, so that node groups
+// aren't listed again and failures to list them don't freeze scale-down.
+func (p *GuardrailsProcessor) checkUnregisteredInstances(context *context.AutoscalingContext, allNodes []*apiv1.Node) string {
+	registered := p.lastRegistered
+	p.lastRegistered = make(map[string]bool, len(allNodes))
+	for _, node := range allNodes {
+		p.lastRegistered[node.Spec.ProviderID] = true
+	}
+	maxUnregistered := context.MaxUnregisteredInstancesPercentage
+	if maxUnregistered <= 0 || p.instances == nil || registered == nil {
+		return ""
+	}
+	running, unregistered := 0, 0
+	for _, instances := range p.instances.GetCloudProviderNodeInstances() {
+		for _, instance := range instances {
+			if instance.Status != nil && instance.Status.State != cloudprovider.InstanceRunning {
+				continue
+			}
+			running++
+			if !registered[instance.Id] {
+				unregistered++
+			}
+		}
+	}
+	if running > 0 && float64(unregistered) > float64(running)*maxUnregistered/100 {
+		return fmt.Sprintf("%d of %d running instances are not registered as nodes, more than %v%%; freezing scale-down.", unregistered, running, maxUnregistered)
+	}
+	return ""
+}
+
+func (p *GuardrailsProcessor) checkControlPlane(context *context.AutoscalingContext, _ []*apiv1.Node) string {
+	if !context.ControlPlaneHealthCheck {
+		return ""
+	}
+	if err := p.controlPlaneHealth(context); err != nil {
+		return fmt.Sprintf("Control plane is unhealthy: %v; freezing scale-down.", err)
+	}
+	return ""
+}
+
+// apiServerReadiness checks the readiness endpoint of the API server, which
+// covers its storage and controllers it depends on.
+func apiServerReadiness(context *context.AutoscalingContext) error {
+	client := context.ClientSet.Discovery().RESTClient()
+	if client == nil {
+		return nil
+	}
+	body, err := client.Get().AbsPath("/readyz").DoRaw(ctx.TODO())
+	if err != nil {
+		return fmt.Errorf("API server not ready: %v %s", err, body)
+	}
+	return nil
+}
+
+// checkKillSwitch reads the kill switch ConfigMap. Scale-down is frozen when
+// the ConfigMap can't be read, as it might be paused.
+func (p *GuardrailsProcessor) checkKillSwitch(context *context.AutoscalingContext, _ []*apiv1.Node) string {
+	name := context.ScaleDownKillSwitchConfigMapName
+	if name == "" || p.killSwitch == nil {
+		return ""
+	}
+	configMap, err := p.killSwitch.Get(name)
+	if kube_errors.IsNotFound(err) {
+		return ""
+	}
+	if err != nil {
+		return fmt.Sprintf("Failed to read kill switch ConfigMap %s: %v; freezing scale-down.", name, err)
+	}
+	if configMap.Data[ScaleDownPausedKey] == "true" || configMap.Annotations[ScaleDownPausedAnnotationKey] == "true" {
+		return fmt.Sprintf("Scale-down paused through kill switch ConfigMap %s.", name)
+	}
+	return ""
+}
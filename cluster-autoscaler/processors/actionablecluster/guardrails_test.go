@@ -0,0 +1,271 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actionablecluster
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	testprovider "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/test"
+	"k8s.io/autoscaler/cluster-autoscaler/clusterstate/utils"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/callbacks"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+	"k8s.io/client-go/kubernetes/fake"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	kube_record "k8s.io/client-go/tools/record"
+)
+
+func buildNodes(count int) []*apiv1.Node {
+	nodes := make([]*apiv1.Node, 0, count)
+	for i := 0; i < count; i++ {
+		nodes = append(nodes, BuildTestNode(fmt.Sprintf("n%d", i), 1000, 1000))
+	}
+	return nodes
+}
+
+func newTestContext(t *testing.T, options config.AutoscalingOptions, provider *testprovider.TestCloudProvider, objects ...runtime.Object) (*context.AutoscalingContext, *callbacks.TestProcessorCallbacks, *kube_record.FakeRecorder) {
+	client := fake.NewSimpleClientset(objects...)
+	recorder := kube_record.NewFakeRecorder(10)
+	logRecorder, err := utils.NewStatusMapRecorder(client, "kube-system", recorder, true, "my-cool-configmap")
+	assert.NoError(t, err)
+	if provider == nil {
+		provider = testprovider.NewTestCloudProvider(nil, nil)
+	}
+	options.ScaleUpFromZero = true
+	options.ConfigNamespace = "kube-system"
+	processorCallbacks := callbacks.NewTestProcessorCallbacks()
+	return &context.AutoscalingContext{
+		AutoscalingOptions: options,
+		AutoscalingKubeClients: context.AutoscalingKubeClients{
+			ClientSet:   client,
+			LogRecorder: logRecorder,
+		},
+		CloudProvider:      provider,
+		ProcessorCallbacks: processorCallbacks,
+	}, processorCallbacks, recorder
+}
+
+type fakeDeletedNodesReporter []string
+
+func (r fakeDeletedNodesReporter) DeletedNodes() []string {
+	return r
+}
+
+func TestGuardrailsNodeCountDrop(t *testing.T) {
+	now := time.Now()
+	autoscalingContext, processorCallbacks, recorder := newTestContext(t, config.AutoscalingOptions{MaxNodeCountDropPercentage: 30}, nil)
+	p := NewGuardrailsProcessor(NewCustomActionableClusterProcessor(now, NodesNotReadyAfterStartTimeout))
+
+	nodes := buildNodes(10)
+	abort, err := p.ShouldAbort(autoscalingContext, nodes, nodes, now)
+	assert.NoError(t, err)
+	assert.False(t, abort)
+
+	// A drop within the limit is accepted.
+	abort, _ = p.ShouldAbort(autoscalingContext, nodes[:8], nodes[:8], now.Add(time.Minute))
+	assert.False(t, abort)
+	assert.False(t, processorCallbacks.ScaleDownDisabledForLoop)
+
+	// A larger drop freezes scale-down, until it lasts long enough.
+	abort, _ = p.ShouldAbort(autoscalingContext, nodes[:4], nodes[:4], now.Add(2*time.Minute))
+	assert.False(t, abort)
+	assert.True(t, processorCallbacks.ScaleDownDisabledForLoop)
+	assert.Contains(t, <-recorder.Events, "4 of 8 nodes disappeared without being deleted by the autoscaler")
+	processorCallbacks.ScaleDownDisabledForLoop = false
+	abort, _ = p.ShouldAbort(autoscalingContext, nodes[:4], nodes[:4], now.Add(3*time.Minute))
+	assert.False(t, abort)
+	assert.True(t, processorCallbacks.ScaleDownDisabledForLoop)
+	assert.Empty(t, recorder.Events, "event should only be emitted when the guardrail gets triggered")
+
+	// Recovery of the node list resets the guardrail.
+	processorCallbacks.ScaleDownDisabledForLoop = false
+	p.ShouldAbort(autoscalingContext, nodes[:8], nodes[:8], now.Add(4*time.Minute))
+	assert.False(t, processorCallbacks.ScaleDownDisabledForLoop)
+
+	p.ShouldAbort(autoscalingContext, nodes[:4], nodes[:4], now.Add(5*time.Minute))
+	assert.True(t, processorCallbacks.ScaleDownDisabledForLoop)
+	processorCallbacks.ScaleDownDisabledForLoop = false
+	p.ShouldAbort(autoscalingContext, nodes[:4], nodes[:4], now.Add(5*time.Minute+NodeCountDropTimeout))
+	assert.False(t, processorCallbacks.ScaleDownDisabledForLoop)
+	p.ShouldAbort(autoscalingContext, nodes[:4], nodes[:4], now.Add(6*time.Minute+NodeCountDropTimeout))
+	assert.False(t, processorCallbacks.ScaleDownDisabledForLoop)
+}
+
+func TestGuardrailsNodeCountDropDeletedNodes(t *testing.T) {
+	now := time.Now()
+	autoscalingContext, processorCallbacks, _ := newTestContext(t, config.AutoscalingOptions{MaxNodeCountDropPercentage: 30}, nil)
+	p := NewGuardrailsProcessor(NewCustomActionableClusterProcessor(now, NodesNotReadyAfterStartTimeout))
+	p.SetDeletedNodesReporter(fakeDeletedNodesReporter{"n4", "n5", "n6", "n7"})
+
+	nodes := buildNodes(10)
+	p.ShouldAbort(autoscalingContext, nodes, nodes, now)
+	// Nodes deleted by the autoscaler don't count as dropped.
+	p.ShouldAbort(autoscalingContext, append(nodes[:4:4], nodes[8:]...), nil, now.Add(time.Minute))
+	assert.False(t, processorCallbacks.ScaleDownDisabledForLoop)
+
+	// Other nodes still count.
+	p.ShouldAbort(autoscalingContext, nodes[:3], nil, now.Add(2*time.Minute))
+	assert.True(t, processorCallbacks.ScaleDownDisabledForLoop)
+}
+
+type fakeInstancesReporter map[string][]cloudprovider.Instance
+
+func (r fakeInstancesReporter) GetCloudProviderNodeInstances() map[string][]cloudprovider.Instance {
+	return r
+}
+
+func buildInstances(nodes []*apiv1.Node) []cloudprovider.Instance {
+	instances := make([]cloudprovider.Instance, 0, len(nodes))
+	for _, node := range nodes {
+		instances = append(instances, cloudprovider.Instance{Id: node.Spec.ProviderID})
+	}
+	return instances
+}
+
+func TestGuardrailsUnregisteredInstances(t *testing.T) {
+	now := time.Now()
+	nodes := buildNodes(4)
+	autoscalingContext, processorCallbacks, recorder := newTestContext(t, config.AutoscalingOptions{MaxUnregisteredInstancesPercentage: 50}, nil)
+	p := NewGuardrailsProcessor(NewCustomActionableClusterProcessor(now, NodesNotReadyAfterStartTimeout))
+	p.SetInstancesReporter(fakeInstancesReporter{"ng1": buildInstances(nodes)})
+
+	// Instances are compared with nodes of the previous loop, so the first
+	// loop only records them.
+	abort, err := p.ShouldAbort(autoscalingContext, nodes[:1], nodes[:1], now)
+	assert.NoError(t, err)
+	assert.False(t, abort)
+	assert.False(t, processorCallbacks.ScaleDownDisabledForLoop)
+
+	abort, err = p.ShouldAbort(autoscalingContext, nodes[:2], nodes[:2], now)
+	assert.NoError(t, err)
+	assert.False(t, abort)
+	assert.True(t, processorCallbacks.ScaleDownDisabledForLoop)
+	assert.Contains(t, <-recorder.Events, "3 of 4 running instances are not registered as nodes")
+
+	processorCallbacks.ScaleDownDisabledForLoop = false
+	abort, err = p.ShouldAbort(autoscalingContext, nodes[:2], nodes[:2], now)
+	assert.NoError(t, err)
+	assert.False(t, abort)
+	assert.False(t, processorCallbacks.ScaleDownDisabledForLoop)
+}
+
+func TestGuardrailsUnregisteredInstancesMissingNodeGroup(t *testing.T) {
+	now := time.Now()
+	nodes := buildNodes(4)
+	autoscalingContext, processorCallbacks, _ := newTestContext(t, config.AutoscalingOptions{MaxUnregisteredInstancesPercentage: 50}, nil)
+	p := NewGuardrailsProcessor(NewCustomActionableClusterProcessor(now, NodesNotReadyAfterStartTimeout))
+	// Instances of ng2 failed to be listed, so they aren't reported.
+	p.SetInstancesReporter(fakeInstancesReporter{"ng1": buildInstances(nodes[:2])})
+
+	p.ShouldAbort(autoscalingContext, nodes, nodes, now)
+	p.ShouldAbort(autoscalingContext, nodes, nodes, now)
+	assert.False(t, processorCallbacks.ScaleDownDisabledForLoop)
+}
+
+func TestGuardrailsControlPlane(t *testing.T) {
+	now := time.Now()
+	autoscalingContext, processorCallbacks, recorder := newTestContext(t, config.AutoscalingOptions{ControlPlaneHealthCheck: true}, nil)
+	p := NewGuardrailsProcessor(NewCustomActionableClusterProcessor(now, NodesNotReadyAfterStartTimeout))
+	var healthErr error
+	p.controlPlaneHealth = func(*context.AutoscalingContext) error { return healthErr }
+	nodes := buildNodes(3)
+
+	abort, _ := p.ShouldAbort(autoscalingContext, nodes, nodes, now)
+	assert.False(t, abort)
+	assert.False(t, processorCallbacks.ScaleDownDisabledForLoop)
+
+	healthErr = fmt.Errorf("etcd failed")
+	abort, _ = p.ShouldAbort(autoscalingContext, nodes, nodes, now)
+	assert.False(t, abort)
+	assert.True(t, processorCallbacks.ScaleDownDisabledForLoop)
+	assert.Contains(t, <-recorder.Events, "Control plane is unhealthy: etcd failed")
+}
+
+func TestGuardrailsKillSwitch(t *testing.T) {
+	testCases := []struct {
+		name       string
+		configMap  *apiv1.ConfigMap
+		wantFrozen bool
+	}{
+		{
+			name: "no kill switch ConfigMap",
+		},
+		{
+			name: "scale-down not paused",
+			configMap: &apiv1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "kill-switch"},
+				Data:       map[string]string{ScaleDownPausedKey: "false"},
+			},
+		},
+		{
+			name: "scale-down paused by key",
+			configMap: &apiv1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "kill-switch"},
+				Data:       map[string]string{ScaleDownPausedKey: "true"},
+			},
+			wantFrozen: true,
+		},
+		{
+			name: "scale-down paused by annotation",
+			configMap: &apiv1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "kube-system",
+					Name:        "kill-switch",
+					Annotations: map[string]string{ScaleDownPausedAnnotationKey: "true"},
+				},
+			},
+			wantFrozen: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			if tc.configMap != nil {
+				assert.NoError(t, indexer.Add(tc.configMap))
+			}
+			autoscalingContext, processorCallbacks, _ := newTestContext(t, config.AutoscalingOptions{ScaleDownKillSwitchConfigMapName: "kill-switch"}, nil)
+			p := NewGuardrailsProcessor(NewCustomActionableClusterProcessor(time.Now(), NodesNotReadyAfterStartTimeout))
+			p.SetKillSwitchLister(v1lister.NewConfigMapLister(indexer).ConfigMaps("kube-system"))
+			nodes := buildNodes(3)
+
+			abort, err := p.ShouldAbort(autoscalingContext, nodes, nodes, time.Now())
+			assert.NoError(t, err)
+			assert.False(t, abort)
+			assert.Equal(t, tc.wantFrozen, processorCallbacks.ScaleDownDisabledForLoop)
+		})
+	}
+}
+
+func TestGuardrailsEmptyCluster(t *testing.T) {
+	autoscalingContext, processorCallbacks, _ := newTestContext(t, config.AutoscalingOptions{ScaleDownKillSwitchConfigMapName: "kill-switch"}, nil)
+	autoscalingContext.ScaleUpFromZero = false
+	p := NewGuardrailsProcessor(NewCustomActionableClusterProcessor(time.Now(), NodesNotReadyAfterStartTimeout))
+
+	abort, err := p.ShouldAbort(autoscalingContext, nil, nil, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, abort)
+	assert.False(t, processorCallbacks.ScaleDownDisabledForLoop)
+}
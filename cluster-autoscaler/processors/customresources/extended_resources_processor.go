@@ -0,0 +1,194 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customresources
+
+import (
+	"reflect"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// ExtendedResourcesProcessor handles GPUs like GpuCustomResourcesProcessor, and
+// a configured list of extended resources, like SR-IOV NICs, FPGAs or hugepages,
+// whose device plugins may register them some time after the node becomes ready.
+// Nodes are expected to have the extended resources defined in their node group
+// template or, if the cloud provider doesn't provide templates, the extended
+// resources allocatable on other nodes of their node group.
+type ExtendedResourcesProcessor struct {
+	GpuCustomResourcesProcessor
+	resources []apiv1.ResourceName
+	// observed are extended resources allocatable on nodes of each node
+	// group, seen by the last FilterOutNodesWithUnreadyResources call.
+	observed map[string]apiv1.ResourceList
+}
+
+// NewExtendedResourcesProcessor returns a CustomResourcesProcessor handling
+// GPUs and the given extended resources.
+func NewExtendedResourcesProcessor(resources []string) CustomResourcesProcessor {
+	resourceNames := make([]apiv1.ResourceName, 0, len(resources))
+	for _, resource := range resources {
+		resourceNames = append(resourceNames, apiv1.ResourceName(resource))
+	}
+	return &ExtendedResourcesProcessor{resources: resourceNames}
+}
+
+// FilterOutNodesWithUnreadyResources removes nodes that should have GPU or one of
+// the extended resources, but don't have it in allocatable from ready nodes list
+// and updates their status to unready on all nodes list.
+func (p *ExtendedResourcesProcessor) FilterOutNodesWithUnreadyResources(context *context.AutoscalingContext, allNodes, readyNodes []*apiv1.Node) ([]*apiv1.Node, []*apiv1.Node) {
+	allNodes, readyNodes = p.GpuCustomResourcesProcessor.FilterOutNodesWithUnreadyResources(context, allNodes, readyNodes)
+	p.observed = p.observeResources(context, allNodes)
+
+	newAllNodes := make([]*apiv1.Node, 0)
+	newReadyNodes := make([]*apiv1.Node, 0)
+	nodesWithUnreadyResources := make(map[string]*apiv1.Node)
+	templates := make(map[string]apiv1.ResourceList)
+	for _, node := range readyNodes {
+		if resource, unready := p.unreadyResource(context, node, templates); unready {
+			klog.V(3).Infof("Overriding status of node %v, which seems to have unready %v", node.Name, resource)
+			nodesWithUnreadyResources[node.Name] = kubernetes.GetUnreadyNodeCopy(node, kubernetes.ResourceUnready)
+		} else {
+			newReadyNodes = append(newReadyNodes, node)
+		}
+	}
+	// Override any node with unready resources with its "unready" copy
+	for _, node := range allNodes {
+		if newNode, found := nodesWithUnreadyResources[node.Name]; found {
+			newAllNodes = append(newAllNodes, newNode)
+		} else {
+			newAllNodes = append(newAllNodes, node)
+		}
+	}
+	return newAllNodes, newReadyNodes
+}
+
+// unreadyResource returns an extended resource which the node is expected to
+// have, but which isn't allocatable on the node yet. Expected resources of node
+// groups are cached in the given map.
+func (p *ExtendedResourcesProcessor) unreadyResource(context *context.AutoscalingContext, node *apiv1.Node, templates map[string]apiv1.ResourceList) (apiv1.ResourceName, bool) {
+	missing := p.missingResources(node)
+	if len(missing) == 0 {
+		return "", false
+	}
+	nodeGroup, err := context.CloudProvider.NodeGroupForNode(node)
+	if err != nil || nodeGroup == nil || reflect.ValueOf(nodeGroup).IsNil() {
+		return "", false
+	}
+	expected, found := templates[nodeGroup.Id()]
+	if !found {
+		expected, _ = p.expectedResources(nodeGroup)
+		templates[nodeGroup.Id()] = expected
+	}
+	for _, resource := range missing {
+		if capacity, found := expected[resource]; found && !capacity.IsZero() {
+			return resource, true
+		}
+	}
+	return "", false
+}
+
+// expectedResources returns resources which nodes of the node group are
+// expected to have: ones defined in its template or, if the cloud provider
+// doesn't provide templates, extended resources observed on its other nodes.
+func (p *ExtendedResourcesProcessor) expectedResources(nodeGroup cloudprovider.NodeGroup) (apiv1.ResourceList, error) {
+	template, err := nodeGroup.TemplateNodeInfo()
+	if err == cloudprovider.ErrNotImplemented {
+		return p.observed[nodeGroup.Id()], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return template.Node().Status.Capacity, nil
+}
+
+// observeResources returns the largest allocatable amounts of extended
+// resources on nodes of each node group.
+func (p *ExtendedResourcesProcessor) observeResources(context *context.AutoscalingContext, nodes []*apiv1.Node) map[string]apiv1.ResourceList {
+	observed := make(map[string]apiv1.ResourceList)
+	for _, node := range nodes {
+		if len(p.missingResources(node)) == len(p.resources) {
+			continue
+		}
+		nodeGroup, err := context.CloudProvider.NodeGroupForNode(node)
+		if err != nil || nodeGroup == nil || reflect.ValueOf(nodeGroup).IsNil() {
+			continue
+		}
+		resources, found := observed[nodeGroup.Id()]
+		if !found {
+			resources = make(apiv1.ResourceList)
+			observed[nodeGroup.Id()] = resources
+		}
+		for _, resource := range p.resources {
+			allocatable, found := node.Status.Allocatable[resource]
+			if current := resources[resource]; found && allocatable.Cmp(current) > 0 {
+				resources[resource] = allocatable
+			}
+		}
+	}
+	return observed
+}
+
+// missingResources returns extended resources which aren't allocatable on the node.
+func (p *ExtendedResourcesProcessor) missingResources(node *apiv1.Node) []apiv1.ResourceName {
+	var missing []apiv1.ResourceName
+	for _, resource := range p.resources {
+		if allocatable, found := node.Status.Allocatable[resource]; !found || allocatable.IsZero() {
+			missing = append(missing, resource)
+		}
+	}
+	return missing
+}
+
+// GetNodeResourceTargets returns mapping of resource names to their targets.
+// This includes resources which are not yet ready to use and visible in kubernetes.
+func (p *ExtendedResourcesProcessor) GetNodeResourceTargets(context *context.AutoscalingContext, node *apiv1.Node, nodeGroup cloudprovider.NodeGroup) ([]CustomResourceTarget, errors.AutoscalerError) {
+	targets, err := p.GpuCustomResourcesProcessor.GetNodeResourceTargets(context, node, nodeGroup)
+	if err != nil {
+		return targets, err
+	}
+	missing := p.missingResources(node)
+	for _, resource := range p.resources {
+		if allocatable, found := node.Status.Allocatable[resource]; found && !allocatable.IsZero() {
+			targets = append(targets, CustomResourceTarget{string(resource), allocatable.Value()})
+		}
+	}
+	if len(missing) == 0 || nodeGroup == nil {
+		// Nodes outside of autoscaled node groups are expected to have only
+		// resources which are already allocatable.
+		return targets, nil
+	}
+	expected, templateErr := p.expectedResources(nodeGroup)
+	if templateErr != nil {
+		klog.Errorf("Failed to build template for getting extended resources estimation for node %v: %v", node.Name, templateErr)
+		return targets, errors.ToAutoscalerError(errors.CloudProviderError, templateErr)
+	}
+	for _, resource := range missing {
+		if capacity, found := expected[resource]; found && !capacity.IsZero() {
+			targets = append(targets, CustomResourceTarget{string(resource), capacity.Value()})
+		}
+	}
+	return targets, nil
+}
+
+// CleanUp cleans up processor's internal structures.
+func (p *ExtendedResourcesProcessor) CleanUp() {
+}
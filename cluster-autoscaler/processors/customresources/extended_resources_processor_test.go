@@ -0,0 +1,124 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customresources
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	testprovider "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/test"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+const sriovResource = "intel.com/sriov_netdevice"
+
+func TestExtendedResourcesFilterOutNodesWithUnreadyResources(t *testing.T) {
+	now := time.Now()
+	withSriov := func(node *apiv1.Node, count int64) *apiv1.Node {
+		node.Status.Capacity[sriovResource] = *resource.NewQuantity(count, resource.DecimalSI)
+		node.Status.Allocatable[sriovResource] = *resource.NewQuantity(count, resource.DecimalSI)
+		return node
+	}
+	sriovTemplate := schedulerframework.NewNodeInfo()
+	sriovTemplate.SetNode(withSriov(BuildTestNode("t1", 1000, 1000), 4))
+	plainTemplate := schedulerframework.NewNodeInfo()
+	plainTemplate.SetNode(BuildTestNode("t2", 1000, 1000))
+	provider := testprovider.NewTestAutoprovisioningCloudProvider(nil, nil, nil, nil, nil,
+		map[string]*schedulerframework.NodeInfo{"sriov": sriovTemplate, "plain": plainTemplate})
+	provider.AddNodeGroup("sriov", 0, 10, 2)
+	provider.AddNodeGroup("plain", 0, 10, 1)
+
+	sriovReady := withSriov(BuildTestNode("sriovReady", 1000, 1000), 4)
+	sriovUnready := BuildTestNode("sriovUnready", 1000, 1000)
+	plain := BuildTestNode("plain", 1000, 1000)
+	for _, node := range []*apiv1.Node{sriovReady, sriovUnready, plain} {
+		SetNodeReadyState(node, true, now)
+	}
+	provider.AddNode("sriov", sriovReady)
+	provider.AddNode("sriov", sriovUnready)
+	provider.AddNode("plain", plain)
+
+	ctx := &context.AutoscalingContext{CloudProvider: provider}
+	processor := NewExtendedResourcesProcessor([]string{sriovResource})
+	nodes := []*apiv1.Node{sriovReady, sriovUnready, plain}
+	allNodes, readyNodes := processor.FilterOutNodesWithUnreadyResources(ctx, nodes, nodes)
+
+	assert.Equal(t, []*apiv1.Node{sriovReady, plain}, readyNodes)
+	assert.Equal(t, 3, len(allNodes))
+	for _, node := range allNodes {
+		ready, _, _ := kube_util.GetReadinessState(node)
+		assert.Equal(t, node.Name != sriovUnready.Name, ready, node.Name)
+	}
+
+	// Resources of unready nodes come from the template.
+	targets, err := processor.GetNodeResourceTargets(ctx, sriovUnready, provider.GetNodeGroup("sriov"))
+	assert.NoError(t, err)
+	assert.Contains(t, targets, CustomResourceTarget{sriovResource, 4})
+	targets, err = processor.GetNodeResourceTargets(ctx, sriovReady, provider.GetNodeGroup("sriov"))
+	assert.NoError(t, err)
+	assert.Contains(t, targets, CustomResourceTarget{sriovResource, 4})
+	targets, err = processor.GetNodeResourceTargets(ctx, plain, provider.GetNodeGroup("plain"))
+	assert.NoError(t, err)
+	for _, target := range targets {
+		assert.NotEqual(t, sriovResource, target.ResourceType)
+	}
+}
+
+func TestExtendedResourcesWithoutTemplates(t *testing.T) {
+	now := time.Now()
+	withSriov := func(node *apiv1.Node, count int64) *apiv1.Node {
+		node.Status.Capacity[sriovResource] = *resource.NewQuantity(count, resource.DecimalSI)
+		node.Status.Allocatable[sriovResource] = *resource.NewQuantity(count, resource.DecimalSI)
+		return node
+	}
+	// The cloud provider doesn't provide templates.
+	provider := testprovider.NewTestCloudProvider(nil, nil)
+	provider.AddNodeGroup("sriov", 0, 10, 2)
+	provider.AddNodeGroup("plain", 0, 10, 1)
+
+	sriovReady := withSriov(BuildTestNode("sriovReady", 1000, 1000), 4)
+	sriovUnready := BuildTestNode("sriovUnready", 1000, 1000)
+	plain := BuildTestNode("plain", 1000, 1000)
+	for _, node := range []*apiv1.Node{sriovReady, sriovUnready, plain} {
+		SetNodeReadyState(node, true, now)
+	}
+	provider.AddNode("sriov", sriovReady)
+	provider.AddNode("sriov", sriovUnready)
+	provider.AddNode("plain", plain)
+
+	ctx := &context.AutoscalingContext{CloudProvider: provider}
+	processor := NewExtendedResourcesProcessor([]string{sriovResource})
+	nodes := []*apiv1.Node{sriovReady, sriovUnready, plain}
+	_, readyNodes := processor.FilterOutNodesWithUnreadyResources(ctx, nodes, nodes)
+
+	// Resources are expected from other nodes of the node group.
+	assert.Equal(t, []*apiv1.Node{sriovReady, plain}, readyNodes)
+	targets, err := processor.GetNodeResourceTargets(ctx, sriovUnready, provider.GetNodeGroup("sriov"))
+	assert.NoError(t, err)
+	assert.Contains(t, targets, CustomResourceTarget{sriovResource, 4})
+	targets, err = processor.GetNodeResourceTargets(ctx, plain, provider.GetNodeGroup("plain"))
+	assert.NoError(t, err)
+	for _, target := range targets {
+		assert.NotEqual(t, sriovResource, target.ResourceType)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
 	"k8s.io/autoscaler/cluster-autoscaler/context"
 )
 
@@ -33,6 +34,8 @@ type NodeGroupConfigProcessor interface {
 	GetScaleDownUtilizationThreshold(context *context.AutoscalingContext, nodeGroup cloudprovider.NodeGroup) (float64, error)
 	// GetScaleDownGpuUtilizationThreshold returns ScaleDownGpuUtilizationThreshold value that should be used for a given NodeGroup.
 	GetScaleDownGpuUtilizationThreshold(context *context.AutoscalingContext, nodeGroup cloudprovider.NodeGroup) (float64, error)
+	// GetScaleDownSelectionPolicies returns ScaleDownSelectionPolicies value that should be used for a given NodeGroup.
+	GetScaleDownSelectionPolicies(context *context.AutoscalingContext, nodeGroup cloudprovider.NodeGroup) ([]string, error)
 	// CleanUp cleans up processor's internal structures.
 	CleanUp()
 }
@@ -45,50 +48,66 @@ type DelegatingNodeGroupConfigProcessor struct {
 
 // GetScaleDownUnneededTime returns ScaleDownUnneededTime value that should be used for a given NodeGroup.
 func (p *DelegatingNodeGroupConfigProcessor) GetScaleDownUnneededTime(context *context.AutoscalingContext, nodeGroup cloudprovider.NodeGroup) (time.Duration, error) {
-	ngConfig, err := nodeGroup.GetOptions(context.NodeGroupDefaults)
-	if err != nil && err != cloudprovider.ErrNotImplemented {
+	ngConfig, err := p.nodeGroupOptions(context, nodeGroup)
+	if err != nil {
 		return time.Duration(0), err
 	}
-	if ngConfig == nil || err == cloudprovider.ErrNotImplemented {
-		return context.NodeGroupDefaults.ScaleDownUnneededTime, nil
-	}
 	return ngConfig.ScaleDownUnneededTime, nil
 }
 
 // GetScaleDownUnreadyTime returns ScaleDownUnreadyTime value that should be used for a given NodeGroup.
 func (p *DelegatingNodeGroupConfigProcessor) GetScaleDownUnreadyTime(context *context.AutoscalingContext, nodeGroup cloudprovider.NodeGroup) (time.Duration, error) {
-	ngConfig, err := nodeGroup.GetOptions(context.NodeGroupDefaults)
-	if err != nil && err != cloudprovider.ErrNotImplemented {
+	ngConfig, err := p.nodeGroupOptions(context, nodeGroup)
+	if err != nil {
 		return time.Duration(0), err
 	}
-	if ngConfig == nil || err == cloudprovider.ErrNotImplemented {
-		return context.NodeGroupDefaults.ScaleDownUnreadyTime, nil
-	}
 	return ngConfig.ScaleDownUnreadyTime, nil
 }
 
 // GetScaleDownUtilizationThreshold returns ScaleDownUtilizationThreshold value that should be used for a given NodeGroup.
 func (p *DelegatingNodeGroupConfigProcessor) GetScaleDownUtilizationThreshold(context *context.AutoscalingContext, nodeGroup cloudprovider.NodeGroup) (float64, error) {
-	ngConfig, err := nodeGroup.GetOptions(context.NodeGroupDefaults)
-	if err != nil && err != cloudprovider.ErrNotImplemented {
+	ngConfig, err := p.nodeGroupOptions(context, nodeGroup)
+	if err != nil {
 		return 0.0, err
 	}
-	if ngConfig == nil || err == cloudprovider.ErrNotImplemented {
-		return context.NodeGroupDefaults.ScaleDownUtilizationThreshold, nil
-	}
 	return ngConfig.ScaleDownUtilizationThreshold, nil
 }
 
 // GetScaleDownGpuUtilizationThreshold returns ScaleDownGpuUtilizationThreshold value that should be used for a given NodeGroup.
 func (p *DelegatingNodeGroupConfigProcessor) GetScaleDownGpuUtilizationThreshold(context *context.AutoscalingContext, nodeGroup cloudprovider.NodeGroup) (float64, error) {
+	ngConfig, err := p.nodeGroupOptions(context, nodeGroup)
+	if err != nil {
+		return 0.0, err
+	}
+	return ngConfig.ScaleDownGpuUtilizationThreshold, nil
+}
+
+// GetScaleDownSelectionPolicies returns ScaleDownSelectionPolicies value that should be used for a given NodeGroup.
+func (p *DelegatingNodeGroupConfigProcessor) GetScaleDownSelectionPolicies(context *context.AutoscalingContext, nodeGroup cloudprovider.NodeGroup) ([]string, error) {
+	ngConfig, err := p.nodeGroupOptions(context, nodeGroup)
+	if err != nil {
+		return nil, err
+	}
+	return ngConfig.ScaleDownSelectionPolicies, nil
+}
+
+// nodeGroupOptions returns options provided by the NodeGroup, or the default
+// ones if it doesn't provide any, with overrides for the NodeGroup applied.
+func (p *DelegatingNodeGroupConfigProcessor) nodeGroupOptions(context *context.AutoscalingContext, nodeGroup cloudprovider.NodeGroup) (config.NodeGroupAutoscalingOptions, error) {
+	options := context.NodeGroupDefaults
 	ngConfig, err := nodeGroup.GetOptions(context.NodeGroupDefaults)
 	if err != nil && err != cloudprovider.ErrNotImplemented {
-		return 0.0, err
+		return options, err
 	}
-	if ngConfig == nil || err == cloudprovider.ErrNotImplemented {
-		return context.NodeGroupDefaults.ScaleDownGpuUtilizationThreshold, nil
+	if ngConfig != nil && err == nil {
+		options = *ngConfig
 	}
-	return ngConfig.ScaleDownGpuUtilizationThreshold, nil
+	if len(context.NodeGroupOverrides) > 0 {
+		if override, found := context.NodeGroupOverrides[nodeGroup.Id()]; found {
+			options = override.Apply(options)
+		}
+	}
+	return options, nil
 }
 
 // CleanUp cleans up processor's internal structures.
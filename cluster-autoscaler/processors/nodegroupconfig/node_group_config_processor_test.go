@@ -48,12 +48,14 @@ func TestDelegatingNodeGroupConfigProcessor(t *testing.T) {
 		ScaleDownUnreadyTime:             4 * time.Minute,
 		ScaleDownGpuUtilizationThreshold: 0.6,
 		ScaleDownUtilizationThreshold:    0.5,
+		ScaleDownSelectionPolicies:       []string{"oldest"},
 	}
 	ngOpts := &config.NodeGroupAutoscalingOptions{
 		ScaleDownUnneededTime:            10 * time.Minute,
 		ScaleDownUnreadyTime:             11 * time.Minute,
 		ScaleDownGpuUtilizationThreshold: 0.85,
 		ScaleDownUtilizationThreshold:    0.75,
+		ScaleDownSelectionPolicies:       []string{"least-utilized", "fewest-evictions"},
 	}
 
 	testUnneededTime := func(t *testing.T, p DelegatingNodeGroupConfigProcessor, c *context.AutoscalingContext, ng cloudprovider.NodeGroup, w Want, we error) {
@@ -96,17 +98,29 @@ func TestDelegatingNodeGroupConfigProcessor(t *testing.T) {
 		}
 		assert.Equal(t, res, results[w])
 	}
+	testSelectionPolicies := func(t *testing.T, p DelegatingNodeGroupConfigProcessor, c *context.AutoscalingContext, ng cloudprovider.NodeGroup, w Want, we error) {
+		res, err := p.GetScaleDownSelectionPolicies(c, ng)
+		assert.Equal(t, err, we)
+		results := map[Want][]string{
+			NIL:    nil,
+			GLOBAL: {"oldest"},
+			NG:     {"least-utilized", "fewest-evictions"},
+		}
+		assert.Equal(t, res, results[w])
+	}
 
 	funcs := map[string]func(*testing.T, DelegatingNodeGroupConfigProcessor, *context.AutoscalingContext, cloudprovider.NodeGroup, Want, error){
 		"ScaleDownUnneededTime":            testUnneededTime,
 		"ScaleDownUnreadyTime":             testUnreadyTime,
 		"ScaleDownUtilizationThreshold":    testUtilizationThreshold,
 		"ScaleDownGpuUtilizationThreshold": testGpuThreshold,
+		"ScaleDownSelectionPolicies":       testSelectionPolicies,
 		"MultipleOptions": func(t *testing.T, p DelegatingNodeGroupConfigProcessor, c *context.AutoscalingContext, ng cloudprovider.NodeGroup, w Want, we error) {
 			testUnneededTime(t, p, c, ng, w, we)
 			testUnreadyTime(t, p, c, ng, w, we)
 			testUtilizationThreshold(t, p, c, ng, w, we)
 			testGpuThreshold(t, p, c, ng, w, we)
+			testSelectionPolicies(t, p, c, ng, w, we)
 		},
 		"RepeatingTheSameCallGivesConsistentResults": func(t *testing.T, p DelegatingNodeGroupConfigProcessor, c *context.AutoscalingContext, ng cloudprovider.NodeGroup, w Want, we error) {
 			testUnneededTime(t, p, c, ng, w, we)
@@ -160,3 +174,47 @@ func TestDelegatingNodeGroupConfigProcessor(t *testing.T) {
 		}
 	}
 }
+
+func TestNodeGroupOverrides(t *testing.T) {
+	threshold := 0.3
+	unneededTime := 20 * time.Minute
+	context := &context.AutoscalingContext{
+		AutoscalingOptions: config.AutoscalingOptions{
+			NodeGroupDefaults: config.NodeGroupAutoscalingOptions{
+				ScaleDownUnneededTime:         3 * time.Minute,
+				ScaleDownUnreadyTime:          4 * time.Minute,
+				ScaleDownUtilizationThreshold: 0.5,
+			},
+			NodeGroupOverrides: map[string]config.NodeGroupAutoscalingOptionsOverride{
+				"ng1": {ScaleDownUtilizationThreshold: &threshold},
+				"ng2": {ScaleDownUnneededTime: &unneededTime},
+			},
+		},
+	}
+	ng1 := &mocks.NodeGroup{}
+	ng1.On("Id").Return("ng1")
+	ng1.On("GetOptions", context.NodeGroupDefaults).Return(nil, cloudprovider.ErrNotImplemented)
+	ng2 := &mocks.NodeGroup{}
+	ng2.On("Id").Return("ng2")
+	ng2.On("GetOptions", context.NodeGroupDefaults).Return(&config.NodeGroupAutoscalingOptions{
+		ScaleDownUnneededTime:         10 * time.Minute,
+		ScaleDownUnreadyTime:          11 * time.Minute,
+		ScaleDownUtilizationThreshold: 0.75,
+	}, nil)
+	p := DelegatingNodeGroupConfigProcessor{}
+
+	res, err := p.GetScaleDownUtilizationThreshold(context, ng1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.3, res)
+	unneeded, err := p.GetScaleDownUnneededTime(context, ng1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3*time.Minute, unneeded)
+
+	// Overrides take precedence over options provided by the node group.
+	unneeded, err = p.GetScaleDownUnneededTime(context, ng2)
+	assert.NoError(t, err)
+	assert.Equal(t, 20*time.Minute, unneeded)
+	unready, err := p.GetScaleDownUnreadyTime(context, ng2)
+	assert.NoError(t, err)
+	assert.Equal(t, 11*time.Minute, unready)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodegroups
+
+import (
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	pod_utils "k8s.io/autoscaler/cluster-autoscaler/utils/pod"
+	klog "k8s.io/klog/v2"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// PodNodeGroupSelectorListProcessor removes node groups which none of the
+// unschedulable pods may trigger scale-up of, because of their node group
+// selector annotations. Pods are matched to the remaining node groups in
+// scale-up.
+type PodNodeGroupSelectorListProcessor struct {
+}
+
+// NewPodNodeGroupSelectorListProcessor creates an instance of PodNodeGroupSelectorListProcessor.
+func NewPodNodeGroupSelectorListProcessor() NodeGroupListProcessor {
+	return &PodNodeGroupSelectorListProcessor{}
+}
+
+// Process removes node groups not selected by any of the unschedulable pods.
+func (p *PodNodeGroupSelectorListProcessor) Process(context *context.AutoscalingContext, nodeGroups []cloudprovider.NodeGroup, nodeInfos map[string]*schedulerframework.NodeInfo,
+	unschedulablePods []*apiv1.Pod) ([]cloudprovider.NodeGroup, map[string]*schedulerframework.NodeInfo, error) {
+	selectors := make([]labels.Selector, 0, len(unschedulablePods))
+	for _, pod := range unschedulablePods {
+		selector, err := pod_utils.NodeGroupSelector(pod)
+		if err != nil {
+			continue
+		}
+		if selector == nil {
+			// The pod may trigger scale-up of any node group.
+			return nodeGroups, nodeInfos, nil
+		}
+		selectors = append(selectors, selector)
+	}
+
+	result := make([]cloudprovider.NodeGroup, 0, len(nodeGroups))
+	for _, nodeGroup := range nodeGroups {
+		nodeInfo, found := nodeInfos[nodeGroup.Id()]
+		if !found {
+			// Node groups without node info are skipped in scale-up.
+			result = append(result, nodeGroup)
+			continue
+		}
+		nodeLabels := labels.Set(nodeInfo.Node().Labels)
+		for _, selector := range selectors {
+			if selector.Matches(nodeLabels) {
+				result = append(result, nodeGroup)
+				break
+			}
+		}
+	}
+	if removed := len(nodeGroups) - len(result); removed > 0 {
+		klog.V(4).Infof("Skipping %d node groups not selected by node group selectors of unschedulable pods", removed)
+	}
+	return result, nodeInfos, nil
+}
+
+// CleanUp cleans up the processor's internal structures.
+func (p *PodNodeGroupSelectorListProcessor) CleanUp() {
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodegroups
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	testprovider "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/test"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	pod_utils "k8s.io/autoscaler/cluster-autoscaler/utils/pod"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+)
+
+func TestPodNodeGroupSelectorListProcessor(t *testing.T) {
+	provider := testprovider.NewTestCloudProvider(nil, nil)
+	nodeInfos := make(map[string]*schedulerframework.NodeInfo)
+	for _, id := range []string{"cpu", "gpu", "highmem"} {
+		provider.AddNodeGroup(id, 0, 10, 0)
+		node := BuildTestNode(id+"-template", 1000, 1000)
+		node.Labels["pool"] = id
+		nodeInfos[id] = schedulerframework.NewNodeInfo()
+		nodeInfos[id].SetNode(node)
+	}
+	provider.AddNodeGroup("no-template", 0, 10, 0)
+	nodeGroups := provider.NodeGroups()
+
+	pinned := func(name, selector string) *apiv1.Pod {
+		pod := BuildTestPod(name, 100, 0)
+		pod.Annotations = map[string]string{pod_utils.NodeGroupSelectorAnnotationKey: selector}
+		return pod
+	}
+	testCases := []struct {
+		name string
+		pods []*apiv1.Pod
+		want []string
+	}{
+		{
+			name: "pod without selector keeps all node groups",
+			pods: []*apiv1.Pod{pinned("p1", "pool=gpu"), BuildTestPod("p2", 100, 0)},
+			want: []string{"cpu", "gpu", "highmem", "no-template"},
+		},
+		{
+			name: "node groups selected by any pod are kept",
+			pods: []*apiv1.Pod{pinned("p1", "pool=gpu"), pinned("p2", "pool in (highmem)")},
+			want: []string{"gpu", "highmem", "no-template"},
+		},
+		{
+			name: "no node group selected",
+			pods: []*apiv1.Pod{pinned("p1", "pool=other")},
+			want: []string{"no-template"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			processor := NewPodNodeGroupSelectorListProcessor()
+			result, resultNodeInfos, err := processor.Process(&context.AutoscalingContext{}, nodeGroups, nodeInfos, tc.pods)
+			assert.NoError(t, err)
+			assert.Equal(t, nodeInfos, resultNodeInfos)
+			assert.ElementsMatch(t, tc.want, nodeGroupIds(result))
+		})
+	}
+}
+
+func nodeGroupIds(nodeGroups []cloudprovider.NodeGroup) []string {
+	ids := make([]string, 0, len(nodeGroups))
+	for _, nodeGroup := range nodeGroups {
+		ids = append(ids, nodeGroup.Id())
+	}
+	return ids
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodegroupset
+
+import (
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// instanceIdentifiers returns values identifying the instance backing the node:
+// the node name, system UUID and the server ID from the provider ID.
+func instanceIdentifiers(node *apiv1.Node) []string {
+	var ids []string
+	for _, id := range []string{
+		node.Name,
+		node.Status.NodeInfo.SystemUUID,
+		node.Spec.ProviderID[strings.LastIndex(node.Spec.ProviderID, "/")+1:],
+	} {
+		if id != "" {
+			ids = append(ids, strings.ToLower(id))
+		}
+	}
+	return ids
+}
+
+func derivedFromInstance(value string, ids []string) bool {
+	value = strings.ToLower(value)
+	for _, id := range ids {
+		if value == id {
+			return true
+		}
+	}
+	return false
+}
+
+// withInstanceDerivedLabels returns ignoredLabels extended with labels whose
+// values on both nodes identify the instances backing them, e.g. are server
+// UUIDs, so they differ between any two nodes. Values merely containing an
+// identifier aren't ignored, as they may carry other information.
+func withInstanceDerivedLabels(n1, n2 *schedulerframework.NodeInfo, ignoredLabels map[string]bool) map[string]bool {
+	ids1 := instanceIdentifiers(n1.Node())
+	ids2 := instanceIdentifiers(n2.Node())
+	var derived []string
+	for label, value1 := range n1.Node().Labels {
+		value2, found := n2.Node().Labels[label]
+		if !found || value1 == value2 || ignoredLabels[label] {
+			continue
+		}
+		if derivedFromInstance(value1, ids1) && derivedFromInstance(value2, ids2) {
+			derived = append(derived, label)
+		}
+	}
+	if len(derived) == 0 {
+		return ignoredLabels
+	}
+	result := make(map[string]bool, len(ignoredLabels)+len(derived))
+	for label, ignored := range ignoredLabels {
+		result[label] = ignored
+	}
+	for _, label := range derived {
+		result[label] = true
+	}
+	return result
+}
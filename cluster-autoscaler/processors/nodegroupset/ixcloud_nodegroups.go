@@ -0,0 +1,46 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodegroupset
+
+import (
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/ixcloud"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// CreateIxCloudNodeInfoComparator returns a comparator that checks if two nodes should be considered
+// part of the same NodeGroupSet. This is true if they match usual conditions checked by IsCloudProviderNodeInfoSimilar,
+// even if they have different IKS-specific labels, or labels identifying the instances backing the nodes,
+// e.g. server UUIDs.
+func CreateIxCloudNodeInfoComparator(extraIgnoredLabels []string) NodeInfoComparator {
+	ixCloudIgnoredLabels := map[string]bool{
+		ixcloud.NodeGroupLabel:                 true, // this is a label used by IKS to identify node group names.
+		"ixcloud.openstack.org/nodegroup-uuid": true, // this is a label used by IKS to identify node group UUIDs.
+		ixcloud.CinderCSIZoneLabel:             true, // this is a label used by the Cinder CSI driver as a target for Persistent Volume Node Affinity.
+	}
+
+	for k, v := range BasicIgnoredLabels {
+		ixCloudIgnoredLabels[k] = v
+	}
+
+	for _, k := range extraIgnoredLabels {
+		ixCloudIgnoredLabels[k] = true
+	}
+
+	return func(n1, n2 *schedulerframework.NodeInfo) bool {
+		return IsCloudProviderNodeInfoSimilar(n1, n2, withInstanceDerivedLabels(n1, n2, ixCloudIgnoredLabels))
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodegroupset
+
+import (
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+)
+
+// buildIxCloudNode builds a node with labels set on worker nodes of an IKS
+// cluster by IKS, the OpenStack cloud controller manager and the Cinder CSI driver.
+func buildIxCloudNode(name, serverID, nodeGroup, flavor, zone string) *apiv1.Node {
+	node := BuildTestNode(name, 1000, 2000)
+	node.Spec.ProviderID = "openstack:///" + serverID
+	node.Status.NodeInfo.SystemUUID = serverID
+	for label, value := range map[string]string{
+		"kubernetes.io/arch":                     "amd64",
+		"kubernetes.io/hostname":                 name,
+		"kubernetes.io/os":                       "linux",
+		"ixcloud.openstack.org/nodegroup":        nodeGroup,
+		"node.kubernetes.io/instance-type":       flavor,
+		"topology.cinder.csi.openstack.org/zone": zone,
+		"topology.kubernetes.io/region":          "kr-central-1",
+		"topology.kubernetes.io/zone":            zone,
+	} {
+		node.Labels[label] = value
+	}
+	return node
+}
+
+func TestIsIxCloudNodeInfoSimilar(t *testing.T) {
+	comparator := CreateIxCloudNodeInfoComparator([]string{})
+	node1 := buildIxCloudNode("pool-a-7c9f2", "0b8e6a2e-5d3c-4a51-9a8e-3f1f7c2d9e10", "pool-a", "c2.large", "kr-central-1a")
+
+	for _, tc := range []struct {
+		description string
+		node2       *apiv1.Node
+		similar     bool
+	}{
+		{
+			description: "node group in another zone",
+			node2:       buildIxCloudNode("pool-b-1d4e8", "9c1d3b7a-2e4f-4c8b-8d6a-5b2e1f0a7c34", "pool-b", "c2.large", "kr-central-1b"),
+			similar:     true,
+		},
+		{
+			description: "node group with another flavor",
+			node2:       buildIxCloudNode("pool-c-5a2b1", "9c1d3b7a-2e4f-4c8b-8d6a-5b2e1f0a7c34", "pool-c", "c2.xlarge", "kr-central-1a"),
+			similar:     false,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			checkNodesSimilar(t, node1, tc.node2, comparator, tc.similar)
+		})
+	}
+}
+
+func TestIsIxCloudNodeInfoSimilarWithInstanceDerivedLabels(t *testing.T) {
+	comparator := CreateIxCloudNodeInfoComparator([]string{})
+	node1 := buildIxCloudNode("pool-a-7c9f2", "0b8e6a2e-5d3c-4a51-9a8e-3f1f7c2d9e10", "pool-a", "c2.large", "kr-central-1a")
+	node2 := buildIxCloudNode("pool-b-1d4e8", "9c1d3b7a-2e4f-4c8b-8d6a-5b2e1f0a7c34", "pool-b", "c2.large", "kr-central-1b")
+
+	// Node group UUIDs and labels set to the server IDs or node names differ between any two nodes.
+	node1.Labels["ixcloud.openstack.org/nodegroup-uuid"] = "6a6f3a2e-3b8c-4d36-9f0e-0b7c6c1b2a11"
+	node2.Labels["ixcloud.openstack.org/nodegroup-uuid"] = "d2c1e5f4-7a9b-4c3d-8e2f-1a0b9c8d7e66"
+	node1.Labels["example.com/server-id"] = "0b8e6a2e-5d3c-4a51-9a8e-3f1f7c2d9e10"
+	node2.Labels["example.com/server-id"] = "9C1D3B7A-2E4F-4C8B-8D6A-5B2E1F0A7C34"
+	node1.Labels["example.com/node"] = "pool-a-7c9f2"
+	node2.Labels["example.com/node"] = "pool-b-1d4e8"
+	checkNodesSimilar(t, node1, node2, comparator, true)
+
+	// Labels with values merely containing the identifiers are compared.
+	node1.Labels["example.com/volume"] = "vol-pool-a-7c9f2"
+	node2.Labels["example.com/volume"] = "vol-pool-b-1d4e8"
+	checkNodesSimilar(t, node1, node2, comparator, false)
+	delete(node1.Labels, "example.com/volume")
+	delete(node2.Labels, "example.com/volume")
+
+	// Labels with values not derived from the instances are compared.
+	node1.Labels["example.com/tier"] = "frontend"
+	node2.Labels["example.com/tier"] = "backend"
+	checkNodesSimilar(t, node1, node2, comparator, false)
+}
+
+func TestFindSimilarNodeGroupsIxCloudBasic(t *testing.T) {
+	context := &context.AutoscalingContext{}
+	ni1, ni2, ni3 := buildBasicNodeGroups(context)
+	processor := &BalancingNodeGroupSetProcessor{Comparator: CreateIxCloudNodeInfoComparator([]string{})}
+	basicSimilarNodeGroupsTest(t, context, processor, ni1, ni2, ni3)
+}
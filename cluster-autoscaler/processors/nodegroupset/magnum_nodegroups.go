@@ -0,0 +1,47 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodegroupset
+
+import (
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/magnum"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// CreateMagnumNodeInfoComparator returns a comparator that checks if two nodes should be considered
+// part of the same NodeGroupSet. This is true if they match usual conditions checked by IsCloudProviderNodeInfoSimilar,
+// even if they have different Magnum-specific labels, or labels identifying the instances backing the nodes.
+func CreateMagnumNodeInfoComparator(extraIgnoredLabels []string) NodeInfoComparator {
+	magnumIgnoredLabels := map[string]bool{
+		magnum.NodeGroupLabel:                 true, // this is a label used by Magnum to identify node group names.
+		"magnum.openstack.org/nodegroup-uuid": true, // this is a label used by Magnum to identify node group UUIDs.
+		"magnum.openstack.org/role":           true, // this is a label set by Magnum from the node group role.
+		"kube_tag":                            true, // this is a Magnum cluster label, which may differ between node groups during upgrades.
+		magnum.CinderCSIZoneLabel:             true, // this is a label used by the Cinder CSI driver as a target for Persistent Volume Node Affinity.
+	}
+
+	for k, v := range BasicIgnoredLabels {
+		magnumIgnoredLabels[k] = v
+	}
+
+	for _, k := range extraIgnoredLabels {
+		magnumIgnoredLabels[k] = true
+	}
+
+	return func(n1, n2 *schedulerframework.NodeInfo) bool {
+		return IsCloudProviderNodeInfoSimilar(n1, n2, withInstanceDerivedLabels(n1, n2, magnumIgnoredLabels))
+	}
+}
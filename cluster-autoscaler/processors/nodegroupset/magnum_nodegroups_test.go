@@ -0,0 +1,94 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodegroupset
+
+import (
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+)
+
+// buildMagnumNode builds a node with labels set on worker nodes of a Magnum
+// cluster by Magnum, the OpenStack cloud controller manager and the Cinder CSI driver.
+func buildMagnumNode(name, serverID, nodeGroup, flavor, zone string) *apiv1.Node {
+	node := BuildTestNode(name, 1000, 2000)
+	node.Spec.ProviderID = "openstack:///" + serverID
+	node.Status.NodeInfo.SystemUUID = serverID
+	for label, value := range map[string]string{
+		"beta.kubernetes.io/arch":                  "amd64",
+		"beta.kubernetes.io/instance-type":         flavor,
+		"beta.kubernetes.io/os":                    "linux",
+		"failure-domain.beta.kubernetes.io/region": "RegionOne",
+		"failure-domain.beta.kubernetes.io/zone":   zone,
+		"kubernetes.io/arch":                       "amd64",
+		"kubernetes.io/hostname":                   name,
+		"kubernetes.io/os":                         "linux",
+		"magnum.openstack.org/nodegroup":           nodeGroup,
+		"magnum.openstack.org/role":                "worker",
+		"node.kubernetes.io/instance-type":         flavor,
+		"topology.cinder.csi.openstack.org/zone":   zone,
+		"topology.kubernetes.io/region":            "RegionOne",
+		"topology.kubernetes.io/zone":              zone,
+	} {
+		node.Labels[label] = value
+	}
+	return node
+}
+
+func TestIsMagnumNodeInfoSimilar(t *testing.T) {
+	comparator := CreateMagnumNodeInfoComparator([]string{})
+	node1 := buildMagnumNode("k8s-abc123-default-worker-node-0", "fa405ca9-4486-4159-9763-0f82fbc2e4ac", "default-worker", "m1.large", "nova")
+
+	for _, tc := range []struct {
+		description string
+		node2       *apiv1.Node
+		similar     bool
+	}{
+		{
+			description: "node group in another zone",
+			node2:       buildMagnumNode("k8s-abc123-worker-az2-node-0", "43e67ac6-0d22-4161-9727-4d624b3e6649", "worker-az2", "m1.large", "az2"),
+			similar:     true,
+		},
+		{
+			description: "node group with another flavor",
+			node2:       buildMagnumNode("k8s-abc123-worker-xl-node-0", "43e67ac6-0d22-4161-9727-4d624b3e6649", "worker-xl", "m1.xlarge", "nova"),
+			similar:     false,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			checkNodesSimilar(t, node1, tc.node2, comparator, tc.similar)
+		})
+	}
+
+	// Node group UUIDs, roles and cluster labels which may differ during upgrades are ignored.
+	node2 := buildMagnumNode("k8s-abc123-worker-az2-node-0", "43e67ac6-0d22-4161-9727-4d624b3e6649", "worker-az2", "m1.large", "az2")
+	node1.Labels["magnum.openstack.org/nodegroup-uuid"] = "6a6f3a2e-3b8c-4d36-9f0e-0b7c6c1b2a11"
+	node2.Labels["magnum.openstack.org/nodegroup-uuid"] = "d2c1e5f4-7a9b-4c3d-8e2f-1a0b9c8d7e66"
+	node2.Labels["magnum.openstack.org/role"] = "worker-az2"
+	node1.Labels["kube_tag"] = "v1.23.3-rancher1"
+	node2.Labels["kube_tag"] = "v1.24.1-rancher1"
+	checkNodesSimilar(t, node1, node2, comparator, true)
+}
+
+func TestFindSimilarNodeGroupsMagnumBasic(t *testing.T) {
+	context := &context.AutoscalingContext{}
+	ni1, ni2, ni3 := buildBasicNodeGroups(context)
+	processor := &BalancingNodeGroupSetProcessor{Comparator: CreateMagnumNodeInfoComparator([]string{})}
+	basicSimilarNodeGroupsTest(t, context, processor, ni1, ni2, ni3)
+}
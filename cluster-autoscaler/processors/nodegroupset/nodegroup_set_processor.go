@@ -19,6 +19,7 @@ package nodegroupset
 import (
 	"fmt"
 
+	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
 	"k8s.io/autoscaler/cluster-autoscaler/context"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
@@ -51,6 +52,14 @@ type NodeGroupSetProcessor interface {
 	CleanUp()
 }
 
+// ZoneAwareNodeGroupSetProcessor is a NodeGroupSetProcessor which can split a scale-up
+// between node groups in different zones according to the needs of pods triggering it.
+type ZoneAwareNodeGroupSetProcessor interface {
+	NodeGroupSetProcessor
+	BalanceScaleUpBetweenZones(context *context.AutoscalingContext, groups []cloudprovider.NodeGroup,
+		nodeInfos map[string]*schedulerframework.NodeInfo, podsPerGroup map[string][]*apiv1.Pod, newNodes int) ([]ScaleUpInfo, errors.AutoscalerError)
+}
+
 // NoOpNodeGroupSetProcessor returns no similar node groups and doesn't do any balancing.
 type NoOpNodeGroupSetProcessor struct {
 }
@@ -0,0 +1,277 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodegroupset
+
+import (
+	"math"
+	"sort"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+
+	klog "k8s.io/klog/v2"
+)
+
+// BalanceScaleUpBetweenZones distributes a given number of nodes between given
+// set of NodeGroups, weighting the zones the groups are in by the number of
+// pods which need to land there. Within a single zone nodes are distributed
+// the same way BalanceScaleUpBetweenGroups does it.
+//
+// podsPerGroup holds, for each group, the pods triggering the scale-up which
+// fit on a node from that group. A pod which fits in a single zone only (e.g.
+// because of a zonal persistent volume or node affinity) adds its weight to
+// that zone. A pod with a zonal topology spread constraint adds its weight to
+// the zone with the fewest matching pods. Other pods are split evenly between
+// the zones they fit in. Zones without any capacity left are not considered,
+// so pods which could only land in such zones don't increase the scale-up.
+// Nodes which don't fit within the max size of the groups in a zone are
+// redistributed to the other zones the pods fit in.
+//
+// If the groups span less than two zones, this is equivalent to
+// BalanceScaleUpBetweenGroups.
+func (b *BalancingNodeGroupSetProcessor) BalanceScaleUpBetweenZones(context *context.AutoscalingContext, groups []cloudprovider.NodeGroup,
+	nodeInfos map[string]*schedulerframework.NodeInfo, podsPerGroup map[string][]*apiv1.Pod, newNodes int) ([]ScaleUpInfo, errors.AutoscalerError) {
+	if len(groups) == 0 {
+		return []ScaleUpInfo{}, errors.NewAutoscalerError(
+			errors.InternalError, "Can't balance scale up between 0 groups")
+	}
+
+	groupsPerZone := make(map[string][]cloudprovider.NodeGroup)
+	capacities := make(map[string]int)
+	zonesPerPod := make(map[*apiv1.Pod]map[string]bool)
+	pods := make([]*apiv1.Pod, 0)
+	for _, ng := range groups {
+		currentSize, err := ng.TargetSize()
+		if err != nil {
+			return []ScaleUpInfo{}, errors.NewAutoscalerError(
+				errors.CloudProviderError,
+				"failed to get node group size: %v", err)
+		}
+		zone := nodeGroupZone(nodeInfos[ng.Id()])
+		groupsPerZone[zone] = append(groupsPerZone[zone], ng)
+		if currentSize >= ng.MaxSize() {
+			// group already maxed, it can't absorb any pods
+			continue
+		}
+		capacities[zone] += ng.MaxSize() - currentSize
+		for _, pod := range podsPerGroup[ng.Id()] {
+			if _, found := zonesPerPod[pod]; !found {
+				zonesPerPod[pod] = make(map[string]bool)
+				pods = append(pods, pod)
+			}
+			zonesPerPod[pod][zone] = true
+		}
+	}
+	if len(groupsPerZone) < 2 {
+		return b.BalanceScaleUpBetweenGroups(context, groups, newNodes)
+	}
+
+	weights := make(map[string]float64)
+	spread := newZoneSpreadTracker(context)
+	for _, pod := range pods {
+		zones := zonesPerPod[pod]
+		if len(zones) == 1 {
+			for zone := range zones {
+				weights[zone]++
+			}
+			continue
+		}
+		if zone, found := spread.pickZone(pod, zones); found {
+			weights[zone]++
+			continue
+		}
+		for zone := range zones {
+			weights[zone] += 1.0 / float64(len(zones))
+		}
+	}
+	if len(weights) == 0 {
+		klog.V(2).Infof("No pods with zone information, balancing scale-up evenly between node groups")
+		return b.BalanceScaleUpBetweenGroups(context, groups, newNodes)
+	}
+
+	result := make([]ScaleUpInfo, 0)
+	for zone, zoneNodes := range splitByWeights(weights, capacities, newNodes) {
+		if zoneNodes == 0 {
+			continue
+		}
+		klog.V(2).Infof("Assigning %d of %d new nodes to zone %q", zoneNodes, newNodes, zone)
+		zoneInfos, err := b.BalanceScaleUpBetweenGroups(context, groupsPerZone[zone], zoneNodes)
+		if err != nil {
+			return []ScaleUpInfo{}, err
+		}
+		result = append(result, zoneInfos...)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Group.Id() < result[j].Group.Id()
+	})
+	return result, nil
+}
+
+// splitByWeights splits count proportionally to weights, without exceeding
+// the capacity of any zone. Whatever doesn't fit in a zone is split again
+// between the zones with capacity left, until either everything is assigned
+// or all zones are full.
+func splitByWeights(weights map[string]float64, capacities map[string]int, count int) map[string]int {
+	result := make(map[string]int, len(weights))
+	for zone := range weights {
+		result[zone] = 0
+	}
+	for count > 0 {
+		available := make(map[string]float64)
+		for zone, weight := range weights {
+			if weight > 0 && result[zone] < capacities[zone] {
+				available[zone] = weight
+			}
+		}
+		if len(available) == 0 {
+			klog.V(2).Infof("All zones are full, %d new nodes can't be assigned", count)
+			break
+		}
+		leftover := 0
+		for zone, zoneNodes := range splitByLargestRemainder(available, count) {
+			if free := capacities[zone] - result[zone]; zoneNodes > free {
+				leftover += zoneNodes - free
+				zoneNodes = free
+			}
+			result[zone] += zoneNodes
+		}
+		count = leftover
+	}
+	return result
+}
+
+// splitByLargestRemainder splits count proportionally to weights, using the
+// largest remainder method. Ties are broken by zone name, to make the result
+// stable.
+func splitByLargestRemainder(weights map[string]float64, count int) map[string]int {
+	zones := make([]string, 0, len(weights))
+	total := 0.0
+	for zone, weight := range weights {
+		zones = append(zones, zone)
+		total += weight
+	}
+	sort.Strings(zones)
+
+	result := make(map[string]int, len(zones))
+	remainders := make(map[string]float64, len(zones))
+	assigned := 0
+	for _, zone := range zones {
+		share := float64(count) * weights[zone] / total
+		result[zone] = int(math.Floor(share))
+		remainders[zone] = share - math.Floor(share)
+		assigned += result[zone]
+	}
+	sort.SliceStable(zones, func(i, j int) bool {
+		return remainders[zones[i]] > remainders[zones[j]]
+	})
+	for i := 0; assigned < count; i++ {
+		result[zones[i%len(zones)]]++
+		assigned++
+	}
+	return result
+}
+
+// nodeGroupZone returns the zone of nodes from a node group, based on its
+// template node.
+func nodeGroupZone(nodeInfo *schedulerframework.NodeInfo) string {
+	if nodeInfo == nil || nodeInfo.Node() == nil {
+		return ""
+	}
+	return nodeZone(nodeInfo.Node())
+}
+
+func nodeZone(node *apiv1.Node) string {
+	if zone, found := node.Labels[apiv1.LabelTopologyZone]; found {
+		return zone
+	}
+	return node.Labels[apiv1.LabelZoneFailureDomain]
+}
+
+// zoneSpreadTracker keeps the number of pods matching zonal topology spread
+// constraints in each zone, including the pods already assigned a zone by
+// the current scale-up.
+type zoneSpreadTracker struct {
+	context *context.AutoscalingContext
+	counts  map[string]map[string]int
+}
+
+func newZoneSpreadTracker(context *context.AutoscalingContext) *zoneSpreadTracker {
+	return &zoneSpreadTracker{
+		context: context,
+		counts:  make(map[string]map[string]int),
+	}
+}
+
+// pickZone returns the zone among the given ones with the fewest pods matching
+// the first zonal topology spread constraint of the pod and counts the pod in
+// it. Returns false if the pod has no such constraint.
+func (t *zoneSpreadTracker) pickZone(pod *apiv1.Pod, zones map[string]bool) (string, bool) {
+	for _, constraint := range pod.Spec.TopologySpreadConstraints {
+		if constraint.TopologyKey != apiv1.LabelTopologyZone && constraint.TopologyKey != apiv1.LabelZoneFailureDomain {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(constraint.LabelSelector)
+		if err != nil {
+			klog.Warningf("Failed to parse topology spread constraint selector of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+		key := pod.Namespace + "/" + selector.String()
+		counts, found := t.counts[key]
+		if !found {
+			counts = t.countMatchingPods(pod.Namespace, selector)
+			t.counts[key] = counts
+		}
+		best, bestCount := "", math.MaxInt32
+		for zone := range zones {
+			if counts[zone] < bestCount || (counts[zone] == bestCount && zone < best) {
+				best, bestCount = zone, counts[zone]
+			}
+		}
+		counts[best]++
+		return best, true
+	}
+	return "", false
+}
+
+func (t *zoneSpreadTracker) countMatchingPods(namespace string, selector labels.Selector) map[string]int {
+	counts := make(map[string]int)
+	if t.context == nil || t.context.ClusterSnapshot == nil {
+		return counts
+	}
+	nodeInfos, err := t.context.ClusterSnapshot.NodeInfos().List()
+	if err != nil {
+		klog.Warningf("Failed to list nodes from cluster snapshot: %v", err)
+		return counts
+	}
+	for _, nodeInfo := range nodeInfos {
+		if nodeInfo.Node() == nil {
+			continue
+		}
+		zone := nodeZone(nodeInfo.Node())
+		for _, podInfo := range nodeInfo.Pods {
+			if podInfo.Pod.Namespace == namespace && selector.Matches(labels.Set(podInfo.Pod.Labels)) {
+				counts[zone]++
+			}
+		}
+	}
+	return counts
+}
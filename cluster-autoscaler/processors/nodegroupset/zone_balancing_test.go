@@ -0,0 +1,208 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodegroupset
+
+import (
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	testprovider "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/test"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/simulator"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildZonalNodeInfo(name, zone string) *schedulerframework.NodeInfo {
+	node := BuildTestNode(name, 1000, 1000)
+	node.Labels[apiv1.LabelTopologyZone] = zone
+	nodeInfo := schedulerframework.NewNodeInfo()
+	nodeInfo.SetNode(node)
+	return nodeInfo
+}
+
+func buildPods(prefix string, count int) []*apiv1.Pod {
+	pods := make([]*apiv1.Pod, 0, count)
+	for i := 0; i < count; i++ {
+		pods = append(pods, BuildTestPod(prefix+string(rune('a'+i)), 100, 100))
+	}
+	return pods
+}
+
+func withZoneSpread(pods []*apiv1.Pod) []*apiv1.Pod {
+	for _, pod := range pods {
+		pod.Labels = map[string]string{"app": "spread"}
+		pod.Spec.TopologySpreadConstraints = []apiv1.TopologySpreadConstraint{{
+			MaxSkew:           1,
+			TopologyKey:       apiv1.LabelTopologyZone,
+			WhenUnsatisfiable: apiv1.DoNotSchedule,
+			LabelSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "spread"}},
+		}}
+	}
+	return pods
+}
+
+func TestBalanceScaleUpBetweenZones(t *testing.T) {
+	processor := &BalancingNodeGroupSetProcessor{Comparator: CreateGenericNodeInfoComparator([]string{})}
+	nodeInfos := map[string]*schedulerframework.NodeInfo{
+		"ng-a": buildZonalNodeInfo("ng-a-template", "zone-a"),
+		"ng-b": buildZonalNodeInfo("ng-b-template", "zone-b"),
+		"ng-c": buildZonalNodeInfo("ng-c-template", "zone-c"),
+		"ng-d": buildZonalNodeInfo("ng-d-template", "zone-a"),
+	}
+
+	flexiblePods := buildPods("flexible-", 6)
+	pinnedPods := buildPods("pinned-", 4)
+	spreadPods := withZoneSpread(buildPods("spread-", 4))
+
+	existingSpreadPods := withZoneSpread(buildPods("existing-", 4))
+	snapshot := simulator.NewBasicClusterSnapshot()
+	existingA := BuildTestNode("existing-a", 1000, 1000)
+	existingA.Labels[apiv1.LabelTopologyZone] = "zone-a"
+	existingB := BuildTestNode("existing-b", 1000, 1000)
+	existingB.Labels[apiv1.LabelTopologyZone] = "zone-b"
+	assert.NoError(t, snapshot.AddNodeWithPods(existingA, existingSpreadPods[:3]))
+	assert.NoError(t, snapshot.AddNodeWithPods(existingB, existingSpreadPods[3:]))
+
+	for _, tc := range []struct {
+		name         string
+		groups       []string
+		maxed        []string
+		maxSizes     map[string]int
+		podsPerGroup map[string][]*apiv1.Pod
+		newNodes     int
+		expected     map[string]int
+	}{
+		{
+			name:   "flexible pods are split evenly",
+			groups: []string{"ng-a", "ng-b", "ng-c"},
+			podsPerGroup: map[string][]*apiv1.Pod{
+				"ng-a": flexiblePods,
+				"ng-b": flexiblePods,
+				"ng-c": flexiblePods,
+			},
+			newNodes: 6,
+			expected: map[string]int{"ng-a": 2, "ng-b": 2, "ng-c": 2},
+		},
+		{
+			name:   "pinned pods weight their zone",
+			groups: []string{"ng-a", "ng-b"},
+			podsPerGroup: map[string][]*apiv1.Pod{
+				"ng-a": append(append([]*apiv1.Pod{}, pinnedPods...), flexiblePods[:2]...),
+				"ng-b": flexiblePods[:2],
+			},
+			newNodes: 6,
+			expected: map[string]int{"ng-a": 5, "ng-b": 1},
+		},
+		{
+			name:   "groups in the same zone share its nodes",
+			groups: []string{"ng-a", "ng-d", "ng-b"},
+			podsPerGroup: map[string][]*apiv1.Pod{
+				"ng-a": append(append([]*apiv1.Pod{}, pinnedPods...), flexiblePods[:2]...),
+				"ng-d": append(append([]*apiv1.Pod{}, pinnedPods...), flexiblePods[:2]...),
+				"ng-b": flexiblePods[:2],
+			},
+			newNodes: 6,
+			expected: map[string]int{"ng-a": 3, "ng-d": 2, "ng-b": 1},
+		},
+		{
+			name:   "topology spread fills the least populated zones first",
+			groups: []string{"ng-a", "ng-b", "ng-c"},
+			podsPerGroup: map[string][]*apiv1.Pod{
+				"ng-a": spreadPods,
+				"ng-b": spreadPods,
+				"ng-c": spreadPods,
+			},
+			newNodes: 4,
+			expected: map[string]int{"ng-b": 2, "ng-c": 2},
+		},
+		{
+			name:   "zone without capacity doesn't absorb its share",
+			groups: []string{"ng-a", "ng-b", "ng-c"},
+			maxed:  []string{"ng-c"},
+			podsPerGroup: map[string][]*apiv1.Pod{
+				"ng-a": flexiblePods[:4],
+				"ng-b": flexiblePods[:4],
+				"ng-c": append(append([]*apiv1.Pod{}, pinnedPods...), flexiblePods[:4]...),
+			},
+			newNodes: 4,
+			expected: map[string]int{"ng-a": 2, "ng-b": 2},
+		},
+		{
+			name:     "nodes which don't fit in a capped zone go to other zones",
+			groups:   []string{"ng-a", "ng-b", "ng-c"},
+			maxSizes: map[string]int{"ng-a": 3},
+			podsPerGroup: map[string][]*apiv1.Pod{
+				"ng-a": pinnedPods,
+				"ng-b": flexiblePods[:4],
+				"ng-c": flexiblePods[:4],
+			},
+			newNodes: 8,
+			expected: map[string]int{"ng-a": 2, "ng-b": 3, "ng-c": 3},
+		},
+		{
+			name:         "single zone falls back to balancing by count",
+			groups:       []string{"ng-a", "ng-d"},
+			podsPerGroup: map[string][]*apiv1.Pod{"ng-a": pinnedPods, "ng-d": pinnedPods},
+			newNodes:     4,
+			expected:     map[string]int{"ng-a": 2, "ng-d": 2},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := testprovider.NewTestCloudProvider(nil, nil)
+			for _, id := range tc.groups {
+				provider.AddNodeGroup(id, 0, 10, 1)
+			}
+			for _, id := range tc.maxed {
+				// replaces the group added above with a maxed out one
+				provider.AddNodeGroup(id, 0, 1, 1)
+			}
+			for id, maxSize := range tc.maxSizes {
+				provider.AddNodeGroup(id, 0, maxSize, 1)
+			}
+			context := &context.AutoscalingContext{CloudProvider: provider, ClusterSnapshot: snapshot}
+			groups := make([]cloudprovider.NodeGroup, 0)
+			for _, id := range tc.groups {
+				groups = append(groups, provider.GetNodeGroup(id))
+			}
+
+			scaleUpInfos, err := processor.BalanceScaleUpBetweenZones(context, groups, nodeInfos, tc.podsPerGroup, tc.newNodes)
+			assert.NoError(t, err)
+			result := make(map[string]int)
+			for _, info := range scaleUpInfos {
+				result[info.Group.Id()] = info.NewSize - info.CurrentSize
+			}
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestSplitByWeights(t *testing.T) {
+	unlimited := map[string]int{"a": 100, "b": 100, "c": 100}
+	assert.Equal(t, map[string]int{"a": 1, "b": 1, "c": 1}, splitByWeights(map[string]float64{"a": 1, "b": 1, "c": 1}, unlimited, 3))
+	assert.Equal(t, map[string]int{"a": 2, "b": 1, "c": 1}, splitByWeights(map[string]float64{"a": 1, "b": 1, "c": 1}, unlimited, 4))
+	assert.Equal(t, map[string]int{"a": 7, "b": 3}, splitByWeights(map[string]float64{"a": 2, "b": 1}, unlimited, 10))
+	assert.Equal(t, map[string]int{"a": 0, "b": 1}, splitByWeights(map[string]float64{"a": 0.25, "b": 1}, unlimited, 1))
+	// zone a is capped, the rest is split between b and c by their weights
+	assert.Equal(t, map[string]int{"a": 2, "b": 6, "c": 2}, splitByWeights(map[string]float64{"a": 4, "b": 3, "c": 1}, map[string]int{"a": 2, "b": 100, "c": 100}, 10))
+	// all zones are capped
+	assert.Equal(t, map[string]int{"a": 2, "b": 3}, splitByWeights(map[string]float64{"a": 1, "b": 1}, map[string]int{"a": 2, "b": 3}, 10))
+}
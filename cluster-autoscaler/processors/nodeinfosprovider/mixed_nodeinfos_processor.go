@@ -18,6 +18,7 @@ package nodeinfosprovider
 
 import (
 	"reflect"
+	"sort"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
@@ -40,6 +41,14 @@ const maxCacheExpireTime = 87660 * time.Hour
 type cacheItem struct {
 	*schedulerframework.NodeInfo
 	added time.Time
+	// nodeName is the node the item was built from, if any.
+	nodeName string
+	// hash is the nodeInfoHash of the item, used to tell whether a node
+	// info built from another node is any different.
+	hash string
+	// templateHash is the nodeInfoHash of the node group template at the
+	// time the item was added, or empty if the template isn't known.
+	templateHash string
 }
 
 // MixedTemplateNodeInfoProvider build nodeInfos from the cluster's nodes and node groups.
@@ -69,6 +78,78 @@ func (p *MixedTemplateNodeInfoProvider) isCacheItemExpired(added time.Time) bool
 func (p *MixedTemplateNodeInfoProvider) CleanUp() {
 }
 
+// Invalidate drops the node info cached for the given node group, so that a
+// new one is built from its nodes or template.
+func (p *MixedTemplateNodeInfoProvider) Invalidate(nodeGroupId string) {
+	if _, found := p.nodeInfoCache[nodeGroupId]; found {
+		klog.V(1).Infof("Dropping cached node info of %s", nodeGroupId)
+		delete(p.nodeInfoCache, nodeGroupId)
+	}
+}
+
+// updateCache caches the node info built from the given node of a node group.
+// An item built from another node which is still a good template candidate is
+// kept, so that the cache doesn't change with the order of nodes, unless the
+// given node is newer. Nodes created after a change of the machine type or
+// image of the node group replace items built from older nodes this way.
+func (p *MixedTemplateNodeInfoProvider) updateCache(nodeGroup cloudprovider.NodeGroup, node *apiv1.Node, nodeInfo *schedulerframework.NodeInfo, goodNodes map[string]*apiv1.Node) {
+	id := nodeGroup.Id()
+	nodeName := node.Name
+	item, found := p.nodeInfoCache[id]
+	if found && item.nodeName != nodeName {
+		if itemNode := goodNodes[item.nodeName]; itemNode != nil && !itemNode.CreationTimestamp.Before(&node.CreationTimestamp) {
+			item.added = time.Now()
+			p.nodeInfoCache[id] = item
+			return
+		}
+	}
+	hash := nodeInfoHash(nodeInfo)
+	if found && item.hash == hash {
+		item.added = time.Now()
+		item.nodeName = nodeName
+		p.nodeInfoCache[id] = item
+		return
+	}
+	nodeInfoCopy, err := utils.DeepCopyNodeInfo(nodeInfo)
+	if err != nil {
+		return
+	}
+	templateHash := item.templateHash
+	if templateHash == "" {
+		templateHash = p.templateHash(nodeGroup)
+	}
+	p.nodeInfoCache[id] = cacheItem{
+		NodeInfo:     nodeInfoCopy,
+		added:        time.Now(),
+		nodeName:     nodeName,
+		hash:         hash,
+		templateHash: templateHash,
+	}
+}
+
+// templateChanged returns true if the template of the node group changed
+// since the cache item was added.
+func (p *MixedTemplateNodeInfoProvider) templateChanged(nodeGroup cloudprovider.NodeGroup, item cacheItem) bool {
+	if item.templateHash == "" {
+		return false
+	}
+	templateHash := p.templateHash(nodeGroup)
+	return templateHash != "" && templateHash != item.templateHash
+}
+
+// templateHash returns the nodeInfoHash of the node group template, or an
+// empty string if it isn't available.
+func (p *MixedTemplateNodeInfoProvider) templateHash(nodeGroup cloudprovider.NodeGroup) string {
+	template, err := nodeGroup.TemplateNodeInfo()
+	if err != nil {
+		if err != cloudprovider.ErrNotImplemented {
+			klog.V(4).Infof("Unable to get template of %s to detect changes: %v", nodeGroup.Id(), err)
+		}
+		return ""
+	}
+	return nodeInfoHash(template)
+}
+
 // Process returns the nodeInfos set for this cluster
 func (p *MixedTemplateNodeInfoProvider) Process(ctx *context.AutoscalingContext, nodes []*apiv1.Node, daemonsets []*appsv1.DaemonSet, ignoredTaints taints.TaintKeySet, now time.Time) (map[string]*schedulerframework.NodeInfo, errors.AutoscalerError) {
 	// TODO(mwielgus): This returns map keyed by url, while most code (including scheduler) uses node.Name for a key.
@@ -81,45 +162,59 @@ func (p *MixedTemplateNodeInfoProvider) Process(ctx *context.AutoscalingContext,
 		return map[string]*schedulerframework.NodeInfo{}, err
 	}
 
-	// processNode returns information whether the nodeTemplate was generated and if there was an error.
-	processNode := func(node *apiv1.Node) (bool, string, errors.AutoscalerError) {
+	if reporter, ok := ctx.CloudProvider.(cloudprovider.TemplateChangeReporter); ok {
+		for _, id := range reporter.ChangedTemplates() {
+			p.Invalidate(id)
+		}
+	}
+	goodNodes := make(map[string]*apiv1.Node)
+	var goodCandidates []*apiv1.Node
+	for _, node := range nodes {
+		if isNodeGoodTemplateCandidate(node, now) {
+			goodNodes[node.Name] = node
+			goodCandidates = append(goodCandidates, node)
+		}
+	}
+	// The newest nodes are the best examples of nodes the node groups
+	// currently create.
+	sort.SliceStable(goodCandidates, func(i, j int) bool {
+		return goodCandidates[j].CreationTimestamp.Before(&goodCandidates[i].CreationTimestamp)
+	})
+
+	// processNode returns the node group if the nodeTemplate was generated and if there was an error.
+	processNode := func(node *apiv1.Node) (cloudprovider.NodeGroup, errors.AutoscalerError) {
 		nodeGroup, err := ctx.CloudProvider.NodeGroupForNode(node)
 		if err != nil {
-			return false, "", errors.ToAutoscalerError(errors.CloudProviderError, err)
+			return nil, errors.ToAutoscalerError(errors.CloudProviderError, err)
 		}
 		if nodeGroup == nil || reflect.ValueOf(nodeGroup).IsNil() {
-			return false, "", nil
+			return nil, nil
 		}
 		id := nodeGroup.Id()
 		if _, found := result[id]; !found {
 			// Build nodeInfo.
 			nodeInfo, err := simulator.BuildNodeInfoForNode(node, podsForNodes)
 			if err != nil {
-				return false, "", err
+				return nil, err
 			}
 			sanitizedNodeInfo, err := utils.SanitizeNodeInfo(nodeInfo, id, ignoredTaints)
 			if err != nil {
-				return false, "", err
+				return nil, err
 			}
 			result[id] = sanitizedNodeInfo
-			return true, id, nil
+			return nodeGroup, nil
 		}
-		return false, "", nil
+		return nil, nil
 	}
 
-	for _, node := range nodes {
-		// Broken nodes might have some stuff missing. Skipping.
-		if !isNodeGoodTemplateCandidate(node, now) {
-			continue
-		}
-		added, id, typedErr := processNode(node)
+	// Broken nodes might have some stuff missing, so only good candidates are used.
+	for _, node := range goodCandidates {
+		nodeGroup, typedErr := processNode(node)
 		if typedErr != nil {
 			return map[string]*schedulerframework.NodeInfo{}, typedErr
 		}
-		if added && p.nodeInfoCache != nil {
-			if nodeInfoCopy, err := utils.DeepCopyNodeInfo(result[id]); err == nil {
-				p.nodeInfoCache[id] = cacheItem{NodeInfo: nodeInfoCopy, added: time.Now()}
-			}
+		if nodeGroup != nil && p.nodeInfoCache != nil {
+			p.updateCache(nodeGroup, node, result[nodeGroup.Id()], goodNodes)
 		}
 	}
 	for _, nodeGroup := range ctx.CloudProvider.NodeGroups() {
@@ -134,6 +229,9 @@ func (p *MixedTemplateNodeInfoProvider) Process(ctx *context.AutoscalingContext,
 			if cacheItem, found := p.nodeInfoCache[id]; found {
 				if p.isCacheItemExpired(cacheItem.added) {
 					delete(p.nodeInfoCache, id)
+				} else if p.templateChanged(nodeGroup, cacheItem) {
+					klog.V(1).Infof("Template of %s changed, dropping cached node info", id)
+					delete(p.nodeInfoCache, id)
 				} else if nodeInfoCopy, err := utils.DeepCopyNodeInfo(cacheItem.NodeInfo); err == nil {
 					result[id] = nodeInfoCopy
 					continue
@@ -168,16 +266,11 @@ func (p *MixedTemplateNodeInfoProvider) Process(ctx *context.AutoscalingContext,
 		if isNodeGoodTemplateCandidate(node, now) {
 			continue
 		}
-		added, _, typedErr := processNode(node)
+		nodeGroup, typedErr := processNode(node)
 		if typedErr != nil {
 			return map[string]*schedulerframework.NodeInfo{}, typedErr
 		}
-		nodeGroup, err := ctx.CloudProvider.NodeGroupForNode(node)
-		if err != nil {
-			return map[string]*schedulerframework.NodeInfo{}, errors.ToAutoscalerError(
-				errors.CloudProviderError, err)
-		}
-		if added {
+		if nodeGroup != nil {
 			klog.Warningf("Built template for %s based on unready/unschedulable node %s", nodeGroup.Id(), node.Name)
 		}
 	}
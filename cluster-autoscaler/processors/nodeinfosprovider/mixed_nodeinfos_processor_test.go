@@ -17,6 +17,7 @@ limitations under the License.
 package nodeinfosprovider
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -29,6 +30,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
 )
 
@@ -289,6 +291,206 @@ func TestGetNodeInfosCacheExpired(t *testing.T) {
 
 }
 
+type templateChangeReportingProvider struct {
+	*testprovider.TestCloudProvider
+	changed []string
+}
+
+func (p *templateChangeReportingProvider) ChangedTemplates() []string {
+	changed := p.changed
+	p.changed = nil
+	return changed
+}
+
+func TestGetNodeInfosCacheInvalidation(t *testing.T) {
+	now := time.Now()
+	ready1 := BuildTestNode("n1", 1000, 1000)
+	SetNodeReadyState(ready1, true, now.Add(-2*time.Minute))
+	ready2 := BuildTestNode("n2", 2000, 2000)
+	SetNodeReadyState(ready2, true, now.Add(-2*time.Minute))
+	tni := schedulerframework.NewNodeInfo()
+	tni.SetNode(BuildTestNode("tn", 5000, 5000))
+	changedTni := schedulerframework.NewNodeInfo()
+	changedTni.SetNode(BuildTestNode("tn", 8000, 8000))
+
+	templates := map[string]*schedulerframework.NodeInfo{"ng1": tni, "ng2": tni}
+	provider := &templateChangeReportingProvider{
+		TestCloudProvider: testprovider.NewTestAutoprovisioningCloudProvider(nil, nil, nil, nil, nil, templates),
+	}
+	provider.AddNodeGroup("ng1", 0, 10, 1)
+	provider.AddNode("ng1", ready1)
+	provider.AddNodeGroup("ng2", 0, 10, 1)
+	provider.AddNode("ng2", ready2)
+	podLister := kube_util.NewTestPodLister([]*apiv1.Pod{})
+	registry := kube_util.NewListerRegistry(nil, nil, podLister, nil, nil, nil, nil, nil, nil, nil)
+	predicateChecker, err := simulator.NewTestPredicateChecker()
+	assert.NoError(t, err)
+	ctx := context.AutoscalingContext{
+		CloudProvider:    provider,
+		PredicateChecker: predicateChecker,
+		AutoscalingKubeClients: context.AutoscalingKubeClients{
+			ListerRegistry: registry,
+		},
+	}
+
+	niProcessor := NewMixedTemplateNodeInfoProvider(nil)
+	_, err = niProcessor.Process(&ctx, []*apiv1.Node{ready1, ready2}, []*appsv1.DaemonSet{}, nil, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(niProcessor.nodeInfoCache))
+
+	// Without nodes, cached node infos are used.
+	res, err := niProcessor.Process(&ctx, []*apiv1.Node{}, []*appsv1.DaemonSet{}, nil, now)
+	assert.NoError(t, err)
+	assertEqualNodeCapacities(t, ready1, res["ng1"].Node())
+	assertEqualNodeCapacities(t, ready2, res["ng2"].Node())
+
+	// Changed template is detected.
+	templates["ng1"] = changedTni
+	// Change reported by the cloud provider.
+	provider.changed = []string{"ng2"}
+	res, err = niProcessor.Process(&ctx, []*apiv1.Node{}, []*appsv1.DaemonSet{}, nil, now)
+	assert.NoError(t, err)
+	assertEqualNodeCapacities(t, changedTni.Node(), res["ng1"].Node())
+	assertEqualNodeCapacities(t, tni.Node(), res["ng2"].Node())
+	assert.Equal(t, 0, len(niProcessor.nodeInfoCache))
+}
+
+func TestGetNodeInfosCacheCheckpoint(t *testing.T) {
+	now := time.Now()
+	ready1 := BuildTestNode("n1", 1000, 1000)
+	SetNodeReadyState(ready1, true, now.Add(-2*time.Minute))
+	ready2 := BuildTestNode("n2", 2000, 2000)
+	SetNodeReadyState(ready2, true, now.Add(-2*time.Minute))
+	tni := schedulerframework.NewNodeInfo()
+	tni.SetNode(BuildTestNode("tn", 5000, 5000))
+	templates := map[string]*schedulerframework.NodeInfo{"ng1": tni}
+
+	provider := testprovider.NewTestAutoprovisioningCloudProvider(nil, nil, nil, nil, nil, templates)
+	provider.AddNodeGroup("ng1", 0, 10, 2)
+	provider.AddNode("ng1", ready1)
+	provider.AddNode("ng1", ready2)
+	podLister := kube_util.NewTestPodLister([]*apiv1.Pod{})
+	registry := kube_util.NewListerRegistry(nil, nil, podLister, nil, nil, nil, nil, nil, nil, nil)
+	predicateChecker, err := simulator.NewTestPredicateChecker()
+	assert.NoError(t, err)
+	ctx := context.AutoscalingContext{
+		CloudProvider:    provider,
+		PredicateChecker: predicateChecker,
+		AutoscalingKubeClients: context.AutoscalingKubeClients{
+			ListerRegistry: registry,
+		},
+	}
+
+	niProcessor := NewMixedTemplateNodeInfoProvider(nil)
+	_, err = niProcessor.Process(&ctx, []*apiv1.Node{ready1, ready2}, []*appsv1.DaemonSet{}, nil, now)
+	assert.NoError(t, err)
+	state, err := niProcessor.CheckpointState()
+	assert.NoError(t, err)
+
+	// State doesn't change with the order of nodes, or the random names of template nodes.
+	_, err = niProcessor.Process(&ctx, []*apiv1.Node{ready2, ready1}, []*appsv1.DaemonSet{}, nil, now)
+	assert.NoError(t, err)
+	newState, err := niProcessor.CheckpointState()
+	assert.NoError(t, err)
+	assert.Equal(t, string(state), string(newState))
+
+	// Cache is restored after a restart, so the node group has a template without nodes.
+	restored := NewMixedTemplateNodeInfoProvider(nil)
+	assert.NoError(t, restored.RestoreState(state))
+	res, err := restored.Process(&ctx, []*apiv1.Node{}, []*appsv1.DaemonSet{}, nil, now)
+	assert.NoError(t, err)
+	assertEqualNodeCapacities(t, ready1, res["ng1"].Node())
+
+	// Template changes while not running are detected.
+	restored = NewMixedTemplateNodeInfoProvider(nil)
+	assert.NoError(t, restored.RestoreState(state))
+	changedTni := schedulerframework.NewNodeInfo()
+	changedTni.SetNode(BuildTestNode("tn", 8000, 8000))
+	templates["ng1"] = changedTni
+	res, err = restored.Process(&ctx, []*apiv1.Node{}, []*appsv1.DaemonSet{}, nil, now)
+	assert.NoError(t, err)
+	assertEqualNodeCapacities(t, changedTni.Node(), res["ng1"].Node())
+}
+
+func TestGetNodeInfosCacheNewerNode(t *testing.T) {
+	now := time.Now()
+	oldNode := BuildTestNode("n1", 1000, 1000)
+	oldNode.CreationTimestamp = metav1.NewTime(now.Add(-time.Hour))
+	SetNodeReadyState(oldNode, true, now.Add(-time.Hour))
+	// A node created after the machine type of the node group changed.
+	newNode := BuildTestNode("n2", 2000, 2000)
+	newNode.CreationTimestamp = metav1.NewTime(now.Add(-10 * time.Minute))
+	SetNodeReadyState(newNode, true, now.Add(-10*time.Minute))
+
+	provider := testprovider.NewTestAutoprovisioningCloudProvider(nil, nil, nil, nil, nil, nil)
+	provider.AddNodeGroup("ng1", 0, 10, 2)
+	provider.AddNode("ng1", oldNode)
+	provider.AddNode("ng1", newNode)
+	podLister := kube_util.NewTestPodLister([]*apiv1.Pod{})
+	registry := kube_util.NewListerRegistry(nil, nil, podLister, nil, nil, nil, nil, nil, nil, nil)
+	predicateChecker, err := simulator.NewTestPredicateChecker()
+	assert.NoError(t, err)
+	ctx := context.AutoscalingContext{
+		CloudProvider:    provider,
+		PredicateChecker: predicateChecker,
+		AutoscalingKubeClients: context.AutoscalingKubeClients{
+			ListerRegistry: registry,
+		},
+	}
+
+	niProcessor := NewMixedTemplateNodeInfoProvider(nil)
+	_, err = niProcessor.Process(&ctx, []*apiv1.Node{oldNode}, []*appsv1.DaemonSet{}, nil, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "n1", niProcessor.nodeInfoCache["ng1"].nodeName)
+
+	// The item built from the old node is replaced, although the old node is still there.
+	res, err := niProcessor.Process(&ctx, []*apiv1.Node{oldNode, newNode}, []*appsv1.DaemonSet{}, nil, now)
+	assert.NoError(t, err)
+	assertEqualNodeCapacities(t, newNode, res["ng1"].Node())
+	assert.Equal(t, "n2", niProcessor.nodeInfoCache["ng1"].nodeName)
+	assertEqualNodeCapacities(t, newNode, niProcessor.nodeInfoCache["ng1"].Node())
+}
+
+func TestNodeInfoCacheCheckpointSize(t *testing.T) {
+	defer func(size int) { maxCheckpointStateSize = size }(maxCheckpointStateSize)
+
+	node := BuildTestNode("n1", 1000, 1000)
+	node.Annotations = map[string]string{"large": strings.Repeat("x", 4096)}
+	node.Status.Images = []apiv1.ContainerImage{{Names: []string{strings.Repeat("image", 1000)}}}
+	pod := BuildTestPod("p1", 100, 100)
+	pod.Annotations = map[string]string{"large": strings.Repeat("x", 4096)}
+	pod.Spec.NodeName = "n1"
+	nodeInfo := schedulerframework.NewNodeInfo(pod)
+	nodeInfo.SetNode(node)
+
+	niProcessor := NewMixedTemplateNodeInfoProvider(nil)
+	niProcessor.nodeInfoCache = map[string]cacheItem{
+		"ng1": {NodeInfo: nodeInfo},
+		"ng2": {NodeInfo: nodeInfo},
+	}
+	state, err := niProcessor.CheckpointState()
+	assert.NoError(t, err)
+	// Annotations and images aren't needed to schedule pods.
+	assert.NotContains(t, string(state), "xxxx")
+	assert.NotContains(t, string(state), "imageimage")
+
+	restored := NewMixedTemplateNodeInfoProvider(nil)
+	assert.NoError(t, restored.RestoreState(state))
+	assert.Equal(t, 2, len(restored.nodeInfoCache))
+	assert.Equal(t, 1, len(restored.nodeInfoCache["ng1"].Pods))
+	assertEqualNodeCapacities(t, node, restored.nodeInfoCache["ng1"].Node())
+	assert.Equal(t, nodeInfoHash(nodeInfo), restored.nodeInfoCache["ng1"].hash)
+
+	// Items over the size limit are left out.
+	maxCheckpointStateSize = len(state) - 1
+	state, err = niProcessor.CheckpointState()
+	assert.NoError(t, err)
+	restored = NewMixedTemplateNodeInfoProvider(nil)
+	assert.NoError(t, restored.RestoreState(state))
+	assert.Equal(t, 1, len(restored.nodeInfoCache))
+	assert.Contains(t, restored.nodeInfoCache, "ng1")
+}
+
 func assertEqualNodeCapacities(t *testing.T, expected, actual *apiv1.Node) {
 	t.Helper()
 	assert.NotEqual(t, actual.Status, nil, "")
@@ -0,0 +1,232 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodeinfosprovider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+
+	klog "k8s.io/klog/v2"
+)
+
+// nodeInfoFingerprint holds the parts of a node info which matter for
+// scheduling, leaving out ones which differ between nodes of a node group.
+type nodeInfoFingerprint struct {
+	Labels      map[string]string  `json:"labels,omitempty"`
+	Taints      []apiv1.Taint      `json:"taints,omitempty"`
+	Capacity    apiv1.ResourceList `json:"capacity,omitempty"`
+	Allocatable apiv1.ResourceList `json:"allocatable,omitempty"`
+	Pods        []string           `json:"pods,omitempty"`
+}
+
+type podFingerprint struct {
+	Namespace string                       `json:"namespace"`
+	Owners    []string                     `json:"owners,omitempty"`
+	Labels    map[string]string            `json:"labels,omitempty"`
+	Resources []apiv1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// nodeInfoHash returns a hash of the node labels, taints and resources and of
+// the pods running on the node, identifying node infos built from equivalent
+// nodes or templates.
+func nodeInfoHash(nodeInfo *schedulerframework.NodeInfo) string {
+	node := nodeInfo.Node()
+	if node == nil {
+		return ""
+	}
+	fingerprint := nodeInfoFingerprint{
+		Labels:      make(map[string]string, len(node.Labels)),
+		Capacity:    node.Status.Capacity,
+		Allocatable: node.Status.Allocatable,
+	}
+	for k, v := range node.Labels {
+		if k != apiv1.LabelHostname {
+			fingerprint.Labels[k] = v
+		}
+	}
+	for _, taint := range node.Spec.Taints {
+		taint.TimeAdded = nil
+		fingerprint.Taints = append(fingerprint.Taints, taint)
+	}
+	for _, podInfo := range nodeInfo.Pods {
+		pod := podInfo.Pod
+		podFingerprint := podFingerprint{Namespace: pod.Namespace, Labels: pod.Labels}
+		for _, owner := range pod.OwnerReferences {
+			podFingerprint.Owners = append(podFingerprint.Owners, owner.Kind+"/"+owner.Name)
+		}
+		for _, container := range pod.Spec.Containers {
+			podFingerprint.Resources = append(podFingerprint.Resources, container.Resources)
+		}
+		data, err := json.Marshal(podFingerprint)
+		if err != nil {
+			return ""
+		}
+		fingerprint.Pods = append(fingerprint.Pods, string(data))
+	}
+	// Pods are listed in no particular order.
+	sort.Strings(fingerprint.Pods)
+
+	data, err := json.Marshal(fingerprint)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// maxCheckpointStateSize limits the size of the checkpointed state, to keep
+// it below the 1 MiB limit of objects stored by the API server.
+var maxCheckpointStateSize = 768 * 1024
+
+// cachedNodeInfoState is the checkpointed state of a cached node info. Only
+// parts of nodes and pods which matter for scheduling are kept.
+type cachedNodeInfoState struct {
+	Node         *apiv1.Node  `json:"node"`
+	Pods         []*apiv1.Pod `json:"pods,omitempty"`
+	TemplateHash string       `json:"templateHash,omitempty"`
+}
+
+// CheckpointState returns the cached node infos, so that node groups without
+// nodes have a template right after a restart. Items are only replaced when
+// they change, so the state stays the same while node groups do. Items which
+// don't fit in maxCheckpointStateSize are left out, in the order of node
+// group ids.
+func (p *MixedTemplateNodeInfoProvider) CheckpointState() ([]byte, error) {
+	if len(p.nodeInfoCache) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, 0, len(p.nodeInfoCache))
+	for id := range p.nodeInfoCache {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	state := make(map[string]json.RawMessage, len(ids))
+	// Braces around the items.
+	size := 2
+	var skipped []string
+	for _, id := range ids {
+		item := p.nodeInfoCache[id]
+		itemState := cachedNodeInfoState{Node: checkpointedNode(item.Node()), TemplateHash: item.templateHash}
+		for _, podInfo := range item.Pods {
+			itemState.Pods = append(itemState.Pods, checkpointedPod(podInfo.Pod))
+		}
+		data, err := json.Marshal(itemState)
+		if err != nil {
+			return nil, err
+		}
+		// Each item adds its quoted id, a colon and a comma.
+		if size+len(data)+len(id)+4 > maxCheckpointStateSize {
+			skipped = append(skipped, id)
+			continue
+		}
+		size += len(data) + len(id) + 4
+		state[id] = data
+	}
+	if len(skipped) > 0 {
+		klog.Warningf("Cached node infos of %d node groups exceed the checkpoint size limit and aren't persisted: %s", len(skipped), strings.Join(skipped, ", "))
+	}
+	return json.Marshal(state)
+}
+
+// checkpointedNode returns a copy of the node with the fields used to
+// schedule pods.
+func checkpointedNode(node *apiv1.Node) *apiv1.Node {
+	return &apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   node.Name,
+			Labels: node.Labels,
+		},
+		Spec: apiv1.NodeSpec{
+			Taints:        node.Spec.Taints,
+			Unschedulable: node.Spec.Unschedulable,
+		},
+		Status: apiv1.NodeStatus{
+			Capacity:    node.Status.Capacity,
+			Allocatable: node.Status.Allocatable,
+			Conditions:  node.Status.Conditions,
+		},
+	}
+}
+
+// checkpointedPod returns a copy of the pod with the fields used to schedule
+// it and other pods next to it.
+func checkpointedPod(pod *apiv1.Pod) *apiv1.Pod {
+	return &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            pod.Name,
+			Namespace:       pod.Namespace,
+			UID:             pod.UID,
+			Labels:          pod.Labels,
+			OwnerReferences: pod.OwnerReferences,
+		},
+		Spec: apiv1.PodSpec{
+			NodeName:       pod.Spec.NodeName,
+			Containers:     checkpointedContainers(pod.Spec.Containers),
+			InitContainers: checkpointedContainers(pod.Spec.InitContainers),
+			Overhead:       pod.Spec.Overhead,
+			Priority:       pod.Spec.Priority,
+			NodeSelector:   pod.Spec.NodeSelector,
+			Affinity:       pod.Spec.Affinity,
+			Tolerations:    pod.Spec.Tolerations,
+		},
+	}
+}
+
+func checkpointedContainers(containers []apiv1.Container) []apiv1.Container {
+	var result []apiv1.Container
+	for _, container := range containers {
+		result = append(result, apiv1.Container{
+			Name:      container.Name,
+			Resources: container.Resources,
+			Ports:     container.Ports,
+		})
+	}
+	return result
+}
+
+// RestoreState restores cached node infos from a checkpoint. Restored items
+// expire after the cache TTL counted from the restore. Items cached since the
+// start take precedence.
+func (p *MixedTemplateNodeInfoProvider) RestoreState(data []byte) error {
+	state := make(map[string]cachedNodeInfoState)
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	for id, itemState := range state {
+		if _, found := p.nodeInfoCache[id]; found || itemState.Node == nil {
+			continue
+		}
+		nodeInfo := schedulerframework.NewNodeInfo(itemState.Pods...)
+		nodeInfo.SetNode(itemState.Node)
+		p.nodeInfoCache[id] = cacheItem{
+			NodeInfo:     nodeInfo,
+			added:        time.Now(),
+			hash:         nodeInfoHash(nodeInfo),
+			templateHash: itemState.TemplateHash,
+		}
+		klog.V(4).Infof("Restored cached node info of %s", id)
+	}
+	return nil
+}
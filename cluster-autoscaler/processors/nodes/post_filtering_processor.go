@@ -17,21 +17,115 @@ limitations under the License.
 package nodes
 
 import (
+	"reflect"
+	"sort"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
 	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/nodegroupconfig"
 	"k8s.io/autoscaler/cluster-autoscaler/simulator"
+
+	klog "k8s.io/klog/v2"
 )
 
-// PostFilteringScaleDownNodeProcessor selects first maxCount nodes (if possible) to be removed
+// PostFilteringScaleDownNodeProcessor orders candidates according to scale down
+// selection policies and selects first maxCount nodes (if possible) to be removed
 type PostFilteringScaleDownNodeProcessor struct {
+	nodeGroupConfigProcessor nodegroupconfig.NodeGroupConfigProcessor
 }
 
-// GetNodesToRemove selects up to maxCount nodes for deletion, by selecting a first maxCount candidates
+// GetNodesToRemove selects up to maxCount nodes for deletion, by selecting a first maxCount candidates.
+//
+// Candidates from each node group are ordered according to the selection
+// policies configured for that node group. The groups are then merged into a
+// single list, picking the next candidate according to the default policies.
+// Candidates which no policy tells apart keep their original order.
 func (n *PostFilteringScaleDownNodeProcessor) GetNodesToRemove(ctx *context.AutoscalingContext, candidates []simulator.NodeToBeRemoved, maxCount int) []simulator.NodeToBeRemoved {
-	end := len(candidates)
-	if len(candidates) > maxCount {
+	ordered := candidates
+	if n.nodeGroupConfigProcessor != nil && len(candidates) > 1 {
+		ordered = n.orderCandidates(ctx, candidates, time.Now())
+	}
+	end := len(ordered)
+	if len(ordered) > maxCount {
 		end = maxCount
 	}
-	return candidates[:end]
+	return ordered[:end]
+}
+
+func (n *PostFilteringScaleDownNodeProcessor) orderCandidates(ctx *context.AutoscalingContext, candidates []simulator.NodeToBeRemoved, now time.Time) []simulator.NodeToBeRemoved {
+	nodeGroups := make([]cloudprovider.NodeGroup, len(candidates))
+	groupIds := make([]string, 0)
+	groupCandidates := make(map[string][]int)
+	groupPolicies := make(map[string][]string)
+	configured := len(ctx.NodeGroupDefaults.ScaleDownSelectionPolicies) > 0
+	for i, candidate := range candidates {
+		id := ""
+		nodeGroup, err := ctx.CloudProvider.NodeGroupForNode(candidate.Node)
+		if err != nil {
+			klog.Warningf("Failed to get node group for %s: %v", candidate.Node.Name, err)
+		} else if nodeGroup != nil && !reflect.ValueOf(nodeGroup).IsNil() {
+			nodeGroups[i] = nodeGroup
+			id = nodeGroup.Id()
+		}
+		if _, found := groupCandidates[id]; !found {
+			groupIds = append(groupIds, id)
+			groupPolicies[id] = n.policies(ctx, nodeGroups[i])
+			configured = configured || len(groupPolicies[id]) > 0
+		}
+		groupCandidates[id] = append(groupCandidates[id], i)
+	}
+	if !configured {
+		return candidates
+	}
+
+	scorer := newCandidateScorer(ctx, candidates, nodeGroups, now)
+	for _, id := range groupIds {
+		indices := groupCandidates[id]
+		policies := groupPolicies[id]
+		sort.SliceStable(indices, func(a, b int) bool {
+			return scorer.less(policies, indices[a], indices[b])
+		})
+	}
+
+	// Merge candidates from all groups, each time taking the best of the
+	// groups' next candidates according to the default policies.
+	defaultPolicies := ctx.NodeGroupDefaults.ScaleDownSelectionPolicies
+	result := make([]simulator.NodeToBeRemoved, 0, len(candidates))
+	for len(result) < len(candidates) {
+		var best []int
+		bestId := ""
+		for _, id := range groupIds {
+			next := groupCandidates[id]
+			if len(next) == 0 {
+				continue
+			}
+			if best == nil || scorer.less(defaultPolicies, next[0], best[0]) ||
+				(!scorer.less(defaultPolicies, best[0], next[0]) && next[0] < best[0]) {
+				best, bestId = next, id
+			}
+		}
+		result = append(result, candidates[best[0]])
+		groupCandidates[bestId] = best[1:]
+	}
+	return result
+}
+
+// policies returns the scale down selection policies configured for a node group.
+func (n *PostFilteringScaleDownNodeProcessor) policies(ctx *context.AutoscalingContext, nodeGroup cloudprovider.NodeGroup) []string {
+	if nodeGroup == nil {
+		return ctx.NodeGroupDefaults.ScaleDownSelectionPolicies
+	}
+	policies, err := n.nodeGroupConfigProcessor.GetScaleDownSelectionPolicies(ctx, nodeGroup)
+	if err != nil {
+		klog.Warningf("Failed to get scale down selection policies for node group %s: %v", nodeGroup.Id(), err)
+		return ctx.NodeGroupDefaults.ScaleDownSelectionPolicies
+	}
+	if err := ValidateScaleDownSelectionPolicies(policies); err != nil {
+		klog.Warningf("Invalid scale down selection policies for node group %s, using defaults: %v", nodeGroup.Id(), err)
+		return ctx.NodeGroupDefaults.ScaleDownSelectionPolicies
+	}
+	return policies
 }
 
 // CleanUp is called at CA termination
@@ -39,6 +133,8 @@ func (n *PostFilteringScaleDownNodeProcessor) CleanUp() {
 }
 
 // NewPostFilteringScaleDownNodeProcessor returns a new PostFilteringScaleDownNodeProcessor
-func NewPostFilteringScaleDownNodeProcessor() *PostFilteringScaleDownNodeProcessor {
-	return &PostFilteringScaleDownNodeProcessor{}
+func NewPostFilteringScaleDownNodeProcessor(nodeGroupConfigProcessor nodegroupconfig.NodeGroupConfigProcessor) *PostFilteringScaleDownNodeProcessor {
+	return &PostFilteringScaleDownNodeProcessor{
+		nodeGroupConfigProcessor: nodeGroupConfigProcessor,
+	}
 }
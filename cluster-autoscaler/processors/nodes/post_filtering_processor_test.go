@@ -0,0 +1,215 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodes
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	testprovider "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/test"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/nodegroupconfig"
+	"k8s.io/autoscaler/cluster-autoscaler/simulator"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+)
+
+type testPricingModel struct {
+	nodePrice map[string]float64
+}
+
+func (tpm *testPricingModel) NodePrice(node *apiv1.Node, startTime time.Time, endTime time.Time) (float64, error) {
+	if price, found := tpm.nodePrice[node.Name]; found {
+		return price, nil
+	}
+	return 0.0, fmt.Errorf("price for node %v not found", node.Name)
+}
+
+func (tpm *testPricingModel) PodPrice(pod *apiv1.Pod, startTime time.Time, endTime time.Time) (float64, error) {
+	return 0.0, nil
+}
+
+func TestPostFilteringScaleDownNodeProcessor_GetNodesToRemove(t *testing.T) {
+	now := time.Now()
+	type testNode struct {
+		name      string
+		nodeGroup string
+		age       time.Duration
+		usedCpu   int64
+		evictions int
+		price     float64
+	}
+	// Input order is n1, n2, n3, m1.
+	testNodes := []testNode{
+		{name: "n1", nodeGroup: "ng1", age: 3 * time.Hour, usedCpu: 600, evictions: 2, price: 3},
+		{name: "n2", nodeGroup: "ng1", age: 1 * time.Hour, usedCpu: 100, evictions: 1, price: 1},
+		{name: "n3", nodeGroup: "ng1", age: 2 * time.Hour, usedCpu: 300, evictions: 1, price: 2},
+		{name: "m1", nodeGroup: "ng2", age: 5 * time.Hour, usedCpu: 200, evictions: 3, price: 2},
+	}
+
+	testCases := []struct {
+		name            string
+		defaultPolicies []string
+		ng1Policies     []string
+		noPricing       bool
+		maxCount        int
+		want            []string
+	}{
+		{
+			name:     "no policies keeps the order",
+			maxCount: 2,
+			want:     []string{"n1", "n2"},
+		},
+		{
+			name:            "least utilized",
+			defaultPolicies: []string{LeastUtilizedPolicyName},
+			maxCount:        10,
+			want:            []string{"n2", "m1", "n3", "n1"},
+		},
+		{
+			name:            "oldest",
+			defaultPolicies: []string{OldestPolicyName},
+			maxCount:        10,
+			want:            []string{"m1", "n1", "n3", "n2"},
+		},
+		{
+			name:            "most expensive, ties keep the order",
+			defaultPolicies: []string{MostExpensivePolicyName},
+			maxCount:        10,
+			want:            []string{"n1", "n3", "m1", "n2"},
+		},
+		{
+			name:            "most expensive without pricing keeps the order",
+			defaultPolicies: []string{MostExpensivePolicyName},
+			noPricing:       true,
+			maxCount:        10,
+			want:            []string{"n1", "n2", "n3", "m1"},
+		},
+		{
+			name:            "fewest evictions",
+			defaultPolicies: []string{FewestEvictionsPolicyName},
+			maxCount:        10,
+			want:            []string{"n2", "n3", "n1", "m1"},
+		},
+		{
+			name:            "fewest evictions, then oldest",
+			defaultPolicies: []string{FewestEvictionsPolicyName, OldestPolicyName},
+			maxCount:        10,
+			want:            []string{"n3", "n2", "n1", "m1"},
+		},
+		{
+			name:            "smallest group",
+			defaultPolicies: []string{SmallestGroupPolicyName},
+			maxCount:        10,
+			want:            []string{"m1", "n1", "n2", "n3"},
+		},
+		{
+			name:            "policies applied before truncating",
+			defaultPolicies: []string{LeastUtilizedPolicyName},
+			maxCount:        1,
+			want:            []string{"n2"},
+		},
+		{
+			name:            "node group policies order the group, default policies merge groups",
+			defaultPolicies: []string{LeastUtilizedPolicyName},
+			ng1Policies:     []string{OldestPolicyName},
+			maxCount:        10,
+			want:            []string{"m1", "n1", "n3", "n2"},
+		},
+		{
+			name:        "node group policies without defaults",
+			ng1Policies: []string{OldestPolicyName},
+			maxCount:    10,
+			want:        []string{"n1", "n3", "n2", "m1"},
+		},
+		{
+			name:            "invalid node group policies fall back to defaults",
+			defaultPolicies: []string{LeastUtilizedPolicyName},
+			ng1Policies:     []string{"unknown"},
+			maxCount:        10,
+			want:            []string{"n2", "m1", "n3", "n1"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := testprovider.NewTestCloudProvider(nil, nil)
+			var ng1Options *config.NodeGroupAutoscalingOptions
+			if tc.ng1Policies != nil {
+				ng1Options = &config.NodeGroupAutoscalingOptions{ScaleDownSelectionPolicies: tc.ng1Policies}
+			}
+			provider.AddNodeGroupWithCustomOptions("ng1", 0, 10, 3, ng1Options)
+			provider.AddNodeGroup("ng2", 0, 10, 1)
+			prices := make(map[string]float64)
+			if !tc.noPricing {
+				provider.SetPricingModel(&testPricingModel{nodePrice: prices})
+			}
+
+			var nodes []*apiv1.Node
+			var pods []*apiv1.Pod
+			var candidates []simulator.NodeToBeRemoved
+			for _, tn := range testNodes {
+				node := BuildTestNode(tn.name, 1000, 1000)
+				node.CreationTimestamp = metav1.NewTime(now.Add(-tn.age))
+				provider.AddNode(tn.nodeGroup, node)
+				nodes = append(nodes, node)
+				pod := BuildTestPod(tn.name+"-pod", tn.usedCpu, 0)
+				pod.Spec.NodeName = tn.name
+				pods = append(pods, pod)
+				prices[tn.name] = tn.price
+
+				candidate := simulator.NodeToBeRemoved{Node: node}
+				for i := 0; i < tn.evictions; i++ {
+					candidate.PodsToReschedule = append(candidate.PodsToReschedule, BuildTestPod(fmt.Sprintf("%s-%d", tn.name, i), 10, 0))
+				}
+				candidates = append(candidates, candidate)
+			}
+			snapshot := simulator.NewBasicClusterSnapshot()
+			simulator.InitializeClusterSnapshotOrDie(t, snapshot, nodes, pods)
+
+			ctx := &context.AutoscalingContext{
+				AutoscalingOptions: config.AutoscalingOptions{
+					NodeGroupDefaults: config.NodeGroupAutoscalingOptions{
+						ScaleDownSelectionPolicies: tc.defaultPolicies,
+					},
+				},
+				CloudProvider:   provider,
+				ClusterSnapshot: snapshot,
+			}
+			processor := NewPostFilteringScaleDownNodeProcessor(nodegroupconfig.NewDefaultNodeGroupConfigProcessor())
+			result := processor.GetNodesToRemove(ctx, candidates, tc.maxCount)
+
+			var names []string
+			for _, r := range result {
+				names = append(names, r.Node.Name)
+			}
+			assert.Equal(t, tc.want, names)
+		})
+	}
+}
+
+func TestValidateScaleDownSelectionPolicies(t *testing.T) {
+	assert.NoError(t, ValidateScaleDownSelectionPolicies(nil))
+	assert.NoError(t, ValidateScaleDownSelectionPolicies(AvailableScaleDownSelectionPolicies))
+	assert.Error(t, ValidateScaleDownSelectionPolicies([]string{"unknown"}))
+	assert.Error(t, ValidateScaleDownSelectionPolicies([]string{OldestPolicyName, OldestPolicyName}))
+}
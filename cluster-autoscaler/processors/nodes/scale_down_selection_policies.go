@@ -0,0 +1,193 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodes
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/simulator"
+	"k8s.io/autoscaler/cluster-autoscaler/simulator/utilization"
+
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// LeastUtilizedPolicyName removes nodes with the lowest utilization first.
+	LeastUtilizedPolicyName = "least-utilized"
+	// OldestPolicyName removes the oldest nodes first, e.g. to rotate node images.
+	OldestPolicyName = "oldest"
+	// MostExpensivePolicyName removes the most expensive nodes first, according to the cloud provider PricingModel.
+	MostExpensivePolicyName = "most-expensive"
+	// FewestEvictionsPolicyName removes nodes which require the fewest pods to be evicted first.
+	FewestEvictionsPolicyName = "fewest-evictions"
+	// SmallestGroupPolicyName removes nodes from the smallest node groups first, to consolidate workloads
+	// on fewer node groups.
+	SmallestGroupPolicyName = "smallest-group"
+)
+
+// AvailableScaleDownSelectionPolicies is a list of available scale down selection policies.
+var AvailableScaleDownSelectionPolicies = []string{LeastUtilizedPolicyName, OldestPolicyName, MostExpensivePolicyName, FewestEvictionsPolicyName, SmallestGroupPolicyName}
+
+// unknownScore is used for candidates a policy can't score, so that they are removed last.
+var unknownScore = math.Inf(1)
+
+// scoreFunc returns the score of the i-th scale down candidate. Candidates with lower scores are removed first.
+type scoreFunc func(s *candidateScorer, i int) float64
+
+var scoreFuncs = map[string]scoreFunc{
+	LeastUtilizedPolicyName:   leastUtilizedScore,
+	OldestPolicyName:          oldestScore,
+	MostExpensivePolicyName:   mostExpensiveScore,
+	FewestEvictionsPolicyName: fewestEvictionsScore,
+	SmallestGroupPolicyName:   smallestGroupScore,
+}
+
+// ValidateScaleDownSelectionPolicies returns an error if any of the policies is unknown or used more than once.
+func ValidateScaleDownSelectionPolicies(policies []string) error {
+	seen := make(map[string]bool)
+	for _, policy := range policies {
+		if _, found := scoreFuncs[policy]; !found {
+			return fmt.Errorf("scale down selection policy %s not supported, available policies: %v", policy, AvailableScaleDownSelectionPolicies)
+		}
+		if seen[policy] {
+			return fmt.Errorf("scale down selection policy %s was specified multiple times", policy)
+		}
+		seen[policy] = true
+	}
+	return nil
+}
+
+// candidateScorer computes and caches scores of scale down candidates.
+type candidateScorer struct {
+	ctx        *context.AutoscalingContext
+	now        time.Time
+	candidates []simulator.NodeToBeRemoved
+	nodeGroups []cloudprovider.NodeGroup
+	scores     map[string][]float64
+	groupSizes map[string]int
+	pricing    cloudprovider.PricingModel
+	pricingErr error
+}
+
+func newCandidateScorer(ctx *context.AutoscalingContext, candidates []simulator.NodeToBeRemoved, nodeGroups []cloudprovider.NodeGroup, now time.Time) *candidateScorer {
+	return &candidateScorer{
+		ctx:        ctx,
+		now:        now,
+		candidates: candidates,
+		nodeGroups: nodeGroups,
+		scores:     make(map[string][]float64),
+		groupSizes: make(map[string]int),
+	}
+}
+
+// score returns the score of the i-th candidate according to the given policy.
+func (s *candidateScorer) score(policy string, i int) float64 {
+	scores, found := s.scores[policy]
+	if !found {
+		scores = make([]float64, len(s.candidates))
+		for j := range scores {
+			scores[j] = math.NaN()
+		}
+		s.scores[policy] = scores
+	}
+	if math.IsNaN(scores[i]) {
+		scores[i] = scoreFuncs[policy](s, i)
+	}
+	return scores[i]
+}
+
+// less reports whether the i-th candidate should be removed before the j-th
+// one. Each policy breaks ties left by the previous ones.
+func (s *candidateScorer) less(policies []string, i, j int) bool {
+	for _, policy := range policies {
+		si, sj := s.score(policy, i), s.score(policy, j)
+		if si != sj {
+			return si < sj
+		}
+	}
+	return false
+}
+
+func (s *candidateScorer) pricingModel() (cloudprovider.PricingModel, error) {
+	if s.pricing == nil && s.pricingErr == nil {
+		s.pricing, s.pricingErr = s.ctx.CloudProvider.Pricing()
+	}
+	return s.pricing, s.pricingErr
+}
+
+func leastUtilizedScore(s *candidateScorer, i int) float64 {
+	candidate := s.candidates[i]
+	if s.ctx.ClusterSnapshot == nil {
+		return unknownScore
+	}
+	nodeInfo, err := s.ctx.ClusterSnapshot.NodeInfos().Get(candidate.Node.Name)
+	if err != nil {
+		klog.Warningf("Failed to get node info for %s: %v", candidate.Node.Name, err)
+		return unknownScore
+	}
+	utilInfo, err := utilization.Calculate(candidate.Node, nodeInfo, s.ctx.IgnoreDaemonSetsUtilization, s.ctx.IgnoreMirrorPodsUtilization, s.ctx.CloudProvider.GPULabel(), s.now)
+	if err != nil {
+		klog.Warningf("Failed to calculate utilization for %s: %v", candidate.Node.Name, err)
+		return unknownScore
+	}
+	return utilInfo.Utilization
+}
+
+func oldestScore(s *candidateScorer, i int) float64 {
+	return float64(s.candidates[i].Node.CreationTimestamp.UnixNano())
+}
+
+func mostExpensiveScore(s *candidateScorer, i int) float64 {
+	candidate := s.candidates[i]
+	pricing, err := s.pricingModel()
+	if err != nil {
+		klog.V(4).Infof("Pricing model not available, can't order scale down candidates by price: %v", err)
+		return unknownScore
+	}
+	price, err := pricing.NodePrice(candidate.Node, s.now, s.now.Add(time.Hour))
+	if err != nil {
+		klog.Warningf("Failed to get price of node %s: %v", candidate.Node.Name, err)
+		return unknownScore
+	}
+	return -price
+}
+
+func fewestEvictionsScore(s *candidateScorer, i int) float64 {
+	return float64(len(s.candidates[i].PodsToReschedule))
+}
+
+func smallestGroupScore(s *candidateScorer, i int) float64 {
+	nodeGroup := s.nodeGroups[i]
+	if nodeGroup == nil {
+		return unknownScore
+	}
+	size, found := s.groupSizes[nodeGroup.Id()]
+	if !found {
+		var err error
+		size, err = nodeGroup.TargetSize()
+		if err != nil {
+			klog.Warningf("Failed to get target size of node group %s: %v", nodeGroup.Id(), err)
+			return unknownScore
+		}
+		s.groupSizes[nodeGroup.Id()] = size
+	}
+	return float64(size)
+}
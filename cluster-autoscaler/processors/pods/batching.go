@@ -0,0 +1,120 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pods
+
+import (
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/metrics"
+	klog "k8s.io/klog/v2"
+)
+
+// BatchingPodListProcessor holds back newly unschedulable pods until no new
+// ones appear for PodBatchingWindow, or until they were held for
+// PodBatchingMaxDelay, so that a burst of pods is handled by a single
+// scale-up instead of several small ones in consecutive loops. Pods are
+// released once per batch and then passed through while they stay
+// unschedulable.
+type BatchingPodListProcessor struct {
+	held        map[types.UID]bool
+	released    map[types.UID]bool
+	batchStart  time.Time
+	lastArrival time.Time
+	now         func() time.Time
+}
+
+// NewBatchingPodListProcessor creates an instance of BatchingPodListProcessor.
+func NewBatchingPodListProcessor() PodListProcessor {
+	return &BatchingPodListProcessor{
+		held:     make(map[types.UID]bool),
+		released: make(map[types.UID]bool),
+		now:      time.Now,
+	}
+}
+
+// Process returns the pods which were already released, and the held pods if
+// their batch is complete.
+func (p *BatchingPodListProcessor) Process(
+	context *context.AutoscalingContext,
+	unschedulablePods []*apiv1.Pod) ([]*apiv1.Pod, error) {
+	window := context.PodBatchingWindow
+	if window <= 0 {
+		p.reset()
+		return unschedulablePods, nil
+	}
+	now := p.now()
+
+	held := make(map[types.UID]bool)
+	released := make(map[types.UID]bool)
+	var result, heldPods []*apiv1.Pod
+	for _, pod := range unschedulablePods {
+		if p.released[pod.UID] {
+			released[pod.UID] = true
+			result = append(result, pod)
+			continue
+		}
+		if !p.held[pod.UID] {
+			if len(held) == 0 && len(p.held) == 0 {
+				p.batchStart = now
+			}
+			p.lastArrival = now
+		}
+		held[pod.UID] = true
+		heldPods = append(heldPods, pod)
+	}
+	p.held = held
+	p.released = released
+
+	if len(heldPods) == 0 {
+		metrics.UpdateBatchedPodsCount(0)
+		return result, nil
+	}
+	wait := now.Sub(p.batchStart)
+	if now.Sub(p.lastArrival) < window && wait < context.PodBatchingMaxDelay {
+		klog.V(1).Infof("Holding %d unschedulable pods for %v waiting for more to appear", len(heldPods), wait)
+		metrics.UpdateBatchedPodsCount(len(heldPods))
+		if len(result) == 0 && context.ProcessorCallbacks != nil {
+			// Held pods are going to be handled, just like pods that are too new.
+			context.ProcessorCallbacks.DisableScaleDownForLoop()
+		}
+		return result, nil
+	}
+
+	klog.V(1).Infof("Releasing batch of %d unschedulable pods held for %v", len(heldPods), wait)
+	metrics.UpdateBatchedPodsCount(0)
+	metrics.RegisterPodBatchReleased(wait)
+	for _, pod := range heldPods {
+		p.released[pod.UID] = true
+	}
+	p.held = make(map[types.UID]bool)
+	return append(result, heldPods...), nil
+}
+
+func (p *BatchingPodListProcessor) reset() {
+	if len(p.held) > 0 || len(p.released) > 0 {
+		p.held = make(map[types.UID]bool)
+		p.released = make(map[types.UID]bool)
+		metrics.UpdateBatchedPodsCount(0)
+	}
+}
+
+// CleanUp cleans up the processor's internal structures.
+func (p *BatchingPodListProcessor) CleanUp() {
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pods
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/callbacks"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+)
+
+func TestBatchingPodListProcessor(t *testing.T) {
+	processorCallbacks := callbacks.NewTestProcessorCallbacks()
+	context := &context.AutoscalingContext{
+		AutoscalingOptions: config.AutoscalingOptions{
+			PodBatchingWindow:   10 * time.Second,
+			PodBatchingMaxDelay: time.Minute,
+		},
+		ProcessorCallbacks: processorCallbacks,
+	}
+	p1 := BuildTestPod("p1", 40, 0)
+	p2 := BuildTestPod("p2", 40, 0)
+	p3 := BuildTestPod("p3", 40, 0)
+	p4 := BuildTestPod("p4", 40, 0)
+
+	now := time.Now()
+	processor := NewBatchingPodListProcessor().(*BatchingPodListProcessor)
+	processor.now = func() time.Time { return now }
+	process := func(after time.Duration, pods ...*apiv1.Pod) []*apiv1.Pod {
+		now = now.Add(after)
+		processorCallbacks.Reset()
+		result, err := processor.Process(context, pods)
+		assert.NoError(t, err)
+		return result
+	}
+
+	// Pods are held while new ones keep appearing.
+	assert.Empty(t, process(0, p1))
+	assert.True(t, processorCallbacks.ScaleDownDisabledForLoop)
+	assert.Empty(t, process(5*time.Second, p1, p2))
+	assert.Empty(t, process(5*time.Second, p1, p2))
+	// Pods which got scheduled leave the batch.
+	assert.Empty(t, process(5*time.Second, p2, p3))
+
+	// The batch is released once pod arrival settles.
+	assert.Equal(t, []*apiv1.Pod{p2, p3}, process(10*time.Second, p2, p3))
+	assert.False(t, processorCallbacks.ScaleDownDisabledForLoop)
+
+	// Released pods are passed through, new pods start a new batch.
+	assert.Equal(t, []*apiv1.Pod{p2}, process(5*time.Second, p2, p4))
+	assert.False(t, processorCallbacks.ScaleDownDisabledForLoop)
+	assert.Equal(t, []*apiv1.Pod{p2, p4}, process(10*time.Second, p2, p4))
+}
+
+func TestBatchingPodListProcessorMaxDelay(t *testing.T) {
+	context := &context.AutoscalingContext{
+		AutoscalingOptions: config.AutoscalingOptions{
+			PodBatchingWindow:   10 * time.Second,
+			PodBatchingMaxDelay: 30 * time.Second,
+		},
+	}
+	now := time.Now()
+	processor := NewBatchingPodListProcessor().(*BatchingPodListProcessor)
+	processor.now = func() time.Time { return now }
+
+	var pods []*apiv1.Pod
+	var released []*apiv1.Pod
+	for i := 0; i < 5 && len(released) == 0; i++ {
+		pods = append(pods, BuildTestPod(string(rune('a'+i)), 40, 0))
+		var err error
+		released, err = processor.Process(context, pods)
+		assert.NoError(t, err)
+		now = now.Add(8 * time.Second)
+	}
+	// Pods keep arriving, but the batch is released after the maximum delay.
+	assert.Len(t, released, 5)
+}
+
+func TestBatchingPodListProcessorDisabled(t *testing.T) {
+	context := &context.AutoscalingContext{}
+	p1 := BuildTestPod("p1", 40, 0)
+	pods, err := NewBatchingPodListProcessor().Process(context, []*apiv1.Pod{p1})
+	assert.NoError(t, err)
+	assert.Equal(t, []*apiv1.Pod{p1}, pods)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pods
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+)
+
+type fakePodListProcessor struct {
+	dropped  string
+	err      error
+	called   bool
+	cleanUps int
+}
+
+func (p *fakePodListProcessor) Process(_ *context.AutoscalingContext, unschedulablePods []*apiv1.Pod) ([]*apiv1.Pod, error) {
+	p.called = true
+	if p.err != nil {
+		return nil, p.err
+	}
+	var result []*apiv1.Pod
+	for _, pod := range unschedulablePods {
+		if pod.Name != p.dropped {
+			result = append(result, pod)
+		}
+	}
+	return result, nil
+}
+
+func (p *fakePodListProcessor) CleanUp() {
+	p.cleanUps++
+}
+
+func TestCombinedPodListProcessor(t *testing.T) {
+	p1 := BuildTestPod("p1", 40, 0)
+	p2 := BuildTestPod("p2", 40, 0)
+	p3 := BuildTestPod("p3", 40, 0)
+
+	first := &fakePodListProcessor{dropped: "p1"}
+	second := &fakePodListProcessor{dropped: "p3"}
+	processor := NewCombinedPodListProcessor([]PodListProcessor{first, second})
+	pods, err := processor.Process(&context.AutoscalingContext{}, []*apiv1.Pod{p1, p2, p3})
+	assert.NoError(t, err)
+	assert.Equal(t, []*apiv1.Pod{p2}, pods)
+
+	processor.CleanUp()
+	assert.Equal(t, 1, first.cleanUps)
+	assert.Equal(t, 1, second.cleanUps)
+}
+
+func TestCombinedPodListProcessorError(t *testing.T) {
+	failing := &fakePodListProcessor{err: fmt.Errorf("failed")}
+	next := &fakePodListProcessor{}
+	processor := NewCombinedPodListProcessor([]PodListProcessor{failing, next})
+	pods, err := processor.Process(&context.AutoscalingContext{}, []*apiv1.Pod{BuildTestPod("p1", 40, 0)})
+	assert.Error(t, err)
+	assert.Nil(t, pods)
+	assert.False(t, next.called, "processors after a failing one shouldn't run")
+}
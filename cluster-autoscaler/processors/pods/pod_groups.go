@@ -0,0 +1,98 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pods
+
+import (
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	klog "k8s.io/klog/v2"
+)
+
+// PodGroupPodListProcessor filters out unschedulable pods of pod groups which
+// can't start even if all their unschedulable pods were scheduled, because
+// not enough pods of the group were created yet. Scheduled pods of the group,
+// including ones placed on existing capacity by earlier processors, are taken
+// from the cluster snapshot. Filtered out pods are explained in an event once,
+// not in every loop they stay pending.
+type PodGroupPodListProcessor struct {
+	// reported are pods filtered out in the previous loop.
+	reported map[types.UID]bool
+}
+
+// NewPodGroupPodListProcessor creates an instance of PodGroupPodListProcessor.
+func NewPodGroupPodListProcessor() PodListProcessor {
+	return &PodGroupPodListProcessor{reported: make(map[types.UID]bool)}
+}
+
+// Process filters out pods of pod groups which have fewer pods than needed.
+func (p *PodGroupPodListProcessor) Process(
+	context *context.AutoscalingContext,
+	unschedulablePods []*apiv1.Pod) ([]*apiv1.Pod, error) {
+	if context.PodGroupFinder == nil {
+		return unschedulablePods, nil
+	}
+	pendingGroups := context.PodGroupFinder.Group(unschedulablePods)
+	if len(pendingGroups) == 0 {
+		p.reported = make(map[types.UID]bool)
+		return unschedulablePods, nil
+	}
+
+	nodeInfos, err := context.ClusterSnapshot.NodeInfos().List()
+	if err != nil {
+		return nil, err
+	}
+	var scheduledPods []*apiv1.Pod
+	for _, nodeInfo := range nodeInfos {
+		for _, podInfo := range nodeInfo.Pods {
+			scheduledPods = append(scheduledPods, podInfo.Pod)
+		}
+	}
+	scheduledGroups := context.PodGroupFinder.Group(scheduledPods)
+
+	incomplete := make(map[string]bool)
+	for key, members := range pendingGroups {
+		created := len(members.Pods)
+		if scheduled, found := scheduledGroups[key]; found {
+			created += len(scheduled.Pods)
+		}
+		if created < members.MinMember {
+			klog.V(4).Infof("Pod group %s has %d of %d pods. Ignoring in scale up.", key, created, members.MinMember)
+			incomplete[key] = true
+		}
+	}
+
+	result := make([]*apiv1.Pod, 0, len(unschedulablePods))
+	reported := make(map[types.UID]bool)
+	for _, pod := range unschedulablePods {
+		if podGroup, found := context.PodGroupFinder.PodGroup(pod); found && incomplete[podGroup.Key()] {
+			reported[pod.UID] = true
+			if !p.reported[pod.UID] {
+				context.Recorder.Eventf(pod, apiv1.EventTypeNormal, "NotTriggerScaleUp",
+					"pod didn't trigger scale-up: pod group %s has fewer than %d pods", podGroup.Name, podGroup.MinMember)
+			}
+			continue
+		}
+		result = append(result, pod)
+	}
+	p.reported = reported
+	return result, nil
+}
+
+// CleanUp cleans up the processor's internal structures.
+func (p *PodGroupPodListProcessor) CleanUp() {
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pods
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/simulator"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/podgroup"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+)
+
+func buildPodGroupPod(name, group, minMember string) *apiv1.Pod {
+	pod := BuildTestPod(name, 40, 0)
+	pod.Labels = map[string]string{podgroup.PodGroupLabelKey: group}
+	pod.Annotations[podgroup.PodGroupMinMemberAnnotationKey] = minMember
+	return pod
+}
+
+func TestPodGroupPodListProcessor(t *testing.T) {
+	// Group a has all 3 pods, one of them scheduled, group b has 2 of 3 pods.
+	a1 := buildPodGroupPod("a1", "a", "3")
+	a2 := buildPodGroupPod("a2", "a", "3")
+	a3 := buildPodGroupPod("a3", "a", "3")
+	b1 := buildPodGroupPod("b1", "b", "3")
+	b2 := buildPodGroupPod("b2", "b", "3")
+	p1 := BuildTestPod("p1", 40, 0)
+
+	node := BuildTestNode("n1", 1000, 1000)
+	clusterSnapshot := simulator.NewBasicClusterSnapshot()
+	assert.NoError(t, clusterSnapshot.AddNodeWithPods(node, []*apiv1.Pod{a3}))
+
+	recorder := record.NewFakeRecorder(10)
+	context := &context.AutoscalingContext{
+		AutoscalingKubeClients: context.AutoscalingKubeClients{Recorder: recorder},
+		ClusterSnapshot:        clusterSnapshot,
+		PodGroupFinder:         podgroup.NewFinder(nil),
+	}
+
+	processor := NewPodGroupPodListProcessor()
+	pods, err := processor.Process(context, []*apiv1.Pod{a1, b1, p1, a2, b2})
+	assert.NoError(t, err)
+	assert.Equal(t, []*apiv1.Pod{a1, p1, a2}, pods)
+
+	assert.Len(t, recorder.Events, 2)
+	assert.Contains(t, <-recorder.Events, "pod group b has fewer than 3 pods")
+	<-recorder.Events
+
+	// Pods still filtered out aren't reported again.
+	pods, err = processor.Process(context, []*apiv1.Pod{a1, b1, p1, a2, b2})
+	assert.NoError(t, err)
+	assert.Equal(t, []*apiv1.Pod{a1, p1, a2}, pods)
+	assert.Empty(t, recorder.Events)
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pods
+
+import (
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	pod_utils "k8s.io/autoscaler/cluster-autoscaler/utils/pod"
+	klog "k8s.io/klog/v2"
+)
+
+// ScaleUpAnnotationsPodListProcessor filters out pods which opted out of
+// triggering scale-up, or which have an invalid node group selector, and
+// explains why they didn't trigger scale-up in an event. The event is emitted
+// once per pod, not in every loop the pod stays pending.
+type ScaleUpAnnotationsPodListProcessor struct {
+	// reported are reasons reported for pods filtered out in the previous loop.
+	reported map[types.UID]string
+}
+
+// NewScaleUpAnnotationsPodListProcessor creates an instance of ScaleUpAnnotationsPodListProcessor.
+func NewScaleUpAnnotationsPodListProcessor() PodListProcessor {
+	return &ScaleUpAnnotationsPodListProcessor{reported: make(map[types.UID]string)}
+}
+
+// Process filters out pods which may not trigger scale-up because of their annotations.
+func (p *ScaleUpAnnotationsPodListProcessor) Process(
+	context *context.AutoscalingContext,
+	unschedulablePods []*apiv1.Pod) ([]*apiv1.Pod, error) {
+	result := make([]*apiv1.Pod, 0, len(unschedulablePods))
+	reported := make(map[types.UID]string)
+	for _, pod := range unschedulablePods {
+		if pod_utils.IsScaleUpDisabled(pod) {
+			klog.V(4).Infof("Pod %s/%s has scale-up disabled by annotation. Ignoring in scale up.", pod.Namespace, pod.Name)
+			reason := fmt.Sprintf("disabled by %s annotation", pod_utils.ScaleUpDisabledAnnotationKey)
+			p.report(context, pod, apiv1.EventTypeNormal, reason, reported)
+			continue
+		}
+		if _, err := pod_utils.NodeGroupSelector(pod); err != nil {
+			klog.V(4).Infof("Pod %s/%s has %v. Ignoring in scale up.", pod.Namespace, pod.Name, err)
+			p.report(context, pod, apiv1.EventTypeWarning, err.Error(), reported)
+			continue
+		}
+		result = append(result, pod)
+	}
+	p.reported = reported
+	return result, nil
+}
+
+// report emits an event explaining why the pod didn't trigger scale-up, unless
+// the same reason was already reported in the previous loop.
+func (p *ScaleUpAnnotationsPodListProcessor) report(context *context.AutoscalingContext, pod *apiv1.Pod, eventType, reason string, reported map[types.UID]string) {
+	reported[pod.UID] = reason
+	if p.reported[pod.UID] == reason {
+		return
+	}
+	context.Recorder.Eventf(pod, eventType, "NotTriggerScaleUp", "pod didn't trigger scale-up: %s", reason)
+}
+
+// CleanUp cleans up the processor's internal structures.
+func (p *ScaleUpAnnotationsPodListProcessor) CleanUp() {
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pods
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	pod_utils "k8s.io/autoscaler/cluster-autoscaler/utils/pod"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+)
+
+func TestScaleUpAnnotationsPodListProcessor(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	context := &context.AutoscalingContext{
+		AutoscalingKubeClients: context.AutoscalingKubeClients{Recorder: recorder},
+	}
+	p1 := BuildTestPod("p1", 40, 0)
+	p2 := BuildTestPod("p2", 40, 0)
+	p2.Annotations = map[string]string{pod_utils.ScaleUpDisabledAnnotationKey: "true"}
+	p3 := BuildTestPod("p3", 40, 0)
+	p3.Annotations = map[string]string{pod_utils.NodeGroupSelectorAnnotationKey: "pool=gpu"}
+	p4 := BuildTestPod("p4", 40, 0)
+	p4.Annotations = map[string]string{pod_utils.NodeGroupSelectorAnnotationKey: "pool in (gpu"}
+
+	processor := NewScaleUpAnnotationsPodListProcessor()
+	pods, err := processor.Process(context, []*apiv1.Pod{p1, p2, p3, p4})
+	assert.NoError(t, err)
+	assert.Equal(t, []*apiv1.Pod{p1, p3}, pods)
+
+	assert.Len(t, recorder.Events, 2)
+	assert.Contains(t, <-recorder.Events, "disabled by "+pod_utils.ScaleUpDisabledAnnotationKey+" annotation")
+	assert.Contains(t, <-recorder.Events, "invalid "+pod_utils.NodeGroupSelectorAnnotationKey+" annotation")
+
+	// Pods are reported once, not in every loop.
+	_, err = processor.Process(context, []*apiv1.Pod{p1, p2, p3, p4})
+	assert.NoError(t, err)
+	assert.Len(t, recorder.Events, 0)
+
+	// A pod which stopped being filtered out is reported again if it's
+	// filtered out later.
+	_, err = processor.Process(context, []*apiv1.Pod{p1, p3, p4})
+	assert.NoError(t, err)
+	_, err = processor.Process(context, []*apiv1.Pod{p1, p2, p3, p4})
+	assert.NoError(t, err)
+	assert.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "disabled by "+pod_utils.ScaleUpDisabledAnnotationKey+" annotation")
+}
@@ -26,6 +26,7 @@ import (
 
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
 	"k8s.io/autoscaler/cluster-autoscaler/context"
+	pod_utils "k8s.io/autoscaler/cluster-autoscaler/utils/pod"
 )
 
 // EventingScaleUpStatusProcessor processes the state of the cluster after
@@ -86,6 +87,11 @@ func ReasonsMessage(noScaleUpInfo NoScaleUpInfo, consideredNodeGroups map[string
 	for msg, count := range aggregated {
 		messages = append(messages, fmt.Sprintf("%d %s", count, msg))
 	}
+	if noScaleUpInfo.Pod != nil {
+		if selector, found := noScaleUpInfo.Pod.Annotations[pod_utils.NodeGroupSelectorAnnotationKey]; found {
+			messages = append(messages, fmt.Sprintf("pod may only trigger scale-up of node groups matching %q", selector))
+		}
+	}
 	return strings.Join(messages, ", ")
 }
 
@@ -145,6 +145,51 @@ type PodEvictionResult struct {
 	Pod      *apiv1.Pod
 	TimedOut bool
 	Err      error
+	// Outcome tells how the eviction of the pod ended.
+	Outcome PodEvictionOutcome
+	// Attempts is the number of eviction requests made for the pod.
+	Attempts int
+}
+
+// PodEvictionOutcome denotes how the eviction of a pod during a node drain ended.
+type PodEvictionOutcome int
+
+const (
+	// PodEvictionNotFinished - the drain ended before the eviction of the pod finished.
+	PodEvictionNotFinished PodEvictionOutcome = iota
+	// PodEvicted - the pod was evicted and, unless not waited for, left the node.
+	PodEvicted
+	// PodEvictionBlockedByPdb - the evictions of the pod were rejected because of a PodDisruptionBudget.
+	PodEvictionBlockedByPdb
+	// PodEvictionFailed - the evictions of the pod failed with an error.
+	PodEvictionFailed
+	// PodReplacementNotReady - the pod wasn't evicted, because replacements of pods evicted earlier from
+	// the same controller didn't become ready in time.
+	PodReplacementNotReady
+	// PodNotRemoved - the pod was evicted, but didn't leave the node in time.
+	PodNotRemoved
+	// PodEvictionRateLimited - the pod wasn't evicted, because the limit of evictions per minute
+	// from its namespace was reached.
+	PodEvictionRateLimited
+)
+
+// String returns a human readable description of the outcome.
+func (o PodEvictionOutcome) String() string {
+	switch o {
+	case PodEvicted:
+		return "evicted"
+	case PodEvictionBlockedByPdb:
+		return "eviction blocked by PodDisruptionBudget"
+	case PodEvictionFailed:
+		return "eviction failed"
+	case PodReplacementNotReady:
+		return "waiting for replacement pods to become ready timed out"
+	case PodNotRemoved:
+		return "evicted but not removed from the node in time"
+	case PodEvictionRateLimited:
+		return "eviction limit of the namespace reached"
+	}
+	return "eviction not finished"
 }
 
 // WasEvictionSuccessful tells if the pod was successfully evicted.
@@ -19,6 +19,7 @@ package simulator
 import (
 	"flag"
 	"fmt"
+	"sync"
 	"time"
 
 	"k8s.io/autoscaler/cluster-autoscaler/utils/drain"
@@ -28,6 +29,8 @@ import (
 
 	apiv1 "k8s.io/api/core/v1"
 	policyv1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
 
 	klog "k8s.io/klog/v2"
@@ -93,14 +96,34 @@ const (
 	BlockedByPod
 	// UnexpectedError - node can't be removed because of an unexpected error.
 	UnexpectedError
+	// DisruptionBudgetExceeded - node can't be removed because it would exceed the scale-down disruption budget.
+	DisruptionBudgetExceeded
+	// InBlackoutWindow - node can't be removed because scale-down is forbidden by a blackout window.
+	InBlackoutWindow
 )
 
 // RemovalSimulator is a helper object for simulating node removal scenarios.
 type RemovalSimulator struct {
-	listers          kube_util.ListerRegistry
-	clusterSnapshot  ClusterSnapshot
-	predicateChecker PredicateChecker
-	usageTracker     *UsageTracker
+	listers                  kube_util.ListerRegistry
+	clusterSnapshot          ClusterSnapshot
+	predicateChecker         PredicateChecker
+	usageTracker             *UsageTracker
+	maxEvictableEmptyDirSize *resource.Quantity
+	parallelism              int
+	workerPredicateCheckers  []PredicateChecker
+}
+
+// podPlacement is a node found for a pod of a node simulated to be removed.
+type podPlacement struct {
+	podKey   string
+	nodeName string
+}
+
+// removalCheckResult is an outcome of checking whether a node can be removed.
+type removalCheckResult struct {
+	toRemove    *NodeToBeRemoved
+	unremovable *UnremovableNode
+	placements  []podPlacement
 }
 
 // NewRemovalSimulator returns a new RemovalSimulator.
@@ -110,7 +133,26 @@ func NewRemovalSimulator(listers kube_util.ListerRegistry, clusterSnapshot Clust
 		clusterSnapshot:  clusterSnapshot,
 		predicateChecker: predicateChecker,
 		usageTracker:     usageTracker,
+		parallelism:      1,
+	}
+}
+
+// SetParallelism sets the maximum number of candidates FindNodesToRemove
+// checks concurrently. Candidates are checked in parallel only if the cluster
+// snapshot is a CopyableClusterSnapshot and the predicate checker is a
+// CopyablePredicateChecker, each worker using its own copies of them.
+func (r *RemovalSimulator) SetParallelism(parallelism int) {
+	if parallelism < 1 {
+		parallelism = 1
 	}
+	r.parallelism = parallelism
+}
+
+// SetMaxEvictableEmptyDirSize sets the maximum size limit of emptyDir volumes
+// annotated as safe to evict which don't block removal of a node. With a nil
+// size, pods with local storage block removal of their nodes.
+func (r *RemovalSimulator) SetMaxEvictableEmptyDirSize(size *resource.Quantity) {
+	r.maxEvictableEmptyDirSize = size
 }
 
 // FindNodesToRemove finds nodes that can be removed. Returns also an
@@ -131,17 +173,112 @@ func (r *RemovalSimulator) FindNodesToRemove(
 		destinationMap[destination] = true
 	}
 
-	for _, nodeName := range candidates {
-		rn, urn := r.CheckNodeRemoval(nodeName, destinationMap, oldHints, newHints, timestamp, pdbs)
-		if rn != nil {
-			result = append(result, *rn)
-		} else if urn != nil {
-			unremovable = append(unremovable, urn)
+	var checkResults []removalCheckResult
+	if r.parallelism > 1 && len(candidates) > 1 {
+		checkResults = r.checkNodesRemovalInParallel(candidates, destinationMap, oldHints, timestamp, pdbs)
+	}
+	if checkResults == nil {
+		checkResults = make([]removalCheckResult, 0, len(candidates))
+		for _, nodeName := range candidates {
+			checkResults = append(checkResults, r.checkNodeRemoval(nodeName, destinationMap, oldHints, timestamp, pdbs))
+		}
+	}
+
+	// Results are merged in order of candidates, so that hints and usages
+	// are the same as if candidates were checked one by one.
+	for i, checkResult := range checkResults {
+		r.registerPlacements(candidates[i], checkResult.placements, newHints, timestamp)
+		if checkResult.toRemove != nil {
+			result = append(result, *checkResult.toRemove)
+		} else if checkResult.unremovable != nil {
+			unremovable = append(unremovable, checkResult.unremovable)
 		}
 	}
 	return result, unremovable, newHints, nil
 }
 
+// checkNodesRemovalInParallel checks candidates using up to r.parallelism
+// workers. Returns results in order of candidates, or nil if candidates can't
+// be checked in parallel.
+func (r *RemovalSimulator) checkNodesRemovalInParallel(
+	candidates []string,
+	destinationMap map[string]bool,
+	oldHints map[string]string,
+	timestamp time.Time,
+	pdbs []*policyv1.PodDisruptionBudget,
+) []removalCheckResult {
+	snapshot, ok := r.clusterSnapshot.(CopyableClusterSnapshot)
+	if !ok {
+		klog.V(4).Infof("Cluster snapshot can't be copied, checking scale-down candidates serially")
+		return nil
+	}
+	workerCount := r.parallelism
+	if workerCount > len(candidates) {
+		workerCount = len(candidates)
+	}
+	checkers, err := r.getWorkerPredicateCheckers(workerCount)
+	if err != nil {
+		klog.Warningf("Failed to create predicate checkers, checking scale-down candidates serially: %v", err)
+		return nil
+	}
+
+	// Copies are taken before starting workers, as copying may update caches of the snapshot.
+	workers := make([]*RemovalSimulator, 0, workerCount)
+	for i := 0; i < workerCount; i++ {
+		workers = append(workers, &RemovalSimulator{
+			listers:                  r.listers,
+			clusterSnapshot:          snapshot.Copy(),
+			predicateChecker:         checkers[i],
+			maxEvictableEmptyDirSize: r.maxEvictableEmptyDirSize,
+			parallelism:              1,
+		})
+	}
+
+	results := make([]removalCheckResult, len(candidates))
+	indexes := make(chan int, len(candidates))
+	for i := range candidates {
+		indexes <- i
+	}
+	close(indexes)
+
+	var wg sync.WaitGroup
+	for _, worker := range workers {
+		wg.Add(1)
+		go func(worker *RemovalSimulator) {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = worker.checkNodeRemoval(candidates[i], destinationMap, oldHints, timestamp, pdbs)
+			}
+		}(worker)
+	}
+	wg.Wait()
+	return results
+}
+
+// getWorkerPredicateCheckers returns count predicate checkers which can be
+// used concurrently. They're created once and reused in later loops.
+func (r *RemovalSimulator) getWorkerPredicateCheckers(count int) ([]PredicateChecker, error) {
+	copyable, ok := r.predicateChecker.(CopyablePredicateChecker)
+	if !ok {
+		return nil, fmt.Errorf("predicate checker can't be copied")
+	}
+	for len(r.workerPredicateCheckers) < count {
+		checker, err := copyable.Copy()
+		if err != nil {
+			return nil, err
+		}
+		r.workerPredicateCheckers = append(r.workerPredicateCheckers, checker)
+	}
+	return r.workerPredicateCheckers[:count], nil
+}
+
+func (r *RemovalSimulator) registerPlacements(removedNode string, placements []podPlacement, newHints map[string]string, timestamp time.Time) {
+	for _, placement := range placements {
+		newHints[placement.podKey] = placement.nodeName
+		r.usageTracker.RegisterUsage(removedNode, placement.nodeName, timestamp)
+	}
+}
+
 // CheckNodeRemoval checks whether a specific node can be removed. Depending on
 // the outcome, exactly one of (NodeToBeRemoved, UnremovableNode) will be
 // populated in the return value, the other will be nil.
@@ -153,6 +290,20 @@ func (r *RemovalSimulator) CheckNodeRemoval(
 	timestamp time.Time,
 	pdbs []*policyv1.PodDisruptionBudget,
 ) (*NodeToBeRemoved, *UnremovableNode) {
+	checkResult := r.checkNodeRemoval(nodeName, destinationMap, oldHints, timestamp, pdbs)
+	r.registerPlacements(nodeName, checkResult.placements, newHints, timestamp)
+	return checkResult.toRemove, checkResult.unremovable
+}
+
+// checkNodeRemoval is CheckNodeRemoval which returns places found for pods
+// instead of registering them, so that it can be called concurrently.
+func (r *RemovalSimulator) checkNodeRemoval(
+	nodeName string,
+	destinationMap map[string]bool,
+	oldHints map[string]string,
+	timestamp time.Time,
+	pdbs []*policyv1.PodDisruptionBudget,
+) removalCheckResult {
 	nodeInfo, err := r.clusterSnapshot.NodeInfos().Get(nodeName)
 	if err != nil {
 		klog.Errorf("Can't retrieve node %s from snapshot, err: %v", nodeName, err)
@@ -161,25 +312,50 @@ func (r *RemovalSimulator) CheckNodeRemoval(
 
 	if _, found := destinationMap[nodeName]; !found {
 		klog.V(2).Infof("nodeInfo for %s not found", nodeName)
-		return nil, &UnremovableNode{Node: nodeInfo.Node(), Reason: UnexpectedError}
+		return removalCheckResult{unremovable: &UnremovableNode{Node: nodeInfo.Node(), Reason: UnexpectedError}}
 	}
 
+	rn, urn := r.drainNodeInfo(nodeInfo, timestamp, pdbs)
+	if urn != nil {
+		return removalCheckResult{unremovable: urn}
+	}
+
+	placements, err := r.findPlaceFor(nodeName, rn.PodsToReschedule, destinationMap, oldHints, timestamp)
+	if err != nil {
+		klog.V(2).Infof("node %s is not suitable for removal: %v", nodeName, err)
+		return removalCheckResult{unremovable: &UnremovableNode{Node: nodeInfo.Node(), Reason: NoPlaceToMovePods}, placements: placements}
+	}
+	klog.V(2).Infof("node %s may be removed", nodeName)
+	return removalCheckResult{toRemove: rn, placements: placements}
+}
+
+// CheckNodeDrain checks whether all pods running on a specific node can be
+// moved, without looking for a place for them. Depending on the outcome,
+// exactly one of (NodeToBeRemoved, UnremovableNode) will be populated in the
+// return value, the other will be nil.
+func (r *RemovalSimulator) CheckNodeDrain(
+	nodeName string,
+	timestamp time.Time,
+	pdbs []*policyv1.PodDisruptionBudget,
+) (*NodeToBeRemoved, *UnremovableNode) {
+	nodeInfo, err := r.clusterSnapshot.NodeInfos().Get(nodeName)
+	if err != nil {
+		klog.Errorf("Can't retrieve node %s from snapshot, err: %v", nodeName, err)
+		return nil, &UnremovableNode{Node: &apiv1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}, Reason: UnexpectedError}
+	}
+	return r.drainNodeInfo(nodeInfo, timestamp, pdbs)
+}
+
+func (r *RemovalSimulator) drainNodeInfo(nodeInfo *schedulerframework.NodeInfo, timestamp time.Time, pdbs []*policyv1.PodDisruptionBudget) (*NodeToBeRemoved, *UnremovableNode) {
 	podsToRemove, daemonSetPods, blockingPod, err := DetailedGetPodsForMove(nodeInfo, *skipNodesWithSystemPods,
-		*skipNodesWithLocalStorage, r.listers, int32(*minReplicaCount), pdbs, timestamp)
+		*skipNodesWithLocalStorage, r.maxEvictableEmptyDirSize, r.listers, int32(*minReplicaCount), pdbs, timestamp)
 	if err != nil {
-		klog.V(2).Infof("node %s cannot be removed: %v", nodeName, err)
+		klog.V(2).Infof("node %s cannot be removed: %v", nodeInfo.Node().Name, err)
 		if blockingPod != nil {
 			return nil, &UnremovableNode{Node: nodeInfo.Node(), Reason: BlockedByPod, BlockingPod: blockingPod}
 		}
 		return nil, &UnremovableNode{Node: nodeInfo.Node(), Reason: UnexpectedError}
 	}
-
-	err = r.findPlaceFor(nodeName, podsToRemove, destinationMap, oldHints, newHints, timestamp)
-	if err != nil {
-		klog.V(2).Infof("node %s is not suitable for removal: %v", nodeName, err)
-		return nil, &UnremovableNode{Node: nodeInfo.Node(), Reason: NoPlaceToMovePods}
-	}
-	klog.V(2).Infof("node %s may be removed", nodeName)
 	return &NodeToBeRemoved{
 		Node:             nodeInfo.Node(),
 		PodsToReschedule: podsToRemove,
@@ -205,11 +381,13 @@ func (r *RemovalSimulator) FindEmptyNodesToRemove(candidates []string, timestamp
 	return result
 }
 
+// findPlaceFor finds places for pods of the removed node. Returns places found
+// for pods, also if places for some pods weren't found.
 func (r *RemovalSimulator) findPlaceFor(removedNode string, pods []*apiv1.Pod, nodes map[string]bool,
-	oldHints map[string]string, newHints map[string]string, timestamp time.Time) error {
+	oldHints map[string]string, timestamp time.Time) ([]podPlacement, error) {
 
 	if err := r.clusterSnapshot.Fork(); err != nil {
-		return err
+		return nil, err
 	}
 	defer func() {
 		err := r.clusterSnapshot.Revert()
@@ -226,6 +404,15 @@ func (r *RemovalSimulator) findPlaceFor(removedNode string, pods []*apiv1.Pod, n
 		return nodeName != removedNode && nodes[nodeName]
 	}
 
+	localStorageFits := func(pod *apiv1.Pod, nodeInfo *schedulerframework.NodeInfo) bool {
+		if err := checkLocalStorage(pod, nodeInfo); err != nil {
+			klog.V(5).Infof("Local storage of %s/%s doesn't fit %s: %v", pod.Namespace, pod.Name, nodeInfo.Node().Name, err)
+			return false
+		}
+		return true
+	}
+
+	var placements []podPlacement
 	pods = tpu.ClearTPURequests(pods)
 
 	// remove pods from clusterSnapshot first
@@ -247,12 +434,15 @@ func (r *RemovalSimulator) findPlaceFor(removedNode string, pods []*apiv1.Pod, n
 		klog.V(5).Infof("Looking for place for %s/%s", pod.Namespace, pod.Name)
 
 		if hintedNode, hasHint := oldHints[podKey(pod)]; hasHint && isCandidateNode(hintedNode) {
-			if err := r.predicateChecker.CheckPredicates(r.clusterSnapshot, pod, hintedNode); err == nil {
+			hintedNodeInfo, err := r.clusterSnapshot.NodeInfos().Get(hintedNode)
+			if err != nil {
+				return placements, fmt.Errorf("Retrieving %s from snapshot return error; %v", hintedNode, err)
+			}
+			if err := r.predicateChecker.CheckPredicates(r.clusterSnapshot, pod, hintedNode); err == nil && localStorageFits(pod, hintedNodeInfo) {
 				klog.V(4).Infof("Pod %s/%s can be moved to %s", pod.Namespace, pod.Name, hintedNode)
 				if err := r.clusterSnapshot.AddPod(pod, hintedNode); err != nil {
-					return fmt.Errorf("Simulating scheduling of %s/%s to %s return error; %v", pod.Namespace, pod.Name, hintedNode, err)
+					return placements, fmt.Errorf("Simulating scheduling of %s/%s to %s return error; %v", pod.Namespace, pod.Name, hintedNode, err)
 				}
-				newHints[podKey(pod)] = hintedNode
 				foundPlace = true
 				targetNode = hintedNode
 			}
@@ -260,21 +450,20 @@ func (r *RemovalSimulator) findPlaceFor(removedNode string, pods []*apiv1.Pod, n
 
 		if !foundPlace {
 			newNodeName, err := r.predicateChecker.FitsAnyNodeMatching(r.clusterSnapshot, pod, func(nodeInfo *schedulerframework.NodeInfo) bool {
-				return isCandidateNode(nodeInfo.Node().Name)
+				return isCandidateNode(nodeInfo.Node().Name) && localStorageFits(pod, nodeInfo)
 			})
 			if err == nil {
 				klog.V(4).Infof("Pod %s/%s can be moved to %s", pod.Namespace, pod.Name, newNodeName)
 				if err := r.clusterSnapshot.AddPod(pod, newNodeName); err != nil {
-					return fmt.Errorf("Simulating scheduling of %s/%s to %s return error; %v", pod.Namespace, pod.Name, newNodeName, err)
+					return placements, fmt.Errorf("Simulating scheduling of %s/%s to %s return error; %v", pod.Namespace, pod.Name, newNodeName, err)
 				}
-				newHints[podKey(pod)] = newNodeName
 				targetNode = newNodeName
 			} else {
-				return fmt.Errorf("failed to find place for %s", podKey(pod))
+				return placements, fmt.Errorf("failed to find place for %s", podKey(pod))
 			}
 		}
 
-		r.usageTracker.RegisterUsage(removedNode, targetNode, timestamp)
+		placements = append(placements, podPlacement{podKey: podKey(pod), nodeName: targetNode})
 	}
-	return nil
+	return placements, nil
 }
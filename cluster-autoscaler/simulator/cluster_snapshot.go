@@ -41,7 +41,8 @@ type ClusterSnapshot interface {
 	AddNodeWithPods(node *apiv1.Node, pods []*apiv1.Pod) error
 
 	// Fork creates a fork of snapshot state. All modifications can later be reverted to moment of forking via Revert()
-	// Forking already forked snapshot is not allowed and will result with an error.
+	// Forking already forked snapshot is not allowed and will result with an error, unless the implementation
+	// supports nested forks, in which case Revert and Commit apply to the most recent fork.
 	Fork() error
 	// Revert reverts snapshot state to moment of forking.
 	Revert() error
@@ -51,4 +52,13 @@ type ClusterSnapshot interface {
 	Clear()
 }
 
+// CopyableClusterSnapshot is a ClusterSnapshot able to create copies of its
+// current state, which can be used concurrently with each other.
+type CopyableClusterSnapshot interface {
+	ClusterSnapshot
+	// Copy returns a snapshot with the current state of this one. Copies can be
+	// modified concurrently, as long as this snapshot isn't modified while they're used.
+	Copy() ClusterSnapshot
+}
+
 var errNodeNotFound = errors.New("node not found")
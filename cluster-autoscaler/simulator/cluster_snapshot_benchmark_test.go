@@ -268,3 +268,89 @@ func BenchmarkBuildNodeInfoList(b *testing.B) {
 		})
 	}
 }
+
+func BenchmarkForkAddPodListRevert(b *testing.B) {
+	nodeTestCases := []int{1, 10, 100, 1000, 5000}
+
+	for snapshotName, snapshotFactory := range snapshots {
+		for _, ntc := range nodeTestCases {
+			nodes := createTestNodes(ntc)
+			pods := createTestPods(ntc * 30)
+			assignPodsToNodes(pods, nodes)
+			clusterSnapshot := snapshotFactory()
+			err := clusterSnapshot.AddNodes(nodes)
+			assert.NoError(b, err)
+			for _, pod := range pods {
+				err = clusterSnapshot.AddPod(pod, pod.Spec.NodeName)
+				assert.NoError(b, err)
+			}
+			tmpPod := BuildTestPod("tmp", 1, 1)
+			b.ResetTimer()
+			b.Run(fmt.Sprintf("%s: ForkAddPodListRevert (%d nodes)", snapshotName, ntc), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if err := clusterSnapshot.Fork(); err != nil {
+						assert.NoError(b, err)
+					}
+					if err := clusterSnapshot.AddPod(tmpPod, nodes[i%ntc].Name); err != nil {
+						assert.NoError(b, err)
+					}
+					if list, err := clusterSnapshot.NodeInfos().List(); err != nil || len(list) != ntc {
+						assert.NoError(b, err)
+						assert.Equal(b, ntc, len(list))
+					}
+					if err := clusterSnapshot.Revert(); err != nil {
+						assert.NoError(b, err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkNestedForkAddPodListRevert(b *testing.B) {
+	nodeTestCases := []int{100, 1000, 5000}
+	depthTestCases := []int{1, 2, 5}
+
+	for snapshotName, snapshotFactory := range snapshots {
+		if !nestedForkSnapshots[snapshotName] {
+			continue
+		}
+		for _, ntc := range nodeTestCases {
+			nodes := createTestNodes(ntc)
+			pods := createTestPods(ntc * 30)
+			assignPodsToNodes(pods, nodes)
+			clusterSnapshot := snapshotFactory()
+			err := clusterSnapshot.AddNodes(nodes)
+			assert.NoError(b, err)
+			for _, pod := range pods {
+				err = clusterSnapshot.AddPod(pod, pod.Spec.NodeName)
+				assert.NoError(b, err)
+			}
+			for _, depth := range depthTestCases {
+				tmpPods := createTestPodsWithPrefix("tmp", depth)
+				b.ResetTimer()
+				b.Run(fmt.Sprintf("%s: NestedForkAddPodListRevert (%d nodes, depth %d)", snapshotName, ntc, depth), func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						for d := 0; d < depth; d++ {
+							if err := clusterSnapshot.Fork(); err != nil {
+								assert.NoError(b, err)
+							}
+							if err := clusterSnapshot.AddPod(tmpPods[d], nodes[(i+d)%ntc].Name); err != nil {
+								assert.NoError(b, err)
+							}
+							if list, err := clusterSnapshot.NodeInfos().List(); err != nil || len(list) != ntc {
+								assert.NoError(b, err)
+								assert.Equal(b, ntc, len(list))
+							}
+						}
+						for d := 0; d < depth; d++ {
+							if err := clusterSnapshot.Revert(); err != nil {
+								assert.NoError(b, err)
+							}
+						}
+					}
+				})
+			}
+		}
+	}
+}
@@ -31,8 +31,18 @@ import (
 )
 
 var snapshots = map[string]func() ClusterSnapshot{
-	"basic": func() ClusterSnapshot { return NewBasicClusterSnapshot() },
-	"delta": func() ClusterSnapshot { return NewDeltaClusterSnapshot() },
+	"basic":         func() ClusterSnapshot { return NewBasicClusterSnapshot() },
+	"delta":         func() ClusterSnapshot { return NewDeltaClusterSnapshot() },
+	"copy-on-write": func() ClusterSnapshot { return NewCopyOnWriteClusterSnapshot() },
+	"incremental": func() ClusterSnapshot {
+		return NewIncrementalClusterSnapshot(func(*apiv1.Pod) bool { return true }, time.Hour)
+	},
+}
+
+// nestedForkSnapshots are snapshots which can be forked while already forked.
+var nestedForkSnapshots = map[string]bool{
+	"copy-on-write": true,
+	"incremental":   true,
 }
 
 func nodeNames(nodes []*apiv1.Node) []string {
@@ -236,6 +246,107 @@ func TestForking(t *testing.T) {
 	}
 }
 
+func TestNestedForking(t *testing.T) {
+	testCases := validTestCases(t)
+
+	otherNode := BuildTestNode("otherNode", 10, 100)
+	otherPod := BuildTestPod("otherPod", 1, 1)
+	otherPod.Spec.NodeName = otherNode.Name
+
+	for name, snapshotFactory := range snapshots {
+		if !nestedForkSnapshots[name] {
+			continue
+		}
+		for _, tc := range testCases {
+			// The outer fork adds a node with a pod, so that the inner fork
+			// modifies state of both the base and the outer fork.
+			outerState := snapshotState{
+				nodes: append([]*apiv1.Node{otherNode}, tc.state.nodes...),
+				pods:  append([]*apiv1.Pod{otherPod}, tc.state.pods...),
+			}
+			modifiedState := snapshotState{
+				nodes: append([]*apiv1.Node{otherNode}, tc.modifiedState.nodes...),
+				pods:  append([]*apiv1.Pod{otherPod}, tc.modifiedState.pods...),
+			}
+			startNestedFork := func(t *testing.T) ClusterSnapshot {
+				snapshot := startSnapshot(t, snapshotFactory, tc.state)
+				assert.NoError(t, snapshot.Fork())
+				assert.NoError(t, snapshot.AddNodeWithPods(otherNode, []*apiv1.Pod{otherPod}))
+				// Allow caches to be build.
+				_, err := snapshot.NodeInfos().List()
+				assert.NoError(t, err)
+				assert.NoError(t, snapshot.Fork())
+				tc.op(snapshot)
+				compareStates(t, modifiedState, getSnapshotState(t, snapshot))
+				return snapshot
+			}
+
+			t.Run(fmt.Sprintf("%s: %s nested fork & revert", name, tc.name), func(t *testing.T) {
+				snapshot := startNestedFork(t)
+
+				assert.NoError(t, snapshot.Revert())
+				compareStates(t, outerState, getSnapshotState(t, snapshot))
+
+				assert.NoError(t, snapshot.Revert())
+				compareStates(t, tc.state, getSnapshotState(t, snapshot))
+			})
+			t.Run(fmt.Sprintf("%s: %s nested fork, commit & revert", name, tc.name), func(t *testing.T) {
+				snapshot := startNestedFork(t)
+
+				assert.NoError(t, snapshot.Commit())
+				compareStates(t, modifiedState, getSnapshotState(t, snapshot))
+
+				assert.NoError(t, snapshot.Revert())
+				compareStates(t, tc.state, getSnapshotState(t, snapshot))
+			})
+			t.Run(fmt.Sprintf("%s: %s nested fork & commit twice", name, tc.name), func(t *testing.T) {
+				snapshot := startNestedFork(t)
+
+				assert.NoError(t, snapshot.Commit())
+				assert.NoError(t, snapshot.Commit())
+				compareStates(t, modifiedState, getSnapshotState(t, snapshot))
+
+				// Nothing is left to revert.
+				assert.NoError(t, snapshot.Revert())
+				compareStates(t, modifiedState, getSnapshotState(t, snapshot))
+			})
+		}
+	}
+}
+
+func TestCopyOnWriteSharesUnmodifiedNodeInfos(t *testing.T) {
+	nodes := createTestNodes(3)
+	pods := createTestPods(6)
+	assignPodsToNodes(pods, nodes)
+	snapshot := startSnapshot(t, func() ClusterSnapshot { return NewCopyOnWriteClusterSnapshot() }, snapshotState{nodes, pods}).(*CopyOnWriteClusterSnapshot)
+
+	base, err := snapshot.NodeInfos().Get(nodes[0].Name)
+	assert.NoError(t, err)
+	basePods := len(base.Pods)
+
+	assert.NoError(t, snapshot.Fork())
+	assert.NoError(t, snapshot.Fork())
+	assert.Equal(t, 2, snapshot.ForkDepth())
+
+	// Reads return node infos of the base.
+	forked, err := snapshot.NodeInfos().Get(nodes[0].Name)
+	assert.NoError(t, err)
+	assert.Same(t, base, forked)
+
+	// Writes modify a copy.
+	assert.NoError(t, snapshot.AddPod(BuildTestPod("new", 1, 1), nodes[0].Name))
+	forked, err = snapshot.NodeInfos().Get(nodes[0].Name)
+	assert.NoError(t, err)
+	assert.NotSame(t, base, forked)
+	assert.Equal(t, basePods+1, len(forked.Pods))
+	assert.Equal(t, basePods, len(base.Pods))
+
+	assert.NoError(t, snapshot.Revert())
+	assert.NoError(t, snapshot.Revert())
+	assert.Equal(t, 0, snapshot.ForkDepth())
+	compareStates(t, snapshotState{nodes, pods}, getSnapshotState(t, snapshot))
+}
+
 func TestClear(t *testing.T) {
 	// Run with -count=1 to avoid caching.
 	localRand := rand.New(rand.NewSource(time.Now().Unix()))
@@ -292,9 +403,13 @@ func TestClear(t *testing.T) {
 
 				compareStates(t, snapshotState{allNodes, allPods}, getSnapshotState(t, snapshot))
 
-				// Fork()ing twice is not allowed.
+				// Fork()ing twice is not allowed, unless forks can be nested.
 				err = snapshot.Fork()
-				assert.Error(t, err)
+				if nestedForkSnapshots[name] {
+					assert.NoError(t, err)
+				} else {
+					assert.Error(t, err)
+				}
 
 				snapshot.Clear()
 
@@ -464,3 +579,30 @@ func TestNodeAlreadyExists(t *testing.T) {
 		}
 	}
 }
+
+func TestCopyOnWriteCopy(t *testing.T) {
+	nodes := createTestNodes(3)
+	pods := createTestPods(6)
+	assignPodsToNodes(pods, nodes)
+	snapshot := startSnapshot(t, func() ClusterSnapshot { return NewCopyOnWriteClusterSnapshot() }, snapshotState{nodes, pods}).(*CopyOnWriteClusterSnapshot)
+	assert.NoError(t, snapshot.Fork())
+
+	copied := snapshot.Copy()
+	compareStates(t, snapshotState{nodes, pods}, getSnapshotState(t, copied))
+
+	// Modifications of the copy aren't visible in the original, also after Commit.
+	extraNode := BuildTestNode("extra", 10, 100)
+	assert.NoError(t, copied.AddNode(extraNode))
+	assert.NoError(t, copied.RemoveNode(nodes[0].Name))
+	assert.NoError(t, copied.Commit())
+	assert.NoError(t, copied.Revert())
+	var remainingPods []*apiv1.Pod
+	for _, pod := range pods {
+		if pod.Spec.NodeName != nodes[0].Name {
+			remainingPods = append(remainingPods, pod)
+		}
+	}
+	compareStates(t, snapshotState{[]*apiv1.Node{extraNode, nodes[1], nodes[2]}, remainingPods}, getSnapshotState(t, copied))
+	compareStates(t, snapshotState{nodes, pods}, getSnapshotState(t, snapshot))
+	assert.Equal(t, 1, snapshot.ForkDepth())
+}
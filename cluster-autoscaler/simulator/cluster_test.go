@@ -24,6 +24,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
 	policyv1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/drain"
 	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
@@ -46,7 +47,6 @@ func TestFindPlaceAllOk(t *testing.T) {
 	new2 := BuildTestPod("p3", 500, 500000)
 
 	oldHints := make(map[string]string)
-	newHints := make(map[string]string)
 	destinations := map[string]bool{
 		"n1": true,
 		"n2": true,
@@ -58,15 +58,15 @@ func TestFindPlaceAllOk(t *testing.T) {
 		[]*apiv1.Node{node1, node2},
 		[]*apiv1.Pod{pod1})
 
-	err = NewRemovalSimulator(nil, clusterSnapshot, predicateChecker, NewUsageTracker()).findPlaceFor(
+	placements, err := NewRemovalSimulator(nil, clusterSnapshot, predicateChecker, NewUsageTracker()).findPlaceFor(
 		"x",
 		[]*apiv1.Pod{new1, new2},
 		destinations,
-		oldHints, newHints, time.Now())
+		oldHints, time.Now())
 
-	assert.Len(t, newHints, 2)
-	assert.Contains(t, newHints, new1.Namespace+"/"+new1.Name)
-	assert.Contains(t, newHints, new2.Namespace+"/"+new2.Name)
+	assert.Len(t, placements, 2)
+	assert.Equal(t, new1.Namespace+"/"+new1.Name, placements[0].podKey)
+	assert.Equal(t, new2.Namespace+"/"+new2.Name, placements[1].podKey)
 	assert.NoError(t, err)
 }
 
@@ -83,7 +83,6 @@ func TestFindPlaceAllBas(t *testing.T) {
 	new3 := BuildTestPod("p4", 700, 500000)
 
 	oldHints := make(map[string]string)
-	newHints := make(map[string]string)
 	destinations := map[string]bool{
 		"nbad": true,
 		"n1":   true,
@@ -96,16 +95,16 @@ func TestFindPlaceAllBas(t *testing.T) {
 		[]*apiv1.Node{node1, node2},
 		[]*apiv1.Pod{pod1})
 
-	err = NewRemovalSimulator(nil, clusterSnapshot, predicateChecker, NewUsageTracker()).findPlaceFor(
+	placements, err := NewRemovalSimulator(nil, clusterSnapshot, predicateChecker, NewUsageTracker()).findPlaceFor(
 		"nbad",
 		[]*apiv1.Pod{new1, new2, new3},
 		destinations,
-		oldHints, newHints, time.Now())
+		oldHints, time.Now())
 
 	assert.Error(t, err)
-	assert.True(t, len(newHints) == 2)
-	assert.Contains(t, newHints, new1.Namespace+"/"+new1.Name)
-	assert.Contains(t, newHints, new2.Namespace+"/"+new2.Name)
+	assert.True(t, len(placements) == 2)
+	assert.Equal(t, new1.Namespace+"/"+new1.Name, placements[0].podKey)
+	assert.Equal(t, new2.Namespace+"/"+new2.Name, placements[1].podKey)
 }
 
 func TestFindNone(t *testing.T) {
@@ -129,12 +128,11 @@ func TestFindNone(t *testing.T) {
 		[]*apiv1.Node{node1, node2},
 		[]*apiv1.Pod{pod1})
 
-	err = NewRemovalSimulator(nil, clusterSnapshot, predicateChecker, NewUsageTracker()).findPlaceFor(
+	_, err = NewRemovalSimulator(nil, clusterSnapshot, predicateChecker, NewUsageTracker()).findPlaceFor(
 		"x",
 		[]*apiv1.Pod{},
 		destinations,
 		make(map[string]string),
-		make(map[string]string),
 		time.Now())
 	assert.NoError(t, err)
 }
@@ -320,3 +318,149 @@ func TestFindNodesToRemove(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckNodeDrain(t *testing.T) {
+	// two small pods backed by ReplicaSet, filling the node
+	drainableNode := BuildTestNode("n1", 200, 2000000)
+	// one small pod, not backed by anything
+	nonDrainableNode := BuildTestNode("n2", 1000, 2000000)
+	SetNodeReadyState(drainableNode, true, time.Time{})
+	SetNodeReadyState(nonDrainableNode, true, time.Time{})
+
+	replicas := int32(5)
+	replicaSets := []*appsv1.ReplicaSet{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "rs",
+				Namespace: "default",
+				SelfLink:  "api/v1/namespaces/default/replicasets/rs",
+			},
+			Spec: appsv1.ReplicaSetSpec{
+				Replicas: &replicas,
+			},
+		},
+	}
+	rsLister, err := kube_util.NewTestReplicaSetLister(replicaSets)
+	assert.NoError(t, err)
+	registry := kube_util.NewListerRegistry(nil, nil, nil, nil, nil, nil, nil, nil, rsLister, nil)
+
+	ownerRefs := GenerateOwnerReferences("rs", "ReplicaSet", "extensions/v1beta1", "")
+	pod1 := BuildTestPod("p1", 100, 100000)
+	pod1.OwnerReferences = ownerRefs
+	pod1.Spec.NodeName = "n1"
+	pod2 := BuildTestPod("p2", 100, 100000)
+	pod2.OwnerReferences = ownerRefs
+	pod2.Spec.NodeName = "n1"
+	pod3 := BuildTestPod("p3", 100, 100000)
+	pod3.Spec.NodeName = "n2"
+
+	clusterSnapshot := NewBasicClusterSnapshot()
+	InitializeClusterSnapshotOrDie(t, clusterSnapshot, []*apiv1.Node{drainableNode, nonDrainableNode}, []*apiv1.Pod{pod1, pod2, pod3})
+	predicateChecker, err := NewTestPredicateChecker()
+	assert.NoError(t, err)
+	r := NewRemovalSimulator(registry, clusterSnapshot, predicateChecker, NewUsageTracker())
+
+	// The pods have nowhere to go, but the node can still be drained.
+	toRemove, unremovable := r.CheckNodeDrain("n1", time.Now(), []*policyv1.PodDisruptionBudget{})
+	assert.Nil(t, unremovable)
+	assert.Equal(t, &NodeToBeRemoved{Node: drainableNode, PodsToReschedule: []*apiv1.Pod{pod1, pod2}, DaemonSetPods: []*apiv1.Pod{}}, toRemove)
+
+	toRemove, unremovable = r.CheckNodeDrain("n2", time.Now(), []*policyv1.PodDisruptionBudget{})
+	assert.Nil(t, toRemove)
+	assert.Equal(t, &UnremovableNode{Node: nonDrainableNode, Reason: BlockedByPod, BlockingPod: &drain.BlockingPod{Pod: pod3, Reason: drain.NotReplicated}}, unremovable)
+
+	toRemove, unremovable = r.CheckNodeDrain("n3", time.Now(), []*policyv1.PodDisruptionBudget{})
+	assert.Nil(t, toRemove)
+	if assert.NotNil(t, unremovable) {
+		assert.Equal(t, UnexpectedError, unremovable.Reason)
+	}
+}
+
+func TestFindNodesToRemoveInParallel(t *testing.T) {
+	replicas := int32(5)
+	replicaSets := []*appsv1.ReplicaSet{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "rs",
+				Namespace: "default",
+				SelfLink:  "api/v1/namespaces/default/replicasets/rs",
+			},
+			Spec: appsv1.ReplicaSetSpec{
+				Replicas: &replicas,
+			},
+		},
+	}
+	rsLister, err := kube_util.NewTestReplicaSetLister(replicaSets)
+	assert.NoError(t, err)
+	registry := kube_util.NewListerRegistry(nil, nil, nil, nil, nil, nil, nil, nil, rsLister, nil)
+	ownerRefs := GenerateOwnerReferences("rs", "ReplicaSet", "extensions/v1beta1", "")
+
+	// Candidates are full, so that their pods can only be moved to the sink
+	// node and the outcome doesn't depend on order of checks.
+	sink := BuildTestNode("sink", 100000, 2000000)
+	SetNodeReadyState(sink, true, time.Time{})
+	nodes := []*apiv1.Node{sink}
+	var pods []*apiv1.Pod
+	var candidates []string
+	destinations := []string{sink.Name}
+	oldHints := map[string]string{}
+	for i := 0; i < 40; i++ {
+		cpu := int64(1000)
+		if i%6 == 5 {
+			// Empty nodes are too small for any pod.
+			cpu = 100
+		}
+		node := BuildTestNode(fmt.Sprintf("n%d", i), cpu, 4000000)
+		SetNodeReadyState(node, true, time.Time{})
+		nodes = append(nodes, node)
+		candidates = append(candidates, node.Name)
+		if i%11 != 10 {
+			destinations = append(destinations, node.Name)
+		}
+		if i%6 == 5 {
+			continue
+		}
+		for j := 0; j < 2; j++ {
+			pod := BuildTestPod(fmt.Sprintf("p%d-%d", i, j), 500, 100000)
+			pod.Spec.NodeName = node.Name
+			if i%5 != 4 {
+				pod.OwnerReferences = ownerRefs
+			}
+			if i%7 == 6 && j == 1 {
+				// Too large for the sink.
+				pod.Spec.Containers[0].Resources.Requests[apiv1.ResourceMemory] = *resource.NewQuantity(3000000, resource.DecimalSI)
+			}
+			if i%3 == 0 {
+				oldHints[pod.Namespace+"/"+pod.Name] = sink.Name
+			}
+			pods = append(pods, pod)
+		}
+	}
+
+	testTime := time.Date(2020, time.December, 18, 17, 0, 0, 0, time.UTC)
+	findNodesToRemove := func(parallelism int) ([]NodeToBeRemoved, []*UnremovableNode, map[string]string, *UsageTracker) {
+		clusterSnapshot := NewCopyOnWriteClusterSnapshot()
+		InitializeClusterSnapshotOrDie(t, clusterSnapshot, nodes, pods)
+		predicateChecker, err := NewTestPredicateChecker()
+		assert.NoError(t, err)
+		tracker := NewUsageTracker()
+		r := NewRemovalSimulator(registry, clusterSnapshot, predicateChecker, tracker)
+		r.SetParallelism(parallelism)
+		toRemove, unremovable, newHints, err := r.FindNodesToRemove(candidates, destinations, oldHints, testTime, []*policyv1.PodDisruptionBudget{})
+		assert.NoError(t, err)
+		return toRemove, unremovable, newHints, tracker
+	}
+
+	toRemove, unremovable, newHints, tracker := findNodesToRemove(1)
+	assert.NotEmpty(t, toRemove)
+	assert.NotEmpty(t, unremovable)
+	for _, parallelism := range []int{2, 4, 64} {
+		t.Run(fmt.Sprintf("parallelism %d", parallelism), func(t *testing.T) {
+			parallelToRemove, parallelUnremovable, parallelNewHints, parallelTracker := findNodesToRemove(parallelism)
+			assert.Equal(t, toRemove, parallelToRemove)
+			assert.Equal(t, unremovable, parallelUnremovable)
+			assert.Equal(t, newHints, parallelNewHints)
+			assert.Equal(t, tracker, parallelTracker)
+		})
+	}
+}
@@ -0,0 +1,357 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simulator
+
+import (
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// CopyOnWriteClusterSnapshot is an implementation of ClusterSnapshot which
+// supports nested forks, for simulations running what-ifs within what-ifs.
+//
+// Each fork pushes a layer on a stack. A layer holds node infos added or
+// modified since the fork and names of removed nodes. Node infos of lower
+// layers are shared, and cloned into the top layer on their first
+// modification.
+//
+// Complexity of some notable operations:
+//	fork - O(1)
+//	revert - O(1)
+//	commit - O(number of nodes modified in the reverted layer)
+//	get node info - O(number of forks)
+//	list node infos - O(n), cached per layer
+//
+// Watch out for:
+//	node additions and deletions, pod additions & deletions - invalidate cache of the top layer.
+type CopyOnWriteClusterSnapshot struct {
+	layers []*copyOnWriteLayer
+	// shared is the number of bottom layers shared with the snapshot this
+	// one was copied from. They are never modified.
+	shared int
+}
+
+type copyOnWriteNodeLister CopyOnWriteClusterSnapshot
+
+type copyOnWriteLayer struct {
+	nodeInfos map[string]*schedulerframework.NodeInfo
+	// removed are nodes of lower layers removed in this layer. It's always
+	// empty in the base layer, which removes nodes from nodeInfos.
+	removed map[string]bool
+
+	nodeInfoList                     []*schedulerframework.NodeInfo
+	havePodsWithAffinity             []*schedulerframework.NodeInfo
+	havePodsWithRequiredAntiAffinity []*schedulerframework.NodeInfo
+}
+
+func newCopyOnWriteLayer() *copyOnWriteLayer {
+	return &copyOnWriteLayer{
+		nodeInfos: make(map[string]*schedulerframework.NodeInfo),
+		removed:   make(map[string]bool),
+	}
+}
+
+func (layer *copyOnWriteLayer) clearCaches() {
+	layer.nodeInfoList = nil
+	layer.havePodsWithAffinity = nil
+	layer.havePodsWithRequiredAntiAffinity = nil
+}
+
+// NewCopyOnWriteClusterSnapshot creates instances of CopyOnWriteClusterSnapshot.
+func NewCopyOnWriteClusterSnapshot() *CopyOnWriteClusterSnapshot {
+	snapshot := &CopyOnWriteClusterSnapshot{}
+	snapshot.Clear()
+	return snapshot
+}
+
+func (snapshot *CopyOnWriteClusterSnapshot) top() *copyOnWriteLayer {
+	return snapshot.layers[len(snapshot.layers)-1]
+}
+
+// getNodeInfoBelow returns the node info as seen by the layer with the given
+// index, along with the index of the layer holding it.
+func (snapshot *CopyOnWriteClusterSnapshot) getNodeInfoBelow(index int, nodeName string) (*schedulerframework.NodeInfo, int) {
+	for i := index; i >= 0; i-- {
+		layer := snapshot.layers[i]
+		if nodeInfo, found := layer.nodeInfos[nodeName]; found {
+			return nodeInfo, i
+		}
+		if layer.removed[nodeName] {
+			return nil, -1
+		}
+	}
+	return nil, -1
+}
+
+func (snapshot *CopyOnWriteClusterSnapshot) getNodeInfo(nodeName string) (*schedulerframework.NodeInfo, error) {
+	nodeInfo, _ := snapshot.getNodeInfoBelow(len(snapshot.layers)-1, nodeName)
+	if nodeInfo == nil {
+		return nil, errNodeNotFound
+	}
+	return nodeInfo, nil
+}
+
+// getNodeInfoForUpdate returns the node info owned by the top layer, cloning
+// it from a lower layer if needed.
+func (snapshot *CopyOnWriteClusterSnapshot) getNodeInfoForUpdate(nodeName string) (*schedulerframework.NodeInfo, error) {
+	topIndex := len(snapshot.layers) - 1
+	nodeInfo, index := snapshot.getNodeInfoBelow(topIndex, nodeName)
+	if nodeInfo == nil {
+		return nil, errNodeNotFound
+	}
+	top := snapshot.top()
+	if index != topIndex {
+		nodeInfo = nodeInfo.Clone()
+		top.nodeInfos[nodeName] = nodeInfo
+	}
+	top.clearCaches()
+	return nodeInfo, nil
+}
+
+// AddNode adds node to the snapshot.
+func (snapshot *CopyOnWriteClusterSnapshot) AddNode(node *apiv1.Node) error {
+	if nodeInfo, _ := snapshot.getNodeInfo(node.Name); nodeInfo != nil {
+		return fmt.Errorf("node %s already in snapshot", node.Name)
+	}
+	nodeInfo := schedulerframework.NewNodeInfo()
+	nodeInfo.SetNode(node)
+	top := snapshot.top()
+	top.nodeInfos[node.Name] = nodeInfo
+	delete(top.removed, node.Name)
+	top.clearCaches()
+	return nil
+}
+
+// AddNodes adds nodes in batch to the snapshot.
+func (snapshot *CopyOnWriteClusterSnapshot) AddNodes(nodes []*apiv1.Node) error {
+	for _, node := range nodes {
+		if err := snapshot.AddNode(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddNodeWithPods adds a node and set of pods to be scheduled to this node to the snapshot.
+func (snapshot *CopyOnWriteClusterSnapshot) AddNodeWithPods(node *apiv1.Node, pods []*apiv1.Pod) error {
+	if err := snapshot.AddNode(node); err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		if err := snapshot.AddPod(pod, node.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveNode removes nodes (and pods scheduled to it) from the snapshot.
+func (snapshot *CopyOnWriteClusterSnapshot) RemoveNode(nodeName string) error {
+	topIndex := len(snapshot.layers) - 1
+	if nodeInfo, _ := snapshot.getNodeInfoBelow(topIndex, nodeName); nodeInfo == nil {
+		return errNodeNotFound
+	}
+	top := snapshot.top()
+	delete(top.nodeInfos, nodeName)
+	if topIndex > 0 {
+		if nodeInfo, _ := snapshot.getNodeInfoBelow(topIndex-1, nodeName); nodeInfo != nil {
+			top.removed[nodeName] = true
+		}
+	}
+	top.clearCaches()
+	return nil
+}
+
+// AddPod adds pod to the snapshot and schedules it to given node.
+func (snapshot *CopyOnWriteClusterSnapshot) AddPod(pod *apiv1.Pod, nodeName string) error {
+	nodeInfo, err := snapshot.getNodeInfoForUpdate(nodeName)
+	if err != nil {
+		return err
+	}
+	nodeInfo.AddPod(pod)
+	return nil
+}
+
+// RemovePod removes pod from the snapshot.
+func (snapshot *CopyOnWriteClusterSnapshot) RemovePod(namespace, podName, nodeName string) error {
+	nodeInfo, err := snapshot.getNodeInfo(nodeName)
+	if err != nil {
+		return err
+	}
+	for _, podInfo := range nodeInfo.Pods {
+		if podInfo.Pod.Namespace == namespace && podInfo.Pod.Name == podName {
+			nodeInfo, err = snapshot.getNodeInfoForUpdate(nodeName)
+			if err != nil {
+				return err
+			}
+			if err := nodeInfo.RemovePod(podInfo.Pod); err != nil {
+				return fmt.Errorf("cannot remove pod; %v", err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("pod %s/%s not in snapshot", namespace, podName)
+}
+
+// Fork creates a fork of snapshot state. All modifications can later be reverted to moment of forking via Revert().
+// Forks can be nested: Revert and Commit apply to the most recent fork.
+func (snapshot *CopyOnWriteClusterSnapshot) Fork() error {
+	snapshot.layers = append(snapshot.layers, newCopyOnWriteLayer())
+	return nil
+}
+
+// Revert reverts snapshot state to moment of the most recent forking.
+func (snapshot *CopyOnWriteClusterSnapshot) Revert() error {
+	if len(snapshot.layers) > snapshot.shared+1 {
+		snapshot.layers = snapshot.layers[:len(snapshot.layers)-1]
+	}
+	return nil
+}
+
+// Commit commits changes done after the most recent forking into the state it was forked from.
+func (snapshot *CopyOnWriteClusterSnapshot) Commit() error {
+	if len(snapshot.layers) == snapshot.shared+1 {
+		// do nothing
+		return nil
+	}
+	committed := snapshot.top()
+	snapshot.layers = snapshot.layers[:len(snapshot.layers)-1]
+	parentIndex := len(snapshot.layers) - 1
+	parent := snapshot.top()
+	for nodeName := range committed.removed {
+		delete(parent.nodeInfos, nodeName)
+		if parentIndex > 0 {
+			if nodeInfo, _ := snapshot.getNodeInfoBelow(parentIndex-1, nodeName); nodeInfo != nil {
+				parent.removed[nodeName] = true
+			}
+		}
+	}
+	for nodeName, nodeInfo := range committed.nodeInfos {
+		parent.nodeInfos[nodeName] = nodeInfo
+		delete(parent.removed, nodeName)
+	}
+	parent.clearCaches()
+	return nil
+}
+
+// Clear reset cluster snapshot to empty, unforked state
+func (snapshot *CopyOnWriteClusterSnapshot) Clear() {
+	snapshot.layers = []*copyOnWriteLayer{newCopyOnWriteLayer()}
+	snapshot.shared = 0
+}
+
+// Copy returns a snapshot with the current state of this one. Node infos are
+// shared with this snapshot, so Copy is O(number of forks). Copies can be
+// modified concurrently with each other, as long as this snapshot isn't
+// modified until they're no longer used. Commit and Revert on a copy never
+// reach state of this snapshot.
+func (snapshot *CopyOnWriteClusterSnapshot) Copy() ClusterSnapshot {
+	// Build node info lists of all layers, so that copies only read them.
+	snapshot.listNodeInfos(len(snapshot.layers) - 1)
+	layers := make([]*copyOnWriteLayer, len(snapshot.layers), len(snapshot.layers)+1)
+	copy(layers, snapshot.layers)
+	return &CopyOnWriteClusterSnapshot{
+		layers: append(layers, newCopyOnWriteLayer()),
+		shared: len(layers),
+	}
+}
+
+// ForkDepth returns the number of forks which weren't reverted nor committed yet.
+func (snapshot *CopyOnWriteClusterSnapshot) ForkDepth() int {
+	return len(snapshot.layers) - snapshot.shared - 1
+}
+
+// listNodeInfos returns node infos seen by the layer with the given index. The
+// list is built from the list of the layer below, which stays valid as long
+// as the layer is forked.
+func (snapshot *CopyOnWriteClusterSnapshot) listNodeInfos(index int) []*schedulerframework.NodeInfo {
+	layer := snapshot.layers[index]
+	if layer.nodeInfoList != nil {
+		return layer.nodeInfoList
+	}
+	var nodeInfoList []*schedulerframework.NodeInfo
+	if index == 0 {
+		nodeInfoList = make([]*schedulerframework.NodeInfo, 0, len(layer.nodeInfos))
+	} else {
+		lowerList := snapshot.listNodeInfos(index - 1)
+		nodeInfoList = make([]*schedulerframework.NodeInfo, 0, len(lowerList)+len(layer.nodeInfos))
+		for _, nodeInfo := range lowerList {
+			nodeName := nodeInfo.Node().Name
+			if _, found := layer.nodeInfos[nodeName]; found || layer.removed[nodeName] {
+				continue
+			}
+			nodeInfoList = append(nodeInfoList, nodeInfo)
+		}
+	}
+	for _, nodeInfo := range layer.nodeInfos {
+		nodeInfoList = append(nodeInfoList, nodeInfo)
+	}
+	layer.nodeInfoList = nodeInfoList
+	return nodeInfoList
+}
+
+// implementation of SharedLister interface
+
+// NodeInfos exposes snapshot as NodeInfoLister.
+func (snapshot *CopyOnWriteClusterSnapshot) NodeInfos() schedulerframework.NodeInfoLister {
+	return (*copyOnWriteNodeLister)(snapshot)
+}
+
+// List returns the list of nodes in the snapshot.
+func (snapshot *copyOnWriteNodeLister) List() ([]*schedulerframework.NodeInfo, error) {
+	s := (*CopyOnWriteClusterSnapshot)(snapshot)
+	return s.listNodeInfos(len(s.layers) - 1), nil
+}
+
+// HavePodsWithAffinityList returns the list of nodes with at least one pods with inter-pod affinity
+func (snapshot *copyOnWriteNodeLister) HavePodsWithAffinityList() ([]*schedulerframework.NodeInfo, error) {
+	s := (*CopyOnWriteClusterSnapshot)(snapshot)
+	top := s.top()
+	if top.havePodsWithAffinity == nil {
+		nodeInfoList := s.listNodeInfos(len(s.layers) - 1)
+		top.havePodsWithAffinity = make([]*schedulerframework.NodeInfo, 0, len(nodeInfoList))
+		for _, nodeInfo := range nodeInfoList {
+			if len(nodeInfo.PodsWithAffinity) > 0 {
+				top.havePodsWithAffinity = append(top.havePodsWithAffinity, nodeInfo)
+			}
+		}
+	}
+	return top.havePodsWithAffinity, nil
+}
+
+// HavePodsWithRequiredAntiAffinityList returns the list of NodeInfos of nodes with pods with required anti-affinity terms.
+func (snapshot *copyOnWriteNodeLister) HavePodsWithRequiredAntiAffinityList() ([]*schedulerframework.NodeInfo, error) {
+	s := (*CopyOnWriteClusterSnapshot)(snapshot)
+	top := s.top()
+	if top.havePodsWithRequiredAntiAffinity == nil {
+		nodeInfoList := s.listNodeInfos(len(s.layers) - 1)
+		top.havePodsWithRequiredAntiAffinity = make([]*schedulerframework.NodeInfo, 0, len(nodeInfoList))
+		for _, nodeInfo := range nodeInfoList {
+			if len(nodeInfo.PodsWithRequiredAntiAffinity) > 0 {
+				top.havePodsWithRequiredAntiAffinity = append(top.havePodsWithRequiredAntiAffinity, nodeInfo)
+			}
+		}
+	}
+	return top.havePodsWithRequiredAntiAffinity, nil
+}
+
+// Get returns node info by node name.
+func (snapshot *copyOnWriteNodeLister) Get(nodeName string) (*schedulerframework.NodeInfo, error) {
+	return (*CopyOnWriteClusterSnapshot)(snapshot).getNodeInfo(nodeName)
+}
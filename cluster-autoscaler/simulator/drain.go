@@ -22,6 +22,7 @@ import (
 
 	apiv1 "k8s.io/api/core/v1"
 	policyv1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/drain"
@@ -45,6 +46,7 @@ func FastGetPodsToMove(nodeInfo *schedulerframework.NodeInfo, skipNodesWithSyste
 		pdbs,
 		skipNodesWithSystemPods,
 		skipNodesWithLocalStorage,
+		nil,
 		false,
 		nil,
 		0,
@@ -64,9 +66,10 @@ func FastGetPodsToMove(nodeInfo *schedulerframework.NodeInfo, skipNodesWithSyste
 // and a list of DaemonSet pods that should be evicted if the node
 // is drained. Raises error if there is an unreplicated pod.
 // Based on kubectl drain code. It checks whether RC, DS, Jobs and RS that created these pods
-// still exist.
+// still exist. Pods with local storage may be moved if it only consists of emptyDir volumes
+// annotated as safe to evict and not larger than maxEvictableEmptyDirSize.
 func DetailedGetPodsForMove(nodeInfo *schedulerframework.NodeInfo, skipNodesWithSystemPods bool,
-	skipNodesWithLocalStorage bool, listers kube_util.ListerRegistry, minReplicaCount int32,
+	skipNodesWithLocalStorage bool, maxEvictableEmptyDirSize *resource.Quantity, listers kube_util.ListerRegistry, minReplicaCount int32,
 	pdbs []*policyv1.PodDisruptionBudget, timestamp time.Time) (pods []*apiv1.Pod, daemonSetPods []*apiv1.Pod, blockingPod *drain.BlockingPod, err error) {
 	for _, podInfo := range nodeInfo.Pods {
 		pods = append(pods, podInfo.Pod)
@@ -76,6 +79,7 @@ func DetailedGetPodsForMove(nodeInfo *schedulerframework.NodeInfo, skipNodesWith
 		pdbs,
 		skipNodesWithSystemPods,
 		skipNodesWithLocalStorage,
+		maxEvictableEmptyDirSize,
 		true,
 		listers,
 		minReplicaCount,
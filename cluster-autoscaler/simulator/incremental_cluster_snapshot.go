@@ -0,0 +1,303 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simulator
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	klog "k8s.io/klog/v2"
+)
+
+// IncrementalClusterSnapshot is a CopyOnWriteClusterSnapshot keeping its base
+// state across autoscaler loops. Instead of clearing and rebuilding the
+// snapshot, Sync updates the base with changes since the previous loop and
+// forks it, so that each loop works on a fork of the base.
+//
+// Changes of scheduled pods are passed as informer events, through the
+// cache.ResourceEventHandler methods. Nodes are compared by identity with the
+// list passed to Sync, as the autoscaler processes nodes listed from the API
+// before adding them to the snapshot.
+//
+// Pods are also passed to Sync. Their count is compared with the base on every
+// Sync, while the pods themselves are only compared once in resyncInterval. On
+// any difference, e.g. due to events delivered later than the list was taken,
+// the base is rebuilt from the lists.
+type IncrementalClusterSnapshot struct {
+	*CopyOnWriteClusterSnapshot
+	podFilter      func(*apiv1.Pod) bool
+	resyncInterval time.Duration
+
+	mutex sync.Mutex
+	// changedPods are pods changed since the last Sync by their keys. Deleted
+	// pods have nil values.
+	changedPods map[string]*apiv1.Pod
+
+	initialized bool
+	lastResync  time.Time
+	nodes       map[string]*apiv1.Node
+	// podsByNode are all known scheduled pods, also ones scheduled to nodes
+	// which aren't in the snapshot.
+	podsByNode map[string]map[string]*apiv1.Pod
+	podNodes   map[string]string
+}
+
+// NewIncrementalClusterSnapshot creates instances of IncrementalClusterSnapshot.
+// Only pods passing podFilter, if set, are added to the snapshot.
+func NewIncrementalClusterSnapshot(podFilter func(*apiv1.Pod) bool, resyncInterval time.Duration) *IncrementalClusterSnapshot {
+	snapshot := &IncrementalClusterSnapshot{
+		CopyOnWriteClusterSnapshot: NewCopyOnWriteClusterSnapshot(),
+		podFilter:                  podFilter,
+		resyncInterval:             resyncInterval,
+		changedPods:                make(map[string]*apiv1.Pod),
+	}
+	snapshot.Clear()
+	return snapshot
+}
+
+// SetPodFilter replaces the filter of pods added to the snapshot. As pods
+// already in the snapshot passed the previous filter, the next Sync rebuilds
+// the snapshot from scratch.
+func (snapshot *IncrementalClusterSnapshot) SetPodFilter(podFilter func(*apiv1.Pod) bool) {
+	snapshot.podFilter = podFilter
+	snapshot.Clear()
+}
+
+// Clear reset cluster snapshot to empty, unforked state. The next Sync
+// rebuilds the snapshot from scratch.
+func (snapshot *IncrementalClusterSnapshot) Clear() {
+	snapshot.CopyOnWriteClusterSnapshot.Clear()
+	snapshot.initialized = false
+	snapshot.nodes = make(map[string]*apiv1.Node)
+	snapshot.podsByNode = make(map[string]map[string]*apiv1.Pod)
+	snapshot.podNodes = make(map[string]string)
+}
+
+// Sync reverts all forks, brings the base up to date with the given nodes
+// and pod changes received since the previous call, and forks it. Scheduled
+// pods are only used to rebuild the snapshot and to check it for drift.
+func (snapshot *IncrementalClusterSnapshot) Sync(nodes []*apiv1.Node, scheduledPods []*apiv1.Pod, now time.Time) error {
+	for snapshot.ForkDepth() > 0 {
+		if err := snapshot.Revert(); err != nil {
+			return err
+		}
+	}
+
+	snapshot.mutex.Lock()
+	changedPods := snapshot.changedPods
+	snapshot.changedPods = make(map[string]*apiv1.Pod)
+	snapshot.mutex.Unlock()
+
+	if !snapshot.initialized {
+		if err := snapshot.rebuild(nodes, scheduledPods, now); err != nil {
+			return err
+		}
+		return snapshot.Fork()
+	}
+
+	if err := snapshot.update(nodes, changedPods); err != nil {
+		return err
+	}
+	drift := ""
+	if now.Sub(snapshot.lastResync) >= snapshot.resyncInterval {
+		drift = snapshot.drift(scheduledPods)
+		snapshot.lastResync = now
+	} else if len(scheduledPods) != len(snapshot.podNodes) {
+		drift = fmt.Sprintf("%d pods known, %d listed", len(snapshot.podNodes), len(scheduledPods))
+	}
+	if drift != "" {
+		klog.Warningf("Cluster snapshot drifted from the cluster state (%s), rebuilding it", drift)
+		if err := snapshot.rebuild(nodes, scheduledPods, now); err != nil {
+			return err
+		}
+	}
+	return snapshot.Fork()
+}
+
+func (snapshot *IncrementalClusterSnapshot) rebuild(nodes []*apiv1.Node, scheduledPods []*apiv1.Pod, now time.Time) error {
+	snapshot.Clear()
+	for _, pod := range scheduledPods {
+		snapshot.setPod(podKey(pod), pod)
+	}
+	for _, node := range nodes {
+		if err := snapshot.addNode(node); err != nil {
+			return err
+		}
+	}
+	snapshot.initialized = true
+	snapshot.lastResync = now
+	return nil
+}
+
+func (snapshot *IncrementalClusterSnapshot) update(nodes []*apiv1.Node, changedPods map[string]*apiv1.Pod) error {
+	changedNodes := make(map[string]bool)
+	for key, pod := range changedPods {
+		if nodeName, found := snapshot.podNodes[key]; found {
+			changedNodes[nodeName] = true
+		}
+		if pod != nil && snapshot.podFilter != nil && !snapshot.podFilter(pod) {
+			pod = nil
+		}
+		snapshot.setPod(key, pod)
+		if pod != nil {
+			changedNodes[pod.Spec.NodeName] = true
+		}
+	}
+
+	currentNodes := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		currentNodes[node.Name] = true
+		if oldNode, found := snapshot.nodes[node.Name]; found {
+			if oldNode == node && !changedNodes[node.Name] {
+				continue
+			}
+			if err := snapshot.removeNode(node.Name); err != nil {
+				return err
+			}
+		}
+		if err := snapshot.addNode(node); err != nil {
+			return err
+		}
+	}
+	for nodeName := range snapshot.nodes {
+		if !currentNodes[nodeName] {
+			if err := snapshot.removeNode(nodeName); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// drift describes differences between pods in the snapshot and the given
+// scheduled pods. Returns an empty string if there are none.
+func (snapshot *IncrementalClusterSnapshot) drift(scheduledPods []*apiv1.Pod) string {
+	missing, stale := 0, 0
+	keys := make(map[string]bool, len(scheduledPods))
+	for _, pod := range scheduledPods {
+		key := podKey(pod)
+		keys[key] = true
+		nodeName, found := snapshot.podNodes[key]
+		if !found {
+			missing++
+			continue
+		}
+		known := snapshot.podsByNode[nodeName][key]
+		if known.UID != pod.UID || known.ResourceVersion != pod.ResourceVersion || nodeName != pod.Spec.NodeName {
+			stale++
+		}
+	}
+	extra := 0
+	for key := range snapshot.podNodes {
+		if !keys[key] {
+			extra++
+		}
+	}
+	if missing == 0 && stale == 0 && extra == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d pods missing, %d stale, %d extra", missing, stale, extra)
+}
+
+// setPod sets the known version of a pod, removing the pod if it's nil.
+func (snapshot *IncrementalClusterSnapshot) setPod(key string, pod *apiv1.Pod) {
+	if nodeName, found := snapshot.podNodes[key]; found {
+		delete(snapshot.podsByNode[nodeName], key)
+		if len(snapshot.podsByNode[nodeName]) == 0 {
+			delete(snapshot.podsByNode, nodeName)
+		}
+		delete(snapshot.podNodes, key)
+	}
+	if pod == nil {
+		return
+	}
+	nodePods, found := snapshot.podsByNode[pod.Spec.NodeName]
+	if !found {
+		nodePods = make(map[string]*apiv1.Pod)
+		snapshot.podsByNode[pod.Spec.NodeName] = nodePods
+	}
+	nodePods[key] = pod
+	snapshot.podNodes[key] = pod.Spec.NodeName
+}
+
+func (snapshot *IncrementalClusterSnapshot) addNode(node *apiv1.Node) error {
+	nodePods := snapshot.podsByNode[node.Name]
+	keys := make([]string, 0, len(nodePods))
+	for key := range nodePods {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pods := make([]*apiv1.Pod, 0, len(keys))
+	for _, key := range keys {
+		pods = append(pods, nodePods[key])
+	}
+	if err := snapshot.CopyOnWriteClusterSnapshot.AddNodeWithPods(node, pods); err != nil {
+		return err
+	}
+	snapshot.nodes[node.Name] = node
+	return nil
+}
+
+func (snapshot *IncrementalClusterSnapshot) removeNode(nodeName string) error {
+	if err := snapshot.CopyOnWriteClusterSnapshot.RemoveNode(nodeName); err != nil {
+		return err
+	}
+	delete(snapshot.nodes, nodeName)
+	return nil
+}
+
+func (snapshot *IncrementalClusterSnapshot) podChanged(pod *apiv1.Pod, deleted bool) {
+	snapshot.mutex.Lock()
+	defer snapshot.mutex.Unlock()
+	if deleted || pod.Spec.NodeName == "" || pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed {
+		snapshot.changedPods[podKey(pod)] = nil
+		return
+	}
+	snapshot.changedPods[podKey(pod)] = pod
+}
+
+// OnAdd records a pod added to the cluster.
+func (snapshot *IncrementalClusterSnapshot) OnAdd(obj interface{}) {
+	if pod, ok := obj.(*apiv1.Pod); ok {
+		snapshot.podChanged(pod, false)
+	}
+}
+
+// OnUpdate records a pod updated in the cluster.
+func (snapshot *IncrementalClusterSnapshot) OnUpdate(oldObj, newObj interface{}) {
+	if pod, ok := newObj.(*apiv1.Pod); ok {
+		snapshot.podChanged(pod, false)
+	}
+}
+
+// OnDelete records a pod deleted from the cluster.
+func (snapshot *IncrementalClusterSnapshot) OnDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if pod, ok := obj.(*apiv1.Pod); ok {
+		snapshot.podChanged(pod, true)
+	}
+}
+
+func podKey(pod *apiv1.Pod) string {
+	return fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+}
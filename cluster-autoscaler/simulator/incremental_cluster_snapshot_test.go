@@ -0,0 +1,140 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildScheduledTestPod(name, nodeName string) *apiv1.Pod {
+	pod := BuildTestPod(name, 1, 1)
+	pod.Spec.NodeName = nodeName
+	pod.ResourceVersion = "1"
+	return pod
+}
+
+func TestIncrementalClusterSnapshotSync(t *testing.T) {
+	now := time.Now()
+	n1 := BuildTestNode("n1", 1000, 1000)
+	n2 := BuildTestNode("n2", 1000, 1000)
+	n3 := BuildTestNode("n3", 1000, 1000)
+	p1 := buildScheduledTestPod("p1", "n1")
+	p2 := buildScheduledTestPod("p2", "n2")
+	p3 := buildScheduledTestPod("p3", "n3")
+
+	snapshot := NewIncrementalClusterSnapshot(func(*apiv1.Pod) bool { return true }, time.Hour)
+	assert.NoError(t, snapshot.Sync([]*apiv1.Node{n1, n2}, []*apiv1.Pod{p1, p2, p3}, now))
+	compareStates(t, snapshotState{[]*apiv1.Node{n1, n2}, []*apiv1.Pod{p1, p2}}, getSnapshotState(t, snapshot))
+	n1Info, err := snapshot.NodeInfos().Get("n1")
+	assert.NoError(t, err)
+
+	// Changes done during a loop are reverted by the next Sync.
+	assert.NoError(t, snapshot.AddPod(BuildTestPod("tmp", 1, 1), "n1"))
+	assert.NoError(t, snapshot.RemoveNode("n2"))
+
+	// p2 moves to n3, which appears, and p4 is added to n2.
+	movedP2 := buildScheduledTestPod("p2", "n3")
+	movedP2.ResourceVersion = "2"
+	p4 := buildScheduledTestPod("p4", "n2")
+	snapshot.OnUpdate(p2, movedP2)
+	snapshot.OnAdd(p4)
+	assert.NoError(t, snapshot.Sync([]*apiv1.Node{n1, n2, n3}, []*apiv1.Pod{p1, movedP2, p3, p4}, now.Add(time.Minute)))
+	compareStates(t, snapshotState{[]*apiv1.Node{n1, n2, n3}, []*apiv1.Pod{p1, movedP2, p3, p4}}, getSnapshotState(t, snapshot))
+	assert.Equal(t, 1, snapshot.ForkDepth())
+
+	// Unchanged nodes aren't rebuilt.
+	unchangedN1Info, err := snapshot.NodeInfos().Get("n1")
+	assert.NoError(t, err)
+	assert.Same(t, n1Info, unchangedN1Info)
+
+	// p3 terminates, p4 is deleted, n1 is removed and n2 is updated.
+	terminatedP3 := buildScheduledTestPod("p3", "n3")
+	terminatedP3.Status.Phase = apiv1.PodSucceeded
+	updatedN2 := BuildTestNode("n2", 2000, 1000)
+	snapshot.OnUpdate(p3, terminatedP3)
+	snapshot.OnDelete(cache.DeletedFinalStateUnknown{Key: "default/p4", Obj: p4})
+	assert.NoError(t, snapshot.Sync([]*apiv1.Node{updatedN2, n3}, []*apiv1.Pod{p1, movedP2}, now.Add(2*time.Minute)))
+	compareStates(t, snapshotState{[]*apiv1.Node{updatedN2, n3}, []*apiv1.Pod{movedP2}}, getSnapshotState(t, snapshot))
+
+	// n1 comes back with its pod.
+	assert.NoError(t, snapshot.Sync([]*apiv1.Node{n1, updatedN2, n3}, []*apiv1.Pod{p1, movedP2}, now.Add(3*time.Minute)))
+	compareStates(t, snapshotState{[]*apiv1.Node{n1, updatedN2, n3}, []*apiv1.Pod{p1, movedP2}}, getSnapshotState(t, snapshot))
+}
+
+func TestIncrementalClusterSnapshotPodFilter(t *testing.T) {
+	now := time.Now()
+	n1 := BuildTestNode("n1", 1000, 1000)
+	p1 := buildScheduledTestPod("p1", "n1")
+	expendable := buildScheduledTestPod("expendable", "n1")
+
+	snapshot := NewIncrementalClusterSnapshot(func(pod *apiv1.Pod) bool { return pod.Name != expendable.Name }, time.Hour)
+	assert.NoError(t, snapshot.Sync([]*apiv1.Node{n1}, []*apiv1.Pod{}, now))
+	snapshot.OnAdd(p1)
+	snapshot.OnAdd(expendable)
+	assert.NoError(t, snapshot.Sync([]*apiv1.Node{n1}, []*apiv1.Pod{p1}, now.Add(time.Minute)))
+	compareStates(t, snapshotState{[]*apiv1.Node{n1}, []*apiv1.Pod{p1}}, getSnapshotState(t, snapshot))
+
+	// A new filter rebuilds the snapshot from the listed pods.
+	snapshot.SetPodFilter(func(*apiv1.Pod) bool { return true })
+	assert.NoError(t, snapshot.Sync([]*apiv1.Node{n1}, []*apiv1.Pod{p1, expendable}, now.Add(2*time.Minute)))
+	compareStates(t, snapshotState{[]*apiv1.Node{n1}, []*apiv1.Pod{p1, expendable}}, getSnapshotState(t, snapshot))
+}
+
+func TestIncrementalClusterSnapshotResync(t *testing.T) {
+	now := time.Now()
+	n1 := BuildTestNode("n1", 1000, 1000)
+	p1 := buildScheduledTestPod("p1", "n1")
+	p2 := buildScheduledTestPod("p2", "n1")
+	updatedP1 := buildScheduledTestPod("p1", "n1")
+	updatedP1.ResourceVersion = "2"
+
+	snapshot := NewIncrementalClusterSnapshot(func(*apiv1.Pod) bool { return true }, 10*time.Minute)
+	assert.NoError(t, snapshot.Sync([]*apiv1.Node{n1}, []*apiv1.Pod{p1}, now))
+
+	// The update of p1 was missed, which is only detected once the resync
+	// interval passes.
+	assert.NoError(t, snapshot.Sync([]*apiv1.Node{n1}, []*apiv1.Pod{updatedP1}, now.Add(5*time.Minute)))
+	compareStates(t, snapshotState{[]*apiv1.Node{n1}, []*apiv1.Pod{p1}}, getSnapshotState(t, snapshot))
+
+	assert.NoError(t, snapshot.Sync([]*apiv1.Node{n1}, []*apiv1.Pod{updatedP1}, now.Add(10*time.Minute)))
+	compareStates(t, snapshotState{[]*apiv1.Node{n1}, []*apiv1.Pod{updatedP1}}, getSnapshotState(t, snapshot))
+
+	// Events of p2 were missed, which changes the pod count and is detected
+	// right away.
+	assert.NoError(t, snapshot.Sync([]*apiv1.Node{n1}, []*apiv1.Pod{updatedP1, p2}, now.Add(11*time.Minute)))
+	compareStates(t, snapshotState{[]*apiv1.Node{n1}, []*apiv1.Pod{updatedP1, p2}}, getSnapshotState(t, snapshot))
+}
+
+func TestIncrementalClusterSnapshotWithoutPodFilter(t *testing.T) {
+	now := time.Now()
+	n1 := BuildTestNode("n1", 1000, 1000)
+	p1 := buildScheduledTestPod("p1", "n1")
+
+	snapshot := NewIncrementalClusterSnapshot(nil, time.Hour)
+	assert.NoError(t, snapshot.Sync([]*apiv1.Node{n1}, nil, now))
+	snapshot.OnAdd(p1)
+	assert.NoError(t, snapshot.Sync([]*apiv1.Node{n1}, []*apiv1.Pod{p1}, now.Add(time.Minute)))
+	compareStates(t, snapshotState{[]*apiv1.Node{n1}, []*apiv1.Pod{p1}}, getSnapshotState(t, snapshot))
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simulator
+
+import (
+	"sort"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	klog "k8s.io/klog/v2"
+)
+
+// PodReservation records that a node group was scaled up for a pending pod.
+type PodReservation struct {
+	// NodeGroupId is the id of the node group scaled up for the pod.
+	NodeGroupId string
+	// ExpireTime is the time after which the reservation is released, even
+	// if the node didn't register.
+	ExpireTime time.Time
+	// node identifies the new node the pod was packed on by the estimator,
+	// increasing across scale-ups.
+	node int
+}
+
+// PodReservations remember which pending pods upcoming nodes were provisioned
+// for, so that other pending pods don't claim their capacity in simulations
+// and the original pods don't trigger another scale-up.
+type PodReservations struct {
+	reservations map[types.UID]PodReservation
+	nextNode     int
+	// upcomingNodes are names of upcoming nodes in the cluster snapshot by node groups.
+	upcomingNodes map[string][]string
+	// reservedNodes are names of upcoming nodes matched with reserved nodes.
+	reservedNodes map[int]string
+}
+
+// NewPodReservations creates an instance of PodReservations.
+func NewPodReservations() *PodReservations {
+	return &PodReservations{
+		reservations:  make(map[types.UID]PodReservation),
+		upcomingNodes: make(map[string][]string),
+		reservedNodes: make(map[int]string),
+	}
+}
+
+// Reserve reserves upcoming nodes of the node group for pods. Each element
+// of podsPerNode are pods packed on a single new node.
+func (r *PodReservations) Reserve(nodeGroupId string, podsPerNode [][]*apiv1.Pod, expireTime time.Time) {
+	for _, pods := range podsPerNode {
+		for _, pod := range pods {
+			r.reservations[pod.UID] = PodReservation{
+				NodeGroupId: nodeGroupId,
+				ExpireTime:  expireTime,
+				node:        r.nextNode,
+			}
+		}
+		r.nextNode++
+	}
+	r.matchNodes()
+}
+
+// Get returns the reservation of the pod, if there's one.
+func (r *PodReservations) Get(pod *apiv1.Pod) (PodReservation, bool) {
+	reservation, found := r.reservations[pod.UID]
+	return reservation, found
+}
+
+// ReservedNode returns the name of the upcoming node in the cluster snapshot
+// reserved for the pod, if there's one.
+func (r *PodReservations) ReservedNode(pod *apiv1.Pod) (string, bool) {
+	reservation, found := r.reservations[pod.UID]
+	if !found {
+		return "", false
+	}
+	nodeName, found := r.reservedNodes[reservation.node]
+	return nodeName, found
+}
+
+// Update sets upcoming nodes of node groups and releases expired
+// reservations. As it isn't known which of the upcoming nodes registered,
+// other reservations are only released once their pods aren't pending.
+func (r *PodReservations) Update(upcomingNodes map[string][]string, now time.Time) {
+	r.upcomingNodes = upcomingNodes
+	for uid, reservation := range r.reservations {
+		if !now.Before(reservation.ExpireTime) {
+			klog.V(4).Infof("Reservation of pod %s in node group %s expired", uid, reservation.NodeGroupId)
+			delete(r.reservations, uid)
+		}
+	}
+	r.matchNodes()
+}
+
+// Retain releases reservations of pods which aren't pending anymore.
+func (r *PodReservations) Retain(pendingPods []*apiv1.Pod) {
+	pending := make(map[types.UID]bool, len(pendingPods))
+	for _, pod := range pendingPods {
+		pending[pod.UID] = true
+	}
+	for uid := range r.reservations {
+		if !pending[uid] {
+			delete(r.reservations, uid)
+		}
+	}
+	r.matchNodes()
+}
+
+// matchNodes matches reserved nodes with upcoming nodes of their node groups.
+// Nodes reserved last are matched first, as they're the least likely to have
+// registered. Pods on reserved nodes left without a match are treated like
+// other pending pods.
+func (r *PodReservations) matchNodes() {
+	nodesPerGroup := make(map[string]map[int]bool)
+	for _, reservation := range r.reservations {
+		if nodesPerGroup[reservation.NodeGroupId] == nil {
+			nodesPerGroup[reservation.NodeGroupId] = make(map[int]bool)
+		}
+		nodesPerGroup[reservation.NodeGroupId][reservation.node] = true
+	}
+	r.reservedNodes = make(map[int]string)
+	for nodeGroupId, nodes := range nodesPerGroup {
+		sortedNodes := make([]int, 0, len(nodes))
+		for node := range nodes {
+			sortedNodes = append(sortedNodes, node)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(sortedNodes)))
+		upcomingNodes := r.upcomingNodes[nodeGroupId]
+		for i, node := range sortedNodes {
+			if i >= len(upcomingNodes) {
+				klog.V(4).Infof("No upcoming node of node group %s left for reserved node %d", nodeGroupId, node)
+				break
+			}
+			r.reservedNodes[node] = upcomingNodes[i]
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func assertReserved(t *testing.T, reservations *PodReservations, reserved []*apiv1.Pod, released []*apiv1.Pod) {
+	for _, pod := range reserved {
+		_, found := reservations.Get(pod)
+		assert.True(t, found, "pod %s should be reserved", pod.Name)
+	}
+	for _, pod := range released {
+		_, found := reservations.Get(pod)
+		assert.False(t, found, "pod %s should be released", pod.Name)
+	}
+}
+
+func TestPodReservationsExpire(t *testing.T) {
+	now := time.Now()
+	p1 := BuildTestPod("p1", 100, 100)
+	p2 := BuildTestPod("p2", 100, 100)
+
+	reservations := NewPodReservations()
+	reservations.Reserve("ng1", [][]*apiv1.Pod{{p1}}, now.Add(time.Minute))
+	reservations.Reserve("ng1", [][]*apiv1.Pod{{p2}}, now.Add(2*time.Minute))
+	reservation, found := reservations.Get(p1)
+	assert.True(t, found)
+	assert.Equal(t, "ng1", reservation.NodeGroupId)
+	assert.Equal(t, now.Add(time.Minute), reservation.ExpireTime)
+
+	upcomingNodes := map[string][]string{"ng1": {"n1", "n2"}}
+	reservations.Update(upcomingNodes, now)
+	assertReserved(t, reservations, []*apiv1.Pod{p1, p2}, nil)
+
+	reservations.Update(upcomingNodes, now.Add(time.Minute))
+	assertReserved(t, reservations, []*apiv1.Pod{p2}, []*apiv1.Pod{p1})
+}
+
+func TestPodReservationsReservedNodes(t *testing.T) {
+	now := time.Now()
+	expireTime := now.Add(time.Hour)
+	p1 := BuildTestPod("p1", 100, 100)
+	p2 := BuildTestPod("p2", 100, 100)
+	p3 := BuildTestPod("p3", 100, 100)
+	p4 := BuildTestPod("p4", 100, 100)
+	other := BuildTestPod("other", 100, 100)
+
+	reservations := NewPodReservations()
+	reservations.Reserve("ng1", [][]*apiv1.Pod{{p1, p2}, {p3}}, expireTime)
+	reservations.Reserve("ng2", [][]*apiv1.Pod{{p4}}, expireTime)
+
+	assertReservedNode := func(pod *apiv1.Pod, expected string) {
+		nodeName, found := reservations.ReservedNode(pod)
+		assert.Equal(t, expected != "", found, "pod %s", pod.Name)
+		assert.Equal(t, expected, nodeName, "pod %s", pod.Name)
+	}
+
+	// Pods packed on the same node are matched with the same upcoming node.
+	// The third upcoming node of ng1 isn't reserved.
+	reservations.Update(map[string][]string{"ng1": {"n1", "n2", "n3"}, "ng2": {"n4"}}, now)
+	assertReservedNode(p1, "n2")
+	assertReservedNode(p2, "n2")
+	assertReservedNode(p3, "n1")
+	assertReservedNode(p4, "n4")
+	assertReservedNode(other, "")
+
+	// A node of ng1 registered, so one of its reserved nodes isn't matched.
+	// Reservations are kept until their pods aren't pending.
+	reservations.Update(map[string][]string{"ng1": {"n1"}, "ng2": {"n4"}}, now)
+	assertReservedNode(p1, "")
+	assertReservedNode(p3, "n1")
+	assertReserved(t, reservations, []*apiv1.Pod{p1, p2, p3, p4}, nil)
+
+	// Pods of the other node were scheduled on the registered node.
+	reservations.Retain([]*apiv1.Pod{p1, p2, p4})
+	assertReservedNode(p1, "n1")
+	assertReservedNode(p2, "n1")
+
+	// Node groups without upcoming nodes in the cluster snapshot, e.g.
+	// without templates, keep their reservations.
+	reservations.Update(map[string][]string{}, now)
+	assertReservedNode(p1, "")
+	assertReserved(t, reservations, []*apiv1.Pod{p1, p2, p4}, nil)
+}
+
+func TestPodReservationsRetain(t *testing.T) {
+	p1 := BuildTestPod("p1", 100, 100)
+	p2 := BuildTestPod("p2", 100, 100)
+
+	reservations := NewPodReservations()
+	reservations.Reserve("ng1", [][]*apiv1.Pod{{p1, p2}}, time.Now().Add(time.Hour))
+	reservations.Retain([]*apiv1.Pod{p2})
+	assertReserved(t, reservations, []*apiv1.Pod{p2}, []*apiv1.Pod{p1})
+}
@@ -27,3 +27,11 @@ type PredicateChecker interface {
 	FitsAnyNodeMatching(clusterSnapshot ClusterSnapshot, pod *apiv1.Pod, nodeMatches func(*schedulerframework.NodeInfo) bool) (string, error)
 	CheckPredicates(clusterSnapshot ClusterSnapshot, pod *apiv1.Pod, nodeName string) *PredicateError
 }
+
+// CopyablePredicateChecker is a PredicateChecker able to create copies of
+// itself, which can be used concurrently with each other.
+type CopyablePredicateChecker interface {
+	PredicateChecker
+	// Copy returns a new PredicateChecker, which can be used concurrently with this one.
+	Copy() (PredicateChecker, error)
+}
@@ -39,11 +39,29 @@ type SchedulerBasedPredicateChecker struct {
 	nodeLister             v1listers.NodeLister
 	podLister              v1listers.PodLister
 	lastIndex              int
+
+	informerFactory informers.SharedInformerFactory
+	stop            <-chan struct{}
 }
 
 // NewSchedulerBasedPredicateChecker builds scheduler based PredicateChecker.
 func NewSchedulerBasedPredicateChecker(kubeClient kube_client.Interface, stop <-chan struct{}) (*SchedulerBasedPredicateChecker, error) {
 	informerFactory := informers.NewSharedInformerFactory(kubeClient, 0)
+	checker, err := newSchedulerBasedPredicateChecker(informerFactory, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	// this MUST be called after all the informers/listers are acquired via the
+	// informerFactory....Lister()/informerFactory....Informer() methods
+	informerFactory.Start(stop)
+
+	return checker, nil
+}
+
+// newSchedulerBasedPredicateChecker builds scheduler based PredicateChecker
+// using listers of the given informer factory, which the caller must start.
+func newSchedulerBasedPredicateChecker(informerFactory informers.SharedInformerFactory, stop <-chan struct{}) (*SchedulerBasedPredicateChecker, error) {
 	config, err := scheduler_config.Default()
 	if err != nil {
 		return nil, fmt.Errorf("couldn't create scheduler config: %v", err)
@@ -67,12 +85,24 @@ func NewSchedulerBasedPredicateChecker(kubeClient kube_client.Interface, stop <-
 	checker := &SchedulerBasedPredicateChecker{
 		framework:              framework,
 		delegatingSharedLister: sharedLister,
+		informerFactory:        informerFactory,
+		stop:                   stop,
 	}
+	return checker, nil
+}
 
-	// this MUST be called after all the informers/listers are acquired via the
-	// informerFactory....Lister()/informerFactory....Informer() methods
-	informerFactory.Start(stop)
-
+// Copy builds a new SchedulerBasedPredicateChecker with its own scheduler
+// framework, which can be used concurrently with this one. The copy shares
+// the informers of this one, so it doesn't add watches on the API server.
+// Caches its plugins build from informer events fill shortly after it's made.
+func (p *SchedulerBasedPredicateChecker) Copy() (PredicateChecker, error) {
+	checker, err := newSchedulerBasedPredicateChecker(p.informerFactory, p.stop)
+	if err != nil {
+		return nil, err
+	}
+	// Informers are already running, this only starts ones plugins of the
+	// copy requested for the first time, if any.
+	p.informerFactory.Start(p.stop)
 	return checker, nil
 }
 
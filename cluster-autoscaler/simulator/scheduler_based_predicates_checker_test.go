@@ -154,3 +154,33 @@ func TestDebugInfo(t *testing.T) {
 	assert.Equal(t, "node(s) had untolerated taint {SomeTaint: WhyNot?}", predicateErr.Message())
 	assert.Contains(t, predicateErr.VerboseMessage(), "RandomTaint")
 }
+
+func TestCopySharesInformers(t *testing.T) {
+	// The volume of the pod is known only from the informers.
+	pvc, pv := buildBoundVolume("data", csiVolume("csi.example.com", "data"), zoneAffinity("zone-a"))
+	predicateChecker, err := NewTestPredicateCheckerWithObjects(pvc, pv)
+	assert.NoError(t, err)
+
+	copied, err := predicateChecker.(*SchedulerBasedPredicateChecker).Copy()
+	assert.NoError(t, err)
+	original := predicateChecker.(*SchedulerBasedPredicateChecker)
+	copy := copied.(*SchedulerBasedPredicateChecker)
+	assert.Equal(t, original.informerFactory, copy.informerFactory)
+	assert.NotSame(t, original.delegatingSharedLister, copy.delegatingSharedLister)
+
+	n1 := BuildTestNode("n1", 1000, 2000000)
+	n1.Labels[apiv1.LabelTopologyZone] = "zone-a"
+	SetNodeReadyState(n1, true, time.Time{})
+	n2 := BuildTestNode("n2", 1000, 2000000)
+	n2.Labels[apiv1.LabelTopologyZone] = "zone-b"
+	SetNodeReadyState(n2, true, time.Time{})
+	clusterSnapshot := NewBasicClusterSnapshot()
+	InitializeClusterSnapshotOrDie(t, clusterSnapshot, []*apiv1.Node{n1, n2}, []*apiv1.Pod{})
+
+	// Plugins of the copy fill their caches from the shared informers shortly after it's made.
+	pod := withVolumeClaim(BuildTestPod("p1", 100, 100000), "data")
+	assert.Eventually(t, func() bool {
+		return copied.CheckPredicates(clusterSnapshot, pod, "n1") == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.NotNil(t, copied.CheckPredicates(clusterSnapshot, pod, "n2"))
+}
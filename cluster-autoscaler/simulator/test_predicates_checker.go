@@ -17,6 +17,8 @@ limitations under the License.
 package simulator
 
 import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
 	clientsetfake "k8s.io/client-go/kubernetes/fake"
 )
 
@@ -25,3 +27,18 @@ func NewTestPredicateChecker() (PredicateChecker, error) {
 	// just call out to NewSchedulerBasedPredicateChecker but use fake kubeClient
 	return NewSchedulerBasedPredicateChecker(clientsetfake.NewSimpleClientset(), make(chan struct{}))
 }
+
+// NewTestPredicateCheckerWithObjects builds test version of PredicateChecker
+// whose scheduler plugins see the given objects, e.g. volumes, from the start.
+func NewTestPredicateCheckerWithObjects(objects ...runtime.Object) (PredicateChecker, error) {
+	kubeClient := clientsetfake.NewSimpleClientset(objects...)
+	informerFactory := informers.NewSharedInformerFactory(kubeClient, 0)
+	stop := make(chan struct{})
+	checker, err := newSchedulerBasedPredicateChecker(informerFactory, stop)
+	if err != nil {
+		return nil, err
+	}
+	informerFactory.Start(stop)
+	informerFactory.WaitForCacheSync(stop)
+	return checker, nil
+}
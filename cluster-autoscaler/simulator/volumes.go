@@ -0,0 +1,69 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simulator
+
+import (
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// checkLocalStorage checks if the local storage used by the pod fits in the
+// ephemeral storage of the node left by the pods already running on it. Nodes
+// not reporting allocatable ephemeral storage are assumed to have enough.
+// Unlike the scheduler, which only counts ephemeral storage requests, this
+// also counts size limits of emptyDir volumes of pods evicted by scale-down.
+func checkLocalStorage(pod *apiv1.Pod, nodeInfo *schedulerframework.NodeInfo) error {
+	allocatable, found := nodeInfo.Node().Status.Allocatable[apiv1.ResourceEphemeralStorage]
+	if !found || allocatable.IsZero() {
+		return nil
+	}
+	used := resource.Quantity{}
+	for _, podInfo := range nodeInfo.Pods {
+		used.Add(podLocalStorage(podInfo.Pod))
+	}
+	needed := podLocalStorage(pod)
+	used.Add(needed)
+	if used.Cmp(allocatable) > 0 {
+		return fmt.Errorf("node %s doesn't have %s of ephemeral storage left", nodeInfo.Node().Name, needed.String())
+	}
+	return nil
+}
+
+// podLocalStorage returns the local storage the pod may use: the larger of
+// its containers' ephemeral storage requests and the size limits of its disk
+// backed emptyDir volumes, as both count towards its ephemeral storage usage.
+func podLocalStorage(pod *apiv1.Pod) resource.Quantity {
+	requests := resource.Quantity{}
+	for _, container := range pod.Spec.Containers {
+		if request, found := container.Resources.Requests[apiv1.ResourceEphemeralStorage]; found {
+			requests.Add(request)
+		}
+	}
+	emptyDirs := resource.Quantity{}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.EmptyDir != nil && volume.EmptyDir.Medium != apiv1.StorageMediumMemory && volume.EmptyDir.SizeLimit != nil {
+			emptyDirs.Add(*volume.EmptyDir.SizeLimit)
+		}
+	}
+	if emptyDirs.Cmp(requests) > 0 {
+		return emptyDirs
+	}
+	return requests
+}
@@ -0,0 +1,359 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1beta1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/drain"
+	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withEmptyDir(pod *apiv1.Pod, name string, sizeLimit string) *apiv1.Pod {
+	limit := resource.MustParse(sizeLimit)
+	pod.Spec.Volumes = append(pod.Spec.Volumes, apiv1.Volume{
+		Name:         name,
+		VolumeSource: apiv1.VolumeSource{EmptyDir: &apiv1.EmptyDirVolumeSource{SizeLimit: &limit}},
+	})
+	return pod
+}
+
+func withEphemeralStorage(node *apiv1.Node, size string) *apiv1.Node {
+	node.Status.Allocatable[apiv1.ResourceEphemeralStorage] = resource.MustParse(size)
+	node.Status.Capacity[apiv1.ResourceEphemeralStorage] = resource.MustParse(size)
+	return node
+}
+
+func TestCheckLocalStorage(t *testing.T) {
+	testCases := []struct {
+		name        string
+		pod         *apiv1.Pod
+		nodePods    []*apiv1.Pod
+		nodeStorage string
+		wantErr     bool
+	}{
+		{
+			name:        "no volumes",
+			pod:         BuildTestPod("p", 100, 100),
+			nodeStorage: "1Gi",
+		},
+		{
+			name:        "emptyDir fits",
+			pod:         withEmptyDir(BuildTestPod("p", 100, 100), "scratch", "1Gi"),
+			nodePods:    []*apiv1.Pod{withEmptyDir(BuildTestPod("other", 100, 100), "scratch", "2Gi")},
+			nodeStorage: "3Gi",
+		},
+		{
+			name:        "emptyDir doesn't fit",
+			pod:         withEmptyDir(BuildTestPod("p", 100, 100), "scratch", "2Gi"),
+			nodePods:    []*apiv1.Pod{withEmptyDir(BuildTestPod("other", 100, 100), "scratch", "2Gi")},
+			nodeStorage: "3Gi",
+			wantErr:     true,
+		},
+		{
+			name: "emptyDir on node without ephemeral storage reported",
+			pod:  withEmptyDir(BuildTestPod("p", 100, 100), "scratch", "2Gi"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node := BuildTestNode("n1", 1000, 1000)
+			if tc.nodeStorage != "" {
+				withEphemeralStorage(node, tc.nodeStorage)
+			}
+			nodeInfo := schedulerframework.NewNodeInfo(tc.nodePods...)
+			nodeInfo.SetNode(node)
+
+			err := checkLocalStorage(tc.pod, nodeInfo)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCheckNodeRemovalWithEmptyDir(t *testing.T) {
+	replicas := int32(5)
+	rsLister, err := kube_util.NewTestReplicaSetLister([]*appsv1.ReplicaSet{{
+		ObjectMeta: metav1.ObjectMeta{Name: "rs", Namespace: "default", SelfLink: "api/v1/namespaces/default/replicasets/rs"},
+		Spec:       appsv1.ReplicaSetSpec{Replicas: &replicas},
+	}})
+	assert.NoError(t, err)
+	registry := kube_util.NewListerRegistry(nil, nil, nil, nil, nil, nil, nil, nil, rsLister, nil)
+	ownerRefs := GenerateOwnerReferences("rs", "ReplicaSet", "extensions/v1beta1", "")
+
+	testCases := []struct {
+		name                     string
+		maxEvictableEmptyDirSize string
+		annotation               string
+		sizeLimit                string
+		destinationStorage       string
+		wantReason               UnremovableReason
+		wantBlockingReason       drain.BlockingPodReason
+	}{
+		{
+			name:               "eviction of pods with emptyDir disabled",
+			annotation:         "scratch",
+			sizeLimit:          "1Gi",
+			destinationStorage: "10Gi",
+			wantReason:         BlockedByPod,
+			wantBlockingReason: drain.LocalStorageRequested,
+		},
+		{
+			name:                     "annotated small emptyDir",
+			maxEvictableEmptyDirSize: "1Gi",
+			annotation:               "scratch",
+			sizeLimit:                "1Gi",
+			destinationStorage:       "10Gi",
+		},
+		{
+			name:                     "emptyDir not annotated",
+			maxEvictableEmptyDirSize: "1Gi",
+			annotation:               "other",
+			sizeLimit:                "1Gi",
+			destinationStorage:       "10Gi",
+			wantReason:               BlockedByPod,
+			wantBlockingReason:       drain.LocalStorageRequested,
+		},
+		{
+			name:                     "emptyDir too large",
+			maxEvictableEmptyDirSize: "1Gi",
+			annotation:               "scratch",
+			sizeLimit:                "2Gi",
+			destinationStorage:       "10Gi",
+			wantReason:               BlockedByPod,
+			wantBlockingReason:       drain.LocalStorageRequested,
+		},
+		{
+			name:                     "emptyDir doesn't fit destination",
+			maxEvictableEmptyDirSize: "1Gi",
+			annotation:               "scratch",
+			sizeLimit:                "1Gi",
+			destinationStorage:       "512Mi",
+			wantReason:               NoPlaceToMovePods,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			source := BuildTestNode("n1", 1000, 2000000)
+			SetNodeReadyState(source, true, time.Time{})
+			destination := withEphemeralStorage(BuildTestNode("n2", 1000, 2000000), tc.destinationStorage)
+			SetNodeReadyState(destination, true, time.Time{})
+
+			pod := withEmptyDir(BuildTestPod("p1", 100, 100000), "scratch", tc.sizeLimit)
+			pod.OwnerReferences = ownerRefs
+			pod.Spec.NodeName = "n1"
+			pod.Annotations = map[string]string{drain.PodSafeToEvictLocalVolumesKey: tc.annotation}
+
+			clusterSnapshot := NewBasicClusterSnapshot()
+			InitializeClusterSnapshotOrDie(t, clusterSnapshot, []*apiv1.Node{source, destination}, []*apiv1.Pod{pod})
+			predicateChecker, err := NewTestPredicateChecker()
+			assert.NoError(t, err)
+			r := NewRemovalSimulator(registry, clusterSnapshot, predicateChecker, NewUsageTracker())
+			if tc.maxEvictableEmptyDirSize != "" {
+				size := resource.MustParse(tc.maxEvictableEmptyDirSize)
+				r.SetMaxEvictableEmptyDirSize(&size)
+			}
+
+			destinations := map[string]bool{"n1": true, "n2": true}
+			toRemove, unremovable := r.CheckNodeRemoval("n1", destinations, map[string]string{}, map[string]string{}, time.Now(), []*policyv1.PodDisruptionBudget{})
+			if tc.wantReason == NoReason {
+				assert.Nil(t, unremovable)
+				if assert.NotNil(t, toRemove) {
+					assert.Equal(t, []*apiv1.Pod{pod}, toRemove.PodsToReschedule)
+				}
+				return
+			}
+			assert.Nil(t, toRemove)
+			if assert.NotNil(t, unremovable) {
+				assert.Equal(t, tc.wantReason, unremovable.Reason)
+				if tc.wantBlockingReason != drain.NoReason && assert.NotNil(t, unremovable.BlockingPod) {
+					assert.Equal(t, tc.wantBlockingReason, unremovable.BlockingPod.Reason)
+				}
+			}
+		})
+	}
+}
+
+func withVolumeClaim(pod *apiv1.Pod, claimName string) *apiv1.Pod {
+	pod.Spec.Volumes = append(pod.Spec.Volumes, apiv1.Volume{
+		Name:         claimName,
+		VolumeSource: apiv1.VolumeSource{PersistentVolumeClaim: &apiv1.PersistentVolumeClaimVolumeSource{ClaimName: claimName}},
+	})
+	return pod
+}
+
+// buildBoundVolume returns a claim and the persistent volume bound to it.
+func buildBoundVolume(name string, source apiv1.PersistentVolumeSource, nodeAffinity *apiv1.VolumeNodeAffinity) (*apiv1.PersistentVolumeClaim, *apiv1.PersistentVolume) {
+	pvc := &apiv1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			UID:         types.UID(name),
+			Annotations: map[string]string{"pv.kubernetes.io/bind-completed": "yes"},
+		},
+		Spec:   apiv1.PersistentVolumeClaimSpec{VolumeName: name},
+		Status: apiv1.PersistentVolumeClaimStatus{Phase: apiv1.ClaimBound},
+	}
+	pv := &apiv1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: apiv1.PersistentVolumeSpec{
+			PersistentVolumeSource: source,
+			ClaimRef:               &apiv1.ObjectReference{Name: name, Namespace: "default", UID: types.UID(name)},
+			NodeAffinity:           nodeAffinity,
+		},
+		Status: apiv1.PersistentVolumeStatus{Phase: apiv1.VolumeBound},
+	}
+	return pvc, pv
+}
+
+func zoneAffinity(zone string) *apiv1.VolumeNodeAffinity {
+	return &apiv1.VolumeNodeAffinity{
+		Required: &apiv1.NodeSelector{NodeSelectorTerms: []apiv1.NodeSelectorTerm{{
+			MatchExpressions: []apiv1.NodeSelectorRequirement{{
+				Key:      apiv1.LabelTopologyZone,
+				Operator: apiv1.NodeSelectorOpIn,
+				Values:   []string{zone},
+			}},
+		}}},
+	}
+}
+
+func csiVolume(driver, handle string) apiv1.PersistentVolumeSource {
+	return apiv1.PersistentVolumeSource{CSI: &apiv1.CSIPersistentVolumeSource{Driver: driver, VolumeHandle: handle}}
+}
+
+func TestCheckNodeRemovalWithVolumes(t *testing.T) {
+	replicas := int32(5)
+	rsLister, err := kube_util.NewTestReplicaSetLister([]*appsv1.ReplicaSet{{
+		ObjectMeta: metav1.ObjectMeta{Name: "rs", Namespace: "default", SelfLink: "api/v1/namespaces/default/replicasets/rs"},
+		Spec:       appsv1.ReplicaSetSpec{Replicas: &replicas},
+	}})
+	assert.NoError(t, err)
+	registry := kube_util.NewListerRegistry(nil, nil, nil, nil, nil, nil, nil, nil, rsLister, nil)
+	ownerRefs := GenerateOwnerReferences("rs", "ReplicaSet", "extensions/v1beta1", "")
+	const driver = "csi.example.com"
+
+	testCases := []struct {
+		name             string
+		volume           apiv1.PersistentVolumeSource
+		nodeAffinity     *apiv1.VolumeNodeAffinity
+		attachLimit      int32
+		destinationZone  string
+		destinationClaim bool
+		wantRemovable    bool
+	}{
+		{
+			name:            "zonal volume available in destination zone",
+			volume:          csiVolume(driver, "data"),
+			nodeAffinity:    zoneAffinity("zone-a"),
+			destinationZone: "zone-a",
+			wantRemovable:   true,
+		},
+		{
+			name:            "zonal volume not available in destination zone",
+			volume:          csiVolume(driver, "data"),
+			nodeAffinity:    zoneAffinity("zone-a"),
+			destinationZone: "zone-b",
+		},
+		{
+			name:             "destination within CSI attach limit",
+			volume:           csiVolume(driver, "data"),
+			attachLimit:      2,
+			destinationClaim: true,
+			wantRemovable:    true,
+		},
+		{
+			name:             "destination at CSI attach limit",
+			volume:           csiVolume(driver, "data"),
+			attachLimit:      1,
+			destinationClaim: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			source := BuildTestNode("n1", 1000, 2000000)
+			source.Labels[apiv1.LabelTopologyZone] = "zone-a"
+			SetNodeReadyState(source, true, time.Time{})
+			destination := BuildTestNode("n2", 1000, 2000000)
+			if tc.destinationZone != "" {
+				destination.Labels[apiv1.LabelTopologyZone] = tc.destinationZone
+			}
+			SetNodeReadyState(destination, true, time.Time{})
+
+			pvc, pv := buildBoundVolume("data", tc.volume, tc.nodeAffinity)
+			objects := []runtime.Object{pvc, pv}
+			pod := withVolumeClaim(BuildTestPod("p1", 100, 100000), "data")
+			pod.OwnerReferences = ownerRefs
+			pod.Spec.NodeName = "n1"
+			pods := []*apiv1.Pod{pod}
+			if tc.destinationClaim {
+				otherPvc, otherPv := buildBoundVolume("other", csiVolume(driver, "other"), nil)
+				objects = append(objects, otherPvc, otherPv)
+				other := withVolumeClaim(BuildTestPod("p2", 100, 100000), "other")
+				other.Spec.NodeName = "n2"
+				pods = append(pods, other)
+			}
+			if tc.attachLimit > 0 {
+				limit := tc.attachLimit
+				objects = append(objects, &storagev1.CSINode{
+					ObjectMeta: metav1.ObjectMeta{Name: "n2"},
+					Spec: storagev1.CSINodeSpec{Drivers: []storagev1.CSINodeDriver{{
+						Name:        driver,
+						NodeID:      "n2",
+						Allocatable: &storagev1.VolumeNodeResources{Count: &limit},
+					}}},
+				})
+			}
+
+			clusterSnapshot := NewBasicClusterSnapshot()
+			InitializeClusterSnapshotOrDie(t, clusterSnapshot, []*apiv1.Node{source, destination}, pods)
+			predicateChecker, err := NewTestPredicateCheckerWithObjects(objects...)
+			assert.NoError(t, err)
+			r := NewRemovalSimulator(registry, clusterSnapshot, predicateChecker, NewUsageTracker())
+
+			destinations := map[string]bool{"n1": true, "n2": true}
+			toRemove, unremovable := r.CheckNodeRemoval("n1", destinations, map[string]string{}, map[string]string{}, time.Now(), []*policyv1.PodDisruptionBudget{})
+			if tc.wantRemovable {
+				assert.Nil(t, unremovable)
+				if assert.NotNil(t, toRemove) {
+					assert.Equal(t, []*apiv1.Pod{pod}, toRemove.PodsToReschedule)
+				}
+				return
+			}
+			assert.Nil(t, toRemove)
+			if assert.NotNil(t, unremovable) {
+				assert.Equal(t, NoPlaceToMovePods, unremovable.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing records spans of the autoscaler main loop using the
+// OpenTelemetry SDK. By default all spans are no-ops; spans are only recorded
+// and exported after Enable is called.
+//
+// The main loop runs on a single goroutine, so instead of passing a context
+// around, the package tracks the span currently active on it: Start creates a
+// child of the active span and makes it active until End is called. Code
+// running on other goroutines should use Current().StartChild instead, which
+// doesn't change the active span.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlphttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	instrumentationName = "k8s.io/autoscaler/cluster-autoscaler"
+	// shutdownTimeout limits how long exporting the remaining spans can
+	// delay the exit of the process.
+	shutdownTimeout = 10 * time.Second
+)
+
+// Attribute is a key-value pair attached to a span.
+type Attribute = attribute.KeyValue
+
+// String returns a string attribute.
+func String(key, value string) Attribute {
+	return attribute.String(key, value)
+}
+
+// Int returns an integer attribute.
+func Int(key string, value int) Attribute {
+	return attribute.Int(key, value)
+}
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attribute {
+	return attribute.Bool(key, value)
+}
+
+// Span is a single timed operation.
+type Span interface {
+	// SetAttributes adds attributes to the span.
+	SetAttributes(attrs ...Attribute)
+	// RecordError marks the span as failed. Nil errors are ignored.
+	RecordError(err error)
+	// StartChild starts a child span, without making it the active one.
+	// It is safe to call from any goroutine.
+	StartChild(name string, attrs ...Attribute) Span
+	// End finishes the span. If the span is the active one, its parent
+	// becomes active.
+	End()
+}
+
+var (
+	mutex    sync.Mutex
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+	active   *span
+)
+
+// NewOTLPExporter returns an exporter sending spans to the given OTLP/HTTP
+// traces endpoint, e.g. http://otel-collector:4318/v1/traces.
+func NewOTLPExporter(ctx context.Context, endpoint string, timeout time.Duration) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("endpoint %q has no host", endpoint)
+	}
+	opts := []otlphttp.Option{otlphttp.WithEndpoint(u.Host), otlphttp.WithTimeout(timeout)}
+	if u.Path != "" {
+		opts = append(opts, otlphttp.WithTracesURLPath(u.Path))
+	}
+	switch u.Scheme {
+	case "http":
+		opts = append(opts, otlphttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("endpoint %q has unsupported scheme %q", endpoint, u.Scheme)
+	}
+	return otlp.NewExporter(ctx, otlphttp.NewDriver(opts...))
+}
+
+// Enable makes spans recorded. Finished spans are passed to the exporter in
+// batches, at least every batchTimeout. Shutdown should be called before the
+// process exits, to export the remaining spans.
+func Enable(exporter sdktrace.SpanExporter, serviceName string, batchTimeout time.Duration) {
+	otel.SetErrorHandler(errorHandler{})
+	p := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(batchTimeout)),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.ServiceNameKey.String(serviceName))),
+	)
+	mutex.Lock()
+	defer mutex.Unlock()
+	provider = p
+	tracer = p.Tracer(instrumentationName)
+	active = nil
+}
+
+// Shutdown disables tracing and exports the remaining spans. It's a no-op if
+// tracing isn't enabled.
+func Shutdown() {
+	mutex.Lock()
+	p := provider
+	provider = nil
+	tracer = nil
+	active = nil
+	mutex.Unlock()
+	if p == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		klog.Warningf("Failed to export remaining spans: %v", err)
+	}
+}
+
+// Start starts a child of the active span (or a new trace, if there is no
+// active span) and makes it active. It should only be called from the main
+// loop goroutine.
+func Start(name string, attrs ...Attribute) Span {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if tracer == nil {
+		return noopSpan{}
+	}
+	s := newSpan(tracer, active, name, attrs)
+	s.wasActive = true
+	active = s
+	return s
+}
+
+// Current returns the active span. If there is none, a no-op span is returned.
+func Current() Span {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if active == nil {
+		return noopSpan{}
+	}
+	return active
+}
+
+type span struct {
+	tracer    trace.Tracer
+	ctx       context.Context
+	otelSpan  trace.Span
+	parent    *span
+	wasActive bool
+}
+
+func newSpan(tracer trace.Tracer, parent *span, name string, attrs []Attribute) *span {
+	ctx := context.Background()
+	if parent != nil {
+		ctx = parent.ctx
+	}
+	ctx, otelSpan := tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+	return &span{
+		tracer:   tracer,
+		ctx:      ctx,
+		otelSpan: otelSpan,
+		parent:   parent,
+	}
+}
+
+func (s *span) SetAttributes(attrs ...Attribute) {
+	s.otelSpan.SetAttributes(attrs...)
+}
+
+func (s *span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.otelSpan.RecordError(err)
+	s.otelSpan.SetStatus(codes.Error, err.Error())
+}
+
+func (s *span) StartChild(name string, attrs ...Attribute) Span {
+	return newSpan(s.tracer, s, name, attrs)
+}
+
+func (s *span) End() {
+	s.otelSpan.End()
+	if !s.wasActive {
+		return
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	// Children left unfinished (e.g. on an early return) stop being active
+	// together with their parent.
+	for a := active; a != nil; a = a.parent {
+		if a == s {
+			active = s.parent
+			break
+		}
+	}
+}
+
+// errorHandler logs errors of the OpenTelemetry SDK, e.g. failed exports.
+type errorHandler struct{}
+
+func (errorHandler) Handle(err error) {
+	if err != nil {
+		klog.Warningf("Tracing error: %v", err)
+	}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute)           {}
+func (noopSpan) RecordError(error)                    {}
+func (noopSpan) StartChild(string, ...Attribute) Span { return noopSpan{} }
+func (noopSpan) End()                                 {}
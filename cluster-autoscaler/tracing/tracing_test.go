@@ -0,0 +1,134 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordingExporter keeps the recorded spans on shutdown.
+type recordingExporter struct {
+	*tracetest.InMemoryExporter
+}
+
+func (recordingExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+func spansByName(exporter recordingExporter) map[string]*sdktrace.SpanSnapshot {
+	result := make(map[string]*sdktrace.SpanSnapshot)
+	for _, s := range exporter.GetSpans() {
+		result[s.Name] = s
+	}
+	return result
+}
+
+func TestDisabled(t *testing.T) {
+	span := Start("root", String("a", "b"))
+	assert.Equal(t, noopSpan{}, span)
+	assert.Equal(t, noopSpan{}, Current())
+	span.StartChild("child").End()
+	span.End()
+	Shutdown()
+}
+
+func TestSpanTree(t *testing.T) {
+	exporter := recordingExporter{tracetest.NewInMemoryExporter()}
+	Enable(exporter, "test-service", time.Hour)
+
+	root := Start("root", String("key", "value"))
+	child := Start("child")
+	assert.Equal(t, child, Current())
+	grandchild := Start("grandchild")
+	background := Current().StartChild("background", Int("count", 3))
+	assert.Equal(t, grandchild, Current())
+	background.RecordError(errors.New("failed"))
+	background.End()
+	// Ending child before grandchild makes root active again.
+	child.End()
+	assert.Equal(t, root, Current())
+	grandchild.End()
+	assert.Equal(t, root, Current())
+	sibling := Start("sibling")
+	sibling.SetAttributes(Bool("ok", true))
+	sibling.End()
+	root.End()
+	assert.Equal(t, noopSpan{}, Current())
+
+	// Shutdown exports spans which are still waiting for the next batch.
+	assert.Empty(t, exporter.GetSpans())
+	Shutdown()
+	assert.Equal(t, noopSpan{}, Start("after-shutdown"))
+
+	spans := spansByName(exporter)
+	assert.Equal(t, 5, len(spans))
+	r := spans["root"]
+	assert.False(t, r.Parent.IsValid())
+	assert.True(t, r.SpanContext.IsValid())
+	assert.Equal(t, []attribute.KeyValue{attribute.String("key", "value")}, r.Attributes)
+	assert.Contains(t, r.Resource.Attributes(), attribute.String("service.name", "test-service"))
+	for _, name := range []string{"child", "sibling"} {
+		assert.Equal(t, r.SpanContext.TraceID(), spans[name].SpanContext.TraceID(), name)
+		assert.Equal(t, r.SpanContext.SpanID(), spans[name].Parent.SpanID(), name)
+	}
+	assert.Equal(t, spans["child"].SpanContext.SpanID(), spans["grandchild"].Parent.SpanID())
+	assert.Equal(t, spans["grandchild"].SpanContext.SpanID(), spans["background"].Parent.SpanID())
+	assert.Equal(t, []attribute.KeyValue{attribute.Int("count", 3)}, spans["background"].Attributes)
+	assert.Equal(t, codes.Error, spans["background"].StatusCode)
+	assert.Equal(t, "failed", spans["background"].StatusMessage)
+	assert.Equal(t, []attribute.KeyValue{attribute.Bool("ok", true)}, spans["sibling"].Attributes)
+	assert.False(t, r.EndTime.Before(r.StartTime))
+}
+
+func TestOTLPExporter(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		assert.NotEmpty(t, body)
+		requests <- req
+	}))
+	defer server.Close()
+
+	exporter, err := NewOTLPExporter(context.Background(), server.URL+"/custom/traces", time.Second)
+	assert.NoError(t, err)
+	Enable(exporter, "test-service", time.Hour)
+	Start("root").End()
+	Shutdown()
+
+	req := <-requests
+	assert.Equal(t, "/custom/traces", req.URL.Path)
+	assert.Equal(t, "application/x-protobuf", req.Header.Get("Content-Type"))
+}
+
+func TestOTLPExporterInvalidEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"otel-collector:4318", "grpc://otel-collector:4317", "http://"} {
+		_, err := NewOTLPExporter(context.Background(), endpoint, time.Second)
+		assert.Error(t, err, endpoint)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backoff
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+)
+
+// exponentialBackoffState is the checkpointed form of exponentialBackoffInfo.
+type exponentialBackoffState struct {
+	Duration            string    `json:"duration"`
+	BackoffUntil        time.Time `json:"backoffUntil"`
+	LastFailedExecution time.Time `json:"lastFailedExecution"`
+}
+
+// CheckpointState returns the backoff state, so that node groups stay backed
+// off after a restart.
+func (b *exponentialBackoff) CheckpointState() ([]byte, error) {
+	if len(b.backoffInfo) == 0 {
+		return nil, nil
+	}
+	state := make(map[string]exponentialBackoffState, len(b.backoffInfo))
+	for key, info := range b.backoffInfo {
+		state[key] = exponentialBackoffState{
+			Duration:            info.duration.String(),
+			BackoffUntil:        info.backoffUntil,
+			LastFailedExecution: info.lastFailedExecution,
+		}
+	}
+	return json.Marshal(state)
+}
+
+// RestoreState restores the backoff state of node groups not backed off yet.
+func (b *exponentialBackoff) RestoreState(data []byte) error {
+	state := make(map[string]exponentialBackoffState)
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	for key, info := range state {
+		if _, found := b.backoffInfo[key]; found {
+			continue
+		}
+		duration, err := time.ParseDuration(info.Duration)
+		if err != nil {
+			return fmt.Errorf("invalid backoff duration of %s: %v", key, err)
+		}
+		b.backoffInfo[key] = exponentialBackoffInfo{
+			duration:            duration,
+			backoffUntil:        info.BackoffUntil,
+			lastFailedExecution: info.LastFailedExecution,
+		}
+	}
+	return nil
+}
+
+// CheckpointState returns the backoff state, so that node groups stay backed
+// off after a restart.
+func (b *policyBackoff) CheckpointState() ([]byte, error) {
+	if len(b.backoffInfo) == 0 {
+		return nil, nil
+	}
+	return encodeBackoffInfo(b.backoffInfo)
+}
+
+// RestoreState restores the backoff state of scopes not backed off yet.
+func (b *policyBackoff) RestoreState(data []byte) error {
+	state, err := decodeBackoffInfo(data)
+	if err != nil {
+		return err
+	}
+	for key, info := range state {
+		if _, found := b.backoffInfo[key]; !found {
+			b.backoffInfo[key] = info
+		}
+	}
+	return nil
+}
+
+// storedBackoffInfo is the checkpointed form of policyBackoffInfo.
+type storedBackoffInfo struct {
+	Policy              string    `json:"policy"`
+	Scope               string    `json:"scope"`
+	ScopeValue          string    `json:"scopeValue"`
+	Duration            string    `json:"duration"`
+	BackoffUntil        time.Time `json:"backoffUntil"`
+	LastFailedExecution time.Time `json:"lastFailedExecution"`
+}
+
+func encodeBackoffInfo(backoffInfo map[string]policyBackoffInfo) ([]byte, error) {
+	stored := make(map[string]storedBackoffInfo, len(backoffInfo))
+	for key, info := range backoffInfo {
+		stored[key] = storedBackoffInfo{
+			Policy:              info.policy,
+			Scope:               string(info.scope),
+			ScopeValue:          info.scopeValue,
+			Duration:            info.duration.String(),
+			BackoffUntil:        info.backoffUntil,
+			LastFailedExecution: info.lastFailedExecution,
+		}
+	}
+	return json.Marshal(stored)
+}
+
+func decodeBackoffInfo(data []byte) (map[string]policyBackoffInfo, error) {
+	stored := make(map[string]storedBackoffInfo)
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	result := make(map[string]policyBackoffInfo, len(stored))
+	for key, info := range stored {
+		duration, err := time.ParseDuration(info.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backoff duration of %s: %v", key, err)
+		}
+		result[key] = policyBackoffInfo{
+			policy:              info.Policy,
+			scope:               config.BackoffScope(info.Scope),
+			scopeValue:          info.ScopeValue,
+			duration:            duration,
+			backoffUntil:        info.BackoffUntil,
+			lastFailedExecution: info.LastFailedExecution,
+		}
+	}
+	return result, nil
+}
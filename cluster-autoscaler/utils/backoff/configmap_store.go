@@ -0,0 +1,133 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backoff
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	apiv1 "k8s.io/api/core/v1"
+	kube_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kube_client "k8s.io/client-go/kubernetes"
+	klog "k8s.io/klog/v2"
+)
+
+// backoffStateKey is the ConfigMap data key holding the backoff state.
+const backoffStateKey = "backoff"
+
+// configMapStore saves the backoff state of policyBackoff in a ConfigMap.
+// Saving doesn't wait for the API server: a background goroutine writes the
+// latest saved state, skipping states replaced before they were written.
+type configMapStore struct {
+	kubeClient kube_client.Interface
+	namespace  string
+	name       string
+
+	mutex sync.Mutex
+	// pending is the encoded state waiting to be written, nil if there is none.
+	pending []byte
+	// writing tells if the writer goroutine is running.
+	writing bool
+	writes  sync.WaitGroup
+}
+
+func newConfigMapStore(kubeClient kube_client.Interface, namespace, name string) *configMapStore {
+	return &configMapStore{kubeClient: kubeClient, namespace: namespace, name: name}
+}
+
+// load returns the saved backoff state, or an empty state if the ConfigMap
+// doesn't exist.
+func (s *configMapStore) load() (map[string]policyBackoffInfo, error) {
+	result := make(map[string]policyBackoffInfo)
+	configMap, err := s.kubeClient.CoreV1().ConfigMaps(s.namespace).Get(context.TODO(), s.name, metav1.GetOptions{})
+	if kube_errors.IsNotFound(err) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, found := configMap.Data[backoffStateKey]
+	if !found {
+		return result, nil
+	}
+	result, err = decodeBackoffInfo([]byte(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid backoff state in configmap %s/%s: %v", s.namespace, s.name, err)
+	}
+	return result, nil
+}
+
+// saveAsync schedules writing the encoded backoff state to the ConfigMap.
+func (s *configMapStore) saveAsync(data []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pending = data
+	if !s.writing {
+		s.writing = true
+		s.writes.Add(1)
+		go s.writePending()
+	}
+}
+
+// writePending writes pending states until there are none left.
+func (s *configMapStore) writePending() {
+	defer s.writes.Done()
+	for {
+		s.mutex.Lock()
+		data := s.pending
+		s.pending = nil
+		if data == nil {
+			s.writing = false
+			s.mutex.Unlock()
+			return
+		}
+		s.mutex.Unlock()
+		if err := s.write(data); err != nil {
+			klog.Errorf("Failed to save backoff state: %v", err)
+		}
+	}
+}
+
+// waitForWrites waits until all scheduled states are written.
+func (s *configMapStore) waitForWrites() {
+	s.writes.Wait()
+}
+
+// write writes the encoded backoff state to the ConfigMap, creating it if it doesn't exist.
+func (s *configMapStore) write(data []byte) error {
+	maps := s.kubeClient.CoreV1().ConfigMaps(s.namespace)
+	configMap, err := maps.Get(context.TODO(), s.name, metav1.GetOptions{})
+	if kube_errors.IsNotFound(err) {
+		configMap = &apiv1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: s.name},
+			Data:       map[string]string{backoffStateKey: string(data)},
+		}
+		_, err = maps.Create(context.TODO(), configMap, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[backoffStateKey] = string(data)
+	_, err = maps.Update(context.TODO(), configMap, metav1.UpdateOptions{})
+	return err
+}
@@ -101,3 +101,18 @@ func TestIncreaseExistingBackoff(t *testing.T) {
 	assert.False(t, backoff.IsBackedOff(nodeGroup1, nil, time.Now()))
 	// Result: existing backoff duration was scaled up beyond initial duration
 }
+
+func TestBackoffCheckpoint(t *testing.T) {
+	backoff := NewIdBasedExponentialBackoff(1*time.Minute, 10*time.Minute, 3*time.Hour)
+	startTime := time.Now()
+	backoff.Backoff(nodeGroup1, nil, cloudprovider.OtherErrorClass, "", startTime)
+	data, err := backoff.(*exponentialBackoff).CheckpointState()
+	assert.NoError(t, err)
+
+	restarted := NewIdBasedExponentialBackoff(1*time.Minute, 10*time.Minute, 3*time.Hour)
+	assert.NoError(t, restarted.(*exponentialBackoff).RestoreState(data))
+	assert.True(t, restarted.IsBackedOff(nodeGroup1, nil, startTime))
+	assert.False(t, restarted.IsBackedOff(nodeGroup2, nil, startTime))
+	// The backoff duration keeps growing after the restart.
+	assert.Equal(t, startTime.Add(4*time.Minute), restarted.Backoff(nodeGroup1, nil, cloudprovider.OtherErrorClass, "", startTime.Add(2*time.Minute)))
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backoff
+
+import (
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+
+	apiv1 "k8s.io/api/core/v1"
+	kube_client "k8s.io/client-go/kubernetes"
+	klog "k8s.io/klog/v2"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// AllNodeGroupsScopeValue is the scope value of config.ProjectBackoffScope,
+// which covers every node group managed by cluster autoscaler.
+const AllNodeGroupsScopeValue = "*"
+
+// policyBackoff backs off node groups using the policy matching the class and
+// code of the error which caused the backoff. Depending on the scope of the
+// policy, a single failure backs off one node group, all node groups in its
+// zone, all node groups of its instance type or all node groups.
+type policyBackoff struct {
+	defaultPolicy       config.BackoffPolicy
+	policies            []config.BackoffPolicy
+	backoffResetTimeout time.Duration
+	backoffInfo         map[string]policyBackoffInfo
+	store               *configMapStore
+}
+
+type policyBackoffInfo struct {
+	// policy is the selector of the policy which caused the backoff.
+	policy              string
+	scope               config.BackoffScope
+	scopeValue          string
+	duration            time.Duration
+	backoffUntil        time.Time
+	lastFailedExecution time.Time
+}
+
+// NewPolicyBasedBackoff creates an instance of exponential backoff using the
+// first of the policies matching the class and code of the error, or a policy
+// backing off only the failed node group with the given default durations if
+// none matches. Policies for a specific error code are preferred over policies
+// matching any code. If kubeClient is not nil and configMapName is not empty,
+// the backoff state is loaded from and saved to the given ConfigMap, so that
+// it persists across restarts. The ConfigMap is updated in the background, so
+// that backing off doesn't wait for the API server.
+func NewPolicyBasedBackoff(
+	initialBackoffDuration time.Duration,
+	maxBackoffDuration time.Duration,
+	backoffResetTimeout time.Duration,
+	policies []config.BackoffPolicy,
+	kubeClient kube_client.Interface,
+	namespace string,
+	configMapName string) Backoff {
+	b := &policyBackoff{
+		defaultPolicy: config.BackoffPolicy{
+			Scope:                  config.NodeGroupBackoffScope,
+			InitialBackoffDuration: initialBackoffDuration,
+			MaxBackoffDuration:     maxBackoffDuration,
+		},
+		policies:            policies,
+		backoffResetTimeout: backoffResetTimeout,
+		backoffInfo:         make(map[string]policyBackoffInfo),
+	}
+	if kubeClient != nil && configMapName != "" {
+		b.store = newConfigMapStore(kubeClient, namespace, configMapName)
+		backoffInfo, err := b.store.load()
+		if err != nil {
+			klog.Errorf("Failed to load backoff state, starting without it: %v", err)
+		} else {
+			b.backoffInfo = backoffInfo
+		}
+	}
+	return b
+}
+
+// Backoff execution for the given node group. Returns time till execution is backed off.
+func (b *policyBackoff) Backoff(nodeGroup cloudprovider.NodeGroup, nodeInfo *schedulerframework.NodeInfo, errorClass cloudprovider.InstanceErrorClass, errorCode string, currentTime time.Time) time.Time {
+	policy := b.policyFor(errorClass, errorCode)
+	scope := policy.Scope
+	scopeValue, found := scopeValueOf(scope, nodeGroup, nodeInfo)
+	if !found {
+		klog.V(4).Infof("Can't determine %s of node group %s, backing off only the node group", scope, nodeGroup.Id())
+		scope = config.NodeGroupBackoffScope
+		scopeValue, _ = scopeValueOf(scope, nodeGroup, nodeInfo)
+	}
+	key := policy.Selector() + "@" + string(scope) + "/" + scopeValue
+
+	duration := policy.InitialBackoffDuration
+	if backoffInfo, found := b.backoffInfo[key]; found {
+		// Multiple concurrent scale-ups failing shouldn't cause
+		// backoff duration to increase exponentially
+		duration = backoffInfo.duration
+		if backoffInfo.backoffUntil.Before(currentTime) {
+			// Scope is not currently in backoff, but was recently
+			// Increase backoff duration exponentially
+			duration = 2 * backoffInfo.duration
+			if duration > policy.MaxBackoffDuration {
+				duration = policy.MaxBackoffDuration
+			}
+		}
+	}
+	backoffUntil := currentTime.Add(duration)
+	b.backoffInfo[key] = policyBackoffInfo{
+		policy:              policy.Selector(),
+		scope:               scope,
+		scopeValue:          scopeValue,
+		duration:            duration,
+		backoffUntil:        backoffUntil,
+		lastFailedExecution: currentTime,
+	}
+	if scope != config.NodeGroupBackoffScope {
+		klog.Warningf("Backing off all node groups in %s %q until %v after node group %s failed with %s error", scope, scopeValue, backoffUntil, nodeGroup.Id(), policy.Selector())
+	}
+	b.save()
+	return backoffUntil
+}
+
+// IsBackedOff returns true if execution is backed off for the given node group,
+// because of its own failure or a failure of another node group in its scope.
+func (b *policyBackoff) IsBackedOff(nodeGroup cloudprovider.NodeGroup, nodeInfo *schedulerframework.NodeInfo, currentTime time.Time) bool {
+	for _, backoffInfo := range b.backoffInfo {
+		if backoffInfo.backoffUntil.After(currentTime) && b.covers(backoffInfo, nodeGroup, nodeInfo) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveBackoff removes backoff data of all scopes containing the given node
+// group, as its successful execution means the failure cause is gone.
+func (b *policyBackoff) RemoveBackoff(nodeGroup cloudprovider.NodeGroup, nodeInfo *schedulerframework.NodeInfo) {
+	removed := false
+	for key, backoffInfo := range b.backoffInfo {
+		if b.covers(backoffInfo, nodeGroup, nodeInfo) {
+			delete(b.backoffInfo, key)
+			removed = true
+		}
+	}
+	if removed {
+		b.save()
+	}
+}
+
+// RemoveStaleBackoffData removes stale backoff data.
+func (b *policyBackoff) RemoveStaleBackoffData(currentTime time.Time) {
+	removed := false
+	for key, backoffInfo := range b.backoffInfo {
+		if backoffInfo.lastFailedExecution.Add(b.backoffResetTimeout).Before(currentTime) {
+			delete(b.backoffInfo, key)
+			removed = true
+		}
+	}
+	if removed {
+		b.save()
+	}
+}
+
+func (b *policyBackoff) policyFor(errorClass cloudprovider.InstanceErrorClass, errorCode string) config.BackoffPolicy {
+	for _, policy := range b.policies {
+		if policy.ErrorCode != "" && policy.Matches(errorClass.String(), errorCode) {
+			return policy
+		}
+	}
+	for _, policy := range b.policies {
+		if policy.ErrorCode == "" && policy.Matches(errorClass.String(), errorCode) {
+			return policy
+		}
+	}
+	return b.defaultPolicy
+}
+
+func (b *policyBackoff) covers(backoffInfo policyBackoffInfo, nodeGroup cloudprovider.NodeGroup, nodeInfo *schedulerframework.NodeInfo) bool {
+	scopeValue, found := scopeValueOf(backoffInfo.scope, nodeGroup, nodeInfo)
+	return found && scopeValue == backoffInfo.scopeValue
+}
+
+func (b *policyBackoff) save() {
+	if b.store == nil {
+		return
+	}
+	data, err := encodeBackoffInfo(b.backoffInfo)
+	if err != nil {
+		klog.Errorf("Failed to save backoff state: %v", err)
+		return
+	}
+	b.store.saveAsync(data)
+}
+
+// scopeValueOf returns the value identifying the given scope of the node
+// group, e.g. its zone, or false if it can't be determined from the node group
+// template.
+func scopeValueOf(scope config.BackoffScope, nodeGroup cloudprovider.NodeGroup, nodeInfo *schedulerframework.NodeInfo) (string, bool) {
+	switch scope {
+	case config.NodeGroupBackoffScope:
+		return nodeGroup.Id(), true
+	case config.ZoneBackoffScope:
+		return nodeLabel(nodeInfo, apiv1.LabelTopologyZone, apiv1.LabelFailureDomainBetaZone)
+	case config.FlavorBackoffScope:
+		return nodeLabel(nodeInfo, apiv1.LabelInstanceTypeStable, apiv1.LabelInstanceType)
+	case config.ProjectBackoffScope:
+		return AllNodeGroupsScopeValue, true
+	}
+	return "", false
+}
+
+func nodeLabel(nodeInfo *schedulerframework.NodeInfo, labels ...string) (string, bool) {
+	if nodeInfo == nil || nodeInfo.Node() == nil {
+		return "", false
+	}
+	for _, label := range labels {
+		if value := nodeInfo.Node().Labels[label]; value != "" {
+			return value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,249 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backoff
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+	schedulerframework "k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+func templateNodeInfo(zone, flavor string) *schedulerframework.NodeInfo {
+	node := BuildTestNode("template", 1000, 1000)
+	node.Labels = map[string]string{
+		apiv1.LabelTopologyZone:       zone,
+		apiv1.LabelInstanceTypeStable: flavor,
+	}
+	nodeInfo := schedulerframework.NewNodeInfo()
+	nodeInfo.SetNode(node)
+	return nodeInfo
+}
+
+var (
+	zoneAFlavor1 = templateNodeInfo("zone-a", "flavor-1")
+	zoneAFlavor2 = templateNodeInfo("zone-a", "flavor-2")
+	zoneBFlavor1 = templateNodeInfo("zone-b", "flavor-1")
+	nodeGroup3   = nodeGroup("id3")
+)
+
+var testPolicies = []config.BackoffPolicy{
+	{ErrorClass: "OutOfResource", Scope: config.ZoneBackoffScope, InitialBackoffDuration: 5 * time.Minute, MaxBackoffDuration: 20 * time.Minute},
+	{ErrorClass: "OutOfResource", ErrorCode: "QUOTA_EXCEEDED", Scope: config.ProjectBackoffScope, InitialBackoffDuration: 30 * time.Minute, MaxBackoffDuration: 2 * time.Hour},
+	{ErrorClass: "Other", ErrorCode: "FLAVOR_DISABLED", Scope: config.FlavorBackoffScope, InitialBackoffDuration: time.Hour, MaxBackoffDuration: time.Hour},
+}
+
+func TestPolicyBackoffScopes(t *testing.T) {
+	startTime := time.Now()
+	testCases := []struct {
+		name        string
+		errorClass  cloudprovider.InstanceErrorClass
+		errorCode   string
+		wantBackoff []bool
+		wantUntil   time.Time
+	}{
+		{
+			name:        "stockout backs off the zone",
+			errorClass:  cloudprovider.OutOfResourcesErrorClass,
+			errorCode:   "STOCKOUT",
+			wantBackoff: []bool{true, true, false},
+			wantUntil:   startTime.Add(5 * time.Minute),
+		},
+		{
+			name:        "quota error backs off the project",
+			errorClass:  cloudprovider.OutOfResourcesErrorClass,
+			errorCode:   "QUOTA_EXCEEDED",
+			wantBackoff: []bool{true, true, true},
+			wantUntil:   startTime.Add(30 * time.Minute),
+		},
+		{
+			name:        "disabled flavor backs off the flavor",
+			errorClass:  cloudprovider.OtherErrorClass,
+			errorCode:   "FLAVOR_DISABLED",
+			wantBackoff: []bool{true, false, true},
+			wantUntil:   startTime.Add(time.Hour),
+		},
+		{
+			name:        "other errors back off the node group",
+			errorClass:  cloudprovider.OtherErrorClass,
+			errorCode:   "timeout",
+			wantBackoff: []bool{true, false, false},
+			wantUntil:   startTime.Add(time.Minute),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			backoff := NewPolicyBasedBackoff(time.Minute, 10*time.Minute, 3*time.Hour, testPolicies, nil, "", "")
+			until := backoff.Backoff(nodeGroup1, zoneAFlavor1, tc.errorClass, tc.errorCode, startTime)
+			assert.Equal(t, tc.wantUntil, until)
+			assert.Equal(t, tc.wantBackoff[0], backoff.IsBackedOff(nodeGroup1, zoneAFlavor1, startTime))
+			assert.Equal(t, tc.wantBackoff[1], backoff.IsBackedOff(nodeGroup2, zoneAFlavor2, startTime))
+			assert.Equal(t, tc.wantBackoff[2], backoff.IsBackedOff(nodeGroup3, zoneBFlavor1, startTime))
+			assert.False(t, backoff.IsBackedOff(nodeGroup1, zoneAFlavor1, until))
+		})
+	}
+}
+
+func TestPolicyBackoffMaxDurationPerPolicy(t *testing.T) {
+	backoff := NewPolicyBasedBackoff(time.Minute, 10*time.Minute, 3*time.Hour, testPolicies, nil, "", "")
+	startTime := time.Now()
+	until := backoff.Backoff(nodeGroup1, zoneAFlavor1, cloudprovider.OutOfResourcesErrorClass, "STOCKOUT", startTime)
+	assert.Equal(t, startTime.Add(5*time.Minute), until)
+	until = backoff.Backoff(nodeGroup2, zoneAFlavor2, cloudprovider.OutOfResourcesErrorClass, "STOCKOUT", startTime.Add(6*time.Minute))
+	assert.Equal(t, startTime.Add(16*time.Minute), until)
+	until = backoff.Backoff(nodeGroup1, zoneAFlavor1, cloudprovider.OutOfResourcesErrorClass, "STOCKOUT", startTime.Add(17*time.Minute))
+	assert.Equal(t, startTime.Add(37*time.Minute), until)
+	// Capped at the maximum of the zone policy, not the default one.
+	until = backoff.Backoff(nodeGroup1, zoneAFlavor1, cloudprovider.OutOfResourcesErrorClass, "STOCKOUT", startTime.Add(38*time.Minute))
+	assert.Equal(t, startTime.Add(58*time.Minute), until)
+}
+
+func TestPolicyBackoffWithoutTemplate(t *testing.T) {
+	backoff := NewPolicyBasedBackoff(time.Minute, 10*time.Minute, 3*time.Hour, testPolicies, nil, "", "")
+	startTime := time.Now()
+	// The zone is unknown, so only the failed node group is backed off.
+	until := backoff.Backoff(nodeGroup1, nil, cloudprovider.OutOfResourcesErrorClass, "STOCKOUT", startTime)
+	assert.Equal(t, startTime.Add(5*time.Minute), until)
+	assert.True(t, backoff.IsBackedOff(nodeGroup1, zoneAFlavor1, startTime))
+	assert.False(t, backoff.IsBackedOff(nodeGroup2, zoneAFlavor2, startTime))
+}
+
+func TestPolicyBackoffRemoveBackoff(t *testing.T) {
+	backoff := NewPolicyBasedBackoff(time.Minute, 10*time.Minute, 3*time.Hour, testPolicies, nil, "", "")
+	startTime := time.Now()
+	backoff.Backoff(nodeGroup1, zoneAFlavor1, cloudprovider.OutOfResourcesErrorClass, "STOCKOUT", startTime)
+	backoff.Backoff(nodeGroup3, zoneBFlavor1, cloudprovider.OutOfResourcesErrorClass, "STOCKOUT", startTime)
+	// A successful scale-up in zone-a ends the backoff of zone-a only.
+	backoff.RemoveBackoff(nodeGroup2, zoneAFlavor2)
+	assert.False(t, backoff.IsBackedOff(nodeGroup1, zoneAFlavor1, startTime))
+	assert.True(t, backoff.IsBackedOff(nodeGroup3, zoneBFlavor1, startTime))
+}
+
+func TestPolicyBackoffRemoveStaleBackoffData(t *testing.T) {
+	backoff := NewPolicyBasedBackoff(time.Minute, 10*time.Minute, 3*time.Hour, testPolicies, nil, "", "")
+	startTime := time.Now()
+	backoff.Backoff(nodeGroup1, zoneAFlavor1, cloudprovider.OutOfResourcesErrorClass, "STOCKOUT", startTime)
+	backoff.Backoff(nodeGroup3, zoneBFlavor1, cloudprovider.OutOfResourcesErrorClass, "STOCKOUT", startTime.Add(time.Hour))
+	backoff.RemoveStaleBackoffData(startTime.Add(time.Hour))
+	assert.Equal(t, 2, len(backoff.(*policyBackoff).backoffInfo))
+	backoff.RemoveStaleBackoffData(startTime.Add(4 * time.Hour))
+	assert.Equal(t, 1, len(backoff.(*policyBackoff).backoffInfo))
+}
+
+func TestPolicyBackoffPersistence(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	startTime := time.Now().Truncate(time.Second)
+	backoff := NewPolicyBasedBackoff(time.Minute, 10*time.Minute, 3*time.Hour, testPolicies, fakeClient, "kube-system", "backoff-state")
+	backoff.Backoff(nodeGroup1, zoneAFlavor1, cloudprovider.OutOfResourcesErrorClass, "STOCKOUT", startTime)
+	backoff.(*policyBackoff).store.waitForWrites()
+
+	configMap, err := fakeClient.CoreV1().ConfigMaps("kube-system").Get(context.TODO(), "backoff-state", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, configMap.Data[backoffStateKey], "zone-a")
+
+	// A restarted instance continues the backoff, including its duration.
+	restarted := NewPolicyBasedBackoff(time.Minute, 10*time.Minute, 3*time.Hour, testPolicies, fakeClient, "kube-system", "backoff-state")
+	assert.True(t, restarted.IsBackedOff(nodeGroup2, zoneAFlavor2, startTime.Add(time.Minute)))
+	assert.False(t, restarted.IsBackedOff(nodeGroup3, zoneBFlavor1, startTime.Add(time.Minute)))
+	until := restarted.Backoff(nodeGroup2, zoneAFlavor2, cloudprovider.OutOfResourcesErrorClass, "STOCKOUT", startTime.Add(6*time.Minute))
+	assert.Equal(t, startTime.Add(16*time.Minute), until)
+
+	restarted.RemoveBackoff(nodeGroup2, zoneAFlavor2)
+	restarted.(*policyBackoff).store.waitForWrites()
+	restarted = NewPolicyBasedBackoff(time.Minute, 10*time.Minute, 3*time.Hour, testPolicies, fakeClient, "kube-system", "backoff-state")
+	assert.False(t, restarted.IsBackedOff(nodeGroup1, zoneAFlavor1, startTime.Add(7*time.Minute)))
+}
+
+func TestPolicyBackoffSavesInBackground(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	release := make(chan struct{})
+	fakeClient.PrependReactor("get", "configmaps", func(action core.Action) (bool, runtime.Object, error) {
+		<-release
+		return false, nil, nil
+	})
+	backoff := NewPolicyBasedBackoff(time.Minute, 10*time.Minute, 3*time.Hour, testPolicies, nil, "", "")
+	backoff.(*policyBackoff).store = newConfigMapStore(fakeClient, "kube-system", "backoff-state")
+	startTime := time.Now()
+
+	// Backing off doesn't wait for the API server.
+	backoff.Backoff(nodeGroup1, zoneAFlavor1, cloudprovider.OutOfResourcesErrorClass, "STOCKOUT", startTime)
+	backoff.Backoff(nodeGroup3, zoneBFlavor1, cloudprovider.OutOfResourcesErrorClass, "QUOTA_EXCEEDED", startTime)
+	close(release)
+	backoff.(*policyBackoff).store.waitForWrites()
+
+	// The latest state is written.
+	configMap, err := fakeClient.CoreV1().ConfigMaps("kube-system").Get(context.TODO(), "backoff-state", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, configMap.Data[backoffStateKey], "zone-a")
+	assert.Contains(t, configMap.Data[backoffStateKey], "@project/"+AllNodeGroupsScopeValue)
+}
+
+func TestPolicyBackoffInvalidState(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset(&apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "backoff-state"},
+		Data:       map[string]string{backoffStateKey: "not json"},
+	})
+	backoff := NewPolicyBasedBackoff(time.Minute, 10*time.Minute, 3*time.Hour, testPolicies, fakeClient, "kube-system", "backoff-state")
+	startTime := time.Now()
+	assert.False(t, backoff.IsBackedOff(nodeGroup1, zoneAFlavor1, startTime))
+	backoff.Backoff(nodeGroup1, zoneAFlavor1, cloudprovider.OtherErrorClass, "", startTime)
+	assert.True(t, backoff.IsBackedOff(nodeGroup1, zoneAFlavor1, startTime))
+}
+
+func TestPolicyBackoffCheckpoint(t *testing.T) {
+	backoff := NewPolicyBasedBackoff(time.Minute, 10*time.Minute, 3*time.Hour, testPolicies, nil, "", "")
+	startTime := time.Now()
+	backoff.Backoff(nodeGroup1, zoneAFlavor1, cloudprovider.OutOfResourcesErrorClass, "STOCKOUT", startTime)
+	data, err := backoff.(*policyBackoff).CheckpointState()
+	assert.NoError(t, err)
+
+	restarted := NewPolicyBasedBackoff(time.Minute, 10*time.Minute, 3*time.Hour, testPolicies, nil, "", "")
+	assert.NoError(t, restarted.(*policyBackoff).RestoreState(data))
+	assert.True(t, restarted.IsBackedOff(nodeGroup2, zoneAFlavor2, startTime))
+	assert.False(t, restarted.IsBackedOff(nodeGroup3, zoneBFlavor1, startTime))
+}
+
+func TestPolicyBackoffCheckpointProjectScope(t *testing.T) {
+	backoff := NewPolicyBasedBackoff(time.Minute, 10*time.Minute, 3*time.Hour, testPolicies, nil, "", "")
+	startTime := time.Now()
+	backoff.Backoff(nodeGroup1, zoneAFlavor1, cloudprovider.OutOfResourcesErrorClass, "QUOTA_EXCEEDED", startTime)
+	data, err := backoff.(*policyBackoff).CheckpointState()
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "@project/"+AllNodeGroupsScopeValue)
+
+	restarted := NewPolicyBasedBackoff(time.Minute, 10*time.Minute, 3*time.Hour, testPolicies, nil, "", "")
+	assert.NoError(t, restarted.(*policyBackoff).RestoreState(data))
+	assert.True(t, restarted.IsBackedOff(nodeGroup3, zoneBFlavor1, startTime))
+}
+
+func TestPolicyBackoffRestoreInvalidState(t *testing.T) {
+	backoff := NewPolicyBasedBackoff(time.Minute, 10*time.Minute, 3*time.Hour, testPolicies, nil, "", "")
+	assert.Error(t, backoff.(*policyBackoff).RestoreState([]byte("not json")))
+	startTime := time.Now()
+	assert.False(t, backoff.IsBackedOff(nodeGroup1, zoneAFlavor1, startTime))
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkpoint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	klog "k8s.io/klog/v2"
+)
+
+// SchemaVersion is the version of the checkpoint format. Checkpoints of other
+// versions are not restored.
+const SchemaVersion = 1
+
+// Component is implemented by parts of cluster autoscaler whose state is
+// checkpointed, so that it survives restarts and leader failovers.
+type Component interface {
+	// CheckpointState returns the JSON encoded state of the component, or nil
+	// if there is nothing to save.
+	CheckpointState() ([]byte, error)
+	// RestoreState restores the state of the component from a checkpoint.
+	// State already known to the component takes precedence.
+	RestoreState(data []byte) error
+}
+
+// Checkpoint is the state of cluster autoscaler saved in a Store.
+type Checkpoint struct {
+	// Version is the SchemaVersion the checkpoint was written with.
+	Version int `json:"version"`
+	// Time is the time the checkpoint was taken at.
+	Time time.Time `json:"time"`
+	// Components maps component names to their state.
+	Components map[string]json.RawMessage `json:"components"`
+}
+
+// Store saves and loads checkpoints.
+type Store interface {
+	// Load returns the saved checkpoint, or nil if there is none.
+	Load() (*Checkpoint, error)
+	// Save replaces the saved checkpoint.
+	Save(checkpoint *Checkpoint) error
+}
+
+// Checkpointer saves the state of registered components in a Store and
+// restores it after a restart.
+type Checkpointer struct {
+	store      Store
+	maxAge     time.Duration
+	components map[string]Component
+	restored   bool
+	lastSaved  map[string]json.RawMessage
+	lastSaveAt time.Time
+}
+
+// NewCheckpointer creates a Checkpointer using the given store. Checkpoints
+// older than maxAge are not restored, as the state of the cluster has likely
+// changed too much since.
+func NewCheckpointer(store Store, maxAge time.Duration) *Checkpointer {
+	return &Checkpointer{
+		store:      store,
+		maxAge:     maxAge,
+		components: make(map[string]Component),
+	}
+}
+
+// Register adds a component to checkpoints under the given name.
+func (c *Checkpointer) Register(name string, component Component) {
+	c.components[name] = component
+}
+
+// Restore restores the state of registered components from the saved
+// checkpoint. Only the first successful call has any effect. Failing to
+// restore one component doesn't prevent restoring others.
+func (c *Checkpointer) Restore(now time.Time) error {
+	if c.restored {
+		return nil
+	}
+	checkpoint, err := c.store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load checkpoint: %v", err)
+	}
+	c.restored = true
+	if checkpoint == nil {
+		klog.V(1).Info("No checkpoint found, starting with empty state")
+		return nil
+	}
+	if checkpoint.Version != SchemaVersion {
+		klog.Warningf("Ignoring checkpoint with schema version %d, expected %d", checkpoint.Version, SchemaVersion)
+		return nil
+	}
+	if age := now.Sub(checkpoint.Time); age > c.maxAge {
+		klog.Warningf("Ignoring checkpoint taken %v ago, older than %v", age, c.maxAge)
+		return nil
+	}
+	for _, name := range sortedNames(c.components) {
+		data, found := checkpoint.Components[name]
+		if !found {
+			continue
+		}
+		if err := c.components[name].RestoreState(data); err != nil {
+			klog.Errorf("Failed to restore state of %s from checkpoint: %v", name, err)
+			continue
+		}
+		klog.V(1).Infof("Restored state of %s from checkpoint taken at %v", name, checkpoint.Time)
+	}
+	return nil
+}
+
+// Save saves the state of registered components. It does nothing until the
+// state was restored, so that the checkpoint of a previous run isn't lost.
+// Unchanged state is written only once in a while, to keep the checkpoint
+// from getting older than maxAge.
+func (c *Checkpointer) Save(now time.Time) error {
+	if !c.restored {
+		return nil
+	}
+	components := make(map[string]json.RawMessage)
+	for name, component := range c.components {
+		data, err := component.CheckpointState()
+		if err != nil {
+			return fmt.Errorf("failed to checkpoint state of %s: %v", name, err)
+		}
+		if data != nil {
+			components[name] = data
+		}
+	}
+	if equalComponents(components, c.lastSaved) && now.Sub(c.lastSaveAt) < c.maxAge/2 {
+		return nil
+	}
+	checkpoint := &Checkpoint{
+		Version:    SchemaVersion,
+		Time:       now,
+		Components: components,
+	}
+	if err := c.store.Save(checkpoint); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %v", err)
+	}
+	c.lastSaved = components
+	c.lastSaveAt = now
+	return nil
+}
+
+func equalComponents(a, b map[string]json.RawMessage) bool {
+	if a == nil || b == nil || len(a) != len(b) {
+		return false
+	}
+	for name, data := range a {
+		if !bytes.Equal(data, b[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedNames(components map[string]Component) []string {
+	names := make([]string, 0, len(components))
+	for name := range components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+type fakeComponent struct {
+	state    string
+	restored string
+	err      error
+}
+
+func (c *fakeComponent) CheckpointState() ([]byte, error) {
+	if c.state == "" {
+		return nil, nil
+	}
+	return []byte(fmt.Sprintf("%q", c.state)), nil
+}
+
+func (c *fakeComponent) RestoreState(data []byte) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.restored = string(data)
+	return nil
+}
+
+type fakeStore struct {
+	checkpoint *Checkpoint
+	loadErr    error
+	saves      int
+}
+
+func (s *fakeStore) Load() (*Checkpoint, error) {
+	return s.checkpoint, s.loadErr
+}
+
+func (s *fakeStore) Save(checkpoint *Checkpoint) error {
+	s.checkpoint = checkpoint
+	s.saves++
+	return nil
+}
+
+func TestCheckpointerSaveAndRestore(t *testing.T) {
+	now := time.Now()
+	store := &fakeStore{}
+	a := &fakeComponent{state: "a"}
+	b := &fakeComponent{}
+	checkpointer := NewCheckpointer(store, 10*time.Minute)
+	checkpointer.Register("a", a)
+	checkpointer.Register("b", b)
+
+	// Nothing is saved before the previous state is restored.
+	assert.NoError(t, checkpointer.Save(now))
+	assert.Equal(t, 0, store.saves)
+
+	assert.NoError(t, checkpointer.Restore(now))
+	assert.NoError(t, checkpointer.Save(now))
+	assert.Equal(t, 1, store.saves)
+	assert.Equal(t, SchemaVersion, store.checkpoint.Version)
+	assert.Len(t, store.checkpoint.Components, 1)
+
+	// Unchanged state is saved again only after half of the max age.
+	assert.NoError(t, checkpointer.Save(now.Add(time.Minute)))
+	assert.Equal(t, 1, store.saves)
+	assert.NoError(t, checkpointer.Save(now.Add(5*time.Minute)))
+	assert.Equal(t, 2, store.saves)
+	b.state = "b"
+	assert.NoError(t, checkpointer.Save(now.Add(6*time.Minute)))
+	assert.Equal(t, 3, store.saves)
+
+	restoredA := &fakeComponent{}
+	restoredB := &fakeComponent{err: fmt.Errorf("broken")}
+	restarted := NewCheckpointer(store, 10*time.Minute)
+	restarted.Register("a", restoredA)
+	restarted.Register("b", restoredB)
+	assert.NoError(t, restarted.Restore(now.Add(7*time.Minute)))
+	assert.Equal(t, `"a"`, restoredA.restored)
+	assert.Equal(t, "", restoredB.restored)
+
+	// Only the first restore has any effect.
+	restoredA.restored = ""
+	assert.NoError(t, restarted.Restore(now.Add(8*time.Minute)))
+	assert.Equal(t, "", restoredA.restored)
+}
+
+func TestCheckpointerIgnoresUnusableCheckpoints(t *testing.T) {
+	now := time.Now()
+	testCases := []struct {
+		name       string
+		checkpoint *Checkpoint
+	}{
+		{
+			name:       "other schema version",
+			checkpoint: &Checkpoint{Version: SchemaVersion + 1, Time: now, Components: map[string]json.RawMessage{"a": []byte(`"a"`)}},
+		},
+		{
+			name:       "too old",
+			checkpoint: &Checkpoint{Version: SchemaVersion, Time: now.Add(-time.Hour), Components: map[string]json.RawMessage{"a": []byte(`"a"`)}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			component := &fakeComponent{}
+			checkpointer := NewCheckpointer(&fakeStore{checkpoint: tc.checkpoint}, 10*time.Minute)
+			checkpointer.Register("a", component)
+			assert.NoError(t, checkpointer.Restore(now))
+			assert.Equal(t, "", component.restored)
+		})
+	}
+}
+
+func TestCheckpointerRetriesFailedLoad(t *testing.T) {
+	now := time.Now()
+	store := &fakeStore{loadErr: fmt.Errorf("unavailable")}
+	checkpointer := NewCheckpointer(store, 10*time.Minute)
+	checkpointer.Register("a", &fakeComponent{state: "a"})
+	assert.Error(t, checkpointer.Restore(now))
+	assert.NoError(t, checkpointer.Save(now))
+	assert.Equal(t, 0, store.saves)
+
+	store.loadErr = nil
+	assert.NoError(t, checkpointer.Restore(now))
+	assert.NoError(t, checkpointer.Save(now))
+	assert.Equal(t, 1, store.saves)
+}
+
+func TestStores(t *testing.T) {
+	for _, storeType := range []string{ConfigMapStoreType, LeaseStoreType} {
+		t.Run(storeType, func(t *testing.T) {
+			fakeClient := fake.NewSimpleClientset()
+			store, err := NewStore(storeType, fakeClient, "kube-system", "ca-state")
+			assert.NoError(t, err)
+
+			checkpoint, err := store.Load()
+			assert.NoError(t, err)
+			assert.Nil(t, checkpoint)
+
+			saved := &Checkpoint{Version: SchemaVersion, Time: time.Now().UTC().Truncate(time.Second), Components: map[string]json.RawMessage{"a": []byte(`{"x":1}`)}}
+			assert.NoError(t, store.Save(saved))
+			saved.Components["a"] = []byte(`{"x":2}`)
+			assert.NoError(t, store.Save(saved))
+
+			checkpoint, err = store.Load()
+			assert.NoError(t, err)
+			assert.Equal(t, saved.Time, checkpoint.Time)
+			assert.JSONEq(t, `{"x":2}`, string(checkpoint.Components["a"]))
+		})
+	}
+	_, err := NewStore("secret", fake.NewSimpleClientset(), "kube-system", "ca-state")
+	assert.Error(t, err)
+}
+
+func TestStoreIgnoresInvalidCheckpoint(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset(&apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "ca-state"},
+		Data:       map[string]string{ConfigMapDataKey: "{"},
+	})
+	store, err := NewStore(ConfigMapStoreType, fakeClient, "kube-system", "ca-state")
+	assert.NoError(t, err)
+	checkpoint, err := store.Load()
+	assert.NoError(t, err)
+	assert.Nil(t, checkpoint)
+}
+
+func TestStoreLoadError(t *testing.T) {
+	fakeClient := &fake.Clientset{}
+	fakeClient.Fake.AddReactor("get", "configmaps", func(action core.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("unavailable")
+	})
+	store, err := NewStore(ConfigMapStoreType, fakeClient, "kube-system", "ca-state")
+	assert.NoError(t, err)
+	_, err = store.Load()
+	assert.Error(t, err)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apiv1 "k8s.io/api/core/v1"
+	kube_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kube_client "k8s.io/client-go/kubernetes"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// ConfigMapStoreType stores checkpoints in a ConfigMap.
+	ConfigMapStoreType = "configmap"
+	// LeaseStoreType stores checkpoints in an annotation of a Lease.
+	LeaseStoreType = "lease"
+
+	// ConfigMapDataKey is the ConfigMap data key holding the checkpoint.
+	ConfigMapDataKey = "checkpoint"
+	// LeaseAnnotationKey is the Lease annotation holding the checkpoint.
+	LeaseAnnotationKey = "cluster-autoscaler.kubernetes.io/checkpoint"
+)
+
+// NewStore creates a store of the given type, keeping checkpoints in the
+// object with the given name and namespace.
+func NewStore(storeType string, kubeClient kube_client.Interface, namespace, name string) (Store, error) {
+	switch storeType {
+	case ConfigMapStoreType:
+		return &configMapStore{kubeClient: kubeClient, namespace: namespace, name: name}, nil
+	case LeaseStoreType:
+		return &leaseStore{kubeClient: kubeClient, namespace: namespace, name: name}, nil
+	}
+	return nil, fmt.Errorf("unknown checkpoint store type %q, expected one of %q, %q", storeType, ConfigMapStoreType, LeaseStoreType)
+}
+
+type configMapStore struct {
+	kubeClient kube_client.Interface
+	namespace  string
+	name       string
+}
+
+// Load returns the checkpoint saved in the ConfigMap.
+func (s *configMapStore) Load() (*Checkpoint, error) {
+	configMap, err := s.kubeClient.CoreV1().ConfigMaps(s.namespace).Get(context.TODO(), s.name, metav1.GetOptions{})
+	if kube_errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decode(configMap.Data[ConfigMapDataKey], "configmap "+s.namespace+"/"+s.name), nil
+}
+
+// Save writes the checkpoint to the ConfigMap, creating it if it doesn't exist.
+func (s *configMapStore) Save(checkpoint *Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	maps := s.kubeClient.CoreV1().ConfigMaps(s.namespace)
+	configMap, err := maps.Get(context.TODO(), s.name, metav1.GetOptions{})
+	if kube_errors.IsNotFound(err) {
+		configMap = &apiv1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: s.name},
+			Data:       map[string]string{ConfigMapDataKey: string(data)},
+		}
+		_, err = maps.Create(context.TODO(), configMap, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[ConfigMapDataKey] = string(data)
+	_, err = maps.Update(context.TODO(), configMap, metav1.UpdateOptions{})
+	return err
+}
+
+// leaseStore keeps checkpoints in an annotation of a Lease. The Lease should
+// not be the one used for leader election, as its holder overwrites it.
+type leaseStore struct {
+	kubeClient kube_client.Interface
+	namespace  string
+	name       string
+}
+
+// Load returns the checkpoint saved in the Lease annotation.
+func (s *leaseStore) Load() (*Checkpoint, error) {
+	lease, err := s.kubeClient.CoordinationV1().Leases(s.namespace).Get(context.TODO(), s.name, metav1.GetOptions{})
+	if kube_errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decode(lease.Annotations[LeaseAnnotationKey], "lease "+s.namespace+"/"+s.name), nil
+}
+
+// Save writes the checkpoint to the Lease annotation, creating the Lease if it doesn't exist.
+func (s *leaseStore) Save(checkpoint *Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	leases := s.kubeClient.CoordinationV1().Leases(s.namespace)
+	lease, err := leases.Get(context.TODO(), s.name, metav1.GetOptions{})
+	if kube_errors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   s.namespace,
+				Name:        s.name,
+				Annotations: map[string]string{LeaseAnnotationKey: string(data)},
+			},
+		}
+		_, err = leases.Create(context.TODO(), lease, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if lease.Annotations == nil {
+		lease.Annotations = make(map[string]string)
+	}
+	lease.Annotations[LeaseAnnotationKey] = string(data)
+	_, err = leases.Update(context.TODO(), lease, metav1.UpdateOptions{})
+	return err
+}
+
+// decode parses a saved checkpoint. Invalid checkpoints are ignored, so that
+// they get replaced by the next save.
+func decode(data string, source string) *Checkpoint {
+	if data == "" {
+		return nil
+	}
+	checkpoint := &Checkpoint{}
+	if err := json.Unmarshal([]byte(data), checkpoint); err != nil {
+		klog.Errorf("Ignoring invalid checkpoint in %s: %v", source, err)
+		return nil
+	}
+	return checkpoint
+}
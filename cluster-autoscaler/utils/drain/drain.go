@@ -18,11 +18,13 @@ package drain
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
 	policyv1 "k8s.io/api/policy/v1beta1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
@@ -38,6 +40,9 @@ const (
 	// PodSafeToEvictKey - annotation that ignores constraints to evict a pod like not being replicated, being on
 	// kube-system namespace or having a local storage.
 	PodSafeToEvictKey = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+	// PodSafeToEvictLocalVolumesKey - annotation listing comma separated names of emptyDir volumes of a pod
+	// which may be lost when the pod is evicted.
+	PodSafeToEvictLocalVolumesKey = "cluster-autoscaler.kubernetes.io/safe-to-evict-local-volumes"
 )
 
 // BlockingPod represents a pod which is blocking the scale down of a node.
@@ -72,12 +77,15 @@ const (
 )
 
 // GetPodsForDeletionOnNodeDrain returns pods that should be deleted on node drain as well as some extra information
-// about possibly problematic pods (unreplicated and DaemonSets).
+// about possibly problematic pods (unreplicated and DaemonSets). If maxEvictableEmptyDirSize is set, pods with
+// local storage don't block the drain as long as all their local volumes are annotated as safe to evict emptyDir
+// volumes with a size limit not larger than maxEvictableEmptyDirSize.
 func GetPodsForDeletionOnNodeDrain(
 	podList []*apiv1.Pod,
 	pdbs []*policyv1.PodDisruptionBudget,
 	skipNodesWithSystemPods bool,
 	skipNodesWithLocalStorage bool,
+	maxEvictableEmptyDirSize *resource.Quantity,
 	checkReferences bool, // Setting this to true requires client to be not-null.
 	listers kube_util.ListerRegistry,
 	minReplica int32,
@@ -219,7 +227,7 @@ func GetPodsForDeletionOnNodeDrain(
 					return []*apiv1.Pod{}, []*apiv1.Pod{}, &BlockingPod{Pod: pod, Reason: UnmovableKubeSystemPod}, fmt.Errorf("non-daemonset, non-mirrored, non-pdb-assigned kube-system pod present: %s", pod.Name)
 				}
 			}
-			if HasLocalStorage(pod) && skipNodesWithLocalStorage {
+			if HasBlockingLocalStorage(pod, maxEvictableEmptyDirSize) && skipNodesWithLocalStorage {
 				return []*apiv1.Pod{}, []*apiv1.Pod{}, &BlockingPod{Pod: pod, Reason: LocalStorageRequested}, fmt.Errorf("pod with local storage present: %s", pod.Name)
 			}
 			if hasNotSafeToEvictAnnotation(pod) {
@@ -264,6 +272,39 @@ func isLocalVolume(volume *apiv1.Volume) bool {
 	return volume.HostPath != nil || volume.EmptyDir != nil
 }
 
+// HasBlockingLocalStorage returns true if pod has any local storage which can't be lost on eviction.
+// An emptyDir volume can be lost if it is listed in the PodSafeToEvictLocalVolumesKey annotation and
+// has a size limit not larger than maxEvictableEmptyDirSize. A nil maxEvictableEmptyDirSize means no
+// local storage can be lost.
+func HasBlockingLocalStorage(pod *apiv1.Pod, maxEvictableEmptyDirSize *resource.Quantity) bool {
+	if maxEvictableEmptyDirSize == nil {
+		return HasLocalStorage(pod)
+	}
+	safeToEvict := safeToEvictLocalVolumes(pod)
+	for _, volume := range pod.Spec.Volumes {
+		if !isLocalVolume(&volume) {
+			continue
+		}
+		if volume.EmptyDir == nil || !safeToEvict[volume.Name] {
+			return true
+		}
+		if volume.EmptyDir.SizeLimit == nil || volume.EmptyDir.SizeLimit.Cmp(*maxEvictableEmptyDirSize) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func safeToEvictLocalVolumes(pod *apiv1.Pod) map[string]bool {
+	result := make(map[string]bool)
+	for _, name := range strings.Split(pod.GetAnnotations()[PodSafeToEvictLocalVolumesKey], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			result[name] = true
+		}
+	}
+	return result
+}
+
 // This only checks if a matching PDB exist and therefore if it makes sense to attempt drain simulation,
 // as we check for allowed-disruptions later anyway (for all pods with PDB, not just in kube-system)
 func checkKubeSystemPDBs(pod *apiv1.Pod, pdbs []*policyv1.PodDisruptionBudget) (bool, error) {
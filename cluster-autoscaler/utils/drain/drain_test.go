@@ -24,6 +24,7 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	apiv1 "k8s.io/api/core/v1"
 	policyv1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
 	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
@@ -646,7 +647,7 @@ func TestDrain(t *testing.T) {
 
 		registry := kube_util.NewListerRegistry(nil, nil, nil, nil, nil, dsLister, rcLister, jobLister, rsLister, ssLister)
 
-		pods, daemonSetPods, blockingPod, err := GetPodsForDeletionOnNodeDrain(test.pods, test.pdbs, true, true, true, registry, 0, testTime)
+		pods, daemonSetPods, blockingPod, err := GetPodsForDeletionOnNodeDrain(test.pods, test.pdbs, true, true, nil, true, registry, 0, testTime)
 
 		if test.expectFatal {
 			assert.Equal(t, test.expectBlockingPod, blockingPod)
@@ -774,3 +775,87 @@ func TestIsPodLongTerminating(t *testing.T) {
 		})
 	}
 }
+
+func TestHasBlockingLocalStorage(t *testing.T) {
+	maxSize := resource.MustParse("1Gi")
+	small := resource.MustParse("512Mi")
+	large := resource.MustParse("2Gi")
+	emptyDir := func(name string, sizeLimit *resource.Quantity) apiv1.Volume {
+		return apiv1.Volume{Name: name, VolumeSource: apiv1.VolumeSource{EmptyDir: &apiv1.EmptyDirVolumeSource{SizeLimit: sizeLimit}}}
+	}
+	hostPath := apiv1.Volume{Name: "host", VolumeSource: apiv1.VolumeSource{HostPath: &apiv1.HostPathVolumeSource{Path: "/tmp"}}}
+
+	tests := []struct {
+		name       string
+		volumes    []apiv1.Volume
+		annotation string
+		maxSize    *resource.Quantity
+		want       bool
+	}{
+		{
+			name: "no local storage",
+			want: false,
+		},
+		{
+			name:       "eviction of emptyDir disabled",
+			volumes:    []apiv1.Volume{emptyDir("scratch", &small)},
+			annotation: "scratch",
+			want:       true,
+		},
+		{
+			name:       "annotated small emptyDir",
+			volumes:    []apiv1.Volume{emptyDir("scratch", &small)},
+			annotation: "scratch",
+			maxSize:    &maxSize,
+			want:       false,
+		},
+		{
+			name:       "several annotated emptyDirs",
+			volumes:    []apiv1.Volume{emptyDir("scratch", &small), emptyDir("cache", &maxSize)},
+			annotation: "scratch, cache",
+			maxSize:    &maxSize,
+			want:       false,
+		},
+		{
+			name:       "emptyDir not annotated",
+			volumes:    []apiv1.Volume{emptyDir("scratch", &small), emptyDir("cache", &small)},
+			annotation: "scratch",
+			maxSize:    &maxSize,
+			want:       true,
+		},
+		{
+			name:       "emptyDir too large",
+			volumes:    []apiv1.Volume{emptyDir("scratch", &large)},
+			annotation: "scratch",
+			maxSize:    &maxSize,
+			want:       true,
+		},
+		{
+			name:       "emptyDir without size limit",
+			volumes:    []apiv1.Volume{emptyDir("scratch", nil)},
+			annotation: "scratch",
+			maxSize:    &maxSize,
+			want:       true,
+		},
+		{
+			name:       "hostPath",
+			volumes:    []apiv1.Volume{hostPath},
+			annotation: "host",
+			maxSize:    &maxSize,
+			want:       true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pod := &apiv1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "pod",
+					Annotations: map[string]string{PodSafeToEvictLocalVolumesKey: tc.annotation},
+				},
+				Spec: apiv1.PodSpec{Volumes: tc.volumes},
+			}
+			assert.Equal(t, tc.want, HasBlockingLocalStorage(pod, tc.maxSize))
+		})
+	}
+}
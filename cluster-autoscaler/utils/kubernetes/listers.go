@@ -17,6 +17,7 @@ limitations under the License.
 package kubernetes
 
 import (
+	"fmt"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
@@ -196,6 +197,7 @@ func NewUnschedulablePodInNamespaceLister(kubeClient client.Interface, namespace
 // ScheduledPodLister lists scheduled pods.
 type ScheduledPodLister struct {
 	podLister v1lister.PodLister
+	informer  cache.SharedIndexInformer
 }
 
 // List returns all scheduled pods.
@@ -203,21 +205,37 @@ func (lister *ScheduledPodLister) List() ([]*apiv1.Pod, error) {
 	return lister.podLister.List(labels.Everything())
 }
 
+// AddEventHandler passes events of listed pods to the handler. The handler
+// is first sent additions of all pods listed so far.
+func (lister *ScheduledPodLister) AddEventHandler(handler cache.ResourceEventHandler) {
+	lister.informer.AddEventHandler(handler)
+}
+
+// WatchablePodLister is a PodLister which can also pass events of listed pods to handlers.
+type WatchablePodLister interface {
+	PodLister
+	AddEventHandler(handler cache.ResourceEventHandler)
+}
+
 // NewScheduledPodLister builds ScheduledPodLister
 func NewScheduledPodLister(kubeClient client.Interface, stopchannel <-chan struct{}) PodLister {
-	// watch unscheduled pods
-	selector := fields.ParseSelectorOrDie("spec.nodeName!=" + "" + ",status.phase!=" +
-		string(apiv1.PodSucceeded) + ",status.phase!=" + string(apiv1.PodFailed))
-	podListWatch := cache.NewListWatchFromClient(kubeClient.CoreV1().RESTClient(), "pods", apiv1.NamespaceAll, selector)
-	store, reflector := cache.NewNamespaceKeyedIndexerAndReflector(podListWatch, &apiv1.Pod{}, time.Hour)
-	podLister := v1lister.NewPodLister(store)
-	go reflector.Run(stopchannel)
+	// watch scheduled pods, which didn't terminate
+	podListWatch := cache.NewListWatchFromClient(kubeClient.CoreV1().RESTClient(), "pods", apiv1.NamespaceAll, scheduledPodSelector())
+	informer := cache.NewSharedIndexInformer(podListWatch, &apiv1.Pod{}, time.Hour, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	podLister := v1lister.NewPodLister(informer.GetIndexer())
+	go informer.Run(stopchannel)
 
 	return &ScheduledPodLister{
 		podLister: podLister,
+		informer:  informer,
 	}
 }
 
+func scheduledPodSelector() fields.Selector {
+	return fields.ParseSelectorOrDie("spec.nodeName!=" + "" + ",status.phase!=" +
+		string(apiv1.PodSucceeded) + ",status.phase!=" + string(apiv1.PodFailed))
+}
+
 // NodeLister lists nodes.
 type NodeLister interface {
 	List() ([]*apiv1.Node, error)
@@ -368,3 +386,22 @@ func NewConfigMapListerForNamespace(kubeClient client.Interface, stopchannel <-c
 	go reflector.Run(stopchannel)
 	return lister
 }
+
+// NewSyncedConfigMapListerForNamespace builds a lister of the configmap with
+// the passed name in the passed namespace and waits up to syncTimeout until its
+// cache is synced, so that the first reads see the configmap if it exists.
+func NewSyncedConfigMapListerForNamespace(kubeClient client.Interface, stopchannel <-chan struct{},
+	namespace, name string, syncTimeout time.Duration) (v1lister.ConfigMapLister, error) {
+	selector := fields.OneTermEqualSelector("metadata.name", name)
+	listWatcher := cache.NewListWatchFromClient(kubeClient.CoreV1().RESTClient(), "configmaps", namespace, selector)
+	informer := cache.NewSharedIndexInformer(listWatcher, &apiv1.ConfigMap{}, time.Hour, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	lister := v1lister.NewConfigMapLister(informer.GetIndexer())
+	go informer.Run(stopchannel)
+	timeout := make(chan struct{})
+	timer := time.AfterFunc(syncTimeout, func() { close(timeout) })
+	defer timer.Stop()
+	if !cache.WaitForCacheSync(timeout, informer.HasSynced) {
+		return nil, fmt.Errorf("failed to sync configmap %s/%s within %v", namespace, name, syncTimeout)
+	}
+	return lister, nil
+}
@@ -135,3 +135,20 @@ func UpdateDeprecatedLabels(labels map[string]string) {
 		labels[apiv1.LabelZoneFailureDomain] = v
 	}
 }
+
+// UpdateStableTopologyLabels updates stable topology labels from deprecated
+// labels, if they are missing. Topology spread constraints and inter-pod
+// affinity usually refer to stable labels, so templates of nodes carrying only
+// deprecated labels would not be placed in any zone otherwise.
+func UpdateStableTopologyLabels(labels map[string]string) {
+	if _, ok := labels[apiv1.LabelTopologyRegion]; !ok {
+		if v, ok := labels[apiv1.LabelZoneRegion]; ok {
+			labels[apiv1.LabelTopologyRegion] = v
+		}
+	}
+	if _, ok := labels[apiv1.LabelTopologyZone]; !ok {
+		if v, ok := labels[apiv1.LabelZoneFailureDomain]; ok {
+			labels[apiv1.LabelTopologyZone] = v
+		}
+	}
+}
@@ -197,3 +197,58 @@ func TestIsStaticPod(t *testing.T) {
 		})
 	}
 }
+
+func TestScaleUpAnnotations(t *testing.T) {
+	node := &apiv1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"pool": "gpu", "zone": "a"}}}
+	tests := []struct {
+		name         string
+		annotations  map[string]string
+		wantDisabled bool
+		wantErr      bool
+		wantMayScale bool
+	}{
+		{
+			name:         "no annotations",
+			wantMayScale: true,
+		},
+		{
+			name:         "scale-up disabled",
+			annotations:  map[string]string{ScaleUpDisabledAnnotationKey: "true"},
+			wantDisabled: true,
+			wantMayScale: true,
+		},
+		{
+			name:         "scale-up not disabled",
+			annotations:  map[string]string{ScaleUpDisabledAnnotationKey: "false"},
+			wantMayScale: true,
+		},
+		{
+			name:         "matching selector",
+			annotations:  map[string]string{NodeGroupSelectorAnnotationKey: "pool=gpu,zone in (a,b)"},
+			wantMayScale: true,
+		},
+		{
+			name:        "not matching selector",
+			annotations: map[string]string{NodeGroupSelectorAnnotationKey: "pool=cpu"},
+		},
+		{
+			name:        "invalid selector",
+			annotations: map[string]string{NodeGroupSelectorAnnotationKey: "pool in (gpu"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			if got := IsScaleUpDisabled(pod); got != tt.wantDisabled {
+				t.Errorf("IsScaleUpDisabled() = %v, want %v", got, tt.wantDisabled)
+			}
+			if _, err := NodeGroupSelector(pod); (err != nil) != tt.wantErr {
+				t.Errorf("NodeGroupSelector() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := MayScaleUpNodeGroup(pod, node); got != tt.wantMayScale {
+				t.Errorf("MayScaleUpNodeGroup() = %v, want %v", got, tt.wantMayScale)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pod
+
+import (
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// ScaleUpDisabledAnnotationKey - annotation used to prevent a pod from triggering scale-up, if set to "true".
+	ScaleUpDisabledAnnotationKey = "cluster-autoscaler.kubernetes.io/scale-up-disabled"
+	// NodeGroupSelectorAnnotationKey - annotation used to restrict scale-up triggered by a pod to node groups
+	// whose template node labels match the label selector in the annotation value.
+	NodeGroupSelectorAnnotationKey = "cluster-autoscaler.kubernetes.io/scale-up-node-group-selector"
+)
+
+// IsScaleUpDisabled returns true if the pod opted out of triggering scale-up.
+func IsScaleUpDisabled(pod *apiv1.Pod) bool {
+	return pod.Annotations[ScaleUpDisabledAnnotationKey] == "true"
+}
+
+// NodeGroupSelector returns the selector of node groups the pod may trigger
+// scale-up of, or nil if it may trigger scale-up of any node group.
+func NodeGroupSelector(pod *apiv1.Pod) (labels.Selector, error) {
+	value, found := pod.Annotations[NodeGroupSelectorAnnotationKey]
+	if !found {
+		return nil, nil
+	}
+	selector, err := labels.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation %q: %v", NodeGroupSelectorAnnotationKey, value, err)
+	}
+	return selector, nil
+}
+
+// MayScaleUpNodeGroup checks if the pod may trigger scale-up of a node group
+// with the given template node. Pods with an invalid node group selector
+// may not trigger scale-up of any node group.
+func MayScaleUpNodeGroup(pod *apiv1.Pod, templateNode *apiv1.Node) bool {
+	selector, err := NodeGroupSelector(pod)
+	if err != nil {
+		return false
+	}
+	return selector == nil || selector.Matches(labels.Set(templateNode.Labels))
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podgroup
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	v1batchlister "k8s.io/client-go/listers/batch/v1"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// PodGroupLabelKey - label with the name of the pod group a pod belongs to. Pods of a pod group
+	// are only useful if at least the number of pods in the PodGroupMinMemberAnnotationKey
+	// annotation run at the same time.
+	PodGroupLabelKey = "cluster-autoscaler.kubernetes.io/pod-group"
+	// PodGroupMinMemberAnnotationKey - annotation with the minimum number of pods of the pod group
+	// which have to run at the same time.
+	PodGroupMinMemberAnnotationKey = "cluster-autoscaler.kubernetes.io/pod-group-min-member"
+)
+
+// PodGroup is a group of pods which are only useful if at least MinMember of them run at the
+// same time, e.g. pods of a gang-scheduled training job.
+type PodGroup struct {
+	Namespace string
+	// Name is the value of the pod group label, or "job/<name>" for pod groups of Jobs.
+	Name      string
+	MinMember int
+}
+
+// Key identifies the pod group in the cluster.
+func (g PodGroup) Key() string {
+	return fmt.Sprintf("%s/%s", g.Namespace, g.Name)
+}
+
+// Finder finds pod groups pods belong to.
+type Finder struct {
+	jobLister v1batchlister.JobLister
+
+	sync.Mutex
+	// jobPodGroups are pod groups of Jobs by Job UID, cached until ResetCache is called.
+	jobPodGroups map[types.UID]jobPodGroup
+}
+
+type jobPodGroup struct {
+	podGroup PodGroup
+	found    bool
+}
+
+// NewFinder creates an instance of Finder. Pods of Jobs with parallelism greater than one
+// are treated as pod groups only if jobLister isn't nil.
+func NewFinder(jobLister v1batchlister.JobLister) *Finder {
+	return &Finder{jobLister: jobLister, jobPodGroups: make(map[types.UID]jobPodGroup)}
+}
+
+// ResetCache drops pod groups of Jobs cached since the previous call. It's called once per
+// loop, so that Jobs are read once per loop and changes of Jobs are picked up in the next one.
+func (f *Finder) ResetCache() {
+	f.Lock()
+	defer f.Unlock()
+	f.jobPodGroups = make(map[types.UID]jobPodGroup)
+}
+
+// PodGroup returns the pod group the pod belongs to, if it belongs to any.
+func (f *Finder) PodGroup(pod *apiv1.Pod) (PodGroup, bool) {
+	if name, found := pod.Labels[PodGroupLabelKey]; found {
+		minMember, err := strconv.Atoi(pod.Annotations[PodGroupMinMemberAnnotationKey])
+		if err != nil || minMember < 1 {
+			klog.V(4).Infof("Pod %s/%s has invalid %s annotation %q, ignoring its pod group", pod.Namespace, pod.Name,
+				PodGroupMinMemberAnnotationKey, pod.Annotations[PodGroupMinMemberAnnotationKey])
+			return PodGroup{}, false
+		}
+		return PodGroup{Namespace: pod.Namespace, Name: name, MinMember: minMember}, true
+	}
+	if f.jobLister == nil {
+		return PodGroup{}, false
+	}
+	controllerRef := metav1.GetControllerOf(pod)
+	if controllerRef == nil || controllerRef.Kind != "Job" {
+		return PodGroup{}, false
+	}
+	f.Lock()
+	defer f.Unlock()
+	cached, found := f.jobPodGroups[controllerRef.UID]
+	if !found {
+		cached.podGroup, cached.found = f.jobPodGroup(pod.Namespace, controllerRef.Name)
+		f.jobPodGroups[controllerRef.UID] = cached
+	}
+	return cached.podGroup, cached.found
+}
+
+// jobPodGroup returns the pod group of pods of the Job, if they're a pod group.
+func (f *Finder) jobPodGroup(namespace, name string) (PodGroup, bool) {
+	job, err := f.jobLister.Jobs(namespace).Get(name)
+	if err != nil || job.Spec.Parallelism == nil {
+		return PodGroup{}, false
+	}
+	minMember := int(*job.Spec.Parallelism)
+	if job.Spec.Completions != nil {
+		if remaining := int(*job.Spec.Completions - job.Status.Succeeded); remaining < minMember {
+			minMember = remaining
+		}
+	}
+	if minMember <= 1 {
+		return PodGroup{}, false
+	}
+	return PodGroup{Namespace: namespace, Name: "job/" + job.Name, MinMember: minMember}, true
+}
+
+// Members are pods of a pod group.
+type Members struct {
+	PodGroup
+	Pods []*apiv1.Pod
+}
+
+// Complete checks if there are at least MinMember pods.
+func (m *Members) Complete() bool {
+	return len(m.Pods) >= m.MinMember
+}
+
+// Group groups pods belonging to pod groups by pod group keys. Pods which don't belong to any
+// pod group are skipped.
+func (f *Finder) Group(pods []*apiv1.Pod) map[string]*Members {
+	result := make(map[string]*Members)
+	for _, pod := range pods {
+		podGroup, found := f.PodGroup(pod)
+		if !found {
+			continue
+		}
+		members, found := result[podGroup.Key()]
+		if !found {
+			members = &Members{PodGroup: podGroup}
+			result[podGroup.Key()] = members
+		}
+		members.Pods = append(members.Pods, pod)
+	}
+	return result
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podgroup
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+	v1batchlister "k8s.io/client-go/listers/batch/v1"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildGroupPod(name, group, minMember string) *apiv1.Pod {
+	pod := BuildTestPod(name, 100, 0)
+	pod.Labels = map[string]string{PodGroupLabelKey: group}
+	pod.Annotations[PodGroupMinMemberAnnotationKey] = minMember
+	return pod
+}
+
+func buildJobPod(name, job string) *apiv1.Pod {
+	pod := BuildTestPod(name, 100, 0)
+	pod.OwnerReferences = GenerateOwnerReferences(job, "Job", "batch/v1", types.UID(job))
+	return pod
+}
+
+func buildJob(name string, parallelism, completions int32, succeeded int32) *batchv1.Job {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       batchv1.JobSpec{Parallelism: &parallelism},
+		Status:     batchv1.JobStatus{Succeeded: succeeded},
+	}
+	if completions > 0 {
+		job.Spec.Completions = &completions
+	}
+	return job
+}
+
+func TestPodGroup(t *testing.T) {
+	jobLister, err := kube_util.NewTestJobLister([]*batchv1.Job{
+		buildJob("parallel", 4, 0, 0),
+		buildJob("finishing", 4, 10, 8),
+		buildJob("serial", 1, 10, 0),
+	})
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		name          string
+		pod           *apiv1.Pod
+		jobLister     bool
+		expected      PodGroup
+		expectedFound bool
+	}{
+		{
+			name:          "labeled pod",
+			pod:           buildGroupPod("p", "training", "8"),
+			expected:      PodGroup{Namespace: "default", Name: "training", MinMember: 8},
+			expectedFound: true,
+		},
+		{
+			name: "invalid min member",
+			pod:  buildGroupPod("p", "training", "many"),
+		},
+		{
+			name: "non-positive min member",
+			pod:  buildGroupPod("p", "training", "0"),
+		},
+		{
+			name: "job pod without job lister",
+			pod:  buildJobPod("p", "parallel"),
+		},
+		{
+			name:          "job pod",
+			pod:           buildJobPod("p", "parallel"),
+			jobLister:     true,
+			expected:      PodGroup{Namespace: "default", Name: "job/parallel", MinMember: 4},
+			expectedFound: true,
+		},
+		{
+			name:          "job pod limited by remaining completions",
+			pod:           buildJobPod("p", "finishing"),
+			jobLister:     true,
+			expected:      PodGroup{Namespace: "default", Name: "job/finishing", MinMember: 2},
+			expectedFound: true,
+		},
+		{
+			name:      "serial job pod",
+			pod:       buildJobPod("p", "serial"),
+			jobLister: true,
+		},
+		{
+			name:      "missing job",
+			pod:       buildJobPod("p", "missing"),
+			jobLister: true,
+		},
+		{
+			name:      "other pod",
+			pod:       BuildTestPod("p", 100, 0),
+			jobLister: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			finder := NewFinder(nil)
+			if tc.jobLister {
+				finder = NewFinder(jobLister)
+			}
+			podGroup, found := finder.PodGroup(tc.pod)
+			assert.Equal(t, tc.expectedFound, found)
+			assert.Equal(t, tc.expected, podGroup)
+		})
+	}
+}
+
+func TestGroup(t *testing.T) {
+	p1 := buildGroupPod("p1", "a", "2")
+	p2 := buildGroupPod("p2", "a", "2")
+	p3 := buildGroupPod("p3", "b", "3")
+	p4 := BuildTestPod("p4", 100, 0)
+
+	groups := NewFinder(nil).Group([]*apiv1.Pod{p1, p2, p3, p4})
+	assert.Len(t, groups, 2)
+	assert.Equal(t, []*apiv1.Pod{p1, p2}, groups["default/a"].Pods)
+	assert.True(t, groups["default/a"].Complete())
+	assert.Equal(t, []*apiv1.Pod{p3}, groups["default/b"].Pods)
+	assert.False(t, groups["default/b"].Complete())
+}
+
+type countingJobLister struct {
+	v1batchlister.JobLister
+	calls int
+}
+
+func (l *countingJobLister) Jobs(namespace string) v1batchlister.JobNamespaceLister {
+	l.calls++
+	return l.JobLister.Jobs(namespace)
+}
+
+func TestPodGroupCachesJobs(t *testing.T) {
+	job := buildJob("parallel", 4, 0, 0)
+	jobLister, err := kube_util.NewTestJobLister([]*batchv1.Job{job})
+	assert.NoError(t, err)
+	counting := &countingJobLister{JobLister: jobLister}
+	finder := NewFinder(counting)
+
+	groups := finder.Group([]*apiv1.Pod{buildJobPod("p1", "parallel"), buildJobPod("p2", "parallel"), buildJobPod("p3", "missing")})
+	assert.Len(t, groups["default/job/parallel"].Pods, 2)
+	assert.Equal(t, 2, counting.calls)
+
+	// Changes of Jobs are picked up after the cache is reset.
+	parallelism := int32(1)
+	job.Spec.Parallelism = &parallelism
+	_, found := finder.PodGroup(buildJobPod("p4", "parallel"))
+	assert.True(t, found)
+	assert.Equal(t, 2, counting.calls)
+
+	finder.ResetCache()
+	_, found = finder.PodGroup(buildJobPod("p4", "parallel"))
+	assert.False(t, found)
+	assert.Equal(t, 3, counting.calls)
+}